@@ -0,0 +1,122 @@
+package av
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// rtpClockTrack the clock of one SSRC
+type rtpClockTrack struct {
+	clockRate uint32
+
+	timestamps TimestampUnwrapper
+
+	// last sender report,srExtended is the unwrapped SR RTP time
+	hasSR      bool
+	srNtp      time.Time
+	srExtended int64
+}
+
+func (t *rtpClockTrack) time(ext int64) time.Time {
+	return t.srNtp.Add(RtpTicksToDuration(ext-t.srExtended, t.clockRate))
+}
+
+// RtpClockSync maps the RTP timestamps of the tracks of one sender to wall
+// clock through RTCP sender reports,tracks sharing the sender NTP clock are
+// then aligned for lip sync.It is safe for concurrent use
+type RtpClockSync struct {
+	mu     sync.Mutex
+	tracks map[uint32]*rtpClockTrack
+}
+
+// NewRtpClockSync creates an empty clock sync.
+func NewRtpClockSync() *RtpClockSync {
+	return &RtpClockSync{tracks: make(map[uint32]*rtpClockTrack)}
+}
+
+// AddTrack adds the track ssrc with its RTP clock rate.
+func (c *RtpClockSync) AddTrack(ssrc uint32, clockRate uint32) {
+	if clockRate == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.tracks[ssrc] = &rtpClockTrack{clockRate: clockRate}
+	c.mu.Unlock()
+}
+
+// RemoveTrack removes the track ssrc.
+func (c *RtpClockSync) RemoveTrack(ssrc uint32) {
+	c.mu.Lock()
+	delete(c.tracks, ssrc)
+	c.mu.Unlock()
+}
+
+// UpdateSenderReport records the NTP/RTP pair of sr for its track,reports of
+// unknown tracks are ignored.
+func (c *RtpClockSync) UpdateSenderReport(sr *RtcpSenderReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	track := c.tracks[sr.SSRC]
+	if track == nil {
+		return
+	}
+	track.srExtended = track.timestamps.Unwrap(sr.RTPTime)
+	track.srNtp = NtpToTime(sr.NTPTime)
+	track.hasSR = true
+}
+
+// HandleRtcp feeds the sender reports of packets,it can be registered with
+// RtpSession.HandleRtcp.
+func (c *RtpClockSync) HandleRtcp(packets []RtcpPacket, from *net.UDPAddr) {
+	for _, packet := range packets {
+		if sr, ok := packet.(*RtcpSenderReport); ok {
+			c.UpdateSenderReport(sr)
+		}
+	}
+}
+
+// ExtendedTimestamp returns ts of track ssrc extended to 64 bits.
+func (c *RtpClockSync) ExtendedTimestamp(ssrc uint32, ts uint32) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	track := c.tracks[ssrc]
+	if track == nil {
+		return 0, false
+	}
+	return track.timestamps.Unwrap(ts), true
+}
+
+// Time converts ts of track ssrc to the sender wall clock,false until a
+// sender report of the track was received.
+func (c *RtpClockSync) Time(ssrc uint32, ts uint32) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	track := c.tracks[ssrc]
+	if track == nil {
+		return time.Time{}, false
+	}
+	ext := track.timestamps.Unwrap(ts)
+	if !track.hasSR {
+		return time.Time{}, false
+	}
+	return track.time(ext), true
+}
+
+// PacketTime converts the timestamp of pkt to the sender wall clock.
+func (c *RtpClockSync) PacketTime(pkt *RtpPacket) (time.Time, bool) {
+	return c.Time(pkt.SSRC, pkt.Timestamp)
+}
+
+// Synchronized reports whether every track of ssrcs received a sender
+// report,so their timestamps can be compared.
+func (c *RtpClockSync) Synchronized(ssrcs ...uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ssrc := range ssrcs {
+		if track := c.tracks[ssrc]; track == nil || !track.hasSR {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1052 @@
+package av
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dtlsVersion12           = 0xFEFD
+	dtlsRecordHeaderSize    = 13
+	dtlsHandshakeHeaderSize = 12
+	dtlsRandomSize          = 32
+	dtlsMasterSecretSize    = 48
+	dtlsVerifyDataSize      = 12
+	dtlsGcmExplicitSize     = 8
+	dtlsGcmTagSize          = 16
+	dtlsMaxFragment         = 1024 // handshake fragment,below the path MTU with headers
+	dtlsMaxDatagram         = 1200
+	dtlsMaxPendingMessages  = 16
+	dtlsMaxMessageSize      = 16 * 1024 // bounds the reassembly buffer of a handshake message
+
+	dtlsRetransmitInterval    = time.Second
+	dtlsMaxRetransmitInterval = 8 * time.Second
+
+	dtlsContentChangeCipherSpec = 20
+	dtlsContentAlert            = 21
+	dtlsContentHandshake        = 22
+	dtlsContentApplicationData  = 23
+
+	dtlsClientHello        = 1
+	dtlsServerHello        = 2
+	dtlsHelloVerifyRequest = 3
+	dtlsCertificate        = 11
+	dtlsServerKeyExchange  = 12
+	dtlsCertificateRequest = 13
+	dtlsServerHelloDone    = 14
+	dtlsCertificateVerify  = 15
+	dtlsClientKeyExchange  = 16
+	dtlsFinished           = 20
+
+	dtlsAlertWarning          = 1
+	dtlsAlertFatal            = 2
+	dtlsAlertCloseNotify      = 0
+	dtlsAlertHandshakeFailure = 40
+	dtlsAlertBadCertificate   = 42
+
+	dtlsCipherEcdheEcdsaAes128GcmSha256 = 0xC02B
+	dtlsCipherRenegotiationInfoScsv     = 0x00FF
+	dtlsCurveTypeNamed                  = 3
+	dtlsCurveP256                       = 23
+	dtlsCurveX25519                     = 29
+	dtlsSignatureRsaSha256              = 0x0401
+	dtlsSignatureEcdsaSha256            = 0x0403
+	dtlsCertTypeRsaSign                 = 1
+	dtlsCertTypeEcdsaSign               = 64
+
+	dtlsExtSupportedGroups       = 10
+	dtlsExtPointFormats          = 11
+	dtlsExtSignatureAlgorithms   = 13
+	dtlsExtUseSrtp               = 14
+	dtlsExtExtendedMasterSecret  = 23
+	dtlsExtRenegotiationInfo     = 0xFF01
+	dtlsSrtpExporterLabel        = "EXTRACTOR-dtls_srtp"
+	dtlsSrtpExporterMaterialSize = 2 * (SRTP_MASTER_KEY_SIZE + SRTP_MASTER_SALT_SIZE)
+)
+
+const (
+	dtlsStateHello    = iota // server waits for ClientHello,client for the server flight
+	dtlsStateFinished        // waits for the peer flight ending with Finished
+	dtlsStateDone
+)
+
+var (
+	ErrDtlsHandshake   = errors.New("dtls: handshake failed")
+	ErrDtlsFingerprint = errors.New("dtls: certificate does not match the fingerprint")
+	ErrDtlsClosed      = errors.New("dtls: closed")
+	errDtlsTruncated   = errors.New("dtls: message truncated")
+)
+
+// DtlsCertificate the self-signed ECDSA P-256 certificate authenticating a
+// DTLS-SRTP endpoint,peers check it against the SDP fingerprint
+type DtlsCertificate struct {
+	DER        []byte
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// NewDtlsCertificate generates a self-signed certificate valid for a month.
+func NewDtlsCertificate() (*DtlsCertificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "WebRTC"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(30 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &DtlsCertificate{DER: der, PrivateKey: key}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate as written
+// in the SDP fingerprint attribute after "sha-256 ".
+func (c *DtlsCertificate) Fingerprint() string {
+	return dtlsFingerprint(c.DER)
+}
+
+func dtlsFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	var b strings.Builder
+	for i, v := range sum {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		fmt.Fprintf(&b, "%02X", v)
+	}
+	return b.String()
+}
+
+func dtlsUint24(buf []byte) int {
+	return int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+}
+
+func dtlsPutUint24(buf []byte, v int) {
+	buf[0], buf[1], buf[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+// dtlsPrf the TLS 1.2 PRF with SHA-256,RFC 5246 5
+func dtlsPrf(secret []byte, label string, seed []byte, n int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(sha256.New, secret)
+	out := make([]byte, 0, n+sha256.Size)
+	a := labelSeed
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
+
+func dtlsEcdhCurve(id uint16) ecdh.Curve {
+	switch id {
+	case dtlsCurveX25519:
+		return ecdh.X25519()
+	case dtlsCurveP256:
+		return ecdh.P256()
+	}
+	return nil
+}
+
+func appendDtlsExtension(buf []byte, typ uint16, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, typ)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+	return append(buf, data...)
+}
+
+// parseDtlsExtensions parses the extensions block of a hello,absent
+// extensions are an empty map
+func parseDtlsExtensions(buf []byte) (map[uint16][]byte, error) {
+	exts := make(map[uint16][]byte)
+	if len(buf) == 0 {
+		return exts, nil
+	}
+	if len(buf) < 2 || len(buf) < 2+int(binary.BigEndian.Uint16(buf)) {
+		return nil, errDtlsTruncated
+	}
+	buf = buf[2 : 2+int(binary.BigEndian.Uint16(buf))]
+	for len(buf) >= 4 {
+		typ := binary.BigEndian.Uint16(buf)
+		size := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf) < 4+size {
+			return nil, errDtlsTruncated
+		}
+		exts[typ] = buf[4 : 4+size]
+		buf = buf[4+size:]
+	}
+	return exts, nil
+}
+
+// dtlsUint16List parses a list of uint16 prefixed by its length of
+// prefixSize bytes
+func dtlsUint16List(buf []byte, prefixSize int) []uint16 {
+	if len(buf) < prefixSize {
+		return nil
+	}
+	size := int(buf[0])
+	if prefixSize == 2 {
+		size = int(binary.BigEndian.Uint16(buf))
+	}
+	buf = buf[prefixSize:]
+	if len(buf) < size {
+		return nil
+	}
+	list := make([]uint16, 0, size/2)
+	for i := 0; i+1 < size; i += 2 {
+		list = append(list, binary.BigEndian.Uint16(buf[i:]))
+	}
+	return list
+}
+
+func containsUint16(list []uint16, v uint16) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// dtlsFlightRecord one record of a flight,kept in plaintext to be sealed
+// again with a new sequence number when retransmitted
+type dtlsFlightRecord struct {
+	contentType uint8
+	epoch       uint16
+	data        []byte
+}
+
+// dtlsMessage a handshake message being reassembled from its fragments
+type dtlsMessage struct {
+	typ     uint8
+	body    []byte
+	filled  []bool
+	missing int
+}
+
+// dtlsConn a DTLS 1.2 endpoint negotiating SRTP keys (RFC 5764) with the
+// ECDHE-ECDSA-AES128-GCM-SHA256 suite and mutual certificate authentication.
+// It is driven by the datagrams of the ICE transport instead of owning a socket
+type dtlsConn struct {
+	isClient          bool
+	cert              *DtlsCertificate
+	remoteFingerprint string
+	write             func([]byte) error
+
+	mu         sync.Mutex
+	state      int
+	closed     bool
+	timer      *time.Timer
+	retransmit time.Duration
+
+	clientRandom  [dtlsRandomSize]byte
+	serverRandom  [dtlsRandomSize]byte
+	cookie        []byte
+	curve         uint16
+	ecdhKey       *ecdh.PrivateKey
+	peerPublic    []byte // ECDHE public key of the server
+	peerCert      *x509.Certificate
+	certRequested bool
+	peerVerified  bool
+	ems           bool // extended master secret,RFC 7627
+	renegotiation bool
+	srtpProfile   uint16
+	master        []byte
+	transcript    []byte
+
+	sendSeq  uint16 // message_seq of the next sent handshake message
+	recvSeq  uint16 // message_seq of the next processed handshake message
+	messages map[uint16]*dtlsMessage
+	flight   []dtlsFlightRecord
+
+	writeEpoch uint16
+	writeSeq   [2]uint64
+	writeAead  cipher.AEAD
+	writeIV    []byte
+	readAead   cipher.AEAD
+	readIV     []byte
+}
+
+func newDtlsConn(isClient bool, cert *DtlsCertificate, remoteFingerprint string, write func([]byte) error) *dtlsConn {
+	return &dtlsConn{
+		isClient:          isClient,
+		cert:              cert,
+		remoteFingerprint: remoteFingerprint,
+		write:             write,
+		messages:          make(map[uint16]*dtlsMessage),
+	}
+}
+
+// start sends the ClientHello of a client,a server waits for it.
+func (c *dtlsConn) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isClient || c.sendSeq != 0 {
+		return nil
+	}
+	if _, err := rand.Read(c.clientRandom[:]); err != nil {
+		return err
+	}
+	c.addHandshake(dtlsClientHello, c.clientHello())
+	return c.sendFlightTimed()
+}
+
+// close sends close_notify once the handshake is done and stops the
+// retransmissions.
+func (c *dtlsConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.state == dtlsStateDone {
+		c.sendAlert(dtlsAlertWarning, dtlsAlertCloseNotify)
+	}
+	c.closed = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// handshakeDone reports whether the SRTP keys can be exported.
+func (c *dtlsConn) handshakeDone() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == dtlsStateDone
+}
+
+// exportSrtpKeys returns the master keys and salts of the local and the
+// remote direction,RFC 5764 4.2.
+func (c *dtlsConn) exportSrtpKeys() (localKey, localSalt, remoteKey, remoteSalt []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seed := append(append([]byte(nil), c.clientRandom[:]...), c.serverRandom[:]...)
+	material := dtlsPrf(c.master, dtlsSrtpExporterLabel, seed, dtlsSrtpExporterMaterialSize)
+	clientKey := material[:SRTP_MASTER_KEY_SIZE]
+	serverKey := material[SRTP_MASTER_KEY_SIZE : 2*SRTP_MASTER_KEY_SIZE]
+	clientSalt := material[2*SRTP_MASTER_KEY_SIZE : 2*SRTP_MASTER_KEY_SIZE+SRTP_MASTER_SALT_SIZE]
+	serverSalt := material[2*SRTP_MASTER_KEY_SIZE+SRTP_MASTER_SALT_SIZE:]
+	if c.isClient {
+		return clientKey, clientSalt, serverKey, serverSalt
+	}
+	return serverKey, serverSalt, clientKey, clientSalt
+}
+
+// handle processes the records of one datagram,it returns true when the
+// handshake completed with it.
+func (c *dtlsConn) handle(buf []byte) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false, ErrDtlsClosed
+	}
+	wasDone := c.state == dtlsStateDone
+	retransmit := false
+	for len(buf) >= dtlsRecordHeaderSize {
+		header := buf[:dtlsRecordHeaderSize]
+		size := int(binary.BigEndian.Uint16(header[11:]))
+		if len(buf) < dtlsRecordHeaderSize+size {
+			break
+		}
+		fragment := buf[dtlsRecordHeaderSize : dtlsRecordHeaderSize+size]
+		buf = buf[dtlsRecordHeaderSize+size:]
+		if binary.BigEndian.Uint16(header[3:]) > 0 {
+			var err error
+			// records of the next epoch arriving before the keys are dropped,
+			// the peer retransmits them
+			if fragment, err = c.openRecord(header, fragment); err != nil {
+				continue
+			}
+		}
+
+		switch header[0] {
+		case dtlsContentAlert:
+			if len(fragment) >= 2 && (fragment[0] == dtlsAlertFatal || fragment[1] == dtlsAlertCloseNotify) {
+				c.closed = true
+				if c.timer != nil {
+					c.timer.Stop()
+				}
+				if fragment[1] == dtlsAlertCloseNotify {
+					return false, ErrDtlsClosed
+				}
+				return false, fmt.Errorf("%w:alert %d", ErrDtlsHandshake, fragment[1])
+			}
+		case dtlsContentHandshake:
+			old, err := c.handleHandshake(fragment)
+			if err != nil {
+				desc := uint8(dtlsAlertHandshakeFailure)
+				if errors.Is(err, ErrDtlsFingerprint) {
+					desc = dtlsAlertBadCertificate
+				}
+				c.sendAlert(dtlsAlertFatal, desc)
+				c.closed = true
+				if c.timer != nil {
+					c.timer.Stop()
+				}
+				return false, err
+			}
+			retransmit = retransmit || old
+		}
+		// ChangeCipherSpec needs no processing,the Finished following it is
+		// only readable with the new keys. Application data is not supported
+	}
+	if retransmit && len(c.flight) > 0 {
+		// the peer repeats its flight,so ours was lost
+		c.sendFlight()
+	}
+	return !wasDone && c.state == dtlsStateDone, nil
+}
+
+// handleHandshake reassembles the handshake fragments of a record and
+// processes the completed messages in order,old reports a repeated message.
+func (c *dtlsConn) handleHandshake(record []byte) (old bool, err error) {
+	for len(record) >= dtlsHandshakeHeaderSize {
+		typ := record[0]
+		length := dtlsUint24(record[1:])
+		seq := binary.BigEndian.Uint16(record[4:])
+		offset := dtlsUint24(record[6:])
+		size := dtlsUint24(record[9:])
+		if len(record) < dtlsHandshakeHeaderSize+size || offset+size > length {
+			return old, errDtlsTruncated
+		}
+		if length > dtlsMaxMessageSize {
+			return old, fmt.Errorf("%w:message %d of %d bytes too large", ErrDtlsHandshake, seq, length)
+		}
+		data := record[dtlsHandshakeHeaderSize : dtlsHandshakeHeaderSize+size]
+		record = record[dtlsHandshakeHeaderSize+size:]
+
+		if seq < c.recvSeq {
+			old = true
+			continue
+		}
+		if seq >= c.recvSeq+dtlsMaxPendingMessages {
+			continue
+		}
+		msg := c.messages[seq]
+		if msg == nil {
+			msg = &dtlsMessage{typ: typ, body: make([]byte, length), filled: make([]bool, length), missing: length}
+			c.messages[seq] = msg
+		}
+		if msg.typ != typ || len(msg.body) != length {
+			return old, fmt.Errorf("%w:inconsistent fragments of message %d", ErrDtlsHandshake, seq)
+		}
+		for i := range data {
+			if !msg.filled[offset+i] {
+				msg.filled[offset+i] = true
+				msg.body[offset+i] = data[i]
+				msg.missing--
+			}
+		}
+	}
+
+	for {
+		msg := c.messages[c.recvSeq]
+		if msg == nil || msg.missing > 0 {
+			return old, nil
+		}
+		delete(c.messages, c.recvSeq)
+		// the transcript holds the messages as if they were not fragmented
+		raw := make([]byte, dtlsHandshakeHeaderSize+len(msg.body))
+		raw[0] = msg.typ
+		dtlsPutUint24(raw[1:], len(msg.body))
+		binary.BigEndian.PutUint16(raw[4:], c.recvSeq)
+		dtlsPutUint24(raw[9:], len(msg.body))
+		copy(raw[dtlsHandshakeHeaderSize:], msg.body)
+		c.recvSeq++
+
+		if c.isClient {
+			err = c.processClient(msg.typ, raw)
+		} else {
+			err = c.processServer(msg.typ, raw)
+		}
+		if err != nil {
+			return old, err
+		}
+	}
+}
+
+func (c *dtlsConn) processServer(typ uint8, raw []byte) error {
+	body := raw[dtlsHandshakeHeaderSize:]
+	switch {
+	case c.state == dtlsStateHello && typ == dtlsClientHello:
+		if err := c.parseClientHello(body); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		if _, err := rand.Read(c.serverRandom[:]); err != nil {
+			return err
+		}
+		var err error
+		if c.ecdhKey, err = dtlsEcdhCurve(c.curve).GenerateKey(rand.Reader); err != nil {
+			return err
+		}
+		keyExchange, err := c.serverKeyExchange()
+		if err != nil {
+			return err
+		}
+		c.flight = nil
+		c.addHandshake(dtlsServerHello, c.serverHello())
+		c.addHandshake(dtlsCertificate, c.certificate())
+		c.addHandshake(dtlsServerKeyExchange, keyExchange)
+		c.addHandshake(dtlsCertificateRequest, dtlsCertificateRequestBody())
+		c.addHandshake(dtlsServerHelloDone, nil)
+		c.state = dtlsStateFinished
+		return c.sendFlightTimed()
+
+	case c.state == dtlsStateFinished && typ == dtlsCertificate:
+		if err := c.parseCertificate(body); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		return nil
+
+	case c.state == dtlsStateFinished && typ == dtlsClientKeyExchange:
+		if c.peerCert == nil {
+			// the certificate is what binds DTLS to the signaled fingerprint
+			return fmt.Errorf("%w:client certificate required", ErrDtlsHandshake)
+		}
+		if len(body) < 1 || len(body) < 1+int(body[0]) {
+			return errDtlsTruncated
+		}
+		c.transcript = append(c.transcript, raw...)
+		return c.deriveKeys(body[1 : 1+int(body[0])])
+
+	case c.state == dtlsStateFinished && typ == dtlsCertificateVerify:
+		if c.peerCert == nil || c.master == nil {
+			return fmt.Errorf("%w:unexpected CertificateVerify", ErrDtlsHandshake)
+		}
+		if err := c.verifySignature(body, c.transcript); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		c.peerVerified = true
+		return nil
+
+	case c.state == dtlsStateFinished && typ == dtlsFinished:
+		if !c.peerVerified {
+			return fmt.Errorf("%w:client certificate not verified", ErrDtlsHandshake)
+		}
+		if !hmac.Equal(body, c.finishedData("client finished")) {
+			return fmt.Errorf("%w:bad client Finished", ErrDtlsHandshake)
+		}
+		c.transcript = append(c.transcript, raw...)
+		c.flight = nil
+		c.addChangeCipherSpec()
+		c.addHandshake(dtlsFinished, c.finishedData("server finished"))
+		c.state = dtlsStateDone
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		return c.sendFlight()
+	}
+	return fmt.Errorf("%w:unexpected message %d", ErrDtlsHandshake, typ)
+}
+
+func (c *dtlsConn) processClient(typ uint8, raw []byte) error {
+	body := raw[dtlsHandshakeHeaderSize:]
+	switch {
+	case c.state == dtlsStateHello && typ == dtlsHelloVerifyRequest:
+		// server_version,cookie
+		if len(body) < 3 || len(body) < 3+int(body[2]) {
+			return errDtlsTruncated
+		}
+		c.cookie = append([]byte(nil), body[3:3+int(body[2])]...)
+		// neither the first ClientHello nor HelloVerifyRequest are hashed
+		c.transcript = nil
+		c.flight = nil
+		c.addHandshake(dtlsClientHello, c.clientHello())
+		return c.sendFlightTimed()
+
+	case c.state == dtlsStateHello && typ == dtlsServerHello:
+		if err := c.parseServerHello(body); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		return nil
+
+	case c.state == dtlsStateHello && typ == dtlsCertificate:
+		if err := c.parseCertificate(body); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		return nil
+
+	case c.state == dtlsStateHello && typ == dtlsServerKeyExchange:
+		if err := c.parseServerKeyExchange(body); err != nil {
+			return err
+		}
+		c.transcript = append(c.transcript, raw...)
+		return nil
+
+	case c.state == dtlsStateHello && typ == dtlsCertificateRequest:
+		c.certRequested = true
+		c.transcript = append(c.transcript, raw...)
+		return nil
+
+	case c.state == dtlsStateHello && typ == dtlsServerHelloDone:
+		if c.peerCert == nil || c.ecdhKey == nil {
+			return fmt.Errorf("%w:incomplete server flight", ErrDtlsHandshake)
+		}
+		c.transcript = append(c.transcript, raw...)
+		c.flight = nil
+		if c.certRequested {
+			c.addHandshake(dtlsCertificate, c.certificate())
+		}
+		pub := c.ecdhKey.PublicKey().Bytes()
+		c.addHandshake(dtlsClientKeyExchange, append([]byte{byte(len(pub))}, pub...))
+		if err := c.deriveKeys(c.peerPublic); err != nil {
+			return err
+		}
+		if c.certRequested {
+			signature, err := c.sign(c.transcript)
+			if err != nil {
+				return err
+			}
+			c.addHandshake(dtlsCertificateVerify, signature)
+		}
+		c.addChangeCipherSpec()
+		c.addHandshake(dtlsFinished, c.finishedData("client finished"))
+		c.state = dtlsStateFinished
+		return c.sendFlightTimed()
+
+	case c.state == dtlsStateFinished && typ == dtlsFinished:
+		if !hmac.Equal(body, c.finishedData("server finished")) {
+			return fmt.Errorf("%w:bad server Finished", ErrDtlsHandshake)
+		}
+		c.transcript = append(c.transcript, raw...)
+		c.flight = nil
+		c.state = dtlsStateDone
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		return nil
+	}
+	return fmt.Errorf("%w:unexpected message %d", ErrDtlsHandshake, typ)
+}
+
+func (c *dtlsConn) clientHello() []byte {
+	b := binary.BigEndian.AppendUint16(nil, dtlsVersion12)
+	b = append(b, c.clientRandom[:]...)
+	b = append(b, 0) // session id
+	b = append(b, byte(len(c.cookie)))
+	b = append(b, c.cookie...)
+	b = binary.BigEndian.AppendUint16(b, 2)
+	b = binary.BigEndian.AppendUint16(b, dtlsCipherEcdheEcdsaAes128GcmSha256)
+	b = append(b, 1, 0) // null compression
+
+	var exts []byte
+	exts = appendDtlsExtension(exts, dtlsExtSupportedGroups, []byte{0, 4, 0, dtlsCurveX25519, 0, dtlsCurveP256})
+	exts = appendDtlsExtension(exts, dtlsExtPointFormats, []byte{1, 0})
+	exts = appendDtlsExtension(exts, dtlsExtSignatureAlgorithms, []byte{0, 4, 0x04, 0x03, 0x04, 0x01})
+	exts = appendDtlsExtension(exts, dtlsExtUseSrtp, []byte{0, 2, 0, SRTP_AES128_CM_HMAC_SHA1_80, 0})
+	exts = appendDtlsExtension(exts, dtlsExtExtendedMasterSecret, nil)
+	exts = appendDtlsExtension(exts, dtlsExtRenegotiationInfo, []byte{0})
+	b = binary.BigEndian.AppendUint16(b, uint16(len(exts)))
+	return append(b, exts...)
+}
+
+func (c *dtlsConn) parseClientHello(body []byte) error {
+	// version,random,session id,cookie,cipher suites,compressions,extensions
+	if len(body) < 2+dtlsRandomSize+1 {
+		return errDtlsTruncated
+	}
+	copy(c.clientRandom[:], body[2:2+dtlsRandomSize])
+	n := 2 + dtlsRandomSize
+	n += 1 + int(body[n]) // session id
+	if len(body) < n+1 {
+		return errDtlsTruncated
+	}
+	n += 1 + int(body[n]) // cookie
+	if len(body) < n+2 {
+		return errDtlsTruncated
+	}
+	suites := dtlsUint16List(body[n:], 2)
+	n += 2 + int(binary.BigEndian.Uint16(body[n:]))
+	if len(body) < n+1 {
+		return errDtlsTruncated
+	}
+	n += 1 + int(body[n]) // compressions
+	if len(body) < n {
+		return errDtlsTruncated
+	}
+	exts, err := parseDtlsExtensions(body[n:])
+	if err != nil {
+		return err
+	}
+
+	if !containsUint16(suites, dtlsCipherEcdheEcdsaAes128GcmSha256) {
+		return fmt.Errorf("%w:no supported cipher suite", ErrDtlsHandshake)
+	}
+	if !containsUint16(dtlsUint16List(exts[dtlsExtUseSrtp], 2), SRTP_AES128_CM_HMAC_SHA1_80) {
+		return fmt.Errorf("%w:no supported SRTP protection profile", ErrDtlsHandshake)
+	}
+	c.srtpProfile = SRTP_AES128_CM_HMAC_SHA1_80
+	groups, ok := exts[dtlsExtSupportedGroups]
+	switch list := dtlsUint16List(groups, 2); {
+	case !ok, containsUint16(list, dtlsCurveP256) && !containsUint16(list, dtlsCurveX25519):
+		c.curve = dtlsCurveP256
+	case containsUint16(list, dtlsCurveX25519):
+		c.curve = dtlsCurveX25519
+	default:
+		return fmt.Errorf("%w:no supported group", ErrDtlsHandshake)
+	}
+	_, c.ems = exts[dtlsExtExtendedMasterSecret]
+	// the secure renegotiation support is signaled either way,RFC 5746 3.3
+	_, c.renegotiation = exts[dtlsExtRenegotiationInfo]
+	c.renegotiation = c.renegotiation || containsUint16(suites, dtlsCipherRenegotiationInfoScsv)
+	return nil
+}
+
+func (c *dtlsConn) serverHello() []byte {
+	b := binary.BigEndian.AppendUint16(nil, dtlsVersion12)
+	b = append(b, c.serverRandom[:]...)
+	b = append(b, 0) // session id,no resumption
+	b = binary.BigEndian.AppendUint16(b, dtlsCipherEcdheEcdsaAes128GcmSha256)
+	b = append(b, 0)
+
+	var exts []byte
+	exts = appendDtlsExtension(exts, dtlsExtUseSrtp, []byte{0, 2, byte(c.srtpProfile >> 8), byte(c.srtpProfile), 0})
+	if c.ems {
+		exts = appendDtlsExtension(exts, dtlsExtExtendedMasterSecret, nil)
+	}
+	if c.renegotiation {
+		exts = appendDtlsExtension(exts, dtlsExtRenegotiationInfo, []byte{0})
+	}
+	exts = appendDtlsExtension(exts, dtlsExtPointFormats, []byte{1, 0})
+	b = binary.BigEndian.AppendUint16(b, uint16(len(exts)))
+	return append(b, exts...)
+}
+
+func (c *dtlsConn) parseServerHello(body []byte) error {
+	if len(body) < 2+dtlsRandomSize+1 {
+		return errDtlsTruncated
+	}
+	copy(c.serverRandom[:], body[2:2+dtlsRandomSize])
+	n := 2 + dtlsRandomSize
+	n += 1 + int(body[n]) // session id
+	if len(body) < n+3 {
+		return errDtlsTruncated
+	}
+	if suite := binary.BigEndian.Uint16(body[n:]); suite != dtlsCipherEcdheEcdsaAes128GcmSha256 {
+		return fmt.Errorf("%w:unexpected cipher suite %#x", ErrDtlsHandshake, suite)
+	}
+	exts, err := parseDtlsExtensions(body[n+3:])
+	if err != nil {
+		return err
+	}
+	profiles := dtlsUint16List(exts[dtlsExtUseSrtp], 2)
+	if len(profiles) != 1 || profiles[0] != SRTP_AES128_CM_HMAC_SHA1_80 {
+		return fmt.Errorf("%w:no SRTP protection profile", ErrDtlsHandshake)
+	}
+	c.srtpProfile = profiles[0]
+	_, c.ems = exts[dtlsExtExtendedMasterSecret]
+	return nil
+}
+
+func (c *dtlsConn) certificate() []byte {
+	b := make([]byte, 6, 6+len(c.cert.DER))
+	dtlsPutUint24(b, 3+len(c.cert.DER))
+	dtlsPutUint24(b[3:], len(c.cert.DER))
+	return append(b, c.cert.DER...)
+}
+
+// parseCertificate parses the peer certificate and checks its fingerprint
+func (c *dtlsConn) parseCertificate(body []byte) error {
+	if len(body) < 6 || len(body) < 3+dtlsUint24(body) {
+		return errDtlsTruncated
+	}
+	size := dtlsUint24(body[3:])
+	if len(body) < 6+size || size == 0 {
+		return fmt.Errorf("%w:empty certificate", ErrDtlsHandshake)
+	}
+	der := body[6 : 6+size]
+	if !strings.EqualFold(dtlsFingerprint(der), c.remoteFingerprint) {
+		return ErrDtlsFingerprint
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrDtlsHandshake, err)
+	}
+	c.peerCert = cert
+	return nil
+}
+
+func (c *dtlsConn) serverKeyExchange() ([]byte, error) {
+	pub := c.ecdhKey.PublicKey().Bytes()
+	params := []byte{dtlsCurveTypeNamed, byte(c.curve >> 8), byte(c.curve), byte(len(pub))}
+	params = append(params, pub...)
+	signed := append(append(append([]byte(nil), c.clientRandom[:]...), c.serverRandom[:]...), params...)
+	signature, err := c.sign(signed)
+	if err != nil {
+		return nil, err
+	}
+	return append(params, signature...), nil
+}
+
+func (c *dtlsConn) parseServerKeyExchange(body []byte) error {
+	if c.peerCert == nil {
+		return fmt.Errorf("%w:ServerKeyExchange before Certificate", ErrDtlsHandshake)
+	}
+	if len(body) < 4 || len(body) < 4+int(body[3]) || body[0] != dtlsCurveTypeNamed {
+		return errDtlsTruncated
+	}
+	c.curve = binary.BigEndian.Uint16(body[1:])
+	curve := dtlsEcdhCurve(c.curve)
+	if curve == nil {
+		return fmt.Errorf("%w:unsupported group %d", ErrDtlsHandshake, c.curve)
+	}
+	params := body[:4+int(body[3])]
+	signed := append(append(append([]byte(nil), c.clientRandom[:]...), c.serverRandom[:]...), params...)
+	if err := c.verifySignature(body[len(params):], signed); err != nil {
+		return err
+	}
+	c.peerPublic = append([]byte(nil), params[4:]...)
+	var err error
+	c.ecdhKey, err = curve.GenerateKey(rand.Reader)
+	return err
+}
+
+func dtlsCertificateRequestBody() []byte {
+	b := []byte{2, dtlsCertTypeEcdsaSign, dtlsCertTypeRsaSign}
+	b = append(b, 0, 4, 0x04, 0x03, 0x04, 0x01)
+	return append(b, 0, 0) // no certificate authorities,the certificates are self-signed
+}
+
+// sign returns the signature of data with its algorithm and length
+func (c *dtlsConn) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, c.cert.PrivateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	b := binary.BigEndian.AppendUint16(nil, dtlsSignatureEcdsaSha256)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(signature)))
+	return append(b, signature...), nil
+}
+
+// verifySignature checks the algorithm,length and signature in buf of data
+// with the peer certificate
+func (c *dtlsConn) verifySignature(buf []byte, data []byte) error {
+	if len(buf) < 4 || len(buf) < 4+int(binary.BigEndian.Uint16(buf[2:])) {
+		return errDtlsTruncated
+	}
+	algorithm := binary.BigEndian.Uint16(buf)
+	signature := buf[4 : 4+int(binary.BigEndian.Uint16(buf[2:]))]
+	digest := sha256.Sum256(data)
+	switch key := c.peerCert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if algorithm == dtlsSignatureEcdsaSha256 && ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if algorithm == dtlsSignatureRsaSha256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w:bad signature", ErrDtlsHandshake)
+}
+
+// deriveKeys computes the master secret from the peer ECDHE public key and
+// the record keys of epoch 1,the transcript ends with ClientKeyExchange
+func (c *dtlsConn) deriveKeys(peerPublic []byte) error {
+	pub, err := dtlsEcdhCurve(c.curve).NewPublicKey(peerPublic)
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrDtlsHandshake, err)
+	}
+	preMaster, err := c.ecdhKey.ECDH(pub)
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrDtlsHandshake, err)
+	}
+	if c.ems {
+		sessionHash := sha256.Sum256(c.transcript)
+		c.master = dtlsPrf(preMaster, "extended master secret", sessionHash[:], dtlsMasterSecretSize)
+	} else {
+		seed := append(append([]byte(nil), c.clientRandom[:]...), c.serverRandom[:]...)
+		c.master = dtlsPrf(preMaster, "master secret", seed, dtlsMasterSecretSize)
+	}
+
+	seed := append(append([]byte(nil), c.serverRandom[:]...), c.clientRandom[:]...)
+	keys := dtlsPrf(c.master, "key expansion", seed, 2*16+2*4)
+	clientAead, err := newDtlsAead(keys[0:16])
+	if err != nil {
+		return err
+	}
+	serverAead, err := newDtlsAead(keys[16:32])
+	if err != nil {
+		return err
+	}
+	clientIV, serverIV := keys[32:36], keys[36:40]
+	if c.isClient {
+		c.writeAead, c.writeIV, c.readAead, c.readIV = clientAead, clientIV, serverAead, serverIV
+	} else {
+		c.writeAead, c.writeIV, c.readAead, c.readIV = serverAead, serverIV, clientAead, clientIV
+	}
+	return nil
+}
+
+func newDtlsAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *dtlsConn) finishedData(label string) []byte {
+	sum := sha256.Sum256(c.transcript)
+	return dtlsPrf(c.master, label, sum[:], dtlsVerifyDataSize)
+}
+
+// addHandshake appends a handshake message to the transcript and to the
+// flight,fragmented when larger than dtlsMaxFragment
+func (c *dtlsConn) addHandshake(typ uint8, body []byte) {
+	header := make([]byte, dtlsHandshakeHeaderSize)
+	header[0] = typ
+	dtlsPutUint24(header[1:], len(body))
+	binary.BigEndian.PutUint16(header[4:], c.sendSeq)
+	dtlsPutUint24(header[9:], len(body))
+	c.sendSeq++
+	c.transcript = append(append(c.transcript, header...), body...)
+
+	for offset := 0; ; {
+		size := minInt(len(body)-offset, dtlsMaxFragment)
+		fragment := make([]byte, dtlsHandshakeHeaderSize+size)
+		copy(fragment, header)
+		dtlsPutUint24(fragment[6:], offset)
+		dtlsPutUint24(fragment[9:], size)
+		copy(fragment[dtlsHandshakeHeaderSize:], body[offset:offset+size])
+		c.flight = append(c.flight, dtlsFlightRecord{contentType: dtlsContentHandshake, epoch: c.writeEpoch, data: fragment})
+		offset += size
+		if offset >= len(body) {
+			return
+		}
+	}
+}
+
+func (c *dtlsConn) addChangeCipherSpec() {
+	c.flight = append(c.flight, dtlsFlightRecord{contentType: dtlsContentChangeCipherSpec, epoch: c.writeEpoch, data: []byte{1}})
+	c.writeEpoch = 1
+}
+
+// sealRecord returns the record of data,encrypted from epoch 1
+func (c *dtlsConn) sealRecord(contentType uint8, epoch uint16, data []byte) []byte {
+	seq := c.writeSeq[epoch]
+	c.writeSeq[epoch]++
+	record := make([]byte, dtlsRecordHeaderSize, dtlsRecordHeaderSize+dtlsGcmExplicitSize+len(data)+dtlsGcmTagSize)
+	record[0] = contentType
+	binary.BigEndian.PutUint16(record[1:], dtlsVersion12)
+	binary.BigEndian.PutUint64(record[3:], uint64(epoch)<<48|seq)
+	if epoch == 0 {
+		binary.BigEndian.PutUint16(record[11:], uint16(len(data)))
+		return append(record, data...)
+	}
+	// the explicit nonce is the epoch and sequence number
+	explicit := record[3:11]
+	nonce := append(append(make([]byte, 0, 12), c.writeIV...), explicit...)
+	record = append(record, explicit...)
+	record = c.writeAead.Seal(record, nonce, data, dtlsAdditionalData(record[:dtlsRecordHeaderSize], len(data)))
+	binary.BigEndian.PutUint16(record[11:], uint16(len(record)-dtlsRecordHeaderSize))
+	return record
+}
+
+func (c *dtlsConn) openRecord(header, fragment []byte) ([]byte, error) {
+	if c.readAead == nil {
+		return nil, fmt.Errorf("%w:no keys", ErrDtlsHandshake)
+	}
+	if len(fragment) < dtlsGcmExplicitSize+dtlsGcmTagSize {
+		return nil, errDtlsTruncated
+	}
+	nonce := append(append(make([]byte, 0, 12), c.readIV...), fragment[:dtlsGcmExplicitSize]...)
+	size := len(fragment) - dtlsGcmExplicitSize - dtlsGcmTagSize
+	return c.readAead.Open(nil, nonce, fragment[dtlsGcmExplicitSize:], dtlsAdditionalData(header, size))
+}
+
+// dtlsAdditionalData epoch,sequence number,type,version and plaintext length
+func dtlsAdditionalData(header []byte, size int) []byte {
+	ad := make([]byte, 13)
+	copy(ad, header[3:11])
+	ad[8] = header[0]
+	copy(ad[9:11], header[1:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(size))
+	return ad
+}
+
+// sendFlight sends the records of the flight packed in datagrams
+func (c *dtlsConn) sendFlight() error {
+	var datagram []byte
+	for _, r := range c.flight {
+		record := c.sealRecord(r.contentType, r.epoch, r.data)
+		if len(datagram) > 0 && len(datagram)+len(record) > dtlsMaxDatagram {
+			if err := c.write(datagram); err != nil {
+				return err
+			}
+			datagram = nil
+		}
+		datagram = append(datagram, record...)
+	}
+	if len(datagram) == 0 {
+		return nil
+	}
+	return c.write(datagram)
+}
+
+// sendFlightTimed sends the flight and retransmits it until the peer answers
+func (c *dtlsConn) sendFlightTimed() error {
+	c.retransmit = dtlsRetransmitInterval
+	c.armTimer()
+	return c.sendFlight()
+}
+
+func (c *dtlsConn) armTimer() {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(c.retransmit, c.onTimer)
+}
+
+func (c *dtlsConn) onTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.state == dtlsStateDone {
+		return
+	}
+	if c.retransmit < dtlsMaxRetransmitInterval {
+		c.retransmit *= 2
+	}
+	c.sendFlight()
+	c.armTimer()
+}
+
+func (c *dtlsConn) sendAlert(level, desc uint8) {
+	c.write(c.sealRecord(dtlsContentAlert, c.writeEpoch, []byte{level, desc}))
+}
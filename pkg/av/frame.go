@@ -0,0 +1,77 @@
+package av
+
+import (
+	"fmt"
+	"time"
+)
+
+// CodecType codec of the data carried by a Frame
+type CodecType int
+
+const (
+	CODEC_UNKNOWN CodecType = iota
+	CODEC_H264
+	CODEC_H265
+	CODEC_MJPEG
+	CODEC_AAC
+	CODEC_G711A // PCMA
+	CODEC_G711U // PCMU
+	CODEC_OPUS
+	CODEC_PS // MPEG-2 program stream,GB28181
+	CODEC_TS // MPEG-2 transport stream
+)
+
+var codecNames = map[CodecType]string{
+	CODEC_UNKNOWN: "unknown",
+	CODEC_H264:    "H264",
+	CODEC_H265:    "H265",
+	CODEC_MJPEG:   "MJPEG",
+	CODEC_AAC:     "AAC",
+	CODEC_G711A:   "PCMA",
+	CODEC_G711U:   "PCMU",
+	CODEC_OPUS:    "OPUS",
+	CODEC_PS:      "PS",
+	CODEC_TS:      "TS",
+}
+
+func (c CodecType) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("CodecType(%d)", int(c))
+}
+
+// IsVideo reports whether the codec is a video codec.
+func (c CodecType) IsVideo() bool {
+	return c == CODEC_H264 || c == CODEC_H265 || c == CODEC_MJPEG
+}
+
+// IsAudio reports whether the codec is an audio codec.
+func (c CodecType) IsAudio() bool {
+	return c == CODEC_AAC || c == CODEC_G711A || c == CODEC_G711U || c == CODEC_OPUS
+}
+
+// Frame one access unit (video picture or audio frame) or one chunk of a
+// container stream,the common currency of depacketizers and muxers
+type Frame struct {
+	Codec    CodecType
+	TrackID  int
+	PTS      time.Duration
+	DTS      time.Duration
+	KeyFrame bool
+	// Data for H.264/H.265 is Annex-B,for AAC raw without ADTS header
+	Data []byte
+}
+
+// Clone returns a deep copy of the frame,filters that keep frames after
+// returning must clone them since Data may be reused by the source.
+func (f *Frame) Clone() *Frame {
+	c := *f
+	c.Data = append([]byte(nil), f.Data...)
+	return &c
+}
+
+func (f *Frame) String() string {
+	return fmt.Sprintf("Frame{Codec:%v Track:%d PTS:%v DTS:%v Key:%v Size:%d}",
+		f.Codec, f.TrackID, f.PTS, f.DTS, f.KeyFrame, len(f.Data))
+}
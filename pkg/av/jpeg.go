@@ -0,0 +1,440 @@
+package av
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	RTP_JPEG_CLOCK_RATE   = 90000
+	RTP_JPEG_PAYLOAD_TYPE = 26
+
+	DEFAULT_JPEG_MAX_FRAME_SIZE = 8 << 20
+)
+
+const (
+	jpegHeaderSize        = 8
+	jpegRestartHeaderSize = 4
+	jpegQuantHeaderSize   = 4
+	jpegTypeRestart       = 64 // types 64-127 carry a restart marker header
+	jpegQDynamic          = 255
+	jpegQInBand           = 128 // Q 128-255 carry the tables in band
+
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerAPP0 = 0xE0
+	jpegMarkerDQT  = 0xDB
+	jpegMarkerDRI  = 0xDD
+	jpegMarkerSOF0 = 0xC0
+	jpegMarkerDHT  = 0xC4
+	jpegMarkerSOS  = 0xDA
+)
+
+var (
+	ErrJpegTruncated  = errors.New("rtp jpeg: truncated payload")
+	ErrJpegFrameLost  = errors.New("rtp jpeg: frame dropped for lost fragments")
+	ErrJpegNoTables   = errors.New("rtp jpeg: quantization tables not received")
+	ErrJpegFrameLarge = errors.New("rtp jpeg: frame too large")
+)
+
+// jpegStdQuant the quantization tables of ITU-T T.81 Annex K in zigzag order
+var jpegStdQuant = [2][64]byte{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type jpegHuffmanTable struct {
+	class  byte // 0 DC,1 AC
+	id     byte
+	counts [16]byte
+	values []byte
+}
+
+// jpegStdHuffman the Huffman tables of ITU-T T.81 Annex K.3,RFC 2435
+// payloads are always coded with them
+var jpegStdHuffman = []jpegHuffmanTable{
+	{
+		class:  0,
+		id:     0,
+		counts: [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		class:  1,
+		id:     0,
+		counts: [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		values: []byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		class:  0,
+		id:     1,
+		counts: [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		class:  1,
+		id:     1,
+		counts: [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		values: []byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// jpegQuantTables the quantization tables of one frame,each 64 bytes for 8
+// bits or 128 bytes for 16 bits precision
+type jpegQuantTables struct {
+	tables [][]byte
+}
+
+// makeJpegQuantTables scales the standard tables by the quality factor q of
+// 1-99,RFC 2435 Appendix A
+func makeJpegQuantTables(q byte) *jpegQuantTables {
+	factor := int(q)
+	if factor < 1 {
+		factor = 1
+	} else if factor > 99 {
+		factor = 99
+	}
+	scale := 200 - factor*2
+	if factor < 50 {
+		scale = 5000 / factor
+	}
+	qt := &jpegQuantTables{tables: make([][]byte, 2)}
+	for t := range jpegStdQuant {
+		table := make([]byte, 64)
+		for i, v := range jpegStdQuant[t] {
+			scaled := (int(v)*scale + 50) / 100
+			if scaled < 1 {
+				scaled = 1
+			} else if scaled > 255 {
+				scaled = 255
+			}
+			table[i] = byte(scaled)
+		}
+		qt.tables[t] = table
+	}
+	return qt
+}
+
+// parseJpegQuantTables splits the in band tables by the precision bits
+func parseJpegQuantTables(precision byte, data []byte) (*jpegQuantTables, error) {
+	qt := &jpegQuantTables{}
+	for i := 0; len(data) > 0; i++ {
+		if i >= 8 {
+			return nil, fmt.Errorf("rtp jpeg: too many quantization tables")
+		}
+		size := 64
+		if precision&(1<<i) != 0 {
+			size = 128
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("%w:quantization table %d", ErrJpegTruncated, i)
+		}
+		qt.tables = append(qt.tables, data[:size:size])
+		data = data[size:]
+	}
+	if len(qt.tables) == 0 {
+		return nil, ErrJpegNoTables
+	}
+	return qt, nil
+}
+
+// JpegDepacketizer reassembles the RFC 2435 payloads of one SSRC into full
+// JFIF images,rebuilding the headers stripped by the sender.The zero value
+// is ready to use,it is not safe for concurrent use
+type JpegDepacketizer struct {
+	MaxFrameSize int // 0 means DEFAULT_JPEG_MAX_FRAME_SIZE
+
+	// in band tables of Q 128-254,which may be sent only once
+	tables map[byte]*jpegQuantTables
+
+	started       bool
+	dropping      bool
+	timestamp     uint32
+	typ           byte
+	width         int
+	height        int
+	restart       uint16
+	quant         *jpegQuantTables
+	scan          []byte
+	restartMarker bool
+}
+
+// NewJpegDepacketizer creates a depacketizer with DEFAULT_JPEG_MAX_FRAME_SIZE.
+func NewJpegDepacketizer() *JpegDepacketizer {
+	return &JpegDepacketizer{
+		MaxFrameSize: DEFAULT_JPEG_MAX_FRAME_SIZE,
+		tables:       make(map[byte]*jpegQuantTables),
+	}
+}
+
+// Push adds one packet,it returns the JFIF image when pkt completes a frame
+// and nil otherwise.A frame missing fragments is dropped with
+// ErrJpegFrameLost.
+func (d *JpegDepacketizer) Push(pkt *RtpPacket) ([]byte, error) {
+	/*
+	 *  0                   1                   2                   3
+	 *  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * | Type-specific |              Fragment Offset                  |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |      Type     |       Q       |     Width     |     Height    |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 */
+	payload := pkt.Payload
+	if len(payload) < jpegHeaderSize {
+		return nil, ErrJpegTruncated
+	}
+	offset := int(binary.BigEndian.Uint32(payload[0:4]) & 0xFFFFFF)
+	typ := payload[4]
+	q := payload[5]
+	width := int(payload[6]) * 8
+	height := int(payload[7]) * 8
+	payload = payload[jpegHeaderSize:]
+
+	var lost error
+	if d.started && pkt.Timestamp != d.timestamp {
+		// the marker of the previous frame was lost
+		if !d.dropping {
+			lost = ErrJpegFrameLost
+		}
+		d.reset()
+	}
+
+	var restart uint16
+	if typ >= jpegTypeRestart && typ < 128 {
+		if len(payload) < jpegRestartHeaderSize {
+			return nil, ErrJpegTruncated
+		}
+		restart = binary.BigEndian.Uint16(payload[0:2])
+		payload = payload[jpegRestartHeaderSize:]
+	}
+
+	if offset == 0 {
+		d.reset()
+		quant, rest, err := d.quantTables(q, payload)
+		if err != nil {
+			d.started, d.dropping, d.timestamp = true, true, pkt.Timestamp
+			return nil, err
+		}
+		payload = rest
+		d.started = true
+		d.timestamp = pkt.Timestamp
+		d.typ = typ
+		d.width = width
+		d.height = height
+		d.restart = restart
+		d.quant = quant
+		d.restartMarker = typ >= jpegTypeRestart && typ < 128
+	} else if !d.started {
+		// the first fragment was lost
+		d.started, d.dropping, d.timestamp = true, true, pkt.Timestamp
+		return nil, ErrJpegFrameLost
+	} else if d.dropping {
+		return nil, lost
+	}
+
+	if offset != len(d.scan) {
+		d.dropping = true
+		return nil, ErrJpegFrameLost
+	}
+	maxFrameSize := d.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = DEFAULT_JPEG_MAX_FRAME_SIZE
+	}
+	if len(d.scan)+len(payload) > maxFrameSize {
+		d.dropping = true
+		return nil, ErrJpegFrameLarge
+	}
+	d.scan = append(d.scan, payload...)
+	if !pkt.Marker {
+		return nil, lost
+	}
+
+	image, err := d.buildImage()
+	d.reset()
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (d *JpegDepacketizer) reset() {
+	d.started = false
+	d.dropping = false
+	d.quant = nil
+	d.scan = d.scan[:0]
+}
+
+// quantTables returns the tables of the frame and the payload following the
+// quantization table header
+func (d *JpegDepacketizer) quantTables(q byte, payload []byte) (*jpegQuantTables, []byte, error) {
+	if q < jpegQInBand {
+		if q == 0 || q >= 100 {
+			return nil, nil, fmt.Errorf("rtp jpeg: reserved Q %d", q)
+		}
+		return makeJpegQuantTables(q), payload, nil
+	}
+
+	if len(payload) < jpegQuantHeaderSize {
+		return nil, nil, ErrJpegTruncated
+	}
+	precision := payload[1]
+	length := int(binary.BigEndian.Uint16(payload[2:4]))
+	payload = payload[jpegQuantHeaderSize:]
+	if len(payload) < length {
+		return nil, nil, ErrJpegTruncated
+	}
+	if length == 0 {
+		if qt := d.tables[q]; qt != nil && q != jpegQDynamic {
+			return qt, payload, nil
+		}
+		return nil, nil, ErrJpegNoTables
+	}
+	// copy so the tables outlive the packet
+	qt, err := parseJpegQuantTables(precision, append([]byte(nil), payload[:length]...))
+	if err != nil {
+		return nil, nil, err
+	}
+	if q != jpegQDynamic {
+		if d.tables == nil {
+			d.tables = make(map[byte]*jpegQuantTables)
+		}
+		d.tables[q] = qt
+	}
+	return qt, payload[length:], nil
+}
+
+// buildImage rebuilds the JFIF headers around the scan,RFC 2435 Appendix B
+func (d *JpegDepacketizer) buildImage() ([]byte, error) {
+	var luma byte
+	switch d.typ &^ jpegTypeRestart {
+	case 0:
+		luma = 0x21 // 4:2:2
+	case 1:
+		luma = 0x22 // 4:2:0
+	default:
+		return nil, fmt.Errorf("rtp jpeg: unsupported type %d", d.typ)
+	}
+	if d.width == 0 || d.height == 0 {
+		return nil, fmt.Errorf("rtp jpeg: invalid size %dx%d", d.width, d.height)
+	}
+	chromaTable := byte(0)
+	if len(d.quant.tables) > 1 {
+		chromaTable = 1
+	}
+
+	buf := make([]byte, 0, len(d.scan)+1024)
+	buf = append(buf, 0xFF, jpegMarkerSOI)
+
+	// APP0 JFIF 1.1,no density,no thumbnail
+	buf = append(buf, 0xFF, jpegMarkerAPP0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0)
+
+	for i, table := range d.quant.tables {
+		pq := byte(0)
+		if len(table) == 128 {
+			pq = 1
+		}
+		buf = appendJpegMarker(buf, jpegMarkerDQT, 1+len(table))
+		buf = append(buf, pq<<4|byte(i))
+		buf = append(buf, table...)
+	}
+
+	if d.restartMarker {
+		buf = appendJpegMarker(buf, jpegMarkerDRI, 2)
+		buf = binary.BigEndian.AppendUint16(buf, d.restart)
+	}
+
+	buf = appendJpegMarker(buf, jpegMarkerSOF0, 15)
+	buf = append(buf, 8)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(d.height))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(d.width))
+	buf = append(buf, 3,
+		1, luma, 0,
+		2, 0x11, chromaTable,
+		3, 0x11, chromaTable)
+
+	for _, table := range jpegStdHuffman {
+		buf = appendJpegMarker(buf, jpegMarkerDHT, 1+16+len(table.values))
+		buf = append(buf, table.class<<4|table.id)
+		buf = append(buf, table.counts[:]...)
+		buf = append(buf, table.values...)
+	}
+
+	buf = appendJpegMarker(buf, jpegMarkerSOS, 10)
+	buf = append(buf, 3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 63, 0)
+
+	buf = append(buf, d.scan...)
+	if n := len(d.scan); n < 2 || d.scan[n-2] != 0xFF || d.scan[n-1] != jpegMarkerEOI {
+		buf = append(buf, 0xFF, jpegMarkerEOI)
+	}
+	return buf, nil
+}
+
+// appendJpegMarker appends a marker and the length of its size bytes body
+func appendJpegMarker(buf []byte, marker byte, size int) []byte {
+	buf = append(buf, 0xFF, marker)
+	return binary.BigEndian.AppendUint16(buf, uint16(size+2))
+}
@@ -0,0 +1,55 @@
+package av
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testJpegPacket builds an RFC 2435 packet of type 1,tables are sent in band
+// with Q when not nil
+func testJpegPacket(ts uint32, offset int, q byte, tables []byte, scan []byte, marker bool) *RtpPacket {
+	payload := make([]byte, jpegHeaderSize, jpegHeaderSize+jpegQuantHeaderSize+len(tables)+len(scan))
+	binary.BigEndian.PutUint32(payload[0:4], uint32(offset))
+	payload[4], payload[5], payload[6], payload[7] = 1, q, 40, 30
+	if offset == 0 && q >= jpegQInBand {
+		payload = append(payload, 0, 0, byte(len(tables)>>8), byte(len(tables)))
+		payload = append(payload, tables...)
+	}
+	payload = append(payload, scan...)
+	return &RtpPacket{
+		RtpHeader: RtpHeader{Version: RTP_VERSION, Marker: marker, PayloadType: 26, Timestamp: ts},
+		Payload:   payload,
+	}
+}
+
+func TestJpegDepacketizerZeroValue(t *testing.T) {
+	var d JpegDepacketizer
+	tables := append(bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{2}, 64)...)
+	scan := []byte{0x12, 0x34, 0x56}
+
+	image, err := d.Push(testJpegPacket(1, 0, 128, tables, scan[:2], false))
+	if err != nil || image != nil {
+		t.Fatalf("first fragment: %v %v", image, err)
+	}
+	if image, err = d.Push(testJpegPacket(1, 2, 128, nil, scan[2:], true)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(image, []byte{0xFF, 0xD8}) || !bytes.HasSuffix(image, append(scan, 0xFF, 0xD9)) {
+		t.Fatalf("image % x", image)
+	}
+	if !bytes.Contains(image, tables[:64]) || !bytes.Contains(image, tables[64:]) {
+		t.Fatal("in band tables missing from the image")
+	}
+
+	// the tables of Q 128 may be sent only once
+	if image, err = d.Push(testJpegPacket(2, 0, 128, []byte{}, scan, true)); err != nil || image == nil {
+		t.Fatalf("frame reusing the tables: %v", err)
+	}
+	if _, err = d.Push(testJpegPacket(3, 0, 129, []byte{}, scan, true)); err != ErrJpegNoTables {
+		t.Fatalf("frame without tables: %v", err)
+	}
+	if _, err = d.Push(testJpegPacket(4, 0, 50, nil, bytes.Repeat([]byte{0}, DEFAULT_JPEG_MAX_FRAME_SIZE+1), true)); err != ErrJpegFrameLarge {
+		t.Fatalf("frame over the default size: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package av
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	DEFAULT_MTU = 1400
+)
+
+// Payloader splits the data of one frame into RTP payloads of at most
+// maxSize bytes
+type Payloader interface {
+	Payload(maxSize int, data []byte) [][]byte
+}
+
+// SamplePayloader is implemented by payloaders of sample based codecs whose
+// payloads of one frame do not share the same timestamp,the packetizer
+// advances the timestamp by the samples of each payload
+type SamplePayloader interface {
+	Payloader
+	PayloadSamples(payload []byte) uint32
+}
+
+// MarkerPayloader is implemented by payloaders whose Marker bit is not the
+// end of the frame,Marker reports the bit of payload index of count
+type MarkerPayloader interface {
+	Payloader
+	Marker(index, count int) bool
+}
+
+// Packetizer turns frames into a stream of RtpPackets,managing sequence
+// numbers,the PTS to timestamp conversion,the SSRC and the Marker bit
+type Packetizer struct {
+	MTU         int
+	PayloadType uint8
+	SSRC        uint32
+	ClockRate   uint32
+
+	payloader Payloader
+	sequence  uint16
+	tsOffset  uint32
+}
+
+// NewPacketizer creates a packetizer,an ssrc of zero generates a random one.
+// Sequence number and timestamp start at random values as RFC 3550 requires.
+func NewPacketizer(mtu int, payloadType uint8, ssrc uint32, clockRate uint32, payloader Payloader) *Packetizer {
+	if mtu <= RTP_HEADER_SIZE {
+		mtu = DEFAULT_MTU
+	}
+	if ssrc == 0 {
+		ssrc = NewSSRC()
+	}
+	return &Packetizer{
+		MTU:         mtu,
+		PayloadType: payloadType,
+		SSRC:        ssrc,
+		ClockRate:   clockRate,
+		payloader:   payloader,
+		sequence:    uint16(randomUint32()),
+		tsOffset:    randomUint32(),
+	}
+}
+
+// NewSSRC returns a random non zero SSRC.
+func NewSSRC() uint32 {
+	for {
+		if ssrc := randomUint32(); ssrc != 0 {
+			return ssrc
+		}
+	}
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// Timestamp returns the RTP timestamp of pts.
+func (p *Packetizer) Timestamp(pts time.Duration) uint32 {
+	return p.tsOffset + uint32(DurationToRtpTicks(pts, p.ClockRate))
+}
+
+// NextSequenceNumber returns the sequence number of the next packet.
+func (p *Packetizer) NextSequenceNumber() uint16 {
+	return p.sequence
+}
+
+// Packetize splits data presented at pts into packets,the Marker bit is set
+// on the last packet of the frame unless the payloader is a MarkerPayloader.
+func (p *Packetizer) Packetize(data []byte, pts time.Duration) []*RtpPacket {
+	payloads := p.payloader.Payload(p.MTU-RTP_HEADER_SIZE, data)
+	samplePayloader, sampleBased := p.payloader.(SamplePayloader)
+	markerPayloader, hasMarker := p.payloader.(MarkerPayloader)
+	timestamp := p.Timestamp(pts)
+	packets := make([]*RtpPacket, len(payloads))
+	for i, payload := range payloads {
+		marker := i == len(payloads)-1
+		if hasMarker {
+			marker = markerPayloader.Marker(i, len(payloads))
+		}
+		packets[i] = &RtpPacket{
+			RtpHeader: RtpHeader{
+				Version:        2,
+				Marker:         marker,
+				PayloadType:    p.PayloadType,
+				SequenceNumber: p.sequence,
+				Timestamp:      timestamp,
+				SSRC:           p.SSRC,
+			},
+			Payload: payload,
+		}
+		p.sequence++
+		if sampleBased {
+			timestamp += samplePayloader.PayloadSamples(payload)
+		}
+	}
+	return packets
+}
+
+// PacketizeFrame packetizes frame.Data at frame.PTS.
+func (p *Packetizer) PacketizeFrame(frame *Frame) []*RtpPacket {
+	return p.Packetize(frame.Data, frame.PTS)
+}
+
+// NewCodecPayloader returns the payloader of codec,nil if not supported.
+func NewCodecPayloader(codec CodecType) Payloader {
+	switch codec {
+	case CODEC_H264:
+		return &H264Payloader{}
+	case CODEC_H265:
+		return &H265Payloader{}
+	case CODEC_AAC:
+		return &AACPayloader{}
+	case CODEC_G711A, CODEC_G711U:
+		return &G711Payloader{}
+	case CODEC_PS:
+		return &PSPayloader{}
+	}
+	return nil
+}
+
+// splitPayload cuts data into chunks of at most maxSize bytes
+func splitPayload(maxSize int, data []byte) [][]byte {
+	if maxSize <= 0 || len(data) == 0 {
+		return nil
+	}
+	payloads := make([][]byte, 0, (len(data)+maxSize-1)/maxSize)
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxSize {
+			n = maxSize
+		}
+		payloads = append(payloads, append([]byte(nil), data[:n]...))
+		data = data[n:]
+	}
+	return payloads
+}
+
+// G711Payloader RFC 3551 PCMA/PCMU,one byte per sample
+type G711Payloader struct{}
+
+func (g *G711Payloader) Payload(maxSize int, data []byte) [][]byte {
+	return splitPayload(maxSize, data)
+}
+
+func (g *G711Payloader) PayloadSamples(payload []byte) uint32 {
+	return uint32(len(payload))
+}
+
+// Marker is never set,for audio it flags the first packet of a talkspurt and
+// RFC 3551 4.1 requires zero without silence suppression
+func (g *G711Payloader) Marker(index, count int) bool {
+	return false
+}
+
+// PSPayloader MPEG-2 program stream over RTP as used by GB28181,the stream
+// is cut at arbitrary byte positions
+type PSPayloader struct{}
+
+func (ps *PSPayloader) Payload(maxSize int, data []byte) [][]byte {
+	return splitPayload(maxSize, data)
+}
@@ -0,0 +1,53 @@
+package av
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPacketizerMarker(t *testing.T) {
+	nalu := append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{0xab}, 3000)...)
+	tests := []struct {
+		name      string
+		payloader Payloader
+		data      []byte
+		markers   []bool
+	}{
+		// end of the access unit
+		{"h264", &H264Payloader{}, nalu, []bool{false, false, true}},
+		// end of the access unit,fragments included
+		{"aac", &AACPayloader{}, bytes.Repeat([]byte{1}, 2000), []bool{false, true}},
+		// no talkspurts without silence suppression
+		{"g711", &G711Payloader{}, bytes.Repeat([]byte{0xd5}, 2500), []bool{false, false}},
+	}
+	for _, tt := range tests {
+		p := NewPacketizer(1400, 96, 1, 90000, tt.payloader)
+		packets := p.Packetize(tt.data, 0)
+		if len(packets) != len(tt.markers) {
+			t.Fatalf("%s: %d packets,want %d", tt.name, len(packets), len(tt.markers))
+		}
+		for i, pkt := range packets {
+			if pkt.Marker != tt.markers[i] {
+				t.Errorf("%s: packet %d marker %v", tt.name, i, pkt.Marker)
+			}
+		}
+	}
+}
+
+func TestPacketizerSamples(t *testing.T) {
+	p := NewPacketizer(1400, 8, 1, 8000, &G711Payloader{})
+	start := p.Timestamp(20 * time.Millisecond)
+	seq := p.NextSequenceNumber()
+	packets := p.Packetize(make([]byte, 2000), 20*time.Millisecond)
+	if len(packets) != 2 {
+		t.Fatalf("%d packets", len(packets))
+	}
+	// the second payload starts after the samples of the first
+	if packets[0].Timestamp != start || packets[1].Timestamp != start+uint32(len(packets[0].Payload)) {
+		t.Fatalf("timestamps %d %d from %d", packets[0].Timestamp, packets[1].Timestamp, start)
+	}
+	if packets[0].SequenceNumber != seq || packets[1].SequenceNumber != seq+1 || p.NextSequenceNumber() != seq+2 {
+		t.Fatalf("sequence numbers %d %d from %d", packets[0].SequenceNumber, packets[1].SequenceNumber, seq)
+	}
+}
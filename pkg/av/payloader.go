@@ -0,0 +1,197 @@
+package av
+
+import (
+	"encoding/binary"
+)
+
+const (
+	h264NaluTypeMask = 0x1F
+	h264NaluAUD      = 9
+	h264NaluFiller   = 12
+	h264NaluFUA      = 28
+	h264FUAHeaderLen = 2
+
+	h265NaluAUD      = 35
+	h265NaluFiller   = 38
+	h265NaluFU       = 49
+	h265FUHeaderLen  = 3
+	h265NaluHeadSize = 2
+
+	fuStartBit = 0x80
+	fuEndBit   = 0x40
+
+	aacAUHeaderSize = 2 // AU-size(13) + AU-Index(3),mpeg4-generic AAC-hbr
+)
+
+// SplitAnnexB splits an Annex-B byte stream into NAL units without start codes.
+func SplitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	i := 0
+	for i+2 < len(data) {
+		// 00 00 01 or 00 00 00 01
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			if start >= 0 {
+				end := i
+				if end > start && data[end-1] == 0 {
+					end--
+				}
+				if end > start {
+					nalus = append(nalus, data[start:end])
+				}
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start < 0 {
+		// no start code,treat the whole data as one NAL unit
+		if len(data) > 0 {
+			nalus = append(nalus, data)
+		}
+		return nalus
+	}
+	if start < len(data) {
+		nalus = append(nalus, data[start:])
+	}
+	return nalus
+}
+
+// H264Payloader RFC 6184 packetization mode 1,single NAL unit packets and
+// FU-A fragments.Data is an Annex-B access unit
+type H264Payloader struct{}
+
+func (h *H264Payloader) Payload(maxSize int, data []byte) [][]byte {
+	var payloads [][]byte
+	if maxSize <= h264FUAHeaderLen {
+		return nil
+	}
+	for _, nalu := range SplitAnnexB(data) {
+		naluType := nalu[0] & h264NaluTypeMask
+		if naluType == h264NaluAUD || naluType == h264NaluFiller {
+			continue
+		}
+		if len(nalu) <= maxSize {
+			payloads = append(payloads, append([]byte(nil), nalu...))
+			continue
+		}
+
+		/*
+		 * +---------------+---------------+
+		 * |0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|
+		 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		 * |F|NRI|  Type   |S|E|R|  Type   |
+		 * +---------------+---------------+
+		 */
+		indicator := nalu[0]&^h264NaluTypeMask | h264NaluFUA
+		rest := nalu[1:]
+		first := true
+		for len(rest) > 0 {
+			n := len(rest)
+			if n > maxSize-h264FUAHeaderLen {
+				n = maxSize - h264FUAHeaderLen
+			}
+			header := naluType
+			if first {
+				header |= fuStartBit
+				first = false
+			}
+			if n == len(rest) {
+				header |= fuEndBit
+			}
+			payload := make([]byte, h264FUAHeaderLen+n)
+			payload[0], payload[1] = indicator, header
+			copy(payload[h264FUAHeaderLen:], rest[:n])
+			payloads = append(payloads, payload)
+			rest = rest[n:]
+		}
+	}
+	return payloads
+}
+
+// H265Payloader RFC 7798,single NAL unit packets and fragmentation units.
+// Data is an Annex-B access unit
+type H265Payloader struct{}
+
+func (h *H265Payloader) Payload(maxSize int, data []byte) [][]byte {
+	var payloads [][]byte
+	if maxSize <= h265FUHeaderLen {
+		return nil
+	}
+	for _, nalu := range SplitAnnexB(data) {
+		if len(nalu) < h265NaluHeadSize {
+			continue
+		}
+		naluType := (nalu[0] >> 1) & 0x3F
+		if naluType == h265NaluAUD || naluType == h265NaluFiller {
+			continue
+		}
+		if len(nalu) <= maxSize {
+			payloads = append(payloads, append([]byte(nil), nalu...))
+			continue
+		}
+
+		/*
+		 * +---------------+---------------+---------------+
+		 * |0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|
+		 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		 * |F|   Type=49 |  LayerId  | TID |S|E|  FuType   |
+		 * +-------------+-----------------+---------------+
+		 */
+		payloadHdr0 := nalu[0]&0x81 | h265NaluFU<<1
+		payloadHdr1 := nalu[1]
+		rest := nalu[h265NaluHeadSize:]
+		first := true
+		for len(rest) > 0 {
+			n := len(rest)
+			if n > maxSize-h265FUHeaderLen {
+				n = maxSize - h265FUHeaderLen
+			}
+			header := naluType
+			if first {
+				header |= fuStartBit
+				first = false
+			}
+			if n == len(rest) {
+				header |= fuEndBit
+			}
+			payload := make([]byte, h265FUHeaderLen+n)
+			payload[0], payload[1], payload[2] = payloadHdr0, payloadHdr1, header
+			copy(payload[h265FUHeaderLen:], rest[:n])
+			payloads = append(payloads, payload)
+			rest = rest[n:]
+		}
+	}
+	return payloads
+}
+
+// AACPayloader RFC 3640 mpeg4-generic AAC-hbr mode with one access unit per
+// packet (sizelength=13;indexlength=3;indexdeltalength=3).Data is a raw AAC
+// frame without ADTS header,a frame larger than one packet is fragmented
+// with the AU-size of the whole frame in every fragment
+type AACPayloader struct{}
+
+func (a *AACPayloader) Payload(maxSize int, data []byte) [][]byte {
+	headerLen := 2 + aacAUHeaderSize
+	if maxSize <= headerLen || len(data) == 0 || len(data) >= 1<<13 {
+		return nil
+	}
+	var payloads [][]byte
+	rest := data
+	for len(rest) > 0 {
+		n := len(rest)
+		if n > maxSize-headerLen {
+			n = maxSize - headerLen
+		}
+		payload := make([]byte, headerLen+n)
+		// AU-headers-length in bits
+		binary.BigEndian.PutUint16(payload[0:2], aacAUHeaderSize*8)
+		binary.BigEndian.PutUint16(payload[2:4], uint16(len(data))<<3)
+		copy(payload[headerLen:], rest[:n])
+		payloads = append(payloads, payload)
+		rest = rest[n:]
+	}
+	return payloads
+}
@@ -0,0 +1,205 @@
+package av
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+const defaultPipelineBufferSize = 64
+
+var ErrPipelineNoSink = errors.New("pipeline: no sink")
+
+// Source produces frames,ReadFrame returns io.EOF when the stream ends
+type Source interface {
+	ReadFrame(ctx context.Context) (*Frame, error)
+}
+
+// Sink consumes frames
+type Sink interface {
+	WriteFrame(ctx context.Context, frame *Frame) error
+}
+
+// Filter transforms one frame into zero or more frames,a depacketizer
+// buffering fragments returns nil until an access unit is complete
+type Filter interface {
+	Filter(ctx context.Context, frame *Frame) ([]*Frame, error)
+}
+
+// SourceFunc adapts a function to Source
+type SourceFunc func(ctx context.Context) (*Frame, error)
+
+func (f SourceFunc) ReadFrame(ctx context.Context) (*Frame, error) {
+	return f(ctx)
+}
+
+// SinkFunc adapts a function to Sink
+type SinkFunc func(ctx context.Context, frame *Frame) error
+
+func (f SinkFunc) WriteFrame(ctx context.Context, frame *Frame) error {
+	return f(ctx, frame)
+}
+
+// FilterFunc adapts a function to Filter
+type FilterFunc func(ctx context.Context, frame *Frame) ([]*Frame, error)
+
+func (f FilterFunc) Filter(ctx context.Context, frame *Frame) ([]*Frame, error) {
+	return f(ctx, frame)
+}
+
+// Pipeline runs source -> filters -> sinks,every stage runs in its own
+// goroutine connected by bounded channels,so a slow stage blocks the stages
+// before it instead of growing memory
+type Pipeline struct {
+	// BufferSize capacity of the channel between two stages
+	BufferSize int
+
+	source  Source
+	filters []Filter
+	sinks   []Sink
+}
+
+// NewPipeline creates a pipeline reading from source.
+func NewPipeline(source Source) *Pipeline {
+	return &Pipeline{BufferSize: defaultPipelineBufferSize, source: source}
+}
+
+// Via appends a filter stage.
+func (p *Pipeline) Via(filter Filter) *Pipeline {
+	p.filters = append(p.filters, filter)
+	return p
+}
+
+// To adds sinks,every sink receives every frame output by the last filter.
+func (p *Pipeline) To(sinks ...Sink) *Pipeline {
+	p.sinks = append(p.sinks, sinks...)
+	return p
+}
+
+// pipelineRun state shared by the stage goroutines of one Run
+type pipelineRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+func (r *pipelineRun) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		r.cancel()
+	})
+}
+
+// send blocks until out accepts frame or the run is cancelled
+func (r *pipelineRun) send(out chan<- *Frame, frame *Frame) bool {
+	select {
+	case out <- frame:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// Run processes frames until the source returns io.EOF and every frame is
+// drained to the sinks,until a stage fails or until ctx is cancelled.
+// It returns nil on io.EOF,the first stage error otherwise.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if len(p.sinks) == 0 {
+		return ErrPipelineNoSink
+	}
+	size := p.BufferSize
+	if size < 0 {
+		size = 0
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &pipelineRun{ctx: runCtx, cancel: cancel}
+	var wg sync.WaitGroup
+
+	// source stage
+	out := make(chan *Frame, size)
+	wg.Add(1)
+	go func(out chan<- *Frame) {
+		defer wg.Done()
+		defer close(out)
+		for {
+			frame, err := p.source.ReadFrame(runCtx)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				run.fail(err)
+				return
+			}
+			if !run.send(out, frame) {
+				return
+			}
+		}
+	}(out)
+
+	// filter stages
+	for _, filter := range p.filters {
+		in := out
+		out = make(chan *Frame, size)
+		wg.Add(1)
+		go func(filter Filter, in <-chan *Frame, out chan<- *Frame) {
+			defer wg.Done()
+			defer close(out)
+			for frame := range in {
+				frames, err := filter.Filter(runCtx, frame)
+				if err != nil {
+					run.fail(err)
+					return
+				}
+				for _, f := range frames {
+					if !run.send(out, f) {
+						return
+					}
+				}
+			}
+		}(filter, in, out)
+	}
+
+	// sink stages,fan out the output of the last filter
+	sinkIns := make([]chan *Frame, len(p.sinks))
+	for i, sink := range p.sinks {
+		sinkIns[i] = make(chan *Frame, size)
+		wg.Add(1)
+		go func(sink Sink, in <-chan *Frame) {
+			defer wg.Done()
+			for frame := range in {
+				if runCtx.Err() != nil {
+					return
+				}
+				if err := sink.WriteFrame(runCtx, frame); err != nil {
+					run.fail(err)
+					return
+				}
+			}
+		}(sink, sinkIns[i])
+	}
+	wg.Add(1)
+	go func(in <-chan *Frame) {
+		defer wg.Done()
+		defer func() {
+			for _, sinkIn := range sinkIns {
+				close(sinkIn)
+			}
+		}()
+		for frame := range in {
+			for _, sinkIn := range sinkIns {
+				if !run.send(sinkIn, frame) {
+					return
+				}
+			}
+		}
+	}(out)
+
+	wg.Wait()
+	if run.err != nil {
+		return run.err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,535 @@
+package av
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RTCP packet types
+const (
+	RTCP_TYPE_SR    = 200 // sender report
+	RTCP_TYPE_RR    = 201 // receiver report
+	RTCP_TYPE_SDES  = 202 // source description
+	RTCP_TYPE_BYE   = 203 // goodbye
+	RTCP_TYPE_APP   = 204 // application-defined
+	RTCP_TYPE_RTPFB = 205 // transport layer feedback,RFC 4585
+	RTCP_TYPE_PSFB  = 206 // payload specific feedback,RFC 4585
+
+	RTCP_FMT_PLI = 1 // picture loss indication of RTCP_TYPE_PSFB
+
+	RTCP_HEADER_SIZE = 4
+)
+
+const (
+	rtcpVersion          = 2
+	rtcpCountMask        = 0x1F
+	rtcpReportBlockSize  = 24
+	rtcpSenderInfoSize   = 20
+	rtcpMaxCount         = 31
+	sdesTypeEnd          = 0
+	sdesTypeCNAME        = 1
+	ntpEpochOffsetSecond = 2208988800 // seconds between 1900-01-01 and 1970-01-01
+)
+
+var (
+	errRtcpBadVersion = errors.New("rtcp: bad version")
+	errRtcpTruncated  = errors.New("rtcp: packet truncated")
+	errRtcpWrongType  = errors.New("rtcp: wrong packet type")
+	errRtcpTooMany    = errors.New("rtcp: too many reports or chunks")
+)
+
+// RtcpPacket is implemented by every RTCP packet type
+type RtcpPacket interface {
+	Marshal() ([]byte, error)
+	Unmarshal(buf []byte) error
+}
+
+// RtcpHeader is the common header of every RTCP packet
+type RtcpHeader struct {
+	Padding bool
+	Count   uint8 // report count, source count or subtype
+	Type    uint8
+	Length  uint16 // length in 32-bit words minus one
+}
+
+// Unmarshal parses the 4 bytes common header.
+func (h *RtcpHeader) Unmarshal(buf []byte) error {
+	/*
+	 *  0                   1                   2                   3
+	 *  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |V=2|P|    RC   |      PT       |             length            |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 */
+	if len(buf) < RTCP_HEADER_SIZE {
+		return errRtcpTruncated
+	}
+	if buf[0]>>versionShift != rtcpVersion {
+		return errRtcpBadVersion
+	}
+	h.Padding = (buf[0]>>paddingShift)&paddingMask > 0
+	h.Count = buf[0] & rtcpCountMask
+	h.Type = buf[1]
+	h.Length = binary.BigEndian.Uint16(buf[2:4])
+	return nil
+}
+
+// MarshalTo writes the 4 bytes common header to buf.
+func (h *RtcpHeader) MarshalTo(buf []byte) error {
+	if len(buf) < RTCP_HEADER_SIZE {
+		return io.ErrShortBuffer
+	}
+	if h.Count > rtcpMaxCount {
+		return errRtcpTooMany
+	}
+	buf[0] = rtcpVersion<<versionShift | h.Count
+	if h.Padding {
+		buf[0] |= 1 << paddingShift
+	}
+	buf[1] = h.Type
+	binary.BigEndian.PutUint16(buf[2:4], h.Length)
+	return nil
+}
+
+// RtcpReceptionReport is one report block of SR/RR
+type RtcpReceptionReport struct {
+	SSRC               uint32 `json:"ssrc"`
+	FractionLost       uint8  `json:"fractionLost"`
+	TotalLost          uint32 `json:"totalLost"`          // 24 bits
+	LastSequenceNumber uint32 `json:"lastSequenceNumber"` // extended highest sequence number received
+	Jitter             uint32 `json:"jitter"`
+	LastSenderReport   uint32 `json:"lastSenderReport"` // middle 32 bits of the NTP timestamp of last SR
+	Delay              uint32 `json:"delay"`            // delay since last SR, 1/65536 seconds
+}
+
+func (r *RtcpReceptionReport) marshalTo(buf []byte) {
+	binary.BigEndian.PutUint32(buf[0:4], r.SSRC)
+	binary.BigEndian.PutUint32(buf[4:8], r.TotalLost&0xFFFFFF)
+	buf[4] = r.FractionLost
+	binary.BigEndian.PutUint32(buf[8:12], r.LastSequenceNumber)
+	binary.BigEndian.PutUint32(buf[12:16], r.Jitter)
+	binary.BigEndian.PutUint32(buf[16:20], r.LastSenderReport)
+	binary.BigEndian.PutUint32(buf[20:24], r.Delay)
+}
+
+func (r *RtcpReceptionReport) unmarshal(buf []byte) {
+	r.SSRC = binary.BigEndian.Uint32(buf[0:4])
+	r.FractionLost = buf[4]
+	r.TotalLost = binary.BigEndian.Uint32(buf[4:8]) & 0xFFFFFF
+	r.LastSequenceNumber = binary.BigEndian.Uint32(buf[8:12])
+	r.Jitter = binary.BigEndian.Uint32(buf[12:16])
+	r.LastSenderReport = binary.BigEndian.Uint32(buf[16:20])
+	r.Delay = binary.BigEndian.Uint32(buf[20:24])
+}
+
+// RtcpSenderReport RFC3550 6.4.1
+type RtcpSenderReport struct {
+	SSRC        uint32                `json:"ssrc"`
+	NTPTime     uint64                `json:"ntpTime"`
+	RTPTime     uint32                `json:"rtpTime"`
+	PacketCount uint32                `json:"packetCount"`
+	OctetCount  uint32                `json:"octetCount"`
+	Reports     []RtcpReceptionReport `json:"reports,omitempty"`
+}
+
+// Marshal serializes the sender report into bytes.
+func (sr *RtcpSenderReport) Marshal() ([]byte, error) {
+	/*
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |V=2|P|    RC   |   PT=SR=200   |             length            |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |                         SSRC of sender                        |
+	 * +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+	 * |              NTP timestamp, most significant word             |
+	 * |             NTP timestamp, least significant word             |
+	 * |                         RTP timestamp                         |
+	 * |                     sender's packet count                     |
+	 * |                      sender's octet count                     |
+	 * +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+	 * |                 report blocks ...                             |
+	 */
+	if len(sr.Reports) > rtcpMaxCount {
+		return nil, errRtcpTooMany
+	}
+	size := RTCP_HEADER_SIZE + 4 + rtcpSenderInfoSize + len(sr.Reports)*rtcpReportBlockSize
+	buf := make([]byte, size)
+	h := RtcpHeader{Count: uint8(len(sr.Reports)), Type: RTCP_TYPE_SR, Length: uint16(size/4 - 1)}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(buf[4:8], sr.SSRC)
+	binary.BigEndian.PutUint64(buf[8:16], sr.NTPTime)
+	binary.BigEndian.PutUint32(buf[16:20], sr.RTPTime)
+	binary.BigEndian.PutUint32(buf[20:24], sr.PacketCount)
+	binary.BigEndian.PutUint32(buf[24:28], sr.OctetCount)
+	n := 28
+	for i := range sr.Reports {
+		sr.Reports[i].marshalTo(buf[n:])
+		n += rtcpReportBlockSize
+	}
+	return buf, nil
+}
+
+// Unmarshal parses a single sender report packet.
+func (sr *RtcpSenderReport) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_SR {
+		return errRtcpWrongType
+	}
+	if len(buf) < RTCP_HEADER_SIZE+4+rtcpSenderInfoSize+int(h.Count)*rtcpReportBlockSize {
+		return errRtcpTruncated
+	}
+	sr.SSRC = binary.BigEndian.Uint32(buf[4:8])
+	sr.NTPTime = binary.BigEndian.Uint64(buf[8:16])
+	sr.RTPTime = binary.BigEndian.Uint32(buf[16:20])
+	sr.PacketCount = binary.BigEndian.Uint32(buf[20:24])
+	sr.OctetCount = binary.BigEndian.Uint32(buf[24:28])
+	sr.Reports = make([]RtcpReceptionReport, h.Count)
+	n := 28
+	for i := range sr.Reports {
+		sr.Reports[i].unmarshal(buf[n:])
+		n += rtcpReportBlockSize
+	}
+	return nil
+}
+
+// RtcpReceiverReport RFC3550 6.4.2
+type RtcpReceiverReport struct {
+	SSRC    uint32                `json:"ssrc"`
+	Reports []RtcpReceptionReport `json:"reports,omitempty"`
+}
+
+// Marshal serializes the receiver report into bytes.
+func (rr *RtcpReceiverReport) Marshal() ([]byte, error) {
+	if len(rr.Reports) > rtcpMaxCount {
+		return nil, errRtcpTooMany
+	}
+	size := RTCP_HEADER_SIZE + 4 + len(rr.Reports)*rtcpReportBlockSize
+	buf := make([]byte, size)
+	h := RtcpHeader{Count: uint8(len(rr.Reports)), Type: RTCP_TYPE_RR, Length: uint16(size/4 - 1)}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(buf[4:8], rr.SSRC)
+	n := 8
+	for i := range rr.Reports {
+		rr.Reports[i].marshalTo(buf[n:])
+		n += rtcpReportBlockSize
+	}
+	return buf, nil
+}
+
+// Unmarshal parses a single receiver report packet.
+func (rr *RtcpReceiverReport) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_RR {
+		return errRtcpWrongType
+	}
+	if len(buf) < RTCP_HEADER_SIZE+4+int(h.Count)*rtcpReportBlockSize {
+		return errRtcpTruncated
+	}
+	rr.SSRC = binary.BigEndian.Uint32(buf[4:8])
+	rr.Reports = make([]RtcpReceptionReport, h.Count)
+	n := 8
+	for i := range rr.Reports {
+		rr.Reports[i].unmarshal(buf[n:])
+		n += rtcpReportBlockSize
+	}
+	return nil
+}
+
+// RtcpSourceDescription RFC3550 6.5,only CNAME item is kept
+type RtcpSourceDescription struct {
+	Chunks []RtcpSdesChunk `json:"chunks"`
+}
+
+// RtcpSdesChunk one SSRC with its CNAME
+type RtcpSdesChunk struct {
+	SSRC  uint32 `json:"ssrc"`
+	CNAME string `json:"cname"`
+}
+
+// Marshal serializes the source description into bytes.
+func (sd *RtcpSourceDescription) Marshal() ([]byte, error) {
+	if len(sd.Chunks) > rtcpMaxCount {
+		return nil, errRtcpTooMany
+	}
+	size := RTCP_HEADER_SIZE
+	for _, c := range sd.Chunks {
+		if len(c.CNAME) > 255 {
+			return nil, fmt.Errorf("rtcp: cname too long:%d", len(c.CNAME))
+		}
+		// ssrc + type + len + text + end, padded to 32 bits
+		size += (4 + 2 + len(c.CNAME) + 1 + 3) / 4 * 4
+	}
+	buf := make([]byte, size)
+	h := RtcpHeader{Count: uint8(len(sd.Chunks)), Type: RTCP_TYPE_SDES, Length: uint16(size/4 - 1)}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	n := RTCP_HEADER_SIZE
+	for _, c := range sd.Chunks {
+		start := n
+		binary.BigEndian.PutUint32(buf[n:], c.SSRC)
+		buf[n+4] = sdesTypeCNAME
+		buf[n+5] = uint8(len(c.CNAME))
+		copy(buf[n+6:], c.CNAME)
+		// the remaining bytes are already zero:end item and padding
+		n = start + (4+2+len(c.CNAME)+1+3)/4*4
+	}
+	return buf, nil
+}
+
+// Unmarshal parses a single source description packet.
+func (sd *RtcpSourceDescription) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_SDES {
+		return errRtcpWrongType
+	}
+	end := RTCP_HEADER_SIZE + int(h.Length)*4
+	if len(buf) < end {
+		return errRtcpTruncated
+	}
+	sd.Chunks = sd.Chunks[:0]
+	n := RTCP_HEADER_SIZE
+	for i := 0; i < int(h.Count); i++ {
+		if n+4 > end {
+			return errRtcpTruncated
+		}
+		chunk := RtcpSdesChunk{SSRC: binary.BigEndian.Uint32(buf[n:])}
+		n += 4
+		for {
+			if n >= end {
+				return errRtcpTruncated
+			}
+			if buf[n] == sdesTypeEnd {
+				// skip end item and padding up to the next 32 bits boundary
+				n = (n + 4) / 4 * 4
+				break
+			}
+			if n+2 > end || n+2+int(buf[n+1]) > end {
+				return errRtcpTruncated
+			}
+			itemType, itemLen := buf[n], int(buf[n+1])
+			if itemType == sdesTypeCNAME {
+				chunk.CNAME = string(buf[n+2 : n+2+itemLen])
+			}
+			n += 2 + itemLen
+		}
+		sd.Chunks = append(sd.Chunks, chunk)
+	}
+	return nil
+}
+
+// RtcpGoodbye RFC3550 6.6
+type RtcpGoodbye struct {
+	Sources []uint32 `json:"sources"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// Marshal serializes the goodbye into bytes.
+func (bye *RtcpGoodbye) Marshal() ([]byte, error) {
+	if len(bye.Sources) > rtcpMaxCount {
+		return nil, errRtcpTooMany
+	}
+	if len(bye.Reason) > 255 {
+		return nil, fmt.Errorf("rtcp: bye reason too long:%d", len(bye.Reason))
+	}
+	size := RTCP_HEADER_SIZE + len(bye.Sources)*4
+	if len(bye.Reason) > 0 {
+		size += (1 + len(bye.Reason) + 3) / 4 * 4
+	}
+	buf := make([]byte, size)
+	h := RtcpHeader{Count: uint8(len(bye.Sources)), Type: RTCP_TYPE_BYE, Length: uint16(size/4 - 1)}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	n := RTCP_HEADER_SIZE
+	for _, ssrc := range bye.Sources {
+		binary.BigEndian.PutUint32(buf[n:], ssrc)
+		n += 4
+	}
+	if len(bye.Reason) > 0 {
+		buf[n] = uint8(len(bye.Reason))
+		copy(buf[n+1:], bye.Reason)
+	}
+	return buf, nil
+}
+
+// Unmarshal parses a single goodbye packet.
+func (bye *RtcpGoodbye) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_BYE {
+		return errRtcpWrongType
+	}
+	end := RTCP_HEADER_SIZE + int(h.Length)*4
+	if len(buf) < end || end < RTCP_HEADER_SIZE+int(h.Count)*4 {
+		return errRtcpTruncated
+	}
+	bye.Sources = make([]uint32, h.Count)
+	n := RTCP_HEADER_SIZE
+	for i := range bye.Sources {
+		bye.Sources[i] = binary.BigEndian.Uint32(buf[n:])
+		n += 4
+	}
+	bye.Reason = ""
+	if n < end {
+		reasonLen := int(buf[n])
+		if n+1+reasonLen > end {
+			return errRtcpTruncated
+		}
+		bye.Reason = string(buf[n+1 : n+1+reasonLen])
+	}
+	return nil
+}
+
+// RtcpPictureLossIndication asks the sender of MediaSSRC for a keyframe,
+// RFC 4585 6.3.1
+type RtcpPictureLossIndication struct {
+	SenderSSRC uint32 `json:"senderSsrc"`
+	MediaSSRC  uint32 `json:"mediaSsrc"`
+}
+
+// Marshal serializes the picture loss indication into bytes.
+func (pli *RtcpPictureLossIndication) Marshal() ([]byte, error) {
+	buf := make([]byte, RTCP_HEADER_SIZE+8)
+	h := RtcpHeader{Count: RTCP_FMT_PLI, Type: RTCP_TYPE_PSFB, Length: 2}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(buf[4:8], pli.SenderSSRC)
+	binary.BigEndian.PutUint32(buf[8:12], pli.MediaSSRC)
+	return buf, nil
+}
+
+// Unmarshal parses a single picture loss indication.
+func (pli *RtcpPictureLossIndication) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_PSFB || h.Count != RTCP_FMT_PLI {
+		return errRtcpWrongType
+	}
+	if h.Length < 2 || len(buf) < RTCP_HEADER_SIZE+8 {
+		return errRtcpTruncated
+	}
+	pli.SenderSSRC = binary.BigEndian.Uint32(buf[4:8])
+	pli.MediaSSRC = binary.BigEndian.Uint32(buf[8:12])
+	return nil
+}
+
+// RtcpRawPacket keeps a packet of a type which is not parsed
+type RtcpRawPacket struct {
+	RtcpHeader
+	Data []byte // whole packet including the header
+}
+
+// Marshal returns the raw packet bytes.
+func (raw *RtcpRawPacket) Marshal() ([]byte, error) {
+	return raw.Data, nil
+}
+
+// Unmarshal keeps the passed packet bytes.
+func (raw *RtcpRawPacket) Unmarshal(buf []byte) error {
+	if err := raw.RtcpHeader.Unmarshal(buf); err != nil {
+		return err
+	}
+	raw.Data = buf
+	return nil
+}
+
+// UnmarshalRtcp parses a compound RTCP packet into its individual packets.
+func UnmarshalRtcp(buf []byte) ([]RtcpPacket, error) {
+	var packets []RtcpPacket
+	for len(buf) > 0 {
+		var h RtcpHeader
+		if err := h.Unmarshal(buf); err != nil {
+			return nil, err
+		}
+		size := (int(h.Length) + 1) * 4
+		if size > len(buf) {
+			return nil, errRtcpTruncated
+		}
+
+		var packet RtcpPacket
+		switch h.Type {
+		case RTCP_TYPE_SR:
+			packet = &RtcpSenderReport{}
+		case RTCP_TYPE_RR:
+			packet = &RtcpReceiverReport{}
+		case RTCP_TYPE_SDES:
+			packet = &RtcpSourceDescription{}
+		case RTCP_TYPE_BYE:
+			packet = &RtcpGoodbye{}
+		case RTCP_TYPE_RTPFB:
+			if h.Count == RTCP_FMT_TRANSPORT_CC {
+				packet = &RtcpTransportFeedback{}
+			} else {
+				packet = &RtcpRawPacket{}
+			}
+		case RTCP_TYPE_PSFB:
+			if h.Count == RTCP_FMT_PLI {
+				packet = &RtcpPictureLossIndication{}
+			} else {
+				packet = &RtcpRawPacket{}
+			}
+		default:
+			packet = &RtcpRawPacket{}
+		}
+		if err := packet.Unmarshal(buf[:size]); err != nil {
+			return nil, err
+		}
+		packets = append(packets, packet)
+		buf = buf[size:]
+	}
+	return packets, nil
+}
+
+// MarshalRtcp serializes packets into one compound RTCP packet.
+func MarshalRtcp(packets ...RtcpPacket) ([]byte, error) {
+	var out []byte
+	for _, p := range packets {
+		buf, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf...)
+	}
+	return out, nil
+}
+
+// IsRtcp reports whether buf looks like an RTCP packet rather than RTP when
+// both are multiplexed on one transport (RFC 5761 4).
+func IsRtcp(buf []byte) bool {
+	return len(buf) >= RTCP_HEADER_SIZE && buf[1] >= 192 && buf[1] <= 223
+}
+
+// NtpTime converts t to a 64 bits NTP timestamp.
+func NtpTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffsetSecond)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+// NtpToTime converts a 64 bits NTP timestamp to time.Time.
+func NtpToTime(ntp uint64) time.Time {
+	sec := int64(ntp>>32) - ntpEpochOffsetSecond
+	nsec := int64((ntp & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
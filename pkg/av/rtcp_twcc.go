@@ -0,0 +1,267 @@
+package av
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	RTCP_FMT_TRANSPORT_CC = 15 // transport-wide congestion control feedback
+
+	// TWCC_EXTENSION_URI the header extension carrying the 16 bits
+	// transport-wide sequence number
+	TWCC_EXTENSION_URI = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+
+	TwccDeltaUnit         = 250 * time.Microsecond
+	TwccReferenceTimeUnit = 64 * time.Millisecond
+)
+
+const (
+	twccSymbolNotReceived = 0
+	twccSymbolSmallDelta  = 1
+	twccSymbolLargeDelta  = 2
+
+	twccFixedSize      = 20 // header,two ssrc,base,count,reference time,fb count
+	twccRunLengthMax   = 0x1FFF
+	twccOneBitSymbols  = 14
+	twccTwoBitSymbols  = 7
+	twccChunkVectorBit = 0x8000
+	twccChunkTwoBitBit = 0x4000
+)
+
+// TwccPacketStatus the reception of one transport-wide sequence number
+type TwccPacketStatus struct {
+	SequenceNumber uint16 `json:"sequenceNumber"`
+	Received       bool   `json:"received"`
+	// Delta arrival time from the previous received packet of the feedback,
+	// for the first one from the reference time.A multiple of TwccDeltaUnit
+	Delta time.Duration `json:"delta,omitempty"`
+}
+
+// RtcpTransportFeedback transport-wide congestion control feedback,
+// draft-holmer-rmcat-transport-wide-cc-extensions-01 3.1
+type RtcpTransportFeedback struct {
+	SenderSSRC         uint32             `json:"senderSsrc"`
+	MediaSSRC          uint32             `json:"mediaSsrc"`
+	BaseSequenceNumber uint16             `json:"baseSequenceNumber"`
+	ReferenceTime      uint32             `json:"referenceTime"` // 24 bits,in TwccReferenceTimeUnit
+	FbPktCount         uint8              `json:"fbPktCount"`
+	Packets            []TwccPacketStatus `json:"packets"`
+}
+
+// twccSymbol returns the status symbol of p and its delta in TwccDeltaUnit
+func twccSymbol(p *TwccPacketStatus) (uint8, int64, error) {
+	if !p.Received {
+		return twccSymbolNotReceived, 0, nil
+	}
+	units := int64(p.Delta / TwccDeltaUnit)
+	switch {
+	case units >= 0 && units <= 0xFF:
+		return twccSymbolSmallDelta, units, nil
+	case units >= -0x8000 && units <= 0x7FFF:
+		return twccSymbolLargeDelta, units, nil
+	}
+	return 0, 0, fmt.Errorf("rtcp: twcc delta %v of %d out of range", p.Delta, p.SequenceNumber)
+}
+
+// encodeTwccChunks encodes the status symbols as run length chunks for long
+// runs and status vector chunks otherwise
+func encodeTwccChunks(symbols []uint8) []uint16 {
+	var chunks []uint16
+	for i := 0; i < len(symbols); {
+		run := 1
+		for i+run < len(symbols) && symbols[i+run] == symbols[i] && run < twccRunLengthMax {
+			run++
+		}
+		if run >= twccOneBitSymbols {
+			chunks = append(chunks, uint16(symbols[i])<<13|uint16(run))
+			i += run
+			continue
+		}
+
+		oneBit := true
+		for j := i; j < i+twccOneBitSymbols && j < len(symbols); j++ {
+			if symbols[j] > twccSymbolSmallDelta {
+				oneBit = false
+				break
+			}
+		}
+		chunk := uint16(twccChunkVectorBit)
+		if oneBit {
+			for j := 0; j < twccOneBitSymbols && i < len(symbols); j++ {
+				chunk |= uint16(symbols[i]) << (13 - j)
+				i++
+			}
+		} else {
+			chunk |= twccChunkTwoBitBit
+			for j := 0; j < twccTwoBitSymbols && i < len(symbols); j++ {
+				chunk |= uint16(symbols[i]) << (12 - 2*j)
+				i++
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// Marshal serializes the feedback into bytes.
+func (fb *RtcpTransportFeedback) Marshal() ([]byte, error) {
+	/*
+	 *  0                   1                   2                   3
+	 *  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |V=2|P|  FMT=15 |    PT=205     |           length              |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |                     SSRC of packet sender                     |
+	 * |                      SSRC of media source                     |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |      base sequence number     |      packet status count      |
+	 * |                 reference time                | fb pkt. count |
+	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	 * |          packet chunk         |  packet chunk  ...            |
+	 * |         recv delta            |  recv delta    ...            |
+	 */
+	if len(fb.Packets) > 0xFFFF {
+		return nil, fmt.Errorf("rtcp: too many twcc packets:%d", len(fb.Packets))
+	}
+	symbols := make([]uint8, len(fb.Packets))
+	var deltas []byte
+	for i := range fb.Packets {
+		symbol, units, err := twccSymbol(&fb.Packets[i])
+		if err != nil {
+			return nil, err
+		}
+		symbols[i] = symbol
+		switch symbol {
+		case twccSymbolSmallDelta:
+			deltas = append(deltas, byte(units))
+		case twccSymbolLargeDelta:
+			deltas = binary.BigEndian.AppendUint16(deltas, uint16(int16(units)))
+		}
+	}
+	chunks := encodeTwccChunks(symbols)
+
+	size := twccFixedSize + 2*len(chunks) + len(deltas)
+	padding := (4 - size%4) % 4
+	buf := make([]byte, size+padding)
+	h := RtcpHeader{
+		Padding: padding > 0,
+		Count:   RTCP_FMT_TRANSPORT_CC,
+		Type:    RTCP_TYPE_RTPFB,
+		Length:  uint16((size+padding)/4 - 1),
+	}
+	if err := h.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(buf[4:8], fb.SenderSSRC)
+	binary.BigEndian.PutUint32(buf[8:12], fb.MediaSSRC)
+	binary.BigEndian.PutUint16(buf[12:14], fb.BaseSequenceNumber)
+	binary.BigEndian.PutUint16(buf[14:16], uint16(len(fb.Packets)))
+	binary.BigEndian.PutUint32(buf[16:20], fb.ReferenceTime<<8|uint32(fb.FbPktCount))
+	n := twccFixedSize
+	for _, chunk := range chunks {
+		binary.BigEndian.PutUint16(buf[n:], chunk)
+		n += 2
+	}
+	copy(buf[n:], deltas)
+	if padding > 0 {
+		buf[len(buf)-1] = byte(padding)
+	}
+	return buf, nil
+}
+
+// Unmarshal parses a transport-wide feedback packet.
+func (fb *RtcpTransportFeedback) Unmarshal(buf []byte) error {
+	var h RtcpHeader
+	if err := h.Unmarshal(buf); err != nil {
+		return err
+	}
+	if h.Type != RTCP_TYPE_RTPFB || h.Count != RTCP_FMT_TRANSPORT_CC {
+		return errRtcpWrongType
+	}
+	end := (int(h.Length) + 1) * 4
+	if len(buf) < end || end < twccFixedSize {
+		return errRtcpTruncated
+	}
+	if h.Padding {
+		padding := int(buf[end-1])
+		if padding == 0 || end-padding < twccFixedSize {
+			return errRtcpTruncated
+		}
+		end -= padding
+	}
+
+	fb.SenderSSRC = binary.BigEndian.Uint32(buf[4:8])
+	fb.MediaSSRC = binary.BigEndian.Uint32(buf[8:12])
+	fb.BaseSequenceNumber = binary.BigEndian.Uint16(buf[12:14])
+	count := int(binary.BigEndian.Uint16(buf[14:16]))
+	fb.ReferenceTime = binary.BigEndian.Uint32(buf[16:20]) >> 8
+	fb.FbPktCount = buf[19]
+
+	symbols := make([]uint8, 0, count)
+	n := twccFixedSize
+	for len(symbols) < count {
+		if n+2 > end {
+			return errRtcpTruncated
+		}
+		chunk := binary.BigEndian.Uint16(buf[n:])
+		n += 2
+		switch {
+		case chunk&twccChunkVectorBit == 0:
+			symbol := uint8(chunk >> 13 & 0x03)
+			for run := int(chunk & twccRunLengthMax); run > 0 && len(symbols) < count; run-- {
+				symbols = append(symbols, symbol)
+			}
+		case chunk&twccChunkTwoBitBit == 0:
+			for j := 0; j < twccOneBitSymbols && len(symbols) < count; j++ {
+				symbols = append(symbols, uint8(chunk>>(13-j)&0x01))
+			}
+		default:
+			for j := 0; j < twccTwoBitSymbols && len(symbols) < count; j++ {
+				symbols = append(symbols, uint8(chunk>>(12-2*j)&0x03))
+			}
+		}
+	}
+
+	fb.Packets = make([]TwccPacketStatus, count)
+	for i, symbol := range symbols {
+		p := &fb.Packets[i]
+		p.SequenceNumber = fb.BaseSequenceNumber + uint16(i)
+		switch symbol {
+		case twccSymbolNotReceived:
+		case twccSymbolSmallDelta:
+			if n+1 > end {
+				return errRtcpTruncated
+			}
+			p.Received = true
+			p.Delta = time.Duration(buf[n]) * TwccDeltaUnit
+			n++
+		case twccSymbolLargeDelta:
+			if n+2 > end {
+				return errRtcpTruncated
+			}
+			p.Received = true
+			p.Delta = time.Duration(int16(binary.BigEndian.Uint16(buf[n:]))) * TwccDeltaUnit
+			n += 2
+		default:
+			return fmt.Errorf("rtcp: reserved twcc status symbol at %d", p.SequenceNumber)
+		}
+	}
+	return nil
+}
+
+// ArrivalTimes returns the arrival time of each received packet relative to
+// the origin of the receiver clock,keyed by transport-wide sequence number.
+func (fb *RtcpTransportFeedback) ArrivalTimes() map[uint16]time.Duration {
+	arrivals := make(map[uint16]time.Duration, len(fb.Packets))
+	t := time.Duration(fb.ReferenceTime) * TwccReferenceTimeUnit
+	for _, p := range fb.Packets {
+		if !p.Received {
+			continue
+		}
+		t += p.Delta
+		arrivals[p.SequenceNumber] = t
+	}
+	return arrivals
+}
@@ -7,6 +7,13 @@ import (
 	"io"
 )
 
+var (
+	ErrBadVersion         = errors.New("rtp: bad version")
+	ErrBadPadding         = errors.New("rtp: bad padding")
+	ErrTruncatedHeader    = errors.New("rtp: truncated header")
+	ErrTruncatedExtension = errors.New("rtp: truncated header extension")
+)
+
 // Extension RTP Header extension
 type RtpExtension struct {
 	id      uint8
@@ -37,6 +44,7 @@ type RtpPacket struct {
 
 const (
 	RTP_HEADER_SIZE         = 12
+	RTP_VERSION             = 2
 	headerLength            = 4
 	versionShift            = 6
 	versionMask             = 0x03
@@ -65,7 +73,7 @@ const (
 // It returns the number of bytes read n and any error.
 func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 	if len(buf) < headerLength {
-		return 0, fmt.Errorf("Rtp header size insufficient:%d < %d", len(buf), headerLength)
+		return 0, fmt.Errorf("%w:%d < %d", ErrTruncatedHeader, len(buf), headerLength)
 	}
 
 	/*
@@ -95,7 +103,7 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 
 	n = csrcOffset + (nCSRC * csrcLength)
 	if len(buf) < n {
-		return n, fmt.Errorf("Rtp header size insufficient:%d < %d", len(buf), n)
+		return n, fmt.Errorf("%w:%d < %d", ErrTruncatedHeader, len(buf), n)
 	}
 
 	h.Marker = (buf[1] >> markerShift & markerMask) > 0
@@ -113,10 +121,11 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 	if h.Extensions != nil {
 		h.Extensions = h.Extensions[:0]
 	}
+	h.ExtensionProfile = 0
 
 	if h.Extension {
 		if expected := n + 4; len(buf) < expected {
-			return n, fmt.Errorf("RTP header insufficient size for extension:%d < %d", len(buf), expected)
+			return n, fmt.Errorf("%w:%d < %d", ErrTruncatedExtension, len(buf), expected)
 		}
 
 		h.ExtensionProfile = binary.BigEndian.Uint16(buf[n:])
@@ -125,7 +134,7 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 		n += 2
 
 		if expected := n + extensionLength; len(buf) < expected {
-			return n, fmt.Errorf("RTP header insufficient size for extension:%d < %d", len(buf), expected)
+			return n, fmt.Errorf("%w:%d < %d", ErrTruncatedExtension, len(buf), expected)
 		}
 
 		switch h.ExtensionProfile {
@@ -143,8 +152,12 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 				n++
 
 				if extid == extensionIDReserved {
+					// stop parsing,the rest of the extension is ignored
 					break
 				}
+				if n+len > end {
+					return n, fmt.Errorf("%w:element %d overflows %d", ErrTruncatedExtension, extid, end)
+				}
 
 				extension := RtpExtension{
 					id:      extid,
@@ -152,6 +165,7 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 				h.Extensions = append(h.Extensions, extension)
 				n += len
 			}
+			n = end
 
 		// RFC 8285 RTP Two Byte Header Extension
 		case extensionProfileTwoByte:
@@ -165,9 +179,15 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 				extid := buf[n]
 				n++
 
+				if n >= end {
+					return n, fmt.Errorf("%w:element %d has no length", ErrTruncatedExtension, extid)
+				}
 				len := int(buf[n])
 				n++
 
+				if n+len > end {
+					return n, fmt.Errorf("%w:element %d overflows %d", ErrTruncatedExtension, extid, end)
+				}
 				extension := RtpExtension{
 					id:      extid,
 					payload: buf[n : n+len]}
@@ -177,7 +197,7 @@ func (h *RtpHeader) Unmarshal(buf []byte) (n int, err error) { //nolint:gocognit
 
 		default: // RFC3550 Extension
 			if len(buf) < n+extensionLength {
-				return n, fmt.Errorf("RTP header insufficient size for extension:%d < %d", len(buf), n+extensionLength)
+				return n, fmt.Errorf("%w:%d < %d", ErrTruncatedExtension, len(buf), n+extensionLength)
 			}
 
 			extension := RtpExtension{
@@ -210,7 +230,9 @@ func (h *RtpHeader) MarshalSize() int {
 				extSize += 2 + len(extension.payload)
 			}
 		default:
-			extSize += len(h.Extensions[0].payload)
+			if len(h.Extensions) > 0 {
+				extSize += len(h.Extensions[0].payload)
+			}
 		}
 
 		// extensions size must have 4 bytes boundaries
@@ -236,10 +258,16 @@ func (h *RtpHeader) MarshalTo(buf []byte) (n int, err error) {
 	 * +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 	 */
 
+	if err := h.validateExtensions(); err != nil {
+		return 0, err
+	}
 	size := h.MarshalSize()
 	if size > len(buf) {
 		return 0, io.ErrShortBuffer
 	}
+	if len(h.CSRC) > ccMask {
+		return 0, fmt.Errorf("rtp: too many csrc:%d", len(h.CSRC))
+	}
 
 	// The first byte contains the version, padding bit, extension bit,
 	// and csrc size.
@@ -292,12 +320,9 @@ func (h *RtpHeader) MarshalTo(buf []byte) (n int, err error) {
 				n += copy(buf[n:], extension.payload)
 			}
 		default: // RFC3550 Extension
-			extlen := len(h.Extensions[0].payload)
-			if extlen%4 != 0 {
-				// the payload must be in 32-bit words.
-				return 0, io.ErrShortBuffer
+			if len(h.Extensions) > 0 {
+				n += copy(buf[n:], h.Extensions[0].payload)
 			}
-			n += copy(buf[n:], h.Extensions[0].payload)
 		}
 
 		// calculate extensions size and round to 4 bytes boundaries
@@ -316,6 +341,118 @@ func (h *RtpHeader) MarshalTo(buf []byte) (n int, err error) {
 	return n, nil
 }
 
+// validateExtensions checks the extensions can be encoded with the profile,
+// so that MarshalTo never writes an element it can not represent
+func (h *RtpHeader) validateExtensions() error {
+	if !h.Extension {
+		return nil
+	}
+	switch h.ExtensionProfile {
+	case extensionProfileOneByte:
+		for _, extension := range h.Extensions {
+			if extension.id == 0 || extension.id >= extensionIDReserved {
+				return fmt.Errorf("rtp: invalid one byte extension id %d", extension.id)
+			}
+			if len(extension.payload) == 0 || len(extension.payload) > 16 {
+				return fmt.Errorf("rtp: invalid one byte extension %d size %d", extension.id, len(extension.payload))
+			}
+		}
+	case extensionProfileTwoByte:
+		for _, extension := range h.Extensions {
+			if extension.id == 0 {
+				return errors.New("rtp: invalid two byte extension id 0")
+			}
+			if len(extension.payload) > 255 {
+				return fmt.Errorf("rtp: invalid two byte extension %d size %d", extension.id, len(extension.payload))
+			}
+		}
+	default:
+		if len(h.Extensions) > 1 {
+			return fmt.Errorf("rtp: %d extensions with profile %#x", len(h.Extensions), h.ExtensionProfile)
+		}
+		if len(h.Extensions) == 1 && len(h.Extensions[0].payload)%4 != 0 {
+			// the payload must be in 32-bit words.
+			return fmt.Errorf("rtp: extension size %d is not 32-bit words", len(h.Extensions[0].payload))
+		}
+	}
+	return nil
+}
+
+// ID returns the id of the extension,0 for an RFC 3550 extension.
+func (e RtpExtension) ID() uint8 {
+	return e.id
+}
+
+// Payload returns the data of the extension.
+func (e RtpExtension) Payload() []byte {
+	return e.payload
+}
+
+// GetExtension returns the payload of the RFC 8285 extension id,nil when the
+// header does not carry it.
+func (h *RtpHeader) GetExtension(id uint8) []byte {
+	if !h.Extension || id == 0 {
+		return nil
+	}
+	for _, extension := range h.Extensions {
+		if extension.id == id {
+			return extension.payload
+		}
+	}
+	return nil
+}
+
+// SetExtension sets the payload of the RFC 8285 extension id.The one byte
+// profile is used while every element fits in it,otherwise the two byte one.
+func (h *RtpHeader) SetExtension(id uint8, payload []byte) error {
+	if id == 0 || len(payload) > 255 {
+		return fmt.Errorf("rtp: invalid extension %d size %d", id, len(payload))
+	}
+	fitsOneByte := id < extensionIDReserved && len(payload) > 0 && len(payload) <= 16
+	if h.Extension {
+		switch h.ExtensionProfile {
+		case extensionProfileOneByte:
+			if !fitsOneByte {
+				// every one byte element is a valid two byte element
+				h.ExtensionProfile = extensionProfileTwoByte
+			}
+		case extensionProfileTwoByte:
+		default:
+			return fmt.Errorf("rtp: can not set extension %d with profile %#x", id, h.ExtensionProfile)
+		}
+	} else {
+		h.Extension = true
+		h.Extensions = h.Extensions[:0]
+		h.ExtensionProfile = extensionProfileTwoByte
+		if fitsOneByte {
+			h.ExtensionProfile = extensionProfileOneByte
+		}
+	}
+
+	for i := range h.Extensions {
+		if h.Extensions[i].id == id {
+			h.Extensions[i].payload = payload
+			return nil
+		}
+	}
+	h.Extensions = append(h.Extensions, RtpExtension{id: id, payload: payload})
+	return nil
+}
+
+// DelExtension removes the RFC 8285 extension id.
+func (h *RtpHeader) DelExtension(id uint8) {
+	for i := range h.Extensions {
+		if h.Extensions[i].id == id {
+			h.Extensions = append(h.Extensions[:i], h.Extensions[i+1:]...)
+			break
+		}
+	}
+	if h.Extension && len(h.Extensions) == 0 {
+		h.Extension = false
+		h.ExtensionProfile = 0
+	}
+}
+
 // Marshal serializes the header into bytes.
 func (h *RtpHeader) Marshal() (buf []byte, err error) {
 
@@ -334,17 +471,142 @@ func (p *RtpPacket) Unmarshal(buf []byte) error {
 		return err
 	}
 	end := len(buf)
+	p.PaddingSize = 0
 	if p.Padding {
+		if end <= n {
+			return fmt.Errorf("%w:no padding octet", ErrBadPadding)
+		}
 		p.PaddingSize = buf[end-1]
 		end -= int(p.PaddingSize)
 	}
 	if end < n {
-		return errors.New("buffer too small")
+		return fmt.Errorf("%w:buffer too small", ErrBadPadding)
+	}
+	p.Payload = buf[n:end]
+	return nil
+}
+
+// UnmarshalStrict parses buf like Unmarshal after checking it is a well
+// formed version 2 packet.The error is ErrBadVersion,ErrTruncatedHeader,
+// ErrTruncatedExtension or ErrBadPadding,possibly wrapped.
+func (p *RtpPacket) UnmarshalStrict(buf []byte) error {
+	n, err := p.RtpHeader.UnmarshalStrict(buf)
+	if err != nil {
+		return err
+	}
+	end := len(buf)
+	p.PaddingSize = 0
+	if p.Padding {
+		if end <= n {
+			return fmt.Errorf("%w:no padding octet", ErrBadPadding)
+		}
+		paddingSize := buf[end-1]
+		// the padding count includes itself and can not eat the header
+		if paddingSize == 0 || int(paddingSize) > end-n {
+			return fmt.Errorf("%w:size %d with %d bytes after header", ErrBadPadding, paddingSize, end-n)
+		}
+		p.PaddingSize = paddingSize
+		end -= int(paddingSize)
 	}
 	p.Payload = buf[n:end]
 	return nil
 }
 
+// UnmarshalStrict parses buf like Unmarshal after checking it is a well
+// formed version 2 header,including every RFC 8285 extension element.
+func (h *RtpHeader) UnmarshalStrict(buf []byte) (n int, err error) {
+	if n, err = validateRtpHeader(buf); err != nil {
+		return 0, err
+	}
+	if _, err = h.Unmarshal(buf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// validateRtpHeader checks the header in buf and returns its size
+func validateRtpHeader(buf []byte) (int, error) {
+	if len(buf) < RTP_HEADER_SIZE {
+		return 0, fmt.Errorf("%w:%d < %d", ErrTruncatedHeader, len(buf), RTP_HEADER_SIZE)
+	}
+	if version := buf[0] >> versionShift; version != RTP_VERSION {
+		return 0, fmt.Errorf("%w:%d", ErrBadVersion, version)
+	}
+	n := csrcOffset + int(buf[0]&ccMask)*csrcLength
+	if len(buf) < n {
+		return 0, fmt.Errorf("%w:%d < %d", ErrTruncatedHeader, len(buf), n)
+	}
+	if (buf[0]>>extensionShift)&extensionMask == 0 {
+		return n, nil
+	}
+
+	if len(buf) < n+4 {
+		return 0, fmt.Errorf("%w:%d < %d", ErrTruncatedExtension, len(buf), n+4)
+	}
+	profile := binary.BigEndian.Uint16(buf[n:])
+	end := n + 4 + int(binary.BigEndian.Uint16(buf[n+2:]))*4
+	if len(buf) < end {
+		return 0, fmt.Errorf("%w:%d < %d", ErrTruncatedExtension, len(buf), end)
+	}
+	i := n + 4
+	switch profile {
+	case extensionProfileOneByte:
+		for i < end {
+			if buf[i] == 0x00 { // padding
+				i++
+				continue
+			}
+			if buf[i]>>4 == extensionIDReserved {
+				// the rest of the extension is ignored
+				break
+			}
+			size := int(buf[i]&0x0F) + 1
+			if i+1+size > end {
+				return 0, fmt.Errorf("%w:element at %d", ErrTruncatedExtension, i)
+			}
+			i += 1 + size
+		}
+	case extensionProfileTwoByte:
+		for i < end {
+			if buf[i] == 0x00 { // padding
+				i++
+				continue
+			}
+			if i+2 > end || i+2+int(buf[i+1]) > end {
+				return 0, fmt.Errorf("%w:element at %d", ErrTruncatedExtension, i)
+			}
+			i += 2 + int(buf[i+1])
+		}
+	}
+	return end, nil
+}
+
+// PeekRtpHeader returns the fields needed for routing from the fixed header
+// in buf without parsing CSRCs and extensions nor allocating.
+func PeekRtpHeader(buf []byte) (payloadType uint8, sequenceNumber uint16, ssrc uint32, err error) {
+	if len(buf) < RTP_HEADER_SIZE {
+		return 0, 0, 0, ErrTruncatedHeader
+	}
+	if buf[0]>>versionShift != RTP_VERSION {
+		return 0, 0, 0, ErrBadVersion
+	}
+	payloadType = buf[1] & ptMask
+	sequenceNumber = binary.BigEndian.Uint16(buf[seqNumOffset:])
+	ssrc = binary.BigEndian.Uint32(buf[ssrcOffset:])
+	return payloadType, sequenceNumber, ssrc, nil
+}
+
+// PeekRtpTimestamp returns the timestamp from the fixed header in buf.
+func PeekRtpTimestamp(buf []byte) (uint32, error) {
+	if len(buf) < RTP_HEADER_SIZE {
+		return 0, ErrTruncatedHeader
+	}
+	if buf[0]>>versionShift != RTP_VERSION {
+		return 0, ErrBadVersion
+	}
+	return binary.BigEndian.Uint32(buf[timestampOffset:]), nil
+}
+
 // Marshal serializes the packet into bytes.
 func (p *RtpPacket) Marshal() (buf []byte, err error) {
 	buf = make([]byte, p.MarshalSize())
@@ -383,17 +645,8 @@ func (p *RtpPacket) MarshalSize() int {
 	return p.RtpHeader.MarshalSize() + len(p.Payload) + int(p.PaddingSize)
 }
 
-// String helps with debugging by printing packet information in a readable way
+// FmtString helps with debugging by printing every packet field in a
+// readable way,it is the same as Detail.
 func (p *RtpPacket) FmtString() string {
-	out := "RTP PACKET:\n"
-
-	out += fmt.Sprintf("\tVersion: %v\n", p.Version)
-	out += fmt.Sprintf("\tMarker: %v\n", p.Marker)
-	out += fmt.Sprintf("\tPayload Type: %d\n", p.PayloadType)
-	out += fmt.Sprintf("\tSequence Number: %d\n", p.SequenceNumber)
-	out += fmt.Sprintf("\tTimestamp: %d\n", p.Timestamp)
-	out += fmt.Sprintf("\tSSRC: %d (%x)\n", p.SSRC, p.SSRC)
-	out += fmt.Sprintf("\tPayload Length: %d\n", len(p.Payload))
-
-	return out
+	return p.Detail()
 }
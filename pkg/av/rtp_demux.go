@@ -0,0 +1,254 @@
+package av
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rtpDemuxReadBufferSize = 65536
+	rtpDemuxMinCheckPeriod = 100 * time.Millisecond
+)
+
+var ErrRtpDemuxClosed = errors.New("rtp demux: closed")
+
+// RtpDemuxHandler handles one packet routed by the demuxer,header is parsed
+// from packet and packet is owned by the handler
+type RtpDemuxHandler func(header *RtpHeader, packet []byte, from net.Addr)
+
+// RtpDemuxTimeoutHandler is called once when a route is removed because its
+// stream was silent for the timeout
+type RtpDemuxTimeoutHandler func(ssrc uint32, from net.Addr)
+
+// RtpDemuxUnknownHandler is called for a packet matching no route,it may
+// register a route which will receive this packet
+type RtpDemuxUnknownHandler func(header *RtpHeader, from net.Addr)
+
+type rtpDemuxRoute struct {
+	handler   RtpDemuxHandler
+	onTimeout RtpDemuxTimeoutHandler
+	ssrc      uint32
+	addr      net.Addr
+	lastSeen  int64 // unix nano
+}
+
+// RtpDemuxer routes the RTP packets received on one PacketConn to handlers
+// by SSRC,packets of an SSRC without route are routed by source address.
+// Only the RTP header is parsed
+type RtpDemuxer struct {
+	conn    net.PacketConn
+	timeout time.Duration
+
+	mu         sync.RWMutex
+	ssrcRoutes map[uint32]*rtpDemuxRoute
+	addrRoutes map[string]*rtpDemuxRoute
+	onUnknown  RtpDemuxUnknownHandler
+	onRtcp     func(packet []byte, from net.Addr)
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// NewRtpDemuxer creates a demuxer reading conn,a route without packets for
+// timeout is removed,0 disables timeouts.
+func NewRtpDemuxer(conn net.PacketConn, timeout time.Duration) *RtpDemuxer {
+	return &RtpDemuxer{
+		conn:       conn,
+		timeout:    timeout,
+		ssrcRoutes: make(map[uint32]*rtpDemuxRoute),
+		addrRoutes: make(map[string]*rtpDemuxRoute),
+		closeCh:    make(chan struct{}),
+	}
+}
+
+// Register routes packets of ssrc to handler,the timeout starts now so a
+// stream which never arrives also times out.
+func (d *RtpDemuxer) Register(ssrc uint32, handler RtpDemuxHandler, onTimeout RtpDemuxTimeoutHandler) {
+	route := &rtpDemuxRoute{handler: handler, onTimeout: onTimeout, ssrc: ssrc, lastSeen: time.Now().UnixNano()}
+	d.mu.Lock()
+	d.ssrcRoutes[ssrc] = route
+	d.mu.Unlock()
+}
+
+// Unregister removes the route of ssrc without calling its timeout handler.
+func (d *RtpDemuxer) Unregister(ssrc uint32) {
+	d.mu.Lock()
+	delete(d.ssrcRoutes, ssrc)
+	d.mu.Unlock()
+}
+
+// RegisterAddr routes packets from addr whose SSRC has no route to handler.
+func (d *RtpDemuxer) RegisterAddr(addr net.Addr, handler RtpDemuxHandler, onTimeout RtpDemuxTimeoutHandler) {
+	route := &rtpDemuxRoute{handler: handler, onTimeout: onTimeout, addr: addr, lastSeen: time.Now().UnixNano()}
+	d.mu.Lock()
+	d.addrRoutes[addr.String()] = route
+	d.mu.Unlock()
+}
+
+// UnregisterAddr removes the route of addr without calling its timeout handler.
+func (d *RtpDemuxer) UnregisterAddr(addr net.Addr) {
+	d.mu.Lock()
+	delete(d.addrRoutes, addr.String())
+	d.mu.Unlock()
+}
+
+// OnUnknown sets the handler of packets matching no route.
+func (d *RtpDemuxer) OnUnknown(handler RtpDemuxUnknownHandler) {
+	d.mu.Lock()
+	d.onUnknown = handler
+	d.mu.Unlock()
+}
+
+// OnRtcp sets the handler of RTCP packets multiplexed on the same port,they
+// are dropped when not set.
+func (d *RtpDemuxer) OnRtcp(handler func(packet []byte, from net.Addr)) {
+	d.mu.Lock()
+	d.onRtcp = handler
+	d.mu.Unlock()
+}
+
+// Routes returns the count of SSRC and address routes.
+func (d *RtpDemuxer) Routes() (ssrcs int, addrs int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.ssrcRoutes), len(d.addrRoutes)
+}
+
+func (d *RtpDemuxer) lookup(ssrc uint32, from net.Addr) *rtpDemuxRoute {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if route := d.ssrcRoutes[ssrc]; route != nil {
+		return route
+	}
+	return d.addrRoutes[from.String()]
+}
+
+// Serve reads and routes packets until Close or a read error.
+func (d *RtpDemuxer) Serve() error {
+	if d.timeout > 0 {
+		go d.checkTimeouts()
+	}
+	buf := make([]byte, rtpDemuxReadBufferSize)
+	for {
+		n, from, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-d.closeCh:
+				return ErrRtpDemuxClosed
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			d.Close()
+			return err
+		}
+
+		if IsRtcp(buf[:n]) {
+			d.mu.RLock()
+			onRtcp := d.onRtcp
+			d.mu.RUnlock()
+			if onRtcp != nil {
+				onRtcp(append([]byte(nil), buf[:n]...), from)
+			}
+			continue
+		}
+		_, _, ssrc, err := PeekRtpHeader(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		// only the packets delivered to a handler are copied and parsed
+		var header *RtpHeader
+		var packet []byte
+		var ok bool
+		route := d.lookup(ssrc, from)
+		if route == nil {
+			d.mu.RLock()
+			onUnknown := d.onUnknown
+			d.mu.RUnlock()
+			if onUnknown == nil {
+				continue
+			}
+			if header, packet, ok = parseRtpDemuxPacket(buf[:n]); !ok {
+				continue
+			}
+			onUnknown(header, from)
+			// the handler may have registered a route for this packet
+			if route = d.lookup(ssrc, from); route == nil {
+				continue
+			}
+		} else if header, packet, ok = parseRtpDemuxPacket(buf[:n]); !ok {
+			continue
+		}
+		atomic.StoreInt64(&route.lastSeen, time.Now().UnixNano())
+		route.handler(header, packet, from)
+	}
+}
+
+// parseRtpDemuxPacket copies buf and parses the header from the copy,the
+// header extensions alias the packet
+func parseRtpDemuxPacket(buf []byte) (*RtpHeader, []byte, bool) {
+	packet := append([]byte(nil), buf...)
+	header := &RtpHeader{}
+	if _, err := header.UnmarshalStrict(packet); err != nil {
+		return nil, nil, false
+	}
+	return header, packet, true
+}
+
+// Close stops Serve and closes the connection.
+func (d *RtpDemuxer) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.closeCh)
+		err = d.conn.Close()
+	})
+	return err
+}
+
+func (d *RtpDemuxer) checkTimeouts() {
+	period := d.timeout / 2
+	if period < rtpDemuxMinCheckPeriod {
+		period = rtpDemuxMinCheckPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closeCh:
+			return
+		case now := <-ticker.C:
+			d.expire(now)
+		}
+	}
+}
+
+func (d *RtpDemuxer) expire(now time.Time) {
+	deadline := now.Add(-d.timeout).UnixNano()
+	var expired []*rtpDemuxRoute
+	d.mu.Lock()
+	for ssrc, route := range d.ssrcRoutes {
+		if atomic.LoadInt64(&route.lastSeen) < deadline {
+			delete(d.ssrcRoutes, ssrc)
+			expired = append(expired, route)
+		}
+	}
+	for key, route := range d.addrRoutes {
+		if atomic.LoadInt64(&route.lastSeen) < deadline {
+			delete(d.addrRoutes, key)
+			expired = append(expired, route)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, route := range expired {
+		if route.onTimeout != nil {
+			route.onTimeout(route.ssrc, route.addr)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package av
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ABS_SEND_TIME_URI                = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+	AUDIO_LEVEL_URI                  = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+	TOFFSET_URI                      = "urn:ietf:params:rtp-hdrext:toffset"
+	VIDEO_ORIENTATION_URI            = "urn:3gpp:video-orientation"
+	SDES_MID_URI                     = "urn:ietf:params:rtp-hdrext:sdes:mid"
+	SDES_RTP_STREAM_ID_URI           = "urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id"
+	SDES_REPAIRED_RTP_STREAM_ID_URI  = "urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id"
+	rtpDumpAbsSendTimeFractionalBits = 18
+)
+
+// RtpExtensionMap maps the header extension ids negotiated by the SDP
+// extmap attributes to their URI
+type RtpExtensionMap map[uint8]string
+
+// DefaultRtpExtensionMap decodes the extensions of the packet dumps,it is
+// set once at startup since the dumps read it without lock.
+var DefaultRtpExtensionMap = RtpExtensionMap{}
+
+// ID returns the id negotiated for uri.
+func (m RtpExtensionMap) ID(uri string) (uint8, bool) {
+	for id, u := range m {
+		if u == uri {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// RtpExtensionDump one decoded header extension
+type RtpExtensionDump struct {
+	ID      uint8  `json:"id"`
+	URI     string `json:"uri,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Value   any    `json:"value,omitempty"` // nil when the URI is unknown
+	Payload string `json:"payload"`         // hex
+}
+
+func (d RtpExtensionDump) String() string {
+	name := strconv.Itoa(int(d.ID))
+	if d.Name != "" {
+		name += ":" + d.Name
+	}
+	if d.Value == nil {
+		return name + "=" + d.Payload
+	}
+	if s, ok := d.Value.(string); ok {
+		return name + "=" + strconv.Quote(s)
+	}
+	return fmt.Sprintf("%s=%v", name, d.Value)
+}
+
+// RtpAudioLevel RFC 6464 client to mixer audio level
+type RtpAudioLevel struct {
+	Voice bool `json:"voice"`
+	Level int  `json:"level"` // dBov,0 to -127
+}
+
+func (l RtpAudioLevel) String() string {
+	return fmt.Sprintf("{voice:%v level:%ddBov}", l.Voice, l.Level)
+}
+
+// RtpVideoOrientation 3GPP TS 26.114 coordination of video orientation
+type RtpVideoOrientation struct {
+	BackCamera bool `json:"backCamera"`
+	Flip       bool `json:"flip"`
+	Rotation   int  `json:"rotation"` // degrees clockwise
+}
+
+func (o RtpVideoOrientation) String() string {
+	return fmt.Sprintf("{back:%v flip:%v rotation:%d}", o.BackCamera, o.Flip, o.Rotation)
+}
+
+var rtpExtensionNames = map[string]string{
+	TWCC_EXTENSION_URI:              "transport-cc",
+	ABS_SEND_TIME_URI:               "abs-send-time",
+	AUDIO_LEVEL_URI:                 "audio-level",
+	TOFFSET_URI:                     "toffset",
+	VIDEO_ORIENTATION_URI:           "video-orientation",
+	SDES_MID_URI:                    "mid",
+	SDES_RTP_STREAM_ID_URI:          "rid",
+	SDES_REPAIRED_RTP_STREAM_ID_URI: "repaired-rid",
+	FRAME_MARKING_URI:               "frame-marking",
+}
+
+// Decode decodes e by its negotiated URI,the value of an unknown or
+// malformed extension is nil.
+func (m RtpExtensionMap) Decode(e RtpExtension) RtpExtensionDump {
+	d := RtpExtensionDump{ID: e.id, Payload: hex.EncodeToString(e.payload)}
+	if e.id == 0 {
+		// RFC 3550 extension
+		return d
+	}
+	d.URI = m[e.id]
+	d.Name = rtpExtensionNames[d.URI]
+	p := e.payload
+	switch d.URI {
+	case TWCC_EXTENSION_URI:
+		if len(p) >= 2 {
+			d.Value = uint16(p[0])<<8 | uint16(p[1])
+		}
+	case ABS_SEND_TIME_URI:
+		if len(p) >= 3 {
+			fixed := uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+			d.Value = time.Duration(uint64(fixed) * uint64(time.Second) >> rtpDumpAbsSendTimeFractionalBits)
+		}
+	case AUDIO_LEVEL_URI:
+		if len(p) >= 1 {
+			d.Value = RtpAudioLevel{Voice: p[0]&0x80 != 0, Level: -int(p[0] & 0x7F)}
+		}
+	case TOFFSET_URI:
+		if len(p) >= 3 {
+			// 24 bits signed
+			d.Value = int32(uint32(p[0])<<24|uint32(p[1])<<16|uint32(p[2])<<8) >> 8
+		}
+	case VIDEO_ORIENTATION_URI:
+		if len(p) >= 1 {
+			d.Value = RtpVideoOrientation{BackCamera: p[0]&0x08 != 0, Flip: p[0]&0x04 != 0, Rotation: int(p[0]&0x03) * 90}
+		}
+	case SDES_MID_URI, SDES_RTP_STREAM_ID_URI, SDES_REPAIRED_RTP_STREAM_ID_URI:
+		d.Value = string(p)
+	}
+	return d
+}
+
+// DumpExtensions decodes the extensions of h.
+func (m RtpExtensionMap) DumpExtensions(h *RtpHeader) []RtpExtensionDump {
+	if !h.Extension || len(h.Extensions) == 0 {
+		return nil
+	}
+	dumps := make([]RtpExtensionDump, len(h.Extensions))
+	for i, e := range h.Extensions {
+		dumps[i] = m.Decode(e)
+	}
+	return dumps
+}
+
+func (h *RtpHeader) writeSummary(sb *strings.Builder) {
+	fmt.Fprintf(sb, "v=%d pt=%d seq=%d ts=%d ssrc=0x%08x", h.Version, h.PayloadType, h.SequenceNumber, h.Timestamp, h.SSRC)
+	if h.Marker {
+		sb.WriteString(" marker")
+	}
+	if h.Padding {
+		sb.WriteString(" padding")
+	}
+	if len(h.CSRC) > 0 {
+		sb.WriteString(" csrc=[")
+		for i, csrc := range h.CSRC {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(sb, "0x%08x", csrc)
+		}
+		sb.WriteByte(']')
+	}
+	if extensions := DefaultRtpExtensionMap.DumpExtensions(h); len(extensions) > 0 {
+		fmt.Fprintf(sb, " ext(0x%04x)=%v", h.ExtensionProfile, extensions)
+	}
+}
+
+func (h *RtpHeader) writeDetail(sb *strings.Builder) {
+	fmt.Fprintf(sb, "\tVersion: %d\n", h.Version)
+	fmt.Fprintf(sb, "\tPadding: %v\n", h.Padding)
+	fmt.Fprintf(sb, "\tExtension: %v\n", h.Extension)
+	fmt.Fprintf(sb, "\tMarker: %v\n", h.Marker)
+	fmt.Fprintf(sb, "\tPayload Type: %d\n", h.PayloadType)
+	fmt.Fprintf(sb, "\tSequence Number: %d\n", h.SequenceNumber)
+	fmt.Fprintf(sb, "\tTimestamp: %d\n", h.Timestamp)
+	fmt.Fprintf(sb, "\tSSRC: %d (%x)\n", h.SSRC, h.SSRC)
+	for _, csrc := range h.CSRC {
+		fmt.Fprintf(sb, "\tCSRC: %d (%x)\n", csrc, csrc)
+	}
+	if h.Extension {
+		fmt.Fprintf(sb, "\tExtension Profile: 0x%04x\n", h.ExtensionProfile)
+		for _, e := range DefaultRtpExtensionMap.DumpExtensions(h) {
+			fmt.Fprintf(sb, "\tExtension %d", e.ID)
+			if e.URI != "" {
+				fmt.Fprintf(sb, " (%s)", e.URI)
+			}
+			fmt.Fprintf(sb, ": %s", e.Payload)
+			if e.Value != nil {
+				fmt.Fprintf(sb, " %v", e.Value)
+			}
+			sb.WriteByte('\n')
+		}
+	}
+}
+
+// String returns a one line summary of the header.
+func (h *RtpHeader) String() string {
+	if h == nil {
+		return "<nil>"
+	}
+	var sb strings.Builder
+	sb.WriteString("RTP ")
+	h.writeSummary(&sb)
+	return sb.String()
+}
+
+// Detail returns every field of the header,one per line.
+func (h *RtpHeader) Detail() string {
+	var sb strings.Builder
+	sb.WriteString("RTP HEADER:\n")
+	h.writeDetail(&sb)
+	return sb.String()
+}
+
+// Format implements fmt.Formatter,%v and %s print the summary,%+v the
+// detail and %q the quoted summary.
+func (h *RtpHeader) Format(f fmt.State, verb rune) {
+	formatDump(f, verb, h, h.Detail)
+}
+
+func (h *RtpHeader) dump() rtpHeaderJSON {
+	return rtpHeaderJSON{
+		Version:          h.Version,
+		Padding:          h.Padding,
+		Extension:        h.Extension,
+		Marker:           h.Marker,
+		PayloadType:      h.PayloadType,
+		SequenceNumber:   h.SequenceNumber,
+		Timestamp:        h.Timestamp,
+		SSRC:             h.SSRC,
+		CSRC:             h.CSRC,
+		ExtensionProfile: h.ExtensionProfile,
+		Extensions:       DefaultRtpExtensionMap.DumpExtensions(h),
+	}
+}
+
+type rtpHeaderJSON struct {
+	Version          uint8              `json:"version"`
+	Padding          bool               `json:"padding"`
+	Extension        bool               `json:"extension"`
+	Marker           bool               `json:"marker"`
+	PayloadType      uint8              `json:"payloadType"`
+	SequenceNumber   uint16             `json:"sequenceNumber"`
+	Timestamp        uint32             `json:"timestamp"`
+	SSRC             uint32             `json:"ssrc"`
+	CSRC             []uint32           `json:"csrc,omitempty"`
+	ExtensionProfile uint16             `json:"extensionProfile,omitempty"`
+	Extensions       []RtpExtensionDump `json:"extensions,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler with the decoded extensions.
+func (h *RtpHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.dump())
+}
+
+// String returns a one line summary of the packet.
+func (p *RtpPacket) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	var sb strings.Builder
+	sb.WriteString("RTP ")
+	p.writeSummary(&sb)
+	fmt.Fprintf(&sb, " payload=%d", len(p.Payload))
+	if p.PaddingSize > 0 {
+		fmt.Fprintf(&sb, " padsize=%d", p.PaddingSize)
+	}
+	return sb.String()
+}
+
+// Detail returns every field of the packet,one per line.
+func (p *RtpPacket) Detail() string {
+	var sb strings.Builder
+	sb.WriteString("RTP PACKET:\n")
+	p.writeDetail(&sb)
+	fmt.Fprintf(&sb, "\tPayload Length: %d\n", len(p.Payload))
+	fmt.Fprintf(&sb, "\tPadding Size: %d\n", p.PaddingSize)
+	return sb.String()
+}
+
+// Format implements fmt.Formatter,%v and %s print the summary,%+v the
+// detail and %q the quoted summary.
+func (p *RtpPacket) Format(f fmt.State, verb rune) {
+	formatDump(f, verb, p, p.Detail)
+}
+
+// MarshalJSON implements json.Marshaler with the decoded extensions,the
+// payload is only given by its size.
+func (p *RtpPacket) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		rtpHeaderJSON
+		PayloadSize int  `json:"payloadSize"`
+		PaddingSize byte `json:"paddingSize,omitempty"`
+	}{p.dump(), len(p.Payload), p.PaddingSize})
+}
+
+// formatDump writes s for the fmt verb,detail is used for %+v
+func formatDump(f fmt.State, verb rune, s fmt.Stringer, detail func() string) {
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			io.WriteString(f, detail())
+			return
+		}
+		io.WriteString(f, s.String())
+	case 's':
+		io.WriteString(f, s.String())
+	case 'q':
+		io.WriteString(f, strconv.Quote(s.String()))
+	default:
+		fmt.Fprintf(f, "%%!%c(%s)", verb, s.String())
+	}
+}
+
+// marshalRtcpJSON marshals v with the RTCP packet type name first
+func marshalRtcpJSON(typ string, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	head := `{"type":` + strconv.Quote(typ)
+	if len(body) <= 2 {
+		return []byte(head + "}"), nil
+	}
+	return append([]byte(head+","), body[1:]...), nil
+}
+
+func writeRtcpReports(sb *strings.Builder, reports []RtcpReceptionReport) {
+	for _, r := range reports {
+		fmt.Fprintf(sb, " [ssrc=0x%08x lost=%d fraction=%d/256 seq=%d jitter=%d lsr=0x%08x dlsr=%.3fs]",
+			r.SSRC, r.TotalLost, r.FractionLost, r.LastSequenceNumber, r.Jitter, r.LastSenderReport, float64(r.Delay)/65536)
+	}
+}
+
+func (sr *RtcpSenderReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "RTCP SR ssrc=0x%08x ntp=%s rtp=%d packets=%d octets=%d",
+		sr.SSRC, NtpToTime(sr.NTPTime).UTC().Format(time.RFC3339Nano), sr.RTPTime, sr.PacketCount, sr.OctetCount)
+	writeRtcpReports(&sb, sr.Reports)
+	return sb.String()
+}
+
+// MarshalJSON implements json.Marshaler,the NTP time is also given as
+// RFC 3339 time.
+func (sr *RtcpSenderReport) MarshalJSON() ([]byte, error) {
+	type report RtcpSenderReport
+	return marshalRtcpJSON("SR", struct {
+		*report
+		Time time.Time `json:"time"`
+	}{(*report)(sr), NtpToTime(sr.NTPTime).UTC()})
+}
+
+func (rr *RtcpReceiverReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "RTCP RR ssrc=0x%08x", rr.SSRC)
+	writeRtcpReports(&sb, rr.Reports)
+	return sb.String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (rr *RtcpReceiverReport) MarshalJSON() ([]byte, error) {
+	type report RtcpReceiverReport
+	return marshalRtcpJSON("RR", (*report)(rr))
+}
+
+func (sd *RtcpSourceDescription) String() string {
+	var sb strings.Builder
+	sb.WriteString("RTCP SDES")
+	for _, chunk := range sd.Chunks {
+		fmt.Fprintf(&sb, " [ssrc=0x%08x cname=%q]", chunk.SSRC, chunk.CNAME)
+	}
+	return sb.String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (sd *RtcpSourceDescription) MarshalJSON() ([]byte, error) {
+	type description RtcpSourceDescription
+	return marshalRtcpJSON("SDES", (*description)(sd))
+}
+
+func (bye *RtcpGoodbye) String() string {
+	var sb strings.Builder
+	sb.WriteString("RTCP BYE sources=[")
+	for i, ssrc := range bye.Sources {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "0x%08x", ssrc)
+	}
+	sb.WriteByte(']')
+	if bye.Reason != "" {
+		fmt.Fprintf(&sb, " reason=%q", bye.Reason)
+	}
+	return sb.String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (bye *RtcpGoodbye) MarshalJSON() ([]byte, error) {
+	type goodbye RtcpGoodbye
+	return marshalRtcpJSON("BYE", (*goodbye)(bye))
+}
+
+func (pli *RtcpPictureLossIndication) String() string {
+	return fmt.Sprintf("RTCP PLI sender=0x%08x media=0x%08x", pli.SenderSSRC, pli.MediaSSRC)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pli *RtcpPictureLossIndication) MarshalJSON() ([]byte, error) {
+	type indication RtcpPictureLossIndication
+	return marshalRtcpJSON("PLI", (*indication)(pli))
+}
+
+func (raw *RtcpRawPacket) String() string {
+	return fmt.Sprintf("RTCP type=%d count=%d length=%d data=%s", raw.Type, raw.Count, raw.Length, hex.EncodeToString(raw.Data))
+}
+
+// MarshalJSON implements json.Marshaler,the data is hex encoded.
+func (raw *RtcpRawPacket) MarshalJSON() ([]byte, error) {
+	return marshalRtcpJSON("raw", struct {
+		PacketType uint8  `json:"packetType"`
+		Count      uint8  `json:"count"`
+		Length     uint16 `json:"length"`
+		Data       string `json:"data"`
+	}{raw.Type, raw.Count, raw.Length, hex.EncodeToString(raw.Data)})
+}
+
+func (fb *RtcpTransportFeedback) String() string {
+	received := 0
+	for _, p := range fb.Packets {
+		if p.Received {
+			received++
+		}
+	}
+	return fmt.Sprintf("RTCP TWCC sender=0x%08x media=0x%08x base=%d count=%d received=%d reference=%v fb=%d",
+		fb.SenderSSRC, fb.MediaSSRC, fb.BaseSequenceNumber, len(fb.Packets), received,
+		time.Duration(fb.ReferenceTime)*TwccReferenceTimeUnit, fb.FbPktCount)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (fb *RtcpTransportFeedback) MarshalJSON() ([]byte, error) {
+	type feedback RtcpTransportFeedback
+	return marshalRtcpJSON("TWCC", (*feedback)(fb))
+}
@@ -0,0 +1,487 @@
+package av
+
+import (
+	"sync"
+	"time"
+)
+
+// FRAME_MARKING_URI the frame marking header extension,it carries the
+// keyframe flag and the temporal layer for codecs whose payload hides them
+const FRAME_MARKING_URI = "urn:ietf:params:rtp-hdrext:framemarking"
+
+const (
+	h264NaluIDR      = 5
+	h264NaluSPS      = 7
+	h264NaluPrefix   = 14
+	h264NaluSliceExt = 20
+	h264NaluSTAPA    = 24
+	h264STAPAHeadLen = 1
+	h264SvcIdrFlag   = 0x40
+
+	h265NaluIRAPFirst = 16
+	h265NaluIRAPLast  = 21
+	h265NaluVPS       = 32
+	h265NaluPPS       = 34
+	h265NaluAP        = 48
+
+	frameMarkingStart       = 0x80
+	frameMarkingIndependent = 0x20
+	frameMarkingTIDMask     = 0x07
+
+	rtpForwarderKeyFrameInterval = 500 * time.Millisecond
+)
+
+// AllTemporalLayers forwards every temporal layer
+const AllTemporalLayers = -1
+
+func isH264KeyNalu(nalu []byte) bool {
+	if len(nalu) == 0 {
+		return false
+	}
+	switch nalu[0] & h264NaluTypeMask {
+	case h264NaluIDR, h264NaluSPS:
+		return true
+	case h264NaluPrefix, h264NaluSliceExt:
+		return len(nalu) > 1 && nalu[1]&h264SvcIdrFlag != 0
+	}
+	return false
+}
+
+func isH265KeyNalu(nalu []byte) bool {
+	if len(nalu) < h265NaluHeadSize {
+		return false
+	}
+	typ := nalu[0] >> 1 & 0x3F
+	return (typ >= h265NaluIRAPFirst && typ <= h265NaluIRAPLast) || (typ >= h265NaluVPS && typ <= h265NaluPPS)
+}
+
+// IsRtpKeyFrame reports whether the RTP payload of codec starts a keyframe,
+// i.e. carries a parameter set,or the first fragment of an IDR/IRAP picture.
+func IsRtpKeyFrame(codec CodecType, payload []byte) bool {
+	switch codec {
+	case CODEC_H264:
+		if len(payload) == 0 {
+			return false
+		}
+		switch payload[0] & h264NaluTypeMask {
+		case h264NaluSTAPA:
+			for rest := payload[h264STAPAHeadLen:]; len(rest) > 2; {
+				size := int(rest[0])<<8 | int(rest[1])
+				if size == 0 || len(rest) < 2+size {
+					break
+				}
+				if isH264KeyNalu(rest[2 : 2+size]) {
+					return true
+				}
+				rest = rest[2+size:]
+			}
+			return false
+		case h264NaluFUA:
+			return len(payload) >= h264FUAHeaderLen && payload[1]&fuStartBit != 0 &&
+				isH264KeyNalu([]byte{payload[1] & h264NaluTypeMask})
+		}
+		return isH264KeyNalu(payload)
+	case CODEC_H265:
+		if len(payload) < h265NaluHeadSize {
+			return false
+		}
+		switch payload[0] >> 1 & 0x3F {
+		case h265NaluAP:
+			for rest := payload[h265NaluHeadSize:]; len(rest) > 2; {
+				size := int(rest[0])<<8 | int(rest[1])
+				if size == 0 || len(rest) < 2+size {
+					break
+				}
+				if isH265KeyNalu(rest[2 : 2+size]) {
+					return true
+				}
+				rest = rest[2+size:]
+			}
+			return false
+		case h265NaluFU:
+			return len(payload) >= h265FUHeaderLen && payload[2]&fuStartBit != 0 &&
+				isH265KeyNalu([]byte{(payload[2] & 0x3F) << 1, 1})
+		}
+		return isH265KeyNalu(payload)
+	case CODEC_MJPEG:
+		// every JPEG frame is independent
+		return len(payload) >= jpegHeaderSize && payload[1] == 0 && payload[2] == 0 && payload[3] == 0
+	}
+	return false
+}
+
+// RtpTemporalID returns the temporal layer id carried by the RTP payload of
+// codec,false when the payload does not tell it,e.g. a fragment of H.264
+// which is not the first one.
+func RtpTemporalID(codec CodecType, payload []byte) (int, bool) {
+	switch codec {
+	case CODEC_H264:
+		if len(payload) == 0 {
+			return 0, false
+		}
+		nalu := payload
+		switch payload[0] & h264NaluTypeMask {
+		case h264NaluSTAPA:
+			// the first aggregated NAL,typically the prefix NAL
+			if len(payload) < h264STAPAHeadLen+3 {
+				return 0, false
+			}
+			nalu = payload[h264STAPAHeadLen+2:]
+		case h264NaluFUA:
+			if len(payload) < h264FUAHeaderLen+3 || payload[1]&fuStartBit == 0 {
+				return 0, false
+			}
+			// the original NAL header is folded into the FU header
+			nalu = append([]byte{payload[1]}, payload[h264FUAHeaderLen:]...)
+		}
+		switch nalu[0] & h264NaluTypeMask {
+		case h264NaluPrefix, h264NaluSliceExt:
+			// svc_extension_flag,then temporal_id in the 3 high bits of the
+			// third extension byte,H.264 G.7.3.1.1
+			if len(nalu) < 4 || nalu[1]&0x80 == 0 {
+				return 0, false
+			}
+			return int(nalu[3] >> 5), true
+		}
+		// an AVC NAL is of the base layer
+		return 0, true
+	case CODEC_H265:
+		// nuh_temporal_id_plus1 of the NAL or payload header
+		if len(payload) < h265NaluHeadSize || payload[1]&0x07 == 0 {
+			return 0, false
+		}
+		return int(payload[1]&0x07) - 1, true
+	}
+	return 0, false
+}
+
+// RtpForwarderConfig configures RtpForwarder
+type RtpForwarderConfig struct {
+	Codec      CodecType       // codec of the layers,for keyframes and temporal layers
+	ClockRate  uint32          // default 90000
+	SSRC       uint32          // SSRC of the forwarded stream,0 random
+	MID        string          // when set,packets of another MID are dropped
+	Extensions RtpExtensionMap // negotiated extensions,to read the MID/RID/frame marking
+
+	// OnKeyFrameRequest is called,rate limited,with the SSRC of the target
+	// layer while a switch waits for its keyframe,to send a PLI/FIR upstream
+	OnKeyFrameRequest func(ssrc uint32)
+}
+
+type rtpForwarderSource struct {
+	rid      string
+	mid      string
+	repaired bool // RTX stream,never forwarded
+
+	// temporal id of the current frame,for the fragments which do not carry it
+	frameTs  uint32
+	frameTID int
+	hasFrame bool
+}
+
+// RtpForwarder selects one layer of a simulcast or SVC stream for a viewer
+// and forwards it as one continuous RTP stream.Spatial/simulcast layers are
+// identified by RID,they are switched only on a keyframe of the target
+// layer;temporal layers above the selected one are dropped at frame
+// boundaries.The sequence numbers and timestamps are rewritten so the
+// viewer sees neither the switches nor the dropped packets.It is safe for
+// concurrent use
+type RtpForwarder struct {
+	config RtpForwarderConfig
+
+	midID         uint8
+	ridID         uint8
+	repairedRidID uint8
+	markingID     uint8
+
+	mu      sync.Mutex
+	sources map[uint32]*rtpForwarderSource
+
+	targetRID   string
+	currentSSRC uint32
+	hasCurrent  bool
+	lastRequest time.Time
+
+	targetTID  int
+	currentTID int
+
+	// output continuity
+	started    bool
+	seqOffset  uint16
+	tsOffset   uint32
+	highestIn  uint16
+	barrier    uint16 // packets up to it,once dropped or switched,are never forwarded
+	lastOutSeq uint16
+	lastOutTs  uint32
+	lastOut    time.Time
+	frameTs    uint32
+	dropFrame  bool
+}
+
+// NewRtpForwarder creates a forwarder starting on the layer rid,empty rid
+// for the first layer seen.
+func NewRtpForwarder(config RtpForwarderConfig, rid string) *RtpForwarder {
+	if config.ClockRate == 0 {
+		config.ClockRate = 90000
+	}
+	if config.SSRC == 0 {
+		config.SSRC = NewSSRC()
+	}
+	f := &RtpForwarder{
+		config:     config,
+		sources:    make(map[uint32]*rtpForwarderSource),
+		targetRID:  rid,
+		targetTID:  AllTemporalLayers,
+		currentTID: AllTemporalLayers,
+		lastOutSeq: uint16(randomUint32()),
+		lastOutTs:  randomUint32(),
+	}
+	f.midID, _ = config.Extensions.ID(SDES_MID_URI)
+	f.ridID, _ = config.Extensions.ID(SDES_RTP_STREAM_ID_URI)
+	f.repairedRidID, _ = config.Extensions.ID(SDES_REPAIRED_RTP_STREAM_ID_URI)
+	f.markingID, _ = config.Extensions.ID(FRAME_MARKING_URI)
+	return f
+}
+
+// SSRC returns the SSRC of the forwarded stream.
+func (f *RtpForwarder) SSRC() uint32 {
+	return f.config.SSRC
+}
+
+// SetSourceLayer declares the RID of ssrc,for senders which do not send the
+// RID header extension,e.g. mapped from the SDP ssrc-group:SIM.
+func (f *RtpForwarder) SetSourceLayer(ssrc uint32, rid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.source(ssrc).rid = rid
+}
+
+// SetLayer selects the spatial layer rid,the switch happens on its next
+// keyframe.
+func (f *RtpForwarder) SetLayer(rid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.targetRID = rid
+	f.lastRequest = time.Time{}
+}
+
+// SetTemporalLayer selects the highest temporal layer forwarded,
+// AllTemporalLayers for every one.Going down is applied on the next frame,
+// going up on the next frame of the base layer which every layer refers to.
+func (f *RtpForwarder) SetTemporalLayer(tid int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if tid < 0 {
+		tid = AllTemporalLayers
+	}
+	f.targetTID = tid
+}
+
+// Layer returns the spatial and temporal layers being forwarded.
+func (f *RtpForwarder) Layer() (rid string, tid int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.hasCurrent {
+		return "", f.currentTID
+	}
+	return f.sources[f.currentSSRC].rid, f.currentTID
+}
+
+// Layers returns the RIDs of the layers seen.
+func (f *RtpForwarder) Layers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rids []string
+	seen := map[string]bool{}
+	for _, source := range f.sources {
+		if source.repaired || seen[source.rid] {
+			continue
+		}
+		seen[source.rid] = true
+		rids = append(rids, source.rid)
+	}
+	return rids
+}
+
+func (f *RtpForwarder) source(ssrc uint32) *rtpForwarderSource {
+	source := f.sources[ssrc]
+	if source == nil {
+		source = &rtpForwarderSource{}
+		f.sources[ssrc] = source
+	}
+	return source
+}
+
+// learn records the MID/RID the packet carries,they are usually only sent
+// until the receiver acknowledged the stream
+func (f *RtpForwarder) learn(pkt *RtpPacket) *rtpForwarderSource {
+	source := f.source(pkt.SSRC)
+	if f.midID != 0 {
+		if mid := pkt.GetExtension(f.midID); mid != nil {
+			source.mid = string(mid)
+		}
+	}
+	if f.ridID != 0 {
+		if rid := pkt.GetExtension(f.ridID); rid != nil {
+			source.rid = string(rid)
+		}
+	}
+	if f.repairedRidID != 0 {
+		if rid := pkt.GetExtension(f.repairedRidID); rid != nil {
+			source.rid = string(rid)
+			source.repaired = true
+		}
+	}
+	return source
+}
+
+// keyFrame reports whether pkt starts a keyframe
+func (f *RtpForwarder) keyFrame(pkt *RtpPacket) bool {
+	if f.markingID != 0 {
+		if marking := pkt.GetExtension(f.markingID); len(marking) > 0 {
+			return marking[0]&frameMarkingStart != 0 && marking[0]&frameMarkingIndependent != 0
+		}
+	}
+	return IsRtpKeyFrame(f.config.Codec, pkt.Payload)
+}
+
+// temporalID returns the temporal layer of pkt,carried over the fragments
+// of one frame
+func (f *RtpForwarder) temporalID(source *rtpForwarderSource, pkt *RtpPacket) int {
+	tid, ok := 0, false
+	if f.markingID != 0 {
+		if marking := pkt.GetExtension(f.markingID); len(marking) > 0 {
+			tid, ok = int(marking[0]&frameMarkingTIDMask), true
+		}
+	}
+	if !ok {
+		tid, ok = RtpTemporalID(f.config.Codec, pkt.Payload)
+	}
+	if ok {
+		source.frameTs, source.frameTID, source.hasFrame = pkt.Timestamp, tid, true
+		return tid
+	}
+	if source.hasFrame && source.frameTs == pkt.Timestamp {
+		return source.frameTID
+	}
+	return 0
+}
+
+// Forward returns the packet to send to the viewer for pkt received from
+// the sender,false when it is not forwarded.The returned packet shares the
+// payload of pkt.
+func (f *RtpForwarder) Forward(pkt *RtpPacket) (*RtpPacket, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	source := f.learn(pkt)
+	if source.repaired || (f.config.MID != "" && source.mid != "" && source.mid != f.config.MID) {
+		return nil, false
+	}
+
+	switching := false
+	if !f.hasCurrent || (f.targetRID != "" && source.rid == f.targetRID && pkt.SSRC != f.currentSSRC) {
+		if f.targetRID != "" && source.rid != f.targetRID {
+			return nil, false
+		}
+		if !f.keyFrame(pkt) {
+			f.requestKeyFrame(pkt.SSRC)
+			return nil, false
+		}
+		switching = true
+	} else if pkt.SSRC != f.currentSSRC {
+		return nil, false
+	}
+	tid := f.temporalID(source, pkt)
+
+	if switching {
+		f.switchTo(pkt)
+	} else {
+		if !RtpSeqNewer(pkt.SequenceNumber, f.highestIn) {
+			// reordered,only safe when nothing was dropped since
+			if !RtpSeqNewer(pkt.SequenceNumber, f.barrier) {
+				return nil, false
+			}
+		} else {
+			f.highestIn = pkt.SequenceNumber
+			if pkt.Timestamp != f.frameTs {
+				f.startFrame(pkt, tid)
+			}
+			if f.dropFrame {
+				// skip the packet in the output numbering
+				f.seqOffset--
+				f.barrier = pkt.SequenceNumber
+				return nil, false
+			}
+		}
+	}
+
+	out := *pkt
+	out.SSRC = f.config.SSRC
+	out.SequenceNumber = pkt.SequenceNumber + f.seqOffset
+	out.Timestamp = pkt.Timestamp + f.tsOffset
+	if (f.ridID != 0 && pkt.GetExtension(f.ridID) != nil) || (f.repairedRidID != 0 && pkt.GetExtension(f.repairedRidID) != nil) {
+		// the viewer receives one stream without layers
+		out.Extensions = append([]RtpExtension(nil), pkt.Extensions...)
+		for _, id := range []uint8{f.ridID, f.repairedRidID} {
+			if id != 0 {
+				out.DelExtension(id)
+			}
+		}
+	}
+	if RtpSeqNewer(out.SequenceNumber, f.lastOutSeq) {
+		f.lastOutSeq = out.SequenceNumber
+		f.lastOutTs = out.Timestamp
+		f.lastOut = time.Now()
+	}
+	return &out, true
+}
+
+// switchTo makes the keyframe pkt the first packet of the current layer,
+// continuing the output numbering
+func (f *RtpForwarder) switchTo(pkt *RtpPacket) {
+	gap := uint32(1)
+	if f.started {
+		if elapsed := time.Since(f.lastOut); elapsed > 0 {
+			if ticks := DurationToRtpTicks(elapsed, f.config.ClockRate); ticks > 0 {
+				gap = uint32(ticks)
+			}
+		}
+	}
+	f.seqOffset = f.lastOutSeq + 1 - pkt.SequenceNumber
+	f.tsOffset = f.lastOutTs + gap - pkt.Timestamp
+	f.started = true
+	f.hasCurrent = true
+	f.currentSSRC = pkt.SSRC
+	f.highestIn = pkt.SequenceNumber
+	f.barrier = pkt.SequenceNumber - 1
+	f.frameTs = pkt.Timestamp
+	f.dropFrame = false
+	// a keyframe refers to no other frame,every temporal layer can start
+	f.currentTID = f.targetTID
+	f.lastRequest = time.Time{}
+}
+
+// startFrame decides whether the frame started by pkt is forwarded,applying
+// a pending temporal layer change
+func (f *RtpForwarder) startFrame(pkt *RtpPacket, tid int) {
+	f.frameTs = pkt.Timestamp
+	if f.targetTID != f.currentTID {
+		down := f.targetTID != AllTemporalLayers && (f.currentTID == AllTemporalLayers || f.targetTID < f.currentTID)
+		if down || tid == 0 {
+			f.currentTID = f.targetTID
+		}
+	}
+	f.dropFrame = f.currentTID != AllTemporalLayers && tid > f.currentTID
+}
+
+func (f *RtpForwarder) requestKeyFrame(ssrc uint32) {
+	if f.config.OnKeyFrameRequest == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(f.lastRequest) < rtpForwarderKeyFrameInterval {
+		return
+	}
+	f.lastRequest = now
+	go f.config.OnKeyFrameRequest(ssrc)
+}
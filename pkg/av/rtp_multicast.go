@@ -0,0 +1,123 @@
+package av
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+const rtpSessionDefaultMulticastTTL = 16
+
+var ErrRtpMulticastUnsupported = errors.New("rtp session: multicast socket options unsupported on this platform")
+
+// interfaceIPv4 returns the first IPv4 address of ifi
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if ip4 := ipnet.IP.To4(); ip4 != nil {
+				return ip4, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("rtp session: interface %s has no IPv4 address", ifi.Name)
+}
+
+// listenMulticast joins conf.Group on the RTP/RTCP port pair starting at port
+// and sets the TTL and loopback of the packets sent to the group
+func listenMulticast(conf *RtpSessionConfig, port int) (rtpConn, rtcpConn *net.UDPConn, err error) {
+	network, ipv6 := "udp4", false
+	if conf.Group.To4() == nil {
+		network, ipv6 = "udp6", true
+	}
+	listen := func(port int) (*net.UDPConn, error) {
+		conn, err := net.ListenMulticastUDP(network, conf.Interface, &net.UDPAddr{IP: conf.Group, Port: port})
+		if err != nil {
+			return nil, err
+		}
+		if err := setMulticastTTL(conn, ipv6, conf.MulticastTTL); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// only receive the groups joined by conn,so LeaveGroup takes effect
+		if err := setMulticastAll(conn, ipv6, false); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// ListenMulticastUDP disables the loopback
+		if err := setMulticastLoopback(conn, ipv6, conf.MulticastLoopback); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	if rtpConn, err = listen(port); err != nil {
+		return nil, nil, err
+	}
+	if rtcpConn, err = listen(port + 1); err != nil {
+		rtpConn.Close()
+		return nil, nil, err
+	}
+	return rtpConn, rtcpConn, nil
+}
+
+// Group returns the multicast group of the session,nil for unicast.
+func (s *RtpSession) Group() net.IP {
+	return s.conf.Group
+}
+
+// JoinGroup joins the multicast group again after LeaveGroup,the session
+// joins when created.
+func (s *RtpSession) JoinGroup() error {
+	return s.setMembership(true)
+}
+
+// LeaveGroup leaves the multicast group,the session stops receiving from the
+// group but can still send to it.A sender only session leaves after creation.
+func (s *RtpSession) LeaveGroup() error {
+	return s.setMembership(false)
+}
+
+func (s *RtpSession) setMembership(join bool) error {
+	if s.conf.Group == nil {
+		return errors.New("rtp session: not a multicast session")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closeCh:
+		return ErrRtpSessionClosed
+	default:
+	}
+	if s.joined == join {
+		return nil
+	}
+	if err := setMulticastMembership(s.rtpConn, s.conf.Group, s.conf.Interface, join); err != nil {
+		return err
+	}
+	if err := setMulticastMembership(s.rtcpConn, s.conf.Group, s.conf.Interface, join); err != nil {
+		// keep both sockets in the same state
+		setMulticastMembership(s.rtpConn, s.conf.Group, s.conf.Interface, !join)
+		return err
+	}
+	s.joined = join
+	return nil
+}
+
+// rtcpSenderSSRC returns the SSRC of the sender of a compound packet,which
+// starts with a SR or RR
+func rtcpSenderSSRC(packets []RtcpPacket) (uint32, bool) {
+	if len(packets) == 0 {
+		return 0, false
+	}
+	switch packet := packets[0].(type) {
+	case *RtcpSenderReport:
+		return packet.SSRC, true
+	case *RtcpReceiverReport:
+		return packet.SSRC, true
+	}
+	return 0, false
+}
@@ -0,0 +1,10 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package av
+
+import "net"
+
+// setMulticastAll is a no-op,BSD sockets only receive the groups they joined
+func setMulticastAll(conn *net.UDPConn, ipv6 bool, all bool) error {
+	return nil
+}
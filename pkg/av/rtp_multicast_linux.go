@@ -0,0 +1,28 @@
+package av
+
+import (
+	"net"
+	"syscall"
+)
+
+// not defined by syscall on every architecture,the values are the same on all
+const (
+	ipMulticastAll   = 0x31
+	ipv6MulticastAll = 0x1d
+)
+
+// setMulticastAll sets whether conn receives the groups joined by the other
+// sockets of the host on its port.Linux defaults to true,so a socket keeps
+// receiving a group after leaving it while another socket is still a member
+func setMulticastAll(conn *net.UDPConn, ipv6 bool, all bool) error {
+	v := 0
+	if all {
+		v = 1
+	}
+	return setsockopt(conn, func(fd int) error {
+		if ipv6 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, ipv6MulticastAll, v)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, ipMulticastAll, v)
+	})
+}
@@ -0,0 +1,120 @@
+package av
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	utils "github.com/286897655/gopkgs/pkg/utils"
+)
+
+func getsockoptInt(t *testing.T, conn *net.UDPConn, level, opt int) int {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		v, serr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	return v
+}
+
+func TestRtpSessionMulticastLoopback(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip(err)
+	}
+	group := net.IPv4(239, 255, 42, 10)
+	conf := RtpSessionConfig{
+		Ports:             utils.New(40000, 50000),
+		Group:             group,
+		Interface:         lo,
+		MulticastTTL:      3,
+		MulticastLoopback: true,
+		RtcpInterval:      time.Hour,
+	}
+	sender, err := NewRtpSession(conf)
+	if err != nil {
+		t.Skipf("multicast on lo: %v", err)
+	}
+	defer sender.Close()
+	conf.Ports, conf.Port = nil, sender.RtpPort()
+	receiver, err := NewRtpSession(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	for _, conn := range []*net.UDPConn{receiver.rtpConn, receiver.rtcpConn} {
+		if ttl := getsockoptInt(t, conn, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL); ttl != 3 {
+			t.Fatalf("multicast ttl %d", ttl)
+		}
+		if all := getsockoptInt(t, conn, syscall.IPPROTO_IP, ipMulticastAll); all != 0 {
+			t.Fatalf("IP_MULTICAST_ALL %d", all)
+		}
+		if loop := getsockoptInt(t, conn, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP); loop != 1 {
+			t.Fatalf("multicast loopback %d", loop)
+		}
+	}
+
+	received := make(chan *RtpPacket, 16)
+	receiver.HandleDefault(func(pkt *RtpPacket, from *net.UDPAddr) {
+		received <- pkt
+	})
+	receiver.Start()
+	sender.Start()
+
+	send := func(seq uint16) {
+		t.Helper()
+		pkt := &RtpPacket{
+			RtpHeader: RtpHeader{Version: RTP_VERSION, PayloadType: 96, SequenceNumber: seq, SSRC: sender.SSRC()},
+			Payload:   []byte("multicast"),
+		}
+		if err := sender.WriteRtp(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(1)
+	select {
+	case pkt := <-received:
+		if pkt.SequenceNumber != 1 || pkt.SSRC != sender.SSRC() || string(pkt.Payload) != "multicast" {
+			t.Fatalf("received %+v", pkt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the multicast packet")
+	}
+
+	// the sender is still a member of the group on the same port,with
+	// IP_MULTICAST_ALL cleared the receiver stops receiving once it leaves
+	if err := receiver.LeaveGroup(); err != nil {
+		t.Fatal(err)
+	}
+	send(2)
+	select {
+	case pkt := <-received:
+		t.Fatalf("received %d after leaving the group", pkt.SequenceNumber)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := receiver.JoinGroup(); err != nil {
+		t.Fatal(err)
+	}
+	send(3)
+	select {
+	case pkt := <-received:
+		if pkt.SequenceNumber != 3 {
+			t.Fatalf("received %d after joining again", pkt.SequenceNumber)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the multicast packet after joining again")
+	}
+}
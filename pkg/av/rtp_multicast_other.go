@@ -0,0 +1,21 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package av
+
+import "net"
+
+func setMulticastTTL(conn *net.UDPConn, ipv6 bool, ttl int) error {
+	return ErrRtpMulticastUnsupported
+}
+
+func setMulticastLoopback(conn *net.UDPConn, ipv6 bool, loopback bool) error {
+	return ErrRtpMulticastUnsupported
+}
+
+func setMulticastMembership(conn *net.UDPConn, group net.IP, ifi *net.Interface, join bool) error {
+	return ErrRtpMulticastUnsupported
+}
+
+func setMulticastAll(conn *net.UDPConn, ipv6 bool, all bool) error {
+	return ErrRtpMulticastUnsupported
+}
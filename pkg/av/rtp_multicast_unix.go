@@ -0,0 +1,87 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package av
+
+import (
+	"net"
+	"syscall"
+)
+
+// setsockopt runs set on the socket of conn
+func setsockopt(conn *net.UDPConn, set func(fd int) error) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = set(int(fd))
+	}); err != nil {
+		return err
+	}
+	if serr != nil {
+		return &net.OpError{Op: "setsockopt", Net: "udp", Source: conn.LocalAddr(), Err: serr}
+	}
+	return nil
+}
+
+// setMulticastTTL sets the TTL (hop limit for IPv6) of multicast packets sent by conn
+func setMulticastTTL(conn *net.UDPConn, ipv6 bool, ttl int) error {
+	return setsockopt(conn, func(fd int) error {
+		if ipv6 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ttl)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl)
+	})
+}
+
+// setMulticastLoopback sets whether multicast packets sent by conn are looped
+// back to the local host
+func setMulticastLoopback(conn *net.UDPConn, ipv6 bool, loopback bool) error {
+	v := 0
+	if loopback {
+		v = 1
+	}
+	return setsockopt(conn, func(fd int) error {
+		if ipv6 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_LOOP, v)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, v)
+	})
+}
+
+// setMulticastMembership joins (IGMP/MLD report) or leaves group on ifi,nil
+// ifi lets the system choose the interface
+func setMulticastMembership(conn *net.UDPConn, group net.IP, ifi *net.Interface, join bool) error {
+	if ip4 := group.To4(); ip4 != nil {
+		mreq := &syscall.IPMreq{}
+		copy(mreq.Multiaddr[:], ip4)
+		if ifi != nil {
+			addr, err := interfaceIPv4(ifi)
+			if err != nil {
+				return err
+			}
+			copy(mreq.Interface[:], addr)
+		}
+		opt := syscall.IP_DROP_MEMBERSHIP
+		if join {
+			opt = syscall.IP_ADD_MEMBERSHIP
+		}
+		return setsockopt(conn, func(fd int) error {
+			return syscall.SetsockoptIPMreq(fd, syscall.IPPROTO_IP, opt, mreq)
+		})
+	}
+
+	mreq := &syscall.IPv6Mreq{}
+	copy(mreq.Multiaddr[:], group.To16())
+	if ifi != nil {
+		mreq.Interface = uint32(ifi.Index)
+	}
+	opt := syscall.IPV6_LEAVE_GROUP
+	if join {
+		opt = syscall.IPV6_JOIN_GROUP
+	}
+	return setsockopt(conn, func(fd int) error {
+		return syscall.SetsockoptIPv6Mreq(fd, syscall.IPPROTO_IPV6, opt, mreq)
+	})
+}
@@ -0,0 +1,592 @@
+package av
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RTP_RECORD_EXT                    = ".rtpr"
+	DEFAULT_RTP_RECORD_INDEX_INTERVAL = time.Second
+)
+
+/*
+ * File layout,every integer is big endian:
+ *
+ * header   "RTPR" | version uint16 | reserved uint16 | start unix nano int64
+ * record   arrival unix nano int64 | size uint16 | packet
+ * ...
+ * index    arrival unix nano int64 | record offset int64,one per interval
+ * ...
+ * trailer  index offset int64 | index count uint32 | "RIDX"
+ *
+ * The index and the trailer are written when the file is closed,a file
+ * without them,e.g. after a crash,is indexed by scanning its records.
+ */
+const (
+	rtpRecordMagic          = "RTPR"
+	rtpRecordIndexMagic     = "RIDX"
+	rtpRecordVersion        = 1
+	rtpRecordHeaderSize     = 16
+	rtpRecordEntryHeader    = 10
+	rtpRecordIndexEntrySize = 16
+	rtpRecordTrailerSize    = 16
+	rtpRecordTimeLayout     = "20060102T150405.000000000"
+	rtpRecordMaxPacket      = 0xFFFF
+)
+
+var (
+	ErrRtpRecordFormat = errors.New("rtp record: invalid file")
+	ErrRtpRecordClosed = errors.New("rtp record: closed")
+)
+
+type rtpRecordIndexEntry struct {
+	arrival int64
+	offset  int64
+}
+
+// RtpRecorderConfig configures RtpRecorder
+type RtpRecorderConfig struct {
+	Dir    string
+	Prefix string // file name prefix,followed by the UTC time of the first packet
+
+	MaxFileSize   int64         // rotate when a file would exceed it,0 no limit
+	MaxDuration   time.Duration // rotate when a file spans it,0 no limit
+	IndexInterval time.Duration // default DEFAULT_RTP_RECORD_INDEX_INTERVAL
+
+	// OnRotate is called with the path of every completed file,the recorder
+	// lock is not held so the callback may use the recorder
+	OnRotate func(path string)
+}
+
+// RtpRecorder records raw RTP and RTCP packets with their arrival time into
+// indexed files,rotated by size or duration.It is safe for concurrent use
+type RtpRecorder struct {
+	config RtpRecorderConfig
+
+	mu        sync.Mutex
+	closed    bool
+	file      *os.File
+	w         *bufio.Writer
+	path      string
+	start     time.Time
+	size      int64
+	index     []rtpRecordIndexEntry
+	lastIndex int64
+}
+
+// NewRtpRecorder creates a recorder,the first file is created on the first
+// packet.
+func NewRtpRecorder(config RtpRecorderConfig) (*RtpRecorder, error) {
+	if config.IndexInterval <= 0 {
+		config.IndexInterval = DEFAULT_RTP_RECORD_INDEX_INTERVAL
+	}
+	if config.MaxFileSize > 0 && config.MaxFileSize < rtpRecordHeaderSize+rtpRecordEntryHeader+rtpRecordMaxPacket {
+		return nil, fmt.Errorf("rtp record: max file size %d too small", config.MaxFileSize)
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &RtpRecorder{config: config}, nil
+}
+
+// HandleRtp records pkt arrived now,it can be registered as an RtpHandler.
+func (r *RtpRecorder) HandleRtp(pkt *RtpPacket, from *net.UDPAddr) {
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return
+	}
+	r.WriteRaw(buf, time.Now())
+}
+
+// HandleRtcp records packets arrived now,it can be registered as an
+// RtcpHandler.
+func (r *RtpRecorder) HandleRtcp(packets []RtcpPacket, from *net.UDPAddr) {
+	buf, err := MarshalRtcp(packets...)
+	if err != nil {
+		return
+	}
+	r.WriteRaw(buf, time.Now())
+}
+
+// WritePacket records pkt arrived at arrival.
+func (r *RtpRecorder) WritePacket(pkt *RtpPacket, arrival time.Time) error {
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return err
+	}
+	return r.WriteRaw(buf, arrival)
+}
+
+// WriteRaw records the RTP or RTCP packet buf arrived at arrival,the arrival
+// times are expected to be increasing.
+func (r *RtpRecorder) WriteRaw(buf []byte, arrival time.Time) error {
+	if len(buf) > rtpRecordMaxPacket {
+		return fmt.Errorf("rtp record: packet size %d too large", len(buf))
+	}
+	r.mu.Lock()
+	rotated, err := r.writeRaw(buf, arrival)
+	r.mu.Unlock()
+	r.notifyRotate(rotated)
+	return err
+}
+
+// writeRaw returns the path of the file completed before writing buf
+func (r *RtpRecorder) writeRaw(buf []byte, arrival time.Time) (rotated string, err error) {
+	if r.closed {
+		return "", ErrRtpRecordClosed
+	}
+
+	recordSize := int64(rtpRecordEntryHeader + len(buf))
+	if r.file != nil {
+		indexSize := int64(len(r.index)+1)*rtpRecordIndexEntrySize + rtpRecordTrailerSize
+		if (r.config.MaxFileSize > 0 && r.size+recordSize+indexSize > r.config.MaxFileSize) ||
+			(r.config.MaxDuration > 0 && arrival.Sub(r.start) >= r.config.MaxDuration) {
+			if rotated, err = r.finish(); err != nil {
+				return rotated, err
+			}
+		}
+	}
+	if r.file == nil {
+		if err := r.create(arrival); err != nil {
+			return rotated, err
+		}
+	}
+
+	nano := arrival.UnixNano()
+	if len(r.index) == 0 || nano-r.lastIndex >= int64(r.config.IndexInterval) {
+		r.index = append(r.index, rtpRecordIndexEntry{arrival: nano, offset: r.size})
+		r.lastIndex = nano
+	}
+	var header [rtpRecordEntryHeader]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(nano))
+	binary.BigEndian.PutUint16(header[8:10], uint16(len(buf)))
+	if _, err := r.w.Write(header[:]); err != nil {
+		return rotated, err
+	}
+	if _, err := r.w.Write(buf); err != nil {
+		return rotated, err
+	}
+	r.size += recordSize
+	return rotated, nil
+}
+
+// Path returns the path of the file being written,empty before the first
+// packet.
+func (r *RtpRecorder) Path() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.path
+}
+
+// Flush writes the buffered records to the file.
+func (r *RtpRecorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return nil
+	}
+	return r.w.Flush()
+}
+
+// Close completes the current file.
+func (r *RtpRecorder) Close() error {
+	r.mu.Lock()
+	if r.closed || r.file == nil {
+		r.closed = true
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	path, err := r.finish()
+	r.mu.Unlock()
+	r.notifyRotate(path)
+	return err
+}
+
+// notifyRotate calls OnRotate for a completed file
+func (r *RtpRecorder) notifyRotate(path string) {
+	if path != "" && r.config.OnRotate != nil {
+		r.config.OnRotate(path)
+	}
+}
+
+func (r *RtpRecorder) create(start time.Time) error {
+	name := r.config.Prefix + "_" + start.UTC().Format(rtpRecordTimeLayout) + RTP_RECORD_EXT
+	path := filepath.Join(r.config.Dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(file, 64*1024)
+	var header [rtpRecordHeaderSize]byte
+	copy(header[0:4], rtpRecordMagic)
+	binary.BigEndian.PutUint16(header[4:6], rtpRecordVersion)
+	binary.BigEndian.PutUint64(header[8:16], uint64(start.UnixNano()))
+	if _, err := w.Write(header[:]); err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.w = w
+	r.path = path
+	r.start = start
+	r.size = rtpRecordHeaderSize
+	r.index = r.index[:0]
+	return nil
+}
+
+// finish writes the index and the trailer,closes the file and returns its
+// path
+func (r *RtpRecorder) finish() (string, error) {
+	indexOffset := r.size
+	var entry [rtpRecordIndexEntrySize]byte
+	for _, e := range r.index {
+		binary.BigEndian.PutUint64(entry[0:8], uint64(e.arrival))
+		binary.BigEndian.PutUint64(entry[8:16], uint64(e.offset))
+		r.w.Write(entry[:])
+	}
+	var trailer [rtpRecordTrailerSize]byte
+	binary.BigEndian.PutUint64(trailer[0:8], uint64(indexOffset))
+	binary.BigEndian.PutUint32(trailer[8:12], uint32(len(r.index)))
+	copy(trailer[12:16], rtpRecordIndexMagic)
+	r.w.Write(trailer[:])
+
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	path := r.path
+	r.file = nil
+	r.w = nil
+	return path, err
+}
+
+// ListRtpRecordings returns the files of prefix in dir ordered by start time.
+func ListRtpRecordings(dir, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix+"_") || !strings.HasSuffix(name, RTP_RECORD_EXT) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	// the UTC time layout sorts by name
+	sort.Strings(paths)
+	return paths, nil
+}
+
+type rtpRecordFile struct {
+	path    string
+	start   int64
+	end     int64 // arrival of the last record
+	dataEnd int64 // end of the records
+	index   []rtpRecordIndexEntry
+}
+
+// openRtpRecordFile reads the header and the index of path,rebuilding the
+// index of a file which was not completed
+func openRtpRecordFile(path string) (*rtpRecordFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var header [rtpRecordHeaderSize]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil || string(header[0:4]) != rtpRecordMagic {
+		return nil, fmt.Errorf("%w:%s", ErrRtpRecordFormat, path)
+	}
+	if version := binary.BigEndian.Uint16(header[4:6]); version != rtpRecordVersion {
+		return nil, fmt.Errorf("%w:%s version %d", ErrRtpRecordFormat, path, version)
+	}
+	rf := &rtpRecordFile{
+		path:    path,
+		start:   int64(binary.BigEndian.Uint64(header[8:16])),
+		dataEnd: info.Size(),
+	}
+
+	if rf.readIndex(file, info.Size()) != nil {
+		rf.index = nil
+		rf.dataEnd = info.Size()
+	}
+
+	// the end is the last record,scanned from the last index entry
+	from := int64(rtpRecordHeaderSize)
+	rebuild := rf.index == nil
+	if !rebuild && len(rf.index) > 0 {
+		from = rf.index[len(rf.index)-1].offset
+	}
+	br := bufio.NewReader(io.NewSectionReader(file, from, rf.dataEnd-from))
+	offset := from
+	var lastIndex int64
+	rf.end = rf.start
+	for {
+		arrival, data, err := readRtpRecord(br)
+		if err != nil {
+			break
+		}
+		if rebuild && (len(rf.index) == 0 || arrival-lastIndex >= int64(DEFAULT_RTP_RECORD_INDEX_INTERVAL)) {
+			rf.index = append(rf.index, rtpRecordIndexEntry{arrival: arrival, offset: offset})
+			lastIndex = arrival
+		}
+		offset += int64(rtpRecordEntryHeader + len(data))
+		rf.end = arrival
+	}
+	if rebuild {
+		// ignore a record truncated by the crash
+		rf.dataEnd = offset
+	}
+	return rf, nil
+}
+
+func (rf *rtpRecordFile) readIndex(file *os.File, size int64) error {
+	if size < rtpRecordHeaderSize+rtpRecordTrailerSize {
+		return ErrRtpRecordFormat
+	}
+	var trailer [rtpRecordTrailerSize]byte
+	if _, err := file.ReadAt(trailer[:], size-rtpRecordTrailerSize); err != nil {
+		return err
+	}
+	if string(trailer[12:16]) != rtpRecordIndexMagic {
+		return ErrRtpRecordFormat
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(trailer[0:8]))
+	count := int64(binary.BigEndian.Uint32(trailer[8:12]))
+	if indexOffset < rtpRecordHeaderSize || indexOffset+count*rtpRecordIndexEntrySize != size-rtpRecordTrailerSize {
+		return ErrRtpRecordFormat
+	}
+	buf := make([]byte, count*rtpRecordIndexEntrySize)
+	if _, err := file.ReadAt(buf, indexOffset); err != nil {
+		return err
+	}
+	rf.index = make([]rtpRecordIndexEntry, count)
+	for i := range rf.index {
+		entry := buf[i*rtpRecordIndexEntrySize:]
+		rf.index[i].arrival = int64(binary.BigEndian.Uint64(entry[0:8]))
+		rf.index[i].offset = int64(binary.BigEndian.Uint64(entry[8:16]))
+		if rf.index[i].offset < rtpRecordHeaderSize || rf.index[i].offset >= indexOffset {
+			return ErrRtpRecordFormat
+		}
+	}
+	rf.dataEnd = indexOffset
+	return nil
+}
+
+// readRtpRecord reads one record,a truncated record reads as io.EOF
+func readRtpRecord(r *bufio.Reader) (int64, []byte, error) {
+	var header [rtpRecordEntryHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, io.EOF
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[8:10]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, io.EOF
+	}
+	return int64(binary.BigEndian.Uint64(header[0:8])), data, nil
+}
+
+// RtpRecording reads the packets of recorded files in arrival order.It is
+// not safe for concurrent use
+type RtpRecording struct {
+	files []*rtpRecordFile
+
+	current int
+	file    *os.File
+	reader  *bufio.Reader
+
+	pending        []byte
+	pendingArrival int64
+}
+
+// OpenRtpRecording opens the files of one recording,typically returned by
+// ListRtpRecordings,they are ordered by start time.
+func OpenRtpRecording(paths ...string) (*RtpRecording, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w:no file", ErrRtpRecordFormat)
+	}
+	r := &RtpRecording{}
+	for _, path := range paths {
+		rf, err := openRtpRecordFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r.files = append(r.files, rf)
+	}
+	sort.SliceStable(r.files, func(i, j int) bool { return r.files[i].start < r.files[j].start })
+	if err := r.open(0, rtpRecordHeaderSize); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start returns the start time of the first file.
+func (r *RtpRecording) Start() time.Time {
+	return time.Unix(0, r.files[0].start)
+}
+
+// End returns the arrival time of the last packet.
+func (r *RtpRecording) End() time.Time {
+	return time.Unix(0, r.files[len(r.files)-1].end)
+}
+
+func (r *RtpRecording) open(i int, offset int64) error {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	r.current = i
+	r.pending = nil
+	rf := r.files[i]
+	file, err := os.Open(rf.path)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.reader = bufio.NewReaderSize(io.NewSectionReader(file, offset, rf.dataEnd-offset), 64*1024)
+	return nil
+}
+
+// Next returns the next packet and its arrival time,io.EOF at the end of
+// the recording.
+func (r *RtpRecording) Next() ([]byte, time.Time, error) {
+	if r.pending != nil {
+		data := r.pending
+		r.pending = nil
+		return data, time.Unix(0, r.pendingArrival), nil
+	}
+	for r.file != nil {
+		arrival, data, err := readRtpRecord(r.reader)
+		if err == nil {
+			return data, time.Unix(0, arrival), nil
+		}
+		if r.current+1 >= len(r.files) {
+			break
+		}
+		if err := r.open(r.current+1, rtpRecordHeaderSize); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	return nil, time.Time{}, io.EOF
+}
+
+// Seek positions the recording at the first packet arrived at or after t,
+// io.EOF when there is none.
+func (r *RtpRecording) Seek(t time.Time) error {
+	nano := t.UnixNano()
+	// the last file starting at or before t
+	i := sort.Search(len(r.files), func(i int) bool { return r.files[i].start > nano }) - 1
+	if i < 0 {
+		i = 0
+	}
+	rf := r.files[i]
+	offset := int64(rtpRecordHeaderSize)
+	if j := sort.Search(len(rf.index), func(j int) bool { return rf.index[j].arrival > nano }) - 1; j >= 0 {
+		offset = rf.index[j].offset
+	}
+	if err := r.open(i, offset); err != nil {
+		return err
+	}
+	for {
+		data, arrival, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if arrival.UnixNano() >= nano {
+			r.pending = data
+			r.pendingArrival = arrival.UnixNano()
+			return nil
+		}
+	}
+}
+
+// Replay calls handler with every packet from the current position,paced
+// by the recorded arrival times divided by speed,0 speed replays as fast as
+// possible.It returns nil at the end of the recording.
+func (r *RtpRecording) Replay(ctx context.Context, speed float64, handler func(packet []byte, arrival time.Time) error) error {
+	var first time.Time
+	var wallStart time.Time
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		data, arrival, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = arrival
+			wallStart = time.Now()
+		}
+		if speed > 0 {
+			due := wallStart.Add(time.Duration(float64(arrival.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(data, arrival); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayRtp replays like Replay,parsing the RTP packets for handler and
+// the RTCP ones for rtcpHandler,which may be nil.
+func (r *RtpRecording) ReplayRtp(ctx context.Context, speed float64, handler RtpHandler, rtcpHandler RtcpHandler) error {
+	return r.Replay(ctx, speed, func(packet []byte, arrival time.Time) error {
+		if IsRtcp(packet) {
+			if rtcpHandler != nil {
+				if packets, err := UnmarshalRtcp(packet); err == nil {
+					rtcpHandler(packets, nil)
+				}
+			}
+			return nil
+		}
+		pkt := &RtpPacket{}
+		if err := pkt.Unmarshal(packet); err != nil {
+			return nil
+		}
+		handler(pkt, nil)
+		return nil
+	})
+}
+
+// Close closes the recording.
+func (r *RtpRecording) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,459 @@
+package av
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	utils "github.com/286897655/gopkgs/pkg/utils"
+)
+
+const (
+	rtpSessionDefaultRtcpInterval = 5 * time.Second
+	rtpSessionDefaultClockRate    = 90000
+	rtpSessionReadBufferSize      = 65536
+	rtpSessionBindRetry           = 8
+	// a source silent for this many report intervals is no longer reported
+	rtpSessionSourceTimeoutIntervals = 5
+)
+
+var ErrRtpSessionClosed = errors.New("rtp session: closed")
+
+// RtpHandler handles one received RTP packet,pkt is owned by the handler
+type RtpHandler func(pkt *RtpPacket, from *net.UDPAddr)
+
+// RtcpHandler handles the packets of one received compound RTCP packet
+type RtcpHandler func(packets []RtcpPacket, from *net.UDPAddr)
+
+// RtpSessionConfig configuration of RtpSession
+type RtpSessionConfig struct {
+	Ports        *utils.RangePort // the RTP/RTCP port pair is allocated from it
+	LocalIP      net.IP           // bind address,nil binds all addresses
+	SSRC         uint32           // local SSRC of reports,0 generates one
+	CNAME        string           // SDES CNAME,empty generates one
+	RtcpInterval time.Duration
+	// ClockRates clock rate of each payload type for the jitter,payload
+	// types not listed use 90000
+	ClockRates map[uint8]uint32
+
+	// Group multicast group of the session,nil for unicast.RTP and RTCP are
+	// sent to and received from Group:Port and Group:Port+1
+	Group net.IP
+	// Port RTP port of the group,0 allocates it from Ports
+	Port int
+	// Interface joins the group and sends on it,nil lets the system choose
+	Interface *net.Interface
+	// MulticastTTL TTL of the packets sent to the group,0 uses 16
+	MulticastTTL int
+	// MulticastLoopback loops the packets sent to the group back to the
+	// receivers of the local host
+	MulticastLoopback bool
+}
+
+// RtpSession a unicast or multicast RTP session on a consecutive RTP/RTCP
+// UDP port pair.
+// It dispatches received packets by SSRC then by payload type and
+// periodically sends RTCP sender or receiver reports to the remote
+type RtpSession struct {
+	conf      RtpSessionConfig
+	rtpPort   int
+	rtpConn   *net.UDPConn
+	rtcpConn  *net.UDPConn
+	ownsPorts bool // the port pair was allocated from conf.Ports
+	joined    bool
+
+	mu             sync.RWMutex
+	ssrcHandlers   map[uint32]RtpHandler
+	ptHandlers     map[uint8]RtpHandler
+	defaultHandler RtpHandler
+	rtcpHandler    RtcpHandler
+	remoteRtp      *net.UDPAddr
+	remoteRtcp     *net.UDPAddr
+
+	statsMu       sync.Mutex
+	sources       map[uint32]*RtpSourceStats
+	sentPackets   uint32
+	sentOctets    uint32
+	sentTimestamp uint32
+	sentTime      time.Time
+	sentClockRate uint32
+
+	started   bool
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewRtpSession allocates a port pair from conf.Ports and binds it,call Start
+// once the handlers are registered.
+// With conf.Group the session joins the group and sends to it.
+func NewRtpSession(conf RtpSessionConfig) (*RtpSession, error) {
+	if conf.Group != nil {
+		if !conf.Group.IsMulticast() || (conf.Port == 0 && conf.Ports == nil) || conf.Port%2 != 0 {
+			return nil, utils.ERR_INVALID_PARAMETER
+		}
+		if conf.MulticastTTL <= 0 {
+			conf.MulticastTTL = rtpSessionDefaultMulticastTTL
+		}
+	} else if conf.Ports == nil {
+		return nil, utils.ERR_INVALID_PARAMETER
+	}
+	if conf.SSRC == 0 {
+		conf.SSRC = NewSSRC()
+	}
+	if conf.CNAME == "" {
+		conf.CNAME = utils.RandomString(12)
+	}
+	if conf.RtcpInterval <= 0 {
+		conf.RtcpInterval = rtpSessionDefaultRtcpInterval
+	}
+	session := &RtpSession{
+		conf:         conf,
+		ssrcHandlers: make(map[uint32]RtpHandler),
+		ptHandlers:   make(map[uint8]RtpHandler),
+		sources:      make(map[uint32]*RtpSourceStats),
+		closeCh:      make(chan struct{}),
+	}
+
+	if conf.Group != nil && conf.Port != 0 {
+		rtpConn, rtcpConn, err := listenMulticast(&conf, conf.Port)
+		if err != nil {
+			return nil, err
+		}
+		session.rtpPort, session.rtpConn, session.rtcpConn = conf.Port, rtpConn, rtcpConn
+		session.initGroup()
+		return session, nil
+	}
+
+	var lastErr error
+	// the pair may be taken by another process between select and bind
+	for i := 0; i < rtpSessionBindRetry; i++ {
+		port, err := conf.Ports.SelectUdpPortPair()
+		if err != nil {
+			return nil, err
+		}
+		if conf.Group != nil {
+			rtpConn, rtcpConn, err := listenMulticast(&conf, port)
+			if err != nil {
+				conf.Ports.FreeUdpPortPair(port)
+				lastErr = err
+				continue
+			}
+			session.rtpPort, session.rtpConn, session.rtcpConn = port, rtpConn, rtcpConn
+			session.ownsPorts = true
+			session.initGroup()
+			return session, nil
+		}
+		rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: conf.LocalIP, Port: port})
+		if err != nil {
+			conf.Ports.FreeUdpPortPair(port)
+			lastErr = err
+			continue
+		}
+		rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: conf.LocalIP, Port: port + 1})
+		if err != nil {
+			rtpConn.Close()
+			conf.Ports.FreeUdpPortPair(port)
+			lastErr = err
+			continue
+		}
+		session.rtpPort, session.rtpConn, session.rtcpConn = port, rtpConn, rtcpConn
+		session.ownsPorts = true
+		return session, nil
+	}
+	return nil, lastErr
+}
+
+// initGroup sets the group as the remote of a joined multicast session
+func (s *RtpSession) initGroup() {
+	s.joined = true
+	s.remoteRtp = &net.UDPAddr{IP: s.conf.Group, Port: s.rtpPort}
+	s.remoteRtcp = &net.UDPAddr{IP: s.conf.Group, Port: s.rtpPort + 1}
+}
+
+// RtpPort returns the local RTP port,RTCP is RtpPort()+1.
+func (s *RtpSession) RtpPort() int {
+	return s.rtpPort
+}
+
+// RtcpPort returns the local RTCP port.
+func (s *RtpSession) RtcpPort() int {
+	return s.rtpPort + 1
+}
+
+// SSRC returns the local SSRC.
+func (s *RtpSession) SSRC() uint32 {
+	return s.conf.SSRC
+}
+
+// HandleSSRC registers the handler of packets from ssrc,nil unregisters.
+func (s *RtpSession) HandleSSRC(ssrc uint32, handler RtpHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if handler == nil {
+		delete(s.ssrcHandlers, ssrc)
+	} else {
+		s.ssrcHandlers[ssrc] = handler
+	}
+}
+
+// HandlePayloadType registers the handler of packets of payload type pt
+// without a SSRC handler,nil unregisters.
+func (s *RtpSession) HandlePayloadType(pt uint8, handler RtpHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if handler == nil {
+		delete(s.ptHandlers, pt)
+	} else {
+		s.ptHandlers[pt] = handler
+	}
+}
+
+// HandleDefault registers the handler of packets matching no other handler.
+func (s *RtpSession) HandleDefault(handler RtpHandler) {
+	s.mu.Lock()
+	s.defaultHandler = handler
+	s.mu.Unlock()
+}
+
+// HandleRtcp registers the handler of received RTCP.
+func (s *RtpSession) HandleRtcp(handler RtcpHandler) {
+	s.mu.Lock()
+	s.rtcpHandler = handler
+	s.mu.Unlock()
+}
+
+// SetRemote sets the destination of sent RTP and RTCP,when not set they are
+// learned from the first received packets.A multicast session sends to the
+// group by default.
+func (s *RtpSession) SetRemote(rtp, rtcp *net.UDPAddr) {
+	s.mu.Lock()
+	s.remoteRtp, s.remoteRtcp = rtp, rtcp
+	s.mu.Unlock()
+}
+
+// Start runs the read loops and the RTCP report timer.
+func (s *RtpSession) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.wg.Add(3)
+	go s.readRtp()
+	go s.readRtcp()
+	go s.runReports()
+}
+
+// WriteRtp sends pkt to the remote RTP address,the packet is accounted in
+// the sender reports.
+func (s *RtpSession) WriteRtp(pkt *RtpPacket) error {
+	select {
+	case <-s.closeCh:
+		return ErrRtpSessionClosed
+	default:
+	}
+	s.mu.RLock()
+	remote := s.remoteRtp
+	s.mu.RUnlock()
+	if remote == nil {
+		return errors.New("rtp session: no remote address")
+	}
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := s.rtpConn.WriteToUDP(buf, remote); err != nil {
+		return err
+	}
+
+	s.statsMu.Lock()
+	s.sentPackets++
+	s.sentOctets += uint32(len(pkt.Payload))
+	s.sentTimestamp = pkt.Timestamp
+	s.sentTime = time.Now()
+	s.sentClockRate = s.clockRate(pkt.PayloadType)
+	s.statsMu.Unlock()
+	return nil
+}
+
+// WriteRtcp sends packets as one compound packet to the remote RTCP address.
+func (s *RtpSession) WriteRtcp(packets ...RtcpPacket) error {
+	s.mu.RLock()
+	remote := s.remoteRtcp
+	s.mu.RUnlock()
+	if remote == nil {
+		return errors.New("rtp session: no remote rtcp address")
+	}
+	buf, err := MarshalRtcp(packets...)
+	if err != nil {
+		return err
+	}
+	_, err = s.rtcpConn.WriteToUDP(buf, remote)
+	return err
+}
+
+// Close sends RTCP BYE,stops the loops and frees the port pair.
+func (s *RtpSession) Close() error {
+	s.closeOnce.Do(func() {
+		s.WriteRtcp(&RtcpGoodbye{Sources: []uint32{s.conf.SSRC}})
+		close(s.closeCh)
+		s.rtpConn.Close()
+		s.rtcpConn.Close()
+		s.wg.Wait()
+		if s.ownsPorts {
+			s.conf.Ports.FreeUdpPortPair(s.rtpPort)
+		}
+	})
+	return nil
+}
+
+func (s *RtpSession) clockRate(pt uint8) uint32 {
+	if rate, ok := s.conf.ClockRates[pt]; ok {
+		return rate
+	}
+	return rtpSessionDefaultClockRate
+}
+
+func (s *RtpSession) readRtp() {
+	defer s.wg.Done()
+	buf := make([]byte, rtpSessionReadBufferSize)
+	for {
+		n, from, err := s.rtpConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		pkt := &RtpPacket{}
+		// the packet must not alias the read buffer
+		if err := pkt.UnmarshalStrict(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+		// our own packets looped back by the group
+		if s.conf.Group != nil && pkt.SSRC == s.conf.SSRC {
+			continue
+		}
+		s.dispatch(pkt, from)
+	}
+}
+
+func (s *RtpSession) dispatch(pkt *RtpPacket, from *net.UDPAddr) {
+	now := time.Now()
+	s.statsMu.Lock()
+	stats := s.sources[pkt.SSRC]
+	if stats == nil {
+		stats = NewRtpSourceStats(pkt.SSRC, s.clockRate(pkt.PayloadType))
+		s.sources[pkt.SSRC] = stats
+	}
+	stats.Update(&pkt.RtpHeader, now)
+	s.statsMu.Unlock()
+
+	s.mu.Lock()
+	if s.remoteRtp == nil {
+		s.remoteRtp = from
+	}
+	handler := s.ssrcHandlers[pkt.SSRC]
+	if handler == nil {
+		handler = s.ptHandlers[pkt.PayloadType]
+	}
+	if handler == nil {
+		handler = s.defaultHandler
+	}
+	s.mu.Unlock()
+
+	if handler != nil {
+		handler(pkt, from)
+	}
+}
+
+func (s *RtpSession) readRtcp() {
+	defer s.wg.Done()
+	buf := make([]byte, rtpSessionReadBufferSize)
+	for {
+		n, from, err := s.rtcpConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packets, err := UnmarshalRtcp(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		if ssrc, ok := rtcpSenderSSRC(packets); ok && s.conf.Group != nil && ssrc == s.conf.SSRC {
+			continue
+		}
+		now := time.Now()
+		s.statsMu.Lock()
+		for _, packet := range packets {
+			if sr, ok := packet.(*RtcpSenderReport); ok {
+				if stats := s.sources[sr.SSRC]; stats != nil {
+					stats.UpdateSenderReport(sr, now)
+				}
+			}
+		}
+		s.statsMu.Unlock()
+
+		s.mu.Lock()
+		if s.remoteRtcp == nil {
+			s.remoteRtcp = from
+		}
+		handler := s.rtcpHandler
+		s.mu.Unlock()
+		if handler != nil {
+			handler(packets, from)
+		}
+	}
+}
+
+func (s *RtpSession) runReports() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.conf.RtcpInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case now := <-ticker.C:
+			if packets := s.buildReports(now); packets != nil {
+				s.WriteRtcp(packets...)
+			}
+		}
+	}
+}
+
+// buildReports returns SR (when we sent since the start) or RR followed by
+// SDES,nil when there is nothing to report
+func (s *RtpSession) buildReports(now time.Time) []RtcpPacket {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	timeout := s.conf.RtcpInterval * rtpSessionSourceTimeoutIntervals
+	var reports []RtcpReceptionReport
+	for ssrc, stats := range s.sources {
+		if now.Sub(stats.LastArrival()) > timeout {
+			delete(s.sources, ssrc)
+			continue
+		}
+		if len(reports) < rtcpMaxCount {
+			reports = append(reports, stats.ReceptionReport(now))
+		}
+	}
+
+	var report RtcpPacket
+	if s.sentPackets > 0 {
+		report = &RtcpSenderReport{
+			SSRC:        s.conf.SSRC,
+			NTPTime:     NtpTime(now),
+			RTPTime:     s.sentTimestamp + uint32(DurationToRtpTicks(now.Sub(s.sentTime), s.sentClockRate)),
+			PacketCount: s.sentPackets,
+			OctetCount:  s.sentOctets,
+			Reports:     reports,
+		}
+	} else if len(reports) > 0 {
+		report = &RtcpReceiverReport{SSRC: s.conf.SSRC, Reports: reports}
+	} else {
+		return nil
+	}
+	sdes := &RtcpSourceDescription{Chunks: []RtcpSdesChunk{{SSRC: s.conf.SSRC, CNAME: s.conf.CNAME}}}
+	return []RtcpPacket{report, sdes}
+}
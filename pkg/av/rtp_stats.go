@@ -0,0 +1,163 @@
+package av
+
+import (
+	"time"
+)
+
+const (
+	rtpMaxDropout  = 3000
+	rtpMaxMisorder = 100
+	rtpSeqMod      = 1 << 16
+)
+
+// RtpSourceStats reception statistics of one SSRC,RFC 3550 A.1 A.3 A.8.
+// It is not safe for concurrent use
+type RtpSourceStats struct {
+	SSRC      uint32
+	ClockRate uint32
+
+	started        bool
+	maxSeq         uint16
+	cycles         uint32
+	baseSeq        uint32
+	badSeq         uint32
+	received       uint32
+	expectedPrior  uint32
+	receivedPrior  uint32
+	transit        uint32
+	jitter         float64
+	lastSRNtp      uint64
+	lastSRReceived time.Time
+	lastArrival    time.Time
+	firstArrival   time.Time
+}
+
+// NewRtpSourceStats creates the statistics of ssrc,clockRate is used for
+// the interarrival jitter.
+func NewRtpSourceStats(ssrc uint32, clockRate uint32) *RtpSourceStats {
+	return &RtpSourceStats{SSRC: ssrc, ClockRate: clockRate}
+}
+
+func (s *RtpSourceStats) reset(seq uint16) {
+	s.maxSeq = seq
+	s.cycles = 0
+	s.baseSeq = uint32(seq)
+	s.badSeq = rtpSeqMod + 1
+	s.received = 0
+	s.expectedPrior = 0
+	s.receivedPrior = 0
+}
+
+// Update accounts a packet received at arrival,it returns false for a packet
+// out of the valid sequence range (which may start a new sequence).
+func (s *RtpSourceStats) Update(h *RtpHeader, arrival time.Time) bool {
+	seq := h.SequenceNumber
+	if !s.started {
+		s.started = true
+		s.firstArrival = arrival
+		s.reset(seq)
+	} else {
+		udelta := seq - s.maxSeq
+		switch {
+		case udelta < rtpMaxDropout:
+			// in order,with permissible gap
+			if seq < s.maxSeq {
+				s.cycles += rtpSeqMod
+			}
+			s.maxSeq = seq
+		case udelta <= rtpSeqMod-rtpMaxMisorder:
+			// the sequence number made a very large jump
+			if uint32(seq) == s.badSeq {
+				// two sequential packets,assume the other side restarted
+				s.reset(seq)
+			} else {
+				s.badSeq = (uint32(seq) + 1) & (rtpSeqMod - 1)
+				return false
+			}
+		default:
+			// duplicate or reordered packet
+		}
+	}
+	s.received++
+	s.lastArrival = arrival
+
+	if s.ClockRate > 0 {
+		// arrival is counted from the first packet to not overflow
+		elapsed := arrival.Sub(s.firstArrival)
+		arrivalTicks := DurationToRtpTicks(elapsed, s.ClockRate)
+		// wrap-around of the timestamp cancels out in 32 bits arithmetic
+		transit := uint32(arrivalTicks) - h.Timestamp
+		if s.received > 1 {
+			d := RtpTimestampDiff(transit, s.transit)
+			if d < 0 {
+				d = -d
+			}
+			s.jitter += (float64(d) - s.jitter) / 16
+		}
+		s.transit = transit
+	}
+	return true
+}
+
+// UpdateSenderReport records a sender report of the source for LSR/DLSR.
+func (s *RtpSourceStats) UpdateSenderReport(sr *RtcpSenderReport, arrival time.Time) {
+	s.lastSRNtp = sr.NTPTime
+	s.lastSRReceived = arrival
+}
+
+// LastArrival returns the arrival time of the last accounted packet.
+func (s *RtpSourceStats) LastArrival() time.Time {
+	return s.lastArrival
+}
+
+// ExtendedMaxSequence returns the highest sequence number received extended
+// with the count of cycles.
+func (s *RtpSourceStats) ExtendedMaxSequence() uint32 {
+	return s.cycles + uint32(s.maxSeq)
+}
+
+// Received returns the count of accounted packets.
+func (s *RtpSourceStats) Received() uint32 {
+	return s.received
+}
+
+// Jitter returns the interarrival jitter in timestamp units.
+func (s *RtpSourceStats) Jitter() uint32 {
+	return uint32(s.jitter)
+}
+
+// ReceptionReport builds the report block of the source for now and starts
+// a new reporting interval.
+func (s *RtpSourceStats) ReceptionReport(now time.Time) RtcpReceptionReport {
+	extendedMax := s.ExtendedMaxSequence()
+	expected := extendedMax - s.baseSeq + 1
+	lost := int64(expected) - int64(s.received)
+	if lost < 0 {
+		lost = 0
+	} else if lost > 0x7FFFFF {
+		lost = 0x7FFFFF
+	}
+
+	expectedInterval := expected - s.expectedPrior
+	s.expectedPrior = expected
+	receivedInterval := s.received - s.receivedPrior
+	s.receivedPrior = s.received
+	lostInterval := int64(expectedInterval) - int64(receivedInterval)
+	var fraction uint8
+	if expectedInterval != 0 && lostInterval > 0 {
+		fraction = uint8((lostInterval << 8) / int64(expectedInterval))
+	}
+
+	report := RtcpReceptionReport{
+		SSRC:               s.SSRC,
+		FractionLost:       fraction,
+		TotalLost:          uint32(lost),
+		LastSequenceNumber: extendedMax,
+		Jitter:             s.Jitter(),
+	}
+	if !s.lastSRReceived.IsZero() {
+		report.LastSenderReport = uint32(s.lastSRNtp >> 16)
+		report.Delay = uint32(now.Sub(s.lastSRReceived).Seconds() * 65536)
+	}
+	return report
+}
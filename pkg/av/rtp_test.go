@@ -0,0 +1,348 @@
+package av
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// rtpCanonical reports whether the header of size n in buf is the one
+// Marshal produces,it is not when the RFC 8285 extension block holds
+// padding between elements,more padding than the 4 bytes alignment,an
+// element with the id 0 or elements after the reserved id 15
+func rtpCanonical(buf []byte, n int) bool {
+	if buf[0]&(1<<extensionShift) == 0 {
+		return true
+	}
+	start := csrcOffset + int(buf[0]&ccMask)*csrcLength
+	profile := binary.BigEndian.Uint16(buf[start:])
+	if profile != extensionProfileOneByte && profile != extensionProfileTwoByte {
+		return true
+	}
+	i, end := start+4, n
+	for i < end && buf[i] != 0 {
+		if profile == extensionProfileOneByte {
+			if buf[i]>>4 == 0 || buf[i]>>4 == extensionIDReserved {
+				return false
+			}
+			i += 1 + int(buf[i]&0x0F) + 1
+		} else {
+			i += 2 + int(buf[i+1])
+		}
+	}
+	// only the alignment padding may follow the elements
+	return (i-start+3)&^3 == end-start && bytes.Count(buf[i:end], []byte{0}) == end-i
+}
+
+func FuzzRtpHeaderUnmarshal(f *testing.F) {
+	for _, tt := range rtpTests {
+		f.Add(tt.raw)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var h RtpHeader
+		n, err := h.Unmarshal(data)
+		if err != nil {
+			return
+		}
+		out, err := h.Marshal()
+		if !rtpCanonical(data, n) {
+			// what Marshal produces is canonical
+			if err == nil {
+				var again RtpHeader
+				if m, err := again.Unmarshal(out); err != nil || m != len(out) {
+					t.Fatalf("remarshaled %x: %d %v", out, m, err)
+				}
+				if out2, _ := again.Marshal(); !bytes.Equal(out, out2) {
+					t.Fatalf("not stable\n%x\n%x", out, out2)
+				}
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("marshal %x: %v", data[:n], err)
+		}
+		if !bytes.Equal(out, data[:n]) {
+			t.Fatalf("remarshaled\n%x\nwant\n%x", out, data[:n])
+		}
+	})
+}
+
+func FuzzRtpPacketUnmarshal(f *testing.F) {
+	for _, tt := range rtpTests {
+		f.Add(tt.raw)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p RtpPacket
+		if err := p.Unmarshal(data); err != nil {
+			return
+		}
+		strict := p.UnmarshalStrict(data) == nil
+		var h RtpHeader
+		n, _ := h.Unmarshal(data)
+		// a padding bit without padding count is dropped
+		if !rtpCanonical(data, n) || (p.Padding && p.PaddingSize == 0) {
+			return
+		}
+		out, err := p.Marshal()
+		if err != nil {
+			t.Fatalf("marshal %x: %v", data, err)
+		}
+		// the padding octets but the count are not kept
+		want := append([]byte(nil), data...)
+		if p.PaddingSize > 0 {
+			for i := len(want) - int(p.PaddingSize); i < len(want)-1; i++ {
+				want[i] = 0
+			}
+		}
+		if !bytes.Equal(out, want) {
+			t.Fatalf("remarshaled\n%x\nwant\n%x", out, want)
+		}
+		if p.Version == RTP_VERSION && !strict {
+			t.Fatalf("strict rejects %x", data)
+		}
+	})
+}
+
+var rtpTests = []struct {
+	name   string
+	raw    []byte
+	packet RtpPacket
+}{
+	{
+		name: "basic",
+		raw: []byte{
+			0x80, 0xe0, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0x98, 0x36, 0xbe, 0x88, 0x9e,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Marker: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{}},
+			Payload: []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+		},
+	},
+	{
+		name: "one byte extension",
+		raw: []byte{
+			0x90, 0xe0, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0xbe, 0xde, 0x00, 0x02, 0x10, 0xaa, 0x21, 0xbb, 0xcc, 0x00, 0x00, 0x00,
+			0x98, 0x36, 0xbe, 0x88, 0x9e,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Extension: true, Marker: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{}, ExtensionProfile: extensionProfileOneByte,
+				Extensions: []RtpExtension{{id: 1, payload: []byte{0xaa}}, {id: 2, payload: []byte{0xbb, 0xcc}}}},
+			Payload: []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+		},
+	},
+	{
+		name: "two byte extension",
+		raw: []byte{
+			0x90, 0xe0, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0x10, 0x00, 0x00, 0x03, 0x01, 0x00, 0x10, 0x03, 0xaa, 0xbb, 0xcc, 0x05,
+			0x01, 0xdd, 0x00, 0x00,
+			0x98, 0x36, 0xbe, 0x88, 0x9e,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Extension: true, Marker: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{}, ExtensionProfile: extensionProfileTwoByte,
+				Extensions: []RtpExtension{{id: 1, payload: []byte{}}, {id: 16, payload: []byte{0xaa, 0xbb, 0xcc}},
+					{id: 5, payload: []byte{0xdd}}}},
+			Payload: []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+		},
+	},
+	{
+		name: "rfc 3550 extension",
+		raw: []byte{
+			0x90, 0x60, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0x00, 0x01, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff,
+			0x98, 0x36, 0xbe, 0x88, 0x9e,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Extension: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{}, ExtensionProfile: 1,
+				Extensions: []RtpExtension{{id: 0, payload: []byte{0xff, 0xff, 0xff, 0xff}}}},
+			Payload: []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+		},
+	},
+	{
+		name: "csrc and padding",
+		raw: []byte{
+			0xa2, 0xe0, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+			0x98, 0x36, 0xbe, 0x88, 0x9e, 0x00, 0x00, 0x03,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Padding: true, Marker: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{1, 2}},
+			Payload:     []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+			PaddingSize: 3,
+		},
+	},
+	{
+		name: "padding only",
+		raw: []byte{
+			0xa0, 0x60, 0x69, 0x8f, 0xd9, 0xc2, 0x93, 0xda, 0x1c, 0x64, 0x27, 0x82,
+			0x00, 0x00, 0x00, 0x04,
+		},
+		packet: RtpPacket{
+			RtpHeader: RtpHeader{Version: 2, Padding: true, PayloadType: 96, SequenceNumber: 27023,
+				Timestamp: 3653407706, SSRC: 476325762, CSRC: []uint32{}},
+			Payload:     []byte{},
+			PaddingSize: 4,
+		},
+	},
+}
+
+func TestRtpPacketRoundTrip(t *testing.T) {
+	for _, tt := range rtpTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p RtpPacket
+			if err := p.UnmarshalStrict(tt.raw); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tt.packet) {
+				t.Fatalf("unmarshal\n%+v\nwant\n%+v", p, tt.packet)
+			}
+			if size := tt.packet.MarshalSize(); size != len(tt.raw) {
+				t.Fatalf("marshal size %d,want %d", size, len(tt.raw))
+			}
+			raw, err := tt.packet.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(raw, tt.raw) {
+				t.Fatalf("marshal\n%x\nwant\n%x", raw, tt.raw)
+			}
+		})
+	}
+}
+
+func TestRtpHeaderCsrc(t *testing.T) {
+	for count := 0; count <= 15; count++ {
+		h := RtpHeader{Version: RTP_VERSION, PayloadType: 8, SequenceNumber: uint16(count), SSRC: 0xdeadbeef,
+			CSRC: make([]uint32, count)}
+		for i := range h.CSRC {
+			h.CSRC[i] = uint32(i + 1)
+		}
+		raw, err := h.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) != RTP_HEADER_SIZE+count*csrcLength || int(raw[0]&ccMask) != count {
+			t.Fatalf("%d csrc: marshaled %x", count, raw)
+		}
+		var got RtpHeader
+		n, err := got.Unmarshal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(raw) || !reflect.DeepEqual(got, h) {
+			t.Fatalf("%d csrc: unmarshal %d %+v", count, n, got)
+		}
+		if _, err := got.Unmarshal(raw[:len(raw)-1]); !errors.Is(err, ErrTruncatedHeader) {
+			t.Fatalf("%d csrc truncated: %v", count, err)
+		}
+	}
+
+	h := RtpHeader{Version: RTP_VERSION, CSRC: make([]uint32, 16)}
+	if _, err := h.Marshal(); err == nil {
+		t.Fatal("16 csrc marshaled")
+	}
+}
+
+func TestRtpExtensions(t *testing.T) {
+	var h RtpHeader
+	h.Version = RTP_VERSION
+	if err := h.SetExtension(1, []byte{0xaa}); err != nil {
+		t.Fatal(err)
+	}
+	if h.ExtensionProfile != extensionProfileOneByte {
+		t.Fatalf("profile %#x", h.ExtensionProfile)
+	}
+	// a 17 bytes element switches to the two byte profile
+	long := bytes.Repeat([]byte{0xbb}, 17)
+	if err := h.SetExtension(2, long); err != nil {
+		t.Fatal(err)
+	}
+	if h.ExtensionProfile != extensionProfileTwoByte {
+		t.Fatalf("profile %#x", h.ExtensionProfile)
+	}
+	raw, err := h.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got RtpHeader
+	if _, err := got.UnmarshalStrict(raw); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.GetExtension(1), []byte{0xaa}) || !bytes.Equal(got.GetExtension(2), long) {
+		t.Fatalf("extensions %+v", got.Extensions)
+	}
+	got.DelExtension(1)
+	got.DelExtension(2)
+	if got.Extension || got.MarshalSize() != RTP_HEADER_SIZE {
+		t.Fatalf("extension left %+v", got)
+	}
+
+	invalid := []RtpHeader{
+		{Version: 2, Extension: true, ExtensionProfile: extensionProfileOneByte,
+			Extensions: []RtpExtension{{id: 15, payload: []byte{1}}}},
+		{Version: 2, Extension: true, ExtensionProfile: extensionProfileOneByte,
+			Extensions: []RtpExtension{{id: 1, payload: long}}},
+		{Version: 2, Extension: true, ExtensionProfile: extensionProfileTwoByte,
+			Extensions: []RtpExtension{{id: 0, payload: []byte{1}}}},
+		{Version: 2, Extension: true, ExtensionProfile: 1,
+			Extensions: []RtpExtension{{payload: []byte{1, 2, 3}}}},
+	}
+	for _, h := range invalid {
+		if _, err := h.Marshal(); err == nil {
+			t.Fatalf("marshaled %+v", h)
+		}
+	}
+}
+
+func TestRtpTruncated(t *testing.T) {
+	basic := rtpTests[0].raw
+	oneByte := rtpTests[1].raw
+	twoByte := rtpTests[2].raw
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{"empty", nil, ErrTruncatedHeader},
+		{"fixed header", basic[:RTP_HEADER_SIZE-1], ErrTruncatedHeader},
+		{"csrc", append([]byte{0x82}, basic[1:RTP_HEADER_SIZE+4]...), ErrTruncatedHeader},
+		{"extension header", oneByte[:RTP_HEADER_SIZE+3], ErrTruncatedExtension},
+		{"extension body", oneByte[:RTP_HEADER_SIZE+7], ErrTruncatedExtension},
+		{"one byte element", append(append([]byte(nil), oneByte[:RTP_HEADER_SIZE+4]...),
+			0x17, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00, 0x00), ErrTruncatedExtension},
+		{"two byte element", append(append([]byte(nil), twoByte[:RTP_HEADER_SIZE+2]...),
+			0x00, 0x01, 0x01, 0x04, 0xaa, 0xbb), ErrTruncatedExtension},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p RtpPacket
+			if err := p.Unmarshal(tt.raw); !errors.Is(err, tt.err) {
+				t.Fatalf("unmarshal: %v,want %v", err, tt.err)
+			}
+			if err := p.UnmarshalStrict(tt.raw); !errors.Is(err, tt.err) {
+				t.Fatalf("unmarshal strict: %v,want %v", err, tt.err)
+			}
+		})
+	}
+
+	// padding larger than the payload
+	bad := append([]byte(nil), rtpTests[4].raw...)
+	bad[len(bad)-1] = 0xff
+	var p RtpPacket
+	if err := p.Unmarshal(bad); !errors.Is(err, ErrBadPadding) {
+		t.Fatalf("padding: %v", err)
+	}
+	bad = append([]byte{0x40}, basic[1:]...)
+	if err := p.UnmarshalStrict(bad); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("version: %v", err)
+	}
+}
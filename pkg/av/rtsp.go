@@ -0,0 +1,391 @@
+package av
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	RTSP_VERSION = "RTSP/1.0"
+
+	RTSP_OPTIONS       = "OPTIONS"
+	RTSP_DESCRIBE      = "DESCRIBE"
+	RTSP_SETUP         = "SETUP"
+	RTSP_PLAY          = "PLAY"
+	RTSP_PAUSE         = "PAUSE"
+	RTSP_TEARDOWN      = "TEARDOWN"
+	RTSP_GET_PARAMETER = "GET_PARAMETER"
+	RTSP_SET_PARAMETER = "SET_PARAMETER"
+
+	// interleaved binary data frame starts with '$'
+	RTSP_INTERLEAVED_MAGIC = 0x24
+)
+
+const (
+	rtspMaxBodySize = 64 * 1024
+)
+
+var errRtspBadMessage = errors.New("rtsp: malformed message")
+
+// rtspHeaderNames keeps the spelling RTSP peers expect for headers which
+// textproto would canonicalize differently
+var rtspHeaderNames = map[string]string{
+	"Cseq":             "CSeq",
+	"Rtp-Info":         "RTP-Info",
+	"Www-Authenticate": "WWW-Authenticate",
+}
+
+// RtspHeader header fields of an RTSP message,keys are canonical MIME keys
+type RtspHeader map[string]string
+
+// Get returns the value of key,key is case insensitive.
+func (h RtspHeader) Get(key string) string {
+	return h[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// Set sets the value of key,key is case insensitive.
+func (h RtspHeader) Set(key, value string) {
+	h[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+func (h RtspHeader) write(w io.Writer) {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	// CSeq first and the rest sorted to have stable output
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == "Cseq" || keys[j] == "Cseq" {
+			return keys[i] == "Cseq"
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		name := key
+		if spelled, ok := rtspHeaderNames[key]; ok {
+			name = spelled
+		}
+		fmt.Fprintf(w, "%s: %s\r\n", name, h[key])
+	}
+}
+
+func readRtspHeader(r *textproto.Reader) (RtspHeader, error) {
+	mime, err := r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	h := make(RtspHeader, len(mime))
+	for key, values := range mime {
+		h[key] = values[0]
+	}
+	return h, nil
+}
+
+func readRtspBody(r *bufio.Reader, h RtspHeader) ([]byte, error) {
+	length := h.Get("Content-Length")
+	if length == "" {
+		return nil, nil
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil || size < 0 || size > rtspMaxBodySize {
+		return nil, fmt.Errorf("rtsp: invalid content length %q", length)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// RtspRequest an RTSP request message
+type RtspRequest struct {
+	Method string
+	URL    *url.URL
+	Header RtspHeader
+	Body   []byte
+}
+
+// ReadRtspRequest reads one request from r.
+func ReadRtspRequest(r *bufio.Reader) (*RtspRequest, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || parts[2] != RTSP_VERSION {
+		return nil, errRtspBadMessage
+	}
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	req := &RtspRequest{Method: parts[0], URL: u}
+	if req.Header, err = readRtspHeader(tp); err != nil {
+		return nil, err
+	}
+	if req.Body, err = readRtspBody(r, req.Header); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Write writes the request to w.
+func (req *RtspRequest) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s\r\n", req.Method, req.URL.String(), RTSP_VERSION)
+	if req.Header == nil {
+		req.Header = RtspHeader{}
+	}
+	if len(req.Body) > 0 {
+		req.Header.Set("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	req.Header.write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(req.Body)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// RtspResponse an RTSP response message
+type RtspResponse struct {
+	StatusCode int
+	Reason     string
+	Header     RtspHeader
+	Body       []byte
+}
+
+// NewRtspResponse creates a response answering req with the passed status.
+func NewRtspResponse(req *RtspRequest, code int) *RtspResponse {
+	res := &RtspResponse{StatusCode: code, Header: RtspHeader{}}
+	if req != nil {
+		res.Header.Set("CSeq", req.Header.Get("CSeq"))
+	}
+	return res
+}
+
+// ReadRtspResponse reads one response from r.
+func ReadRtspResponse(r *bufio.Reader) (*RtspResponse, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || parts[0] != RTSP_VERSION {
+		return nil, errRtspBadMessage
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errRtspBadMessage
+	}
+	res := &RtspResponse{StatusCode: code}
+	if len(parts) == 3 {
+		res.Reason = parts[2]
+	}
+	if res.Header, err = readRtspHeader(tp); err != nil {
+		return nil, err
+	}
+	if res.Body, err = readRtspBody(r, res.Header); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Write writes the response to w.
+func (res *RtspResponse) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	reason := res.Reason
+	if reason == "" {
+		reason = RtspStatusText(res.StatusCode)
+	}
+	fmt.Fprintf(&buf, "%s %d %s\r\n", RTSP_VERSION, res.StatusCode, reason)
+	if res.Header == nil {
+		res.Header = RtspHeader{}
+	}
+	if len(res.Body) > 0 {
+		res.Header.Set("Content-Length", strconv.Itoa(len(res.Body)))
+	}
+	res.Header.write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(res.Body)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// RtspStatusText returns the reason phrase of an RTSP status code.
+func RtspStatusText(code int) string {
+	switch code {
+	case 200:
+		return "OK"
+	case 400:
+		return "Bad Request"
+	case 401:
+		return "Unauthorized"
+	case 404:
+		return "Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 454:
+		return "Session Not Found"
+	case 455:
+		return "Method Not Valid in This State"
+	case 459:
+		return "Aggregate Operation Not Allowed"
+	case 461:
+		return "Unsupported Transport"
+	case 500:
+		return "Internal Server Error"
+	case 501:
+		return "Not Implemented"
+	case 503:
+		return "Service Unavailable"
+	}
+	return "Unknown"
+}
+
+// ReadRtspInterleaved reads one '$' framed packet,the magic byte must not be
+// consumed yet.
+func ReadRtspInterleaved(r *bufio.Reader) (channel uint8, payload []byte, err error) {
+	var head [4]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	if head[0] != RTSP_INTERLEAVED_MAGIC {
+		return 0, nil, errRtspBadMessage
+	}
+	payload = make([]byte, int(head[2])<<8|int(head[3]))
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return head[1], payload, nil
+}
+
+// AppendRtspInterleaved appends payload framed for channel to buf.
+func AppendRtspInterleaved(buf []byte, channel uint8, payload []byte) []byte {
+	buf = append(buf, RTSP_INTERLEAVED_MAGIC, channel, byte(len(payload)>>8), byte(len(payload)))
+	return append(buf, payload...)
+}
+
+// RtspTransport the parsed Transport header (RFC 2326 12.39),only the first
+// transport specification is kept
+type RtspTransport struct {
+	Protocol    string // RTP/AVP or RTP/AVP/TCP
+	Multicast   bool
+	Destination net.IP
+	ClientPort  [2]int
+	ServerPort  [2]int
+	Port        [2]int // multicast port pair
+	Interleaved [2]int
+	TTL         int
+	SSRC        uint32
+	HasSSRC     bool
+	Mode        string
+}
+
+// IsTCP reports whether RTP is interleaved into the RTSP connection.
+func (t *RtspTransport) IsTCP() bool {
+	return strings.HasSuffix(t.Protocol, "/TCP")
+}
+
+func parseRtspPortRange(value string) ([2]int, error) {
+	var ports [2]int
+	lo, hi, found := strings.Cut(value, "-")
+	var err error
+	if ports[0], err = strconv.Atoi(lo); err != nil {
+		return ports, err
+	}
+	ports[1] = ports[0] + 1
+	if found {
+		if ports[1], err = strconv.Atoi(hi); err != nil {
+			return ports, err
+		}
+	}
+	return ports, nil
+}
+
+// ParseRtspTransport parses a Transport header value.
+func ParseRtspTransport(value string) (*RtspTransport, error) {
+	spec, _, _ := strings.Cut(value, ",")
+	fields := strings.Split(spec, ";")
+	t := &RtspTransport{Protocol: strings.ToUpper(strings.TrimSpace(fields[0]))}
+	if t.Protocol != "RTP/AVP" && t.Protocol != "RTP/AVP/UDP" && t.Protocol != "RTP/AVP/TCP" {
+		return nil, fmt.Errorf("rtsp: unsupported transport %q", fields[0])
+	}
+	var err error
+	for _, field := range fields[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch strings.ToLower(key) {
+		case "unicast":
+			t.Multicast = false
+		case "multicast":
+			t.Multicast = true
+		case "destination":
+			t.Destination = net.ParseIP(val)
+		case "client_port":
+			t.ClientPort, err = parseRtspPortRange(val)
+		case "server_port":
+			t.ServerPort, err = parseRtspPortRange(val)
+		case "port":
+			t.Port, err = parseRtspPortRange(val)
+		case "interleaved":
+			t.Interleaved, err = parseRtspPortRange(val)
+		case "ttl":
+			t.TTL, err = strconv.Atoi(val)
+		case "ssrc":
+			var ssrc uint64
+			ssrc, err = strconv.ParseUint(val, 16, 32)
+			t.SSRC, t.HasSSRC = uint32(ssrc), true
+		case "mode":
+			t.Mode = strings.Trim(val, `"`)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rtsp: invalid transport parameter %q", field)
+		}
+	}
+	return t, nil
+}
+
+// String formats the transport as a Transport header value.
+func (t *RtspTransport) String() string {
+	parts := []string{t.Protocol}
+	if t.Multicast {
+		parts = append(parts, "multicast")
+	} else {
+		parts = append(parts, "unicast")
+	}
+	if t.Destination != nil {
+		parts = append(parts, "destination="+t.Destination.String())
+	}
+	if t.IsTCP() {
+		parts = append(parts, fmt.Sprintf("interleaved=%d-%d", t.Interleaved[0], t.Interleaved[1]))
+	} else if t.Multicast {
+		parts = append(parts, fmt.Sprintf("port=%d-%d", t.Port[0], t.Port[1]))
+		if t.TTL > 0 {
+			parts = append(parts, fmt.Sprintf("ttl=%d", t.TTL))
+		}
+	} else {
+		if t.ClientPort[0] != 0 {
+			parts = append(parts, fmt.Sprintf("client_port=%d-%d", t.ClientPort[0], t.ClientPort[1]))
+		}
+		if t.ServerPort[0] != 0 {
+			parts = append(parts, fmt.Sprintf("server_port=%d-%d", t.ServerPort[0], t.ServerPort[1]))
+		}
+	}
+	if t.HasSSRC {
+		parts = append(parts, fmt.Sprintf("ssrc=%08X", t.SSRC))
+	}
+	if t.Mode != "" {
+		parts = append(parts, "mode="+t.Mode)
+	}
+	return strings.Join(parts, ";")
+}
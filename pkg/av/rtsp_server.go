@@ -0,0 +1,1078 @@
+package av
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	utils "github.com/286897655/gopkgs/pkg/utils"
+)
+
+const (
+	rtspDefaultSessionTimeout = 60 * time.Second
+	rtspDefaultRtcpInterval   = 5 * time.Second
+	rtspWriteTimeout          = 10 * time.Second
+	rtspConnQueueSize         = 512
+	rtspTrackControlPrefix    = "trackID="
+	rtspPublicMethods         = "OPTIONS, DESCRIBE, SETUP, PLAY, PAUSE, TEARDOWN, GET_PARAMETER, SET_PARAMETER"
+	rtspReadBufferSize        = 1500
+)
+
+var (
+	ErrRtspServerClosed = errors.New("rtsp: server closed")
+	ErrRtspTrackID      = errors.New("rtsp: invalid track id")
+)
+
+// RtspTrack describes one media of an RtspStream,used to generate its SDP
+type RtspTrack struct {
+	Media        string // video or audio
+	PayloadType  uint8
+	EncodingName string // H264,H265,PCMA,MPEG4-GENERIC,MP2P...
+	ClockRate    uint32
+	Channels     int    // audio channels,0 means unspecified
+	Fmtp         string // a=fmtp parameters without the payload type
+}
+
+func (t *RtspTrack) sdpMedia(trackID int) *SdpMedia {
+	pt := strconv.Itoa(int(t.PayloadType))
+	m := &SdpMedia{Media: t.Media, Proto: "RTP/AVP", Formats: []string{pt}}
+	rtpmap := fmt.Sprintf("%s %s/%d", pt, t.EncodingName, t.ClockRate)
+	if t.Channels > 0 {
+		rtpmap += "/" + strconv.Itoa(t.Channels)
+	}
+	m.AddAttribute("rtpmap", rtpmap)
+	if t.Fmtp != "" {
+		m.AddAttribute("fmtp", pt+" "+t.Fmtp)
+	}
+	m.AddAttribute("control", rtspTrackControlPrefix+strconv.Itoa(trackID))
+	return m
+}
+
+// rtspTrackState what the stream knows of the latest packet of a track
+type rtspTrackState struct {
+	received      bool
+	ssrc          uint32
+	seq           uint16
+	timestamp     uint32
+	arrival       time.Time
+	packetCount   uint32
+	octetCount    uint32
+	multicastAddr *net.UDPAddr
+}
+
+// RtspStream a set of tracks fed with RtpPackets by a producer and
+// re-published to every playing RTSP session
+type RtspStream struct {
+	Name    string
+	tracks  []*RtspTrack
+	mu      sync.RWMutex
+	states  []rtspTrackState
+	readers map[*rtspSession]struct{}
+	group   net.IP // multicast group,allocated on the first multicast SETUP
+}
+
+// NewRtspStream creates a stream with fixed tracks,the index of a track is
+// its track id.
+func NewRtspStream(name string, tracks ...*RtspTrack) *RtspStream {
+	return &RtspStream{
+		Name:    name,
+		tracks:  tracks,
+		states:  make([]rtspTrackState, len(tracks)),
+		readers: make(map[*rtspSession]struct{}),
+	}
+}
+
+// Tracks returns the tracks of the stream.
+func (s *RtspStream) Tracks() []*RtspTrack {
+	return s.tracks
+}
+
+// SessionDescription generates the SDP announced by DESCRIBE.
+func (s *RtspStream) SessionDescription(host string) *SessionDescription {
+	ip := net.ParseIP(host)
+	addrType := "IP4"
+	if ip != nil && ip.To4() == nil {
+		addrType = "IP6"
+	}
+	if ip == nil {
+		host = "0.0.0.0"
+	}
+	name := s.Name
+	if name == "" {
+		name = "Stream"
+	}
+	sd := &SessionDescription{
+		Origin:      fmt.Sprintf("- %d 1 IN %s %s", time.Now().Unix(), addrType, host),
+		SessionName: name,
+		Connection:  "IN IP4 0.0.0.0",
+	}
+	if addrType == "IP6" {
+		sd.Connection = "IN IP6 ::"
+	}
+	sd.AddAttribute("tool", "gopkgs")
+	sd.AddAttribute("range", "npt=0-")
+	sd.AddAttribute("control", "*")
+	for i, track := range s.tracks {
+		sd.Medias = append(sd.Medias, track.sdpMedia(i))
+	}
+	return sd
+}
+
+// WritePacket publishes pkt on track trackID to every playing session.
+func (s *RtspStream) WritePacket(trackID int, pkt *RtpPacket) error {
+	if trackID < 0 || trackID >= len(s.tracks) {
+		return ErrRtspTrackID
+	}
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	state := &s.states[trackID]
+	state.received = true
+	state.ssrc = pkt.SSRC
+	state.seq = pkt.SequenceNumber
+	state.timestamp = pkt.Timestamp
+	state.arrival = time.Now()
+	state.packetCount++
+	state.octetCount += uint32(len(pkt.Payload))
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var multicast *rtspSession
+	for sess := range s.readers {
+		if sess.writeRtp(trackID, buf, len(pkt.Payload)) {
+			multicast = sess
+		}
+	}
+	// a multicast track is sent once for all of its readers
+	if multicast != nil && state.multicastAddr != nil {
+		multicast.server.rtpConn.WriteToUDP(buf, state.multicastAddr)
+	}
+	return nil
+}
+
+// Close tears down every session reading the stream.
+func (s *RtspStream) Close() {
+	s.mu.Lock()
+	readers := make([]*rtspSession, 0, len(s.readers))
+	for sess := range s.readers {
+		readers = append(readers, sess)
+	}
+	s.mu.Unlock()
+	for _, sess := range readers {
+		sess.close()
+	}
+}
+
+func (s *RtspStream) addReader(sess *rtspSession) {
+	s.mu.Lock()
+	s.readers[sess] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *RtspStream) removeReader(sess *rtspSession) {
+	s.mu.Lock()
+	delete(s.readers, sess)
+	s.mu.Unlock()
+}
+
+func (s *RtspStream) trackState(trackID int) rtspTrackState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.states[trackID]
+}
+
+// RtspStreamSource resolves the stream of a request path,a nil stream
+// without error answers 404.The opened stream is kept as if passed to Handle
+// so later requests of the path are served by the same stream until Unhandle
+type RtspStreamSource interface {
+	OpenStream(path string) (*RtspStream, error)
+}
+
+// RtspStreamSourceFunc adapts a function to RtspStreamSource
+type RtspStreamSourceFunc func(path string) (*RtspStream, error)
+
+func (f RtspStreamSourceFunc) OpenStream(path string) (*RtspStream, error) {
+	return f(path)
+}
+
+// RtspServerConfig configuration of RtspServer
+type RtspServerConfig struct {
+	Address string // RTSP listen address,":554"
+	// UdpRtpPort the even port receiving and sending RTP of UDP transport,
+	// RTCP uses UdpRtpPort+1.0 disables UDP and multicast transport
+	UdpRtpPort int
+	// MulticastRange the group range allocated to streams,"239.0.0.0/16".
+	// empty disables multicast
+	MulticastRange string
+	// MulticastPort first port of multicast,track n uses MulticastPort+2n
+	MulticastPort  int
+	MulticastTTL   int
+	SessionTimeout time.Duration
+	RtcpInterval   time.Duration
+	Source         RtspStreamSource // consulted when the path is not handled
+}
+
+// RtspServer re-publishes RtspStreams to RTSP clients with UDP,multicast or
+// TCP interleaved transport and per-session RTCP sender reports
+type RtspServer struct {
+	conf      RtspServerConfig
+	listener  net.Listener
+	rtpConn   *net.UDPConn
+	rtcpConn  *net.UDPConn
+	multicast *net.IPNet
+
+	mu        sync.Mutex
+	streams   map[string]*RtspStream
+	sessions  map[string]*rtspSession
+	udpPeers  map[string]*rtspSession // rtcp address of the client
+	conns     map[*rtspConn]struct{}
+	nextGroup uint32
+	closed    bool
+	closeCh   chan struct{}
+	cname     string
+	wg        sync.WaitGroup
+}
+
+// NewRtspServer creates a server,call ListenAndServe or Serve to run it.
+func NewRtspServer(conf RtspServerConfig) (*RtspServer, error) {
+	if conf.SessionTimeout <= 0 {
+		conf.SessionTimeout = rtspDefaultSessionTimeout
+	}
+	if conf.RtcpInterval <= 0 {
+		conf.RtcpInterval = rtspDefaultRtcpInterval
+	}
+	if conf.MulticastTTL <= 0 {
+		conf.MulticastTTL = 16
+	}
+	server := &RtspServer{
+		conf:     conf,
+		streams:  make(map[string]*RtspStream),
+		sessions: make(map[string]*rtspSession),
+		udpPeers: make(map[string]*rtspSession),
+		conns:    make(map[*rtspConn]struct{}),
+		closeCh:  make(chan struct{}),
+		cname:    utils.RandomString(12),
+	}
+	if conf.MulticastRange != "" {
+		if conf.UdpRtpPort == 0 || conf.MulticastPort == 0 {
+			return nil, errors.New("rtsp: multicast requires UdpRtpPort and MulticastPort")
+		}
+		_, ipnet, err := net.ParseCIDR(conf.MulticastRange)
+		if err != nil {
+			return nil, err
+		}
+		if !ipnet.IP.IsMulticast() || ipnet.IP.To4() == nil {
+			return nil, fmt.Errorf("rtsp: %s is not an IPv4 multicast range", conf.MulticastRange)
+		}
+		server.multicast = ipnet
+	}
+	if conf.UdpRtpPort%2 != 0 {
+		return nil, fmt.Errorf("rtsp: rtp port %d is not even", conf.UdpRtpPort)
+	}
+	return server, nil
+}
+
+// Handle publishes stream at path,path is the URL path like "/live/1".
+func (server *RtspServer) Handle(path string, stream *RtspStream) {
+	server.mu.Lock()
+	server.streams[rtspCleanPath(path)] = stream
+	server.mu.Unlock()
+}
+
+// Unhandle removes the stream of path and tears down its sessions.
+func (server *RtspServer) Unhandle(path string) {
+	server.mu.Lock()
+	stream := server.streams[rtspCleanPath(path)]
+	delete(server.streams, rtspCleanPath(path))
+	server.mu.Unlock()
+	if stream != nil {
+		stream.Close()
+	}
+}
+
+// ListenAndServe listens on conf.Address and serves until Close.
+func (server *RtspServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", server.conf.Address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve accepts RTSP connections on listener until Close.
+func (server *RtspServer) Serve(listener net.Listener) error {
+	server.mu.Lock()
+	if server.closed {
+		server.mu.Unlock()
+		listener.Close()
+		return ErrRtspServerClosed
+	}
+	server.listener = listener
+	server.mu.Unlock()
+
+	if server.conf.UdpRtpPort != 0 {
+		rtpConn, rtcpConn, err := server.listenUdp()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		server.mu.Lock()
+		if server.closed {
+			server.mu.Unlock()
+			rtpConn.Close()
+			rtcpConn.Close()
+			return ErrRtspServerClosed
+		}
+		server.rtpConn, server.rtcpConn = rtpConn, rtcpConn
+		server.mu.Unlock()
+		server.wg.Add(2)
+		go server.readUdp(rtpConn, false)
+		go server.readUdp(rtcpConn, true)
+	}
+	server.wg.Add(1)
+	go server.runTimers()
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-server.closeCh:
+				return ErrRtspServerClosed
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		conn := newRtspConn(server, netConn)
+		server.mu.Lock()
+		server.conns[conn] = struct{}{}
+		server.mu.Unlock()
+		go conn.serve()
+	}
+}
+
+// listenUdp opens the RTP and RTCP sockets,multicast is sent from them with
+// the ttl advertised in the Transport header
+func (server *RtspServer) listenUdp() (rtpConn, rtcpConn *net.UDPConn, err error) {
+	if rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: server.conf.UdpRtpPort}); err != nil {
+		return nil, nil, err
+	}
+	if rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: server.conf.UdpRtpPort + 1}); err != nil {
+		rtpConn.Close()
+		return nil, nil, err
+	}
+	if server.multicast != nil {
+		for _, conn := range []*net.UDPConn{rtpConn, rtcpConn} {
+			if err = setMulticastTTL(conn, false, server.conf.MulticastTTL); err != nil {
+				rtpConn.Close()
+				rtcpConn.Close()
+				return nil, nil, err
+			}
+		}
+	}
+	return rtpConn, rtcpConn, nil
+}
+
+// Close stops the server and tears down every connection and session.
+func (server *RtspServer) Close() error {
+	server.mu.Lock()
+	if server.closed {
+		server.mu.Unlock()
+		return nil
+	}
+	server.closed = true
+	close(server.closeCh)
+	listener := server.listener
+	rtpConn, rtcpConn := server.rtpConn, server.rtcpConn
+	conns := make([]*rtspConn, 0, len(server.conns))
+	for conn := range server.conns {
+		conns = append(conns, conn)
+	}
+	server.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+	for _, conn := range conns {
+		conn.close()
+	}
+	if rtpConn != nil {
+		rtpConn.Close()
+		rtcpConn.Close()
+	}
+	server.wg.Wait()
+	return nil
+}
+
+func rtspCleanPath(path string) string {
+	return "/" + strings.Trim(path, "/")
+}
+
+// lookup resolves the stream of path and the track id in the trailing
+// control part,trackID is -1 for the aggregate url
+func (server *RtspServer) lookup(u *url.URL) (stream *RtspStream, trackID int, err error) {
+	path := rtspCleanPath(u.Path)
+	trackID = -1
+	if i := strings.LastIndex(path, "/"+rtspTrackControlPrefix); i >= 0 {
+		id, err := strconv.Atoi(path[i+1+len(rtspTrackControlPrefix):])
+		if err != nil {
+			return nil, 0, ErrRtspTrackID
+		}
+		trackID, path = id, rtspCleanPath(path[:i])
+	}
+
+	server.mu.Lock()
+	stream = server.streams[path]
+	server.mu.Unlock()
+	if stream == nil && server.conf.Source != nil {
+		if stream, err = server.openStream(path); err != nil {
+			return nil, 0, err
+		}
+	}
+	if stream != nil && trackID >= len(stream.tracks) {
+		return nil, 0, ErrRtspTrackID
+	}
+	return stream, trackID, nil
+}
+
+// rtspLookupStatus the status answering a failed lookup,unknown streams and
+// tracks are 404 and Source failures 500
+func rtspLookupStatus(err error) int {
+	if err == nil || errors.Is(err, ErrRtspTrackID) {
+		return 404
+	}
+	return 500
+}
+
+// openStream opens path from the Source and keeps the stream,a stream opened
+// concurrently for the same path wins over this one
+func (server *RtspServer) openStream(path string) (*RtspStream, error) {
+	stream, err := server.conf.Source.OpenStream(path)
+	if err != nil || stream == nil {
+		return nil, err
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if opened := server.streams[path]; opened != nil {
+		return opened, nil
+	}
+	server.streams[path] = stream
+	return stream, nil
+}
+
+// allocMulticast assigns a group address to stream and the port pair of trackID
+func (server *RtspServer) allocMulticast(stream *RtspStream, trackID int) (*net.UDPAddr, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.group == nil {
+		ones, bits := server.multicast.Mask.Size()
+		size := uint32(1) << uint(bits-ones)
+		base := binary.BigEndian.Uint32(server.multicast.IP.To4())
+		// skip the network address
+		server.nextGroup++
+		if server.nextGroup >= size {
+			server.nextGroup = 1
+		}
+		group := make(net.IP, 4)
+		binary.BigEndian.PutUint32(group, base+server.nextGroup)
+		stream.group = group
+	}
+	state := &stream.states[trackID]
+	if state.multicastAddr == nil {
+		state.multicastAddr = &net.UDPAddr{IP: stream.group, Port: server.conf.MulticastPort + 2*trackID}
+	}
+	return state.multicastAddr, nil
+}
+
+func (server *RtspServer) addSession(sess *rtspSession) {
+	server.mu.Lock()
+	server.sessions[sess.id] = sess
+	server.mu.Unlock()
+}
+
+func (server *RtspServer) session(id string) *rtspSession {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.sessions[id]
+}
+
+func (server *RtspServer) removeSession(sess *rtspSession) {
+	server.mu.Lock()
+	delete(server.sessions, sess.id)
+	for key, peer := range server.udpPeers {
+		if peer == sess {
+			delete(server.udpPeers, key)
+		}
+	}
+	server.mu.Unlock()
+}
+
+func (server *RtspServer) addUdpPeer(addr *net.UDPAddr, sess *rtspSession) {
+	server.mu.Lock()
+	server.udpPeers[addr.String()] = sess
+	server.mu.Unlock()
+}
+
+// readUdp receives RTCP receiver reports (and NAT keepalive RTP) of UDP
+// clients to keep their sessions alive
+func (server *RtspServer) readUdp(conn *net.UDPConn, rtcp bool) {
+	defer server.wg.Done()
+	buf := make([]byte, rtspReadBufferSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if !rtcp || n < RTCP_HEADER_SIZE {
+			continue
+		}
+		server.mu.Lock()
+		sess := server.udpPeers[addr.String()]
+		server.mu.Unlock()
+		if sess != nil {
+			sess.handleRtcp(buf[:n])
+		}
+	}
+}
+
+// runTimers sends RTCP sender reports and reaps timed out sessions
+func (server *RtspServer) runTimers() {
+	defer server.wg.Done()
+	rtcpTicker := time.NewTicker(server.conf.RtcpInterval)
+	defer rtcpTicker.Stop()
+	reapTicker := time.NewTicker(time.Second)
+	defer reapTicker.Stop()
+	for {
+		select {
+		case <-server.closeCh:
+			return
+		case <-rtcpTicker.C:
+			server.sendReports()
+		case <-reapTicker.C:
+			server.reapSessions()
+		}
+	}
+}
+
+func (server *RtspServer) snapshotSessions() []*rtspSession {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	sessions := make([]*rtspSession, 0, len(server.sessions))
+	for _, sess := range server.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+func (server *RtspServer) reapSessions() {
+	deadline := time.Now().Add(-server.conf.SessionTimeout).UnixNano()
+	for _, sess := range server.snapshotSessions() {
+		if atomic.LoadInt64(&sess.lastActive) < deadline {
+			sess.close()
+		}
+	}
+}
+
+func (server *RtspServer) sendReports() {
+	now := time.Now()
+	// multicast tracks are reported once per stream
+	reported := make(map[*net.UDPAddr]bool)
+	for _, sess := range server.snapshotSessions() {
+		sess.sendReports(now, reported)
+	}
+}
+
+// senderReport builds the RTCP of one track for the passed counters
+func (server *RtspServer) senderReport(stream *RtspStream, trackID int, now time.Time, packets, octets uint32) ([]byte, uint32, bool) {
+	state := stream.trackState(trackID)
+	if !state.received {
+		return nil, 0, false
+	}
+	clockRate := stream.tracks[trackID].ClockRate
+	elapsed := now.Sub(state.arrival)
+	sr := &RtcpSenderReport{
+		SSRC:        state.ssrc,
+		NTPTime:     NtpTime(now),
+		RTPTime:     state.timestamp + uint32(DurationToRtpTicks(elapsed, clockRate)),
+		PacketCount: packets,
+		OctetCount:  octets,
+	}
+	sdes := &RtcpSourceDescription{Chunks: []RtcpSdesChunk{{SSRC: state.ssrc, CNAME: server.cname}}}
+	buf, err := MarshalRtcp(sr, sdes)
+	if err != nil {
+		return nil, 0, false
+	}
+	return buf, state.ssrc, true
+}
+
+// rtspSessionTrack the transport negotiated by SETUP for one track
+type rtspSessionTrack struct {
+	transport   *RtspTransport
+	rtpAddr     *net.UDPAddr
+	rtcpAddr    *net.UDPAddr
+	packetCount uint32
+	octetCount  uint32
+}
+
+// rtspSession one RTSP session,created by the first SETUP
+type rtspSession struct {
+	id         string
+	server     *RtspServer
+	conn       *rtspConn
+	stream     *RtspStream
+	lastActive int64
+
+	mu      sync.RWMutex
+	tracks  map[int]*rtspSessionTrack
+	playing bool
+	closed  bool
+}
+
+func (sess *rtspSession) touch() {
+	atomic.StoreInt64(&sess.lastActive, time.Now().UnixNano())
+}
+
+// writeRtp sends one marshaled RTP packet of trackID,it returns true when the
+// track is multicast and the caller has to send the packet to the group
+func (sess *rtspSession) writeRtp(trackID int, buf []byte, payloadSize int) (multicast bool) {
+	sess.mu.RLock()
+	track := sess.tracks[trackID]
+	playing := sess.playing
+	sess.mu.RUnlock()
+	if track == nil || !playing {
+		return false
+	}
+	switch {
+	case track.transport.Multicast:
+		return true
+	case track.transport.IsTCP():
+		frame := AppendRtspInterleaved(make([]byte, 0, 4+len(buf)), uint8(track.transport.Interleaved[0]), buf)
+		if !sess.conn.send(frame, true) {
+			return false
+		}
+	default:
+		if _, err := sess.server.rtpConn.WriteToUDP(buf, track.rtpAddr); err != nil {
+			return false
+		}
+	}
+	atomic.AddUint32(&track.packetCount, 1)
+	atomic.AddUint32(&track.octetCount, uint32(payloadSize))
+	return false
+}
+
+func (sess *rtspSession) writeRtcp(track *rtspSessionTrack, buf []byte) {
+	switch {
+	case track.transport.Multicast:
+		addr := *track.rtpAddr
+		addr.Port++
+		sess.server.rtpConn.WriteToUDP(buf, &addr)
+	case track.transport.IsTCP():
+		frame := AppendRtspInterleaved(make([]byte, 0, 4+len(buf)), uint8(track.transport.Interleaved[1]), buf)
+		sess.conn.send(frame, true)
+	default:
+		sess.server.rtcpConn.WriteToUDP(buf, track.rtcpAddr)
+	}
+}
+
+// snapshotTracks copies the tracks so the stream lock is never taken while
+// holding the session lock
+func (sess *rtspSession) snapshotTracks() map[int]*rtspSessionTrack {
+	sess.mu.RLock()
+	defer sess.mu.RUnlock()
+	tracks := make(map[int]*rtspSessionTrack, len(sess.tracks))
+	for trackID, track := range sess.tracks {
+		tracks[trackID] = track
+	}
+	return tracks
+}
+
+func (sess *rtspSession) sendReports(now time.Time, reported map[*net.UDPAddr]bool) {
+	sess.mu.RLock()
+	playing := sess.playing
+	sess.mu.RUnlock()
+	if !playing {
+		return
+	}
+	for trackID, track := range sess.snapshotTracks() {
+		packets := atomic.LoadUint32(&track.packetCount)
+		octets := atomic.LoadUint32(&track.octetCount)
+		if track.transport.Multicast {
+			if reported[track.rtpAddr] {
+				continue
+			}
+			reported[track.rtpAddr] = true
+			state := sess.stream.trackState(trackID)
+			packets, octets = state.packetCount, state.octetCount
+		}
+		if buf, _, ok := sess.server.senderReport(sess.stream, trackID, now, packets, octets); ok {
+			sess.writeRtcp(track, buf)
+		}
+	}
+}
+
+func (sess *rtspSession) handleRtcp(buf []byte) {
+	if _, err := UnmarshalRtcp(buf); err == nil {
+		sess.touch()
+	}
+}
+
+func (sess *rtspSession) play() {
+	sess.mu.Lock()
+	sess.playing = true
+	sess.mu.Unlock()
+	sess.stream.addReader(sess)
+}
+
+func (sess *rtspSession) pause() {
+	sess.stream.removeReader(sess)
+	sess.mu.Lock()
+	sess.playing = false
+	sess.mu.Unlock()
+}
+
+func (sess *rtspSession) close() {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return
+	}
+	sess.closed = true
+	sess.mu.Unlock()
+
+	sess.stream.removeReader(sess)
+	sess.server.removeSession(sess)
+	sess.conn.removeSession(sess)
+
+	// tell the unicast udp clients we are leaving
+	for trackID, track := range sess.snapshotTracks() {
+		if track.transport.Multicast || track.transport.IsTCP() {
+			continue
+		}
+		state := sess.stream.trackState(trackID)
+		if !state.received {
+			continue
+		}
+		bye, err := (&RtcpGoodbye{Sources: []uint32{state.ssrc}}).Marshal()
+		if err == nil {
+			sess.writeRtcp(track, bye)
+		}
+	}
+}
+
+// rtspConn one RTSP control connection
+type rtspConn struct {
+	server  *RtspServer
+	netConn net.Conn
+	reader  *bufio.Reader
+	out     chan []byte
+	closeCh chan struct{}
+	once    sync.Once
+
+	mu       sync.Mutex
+	sessions map[string]*rtspSession
+}
+
+func newRtspConn(server *RtspServer, netConn net.Conn) *rtspConn {
+	return &rtspConn{
+		server:   server,
+		netConn:  netConn,
+		reader:   bufio.NewReaderSize(netConn, 4096),
+		out:      make(chan []byte, rtspConnQueueSize),
+		closeCh:  make(chan struct{}),
+		sessions: make(map[string]*rtspSession),
+	}
+}
+
+// send queues data for writing,when drop is true the data is discarded if
+// the queue is full instead of blocking the producer
+func (c *rtspConn) send(data []byte, drop bool) bool {
+	if drop {
+		select {
+		case c.out <- data:
+			return true
+		case <-c.closeCh:
+			return false
+		default:
+			return false
+		}
+	}
+	select {
+	case c.out <- data:
+		return true
+	case <-c.closeCh:
+		return false
+	}
+}
+
+func (c *rtspConn) writeLoop() {
+	for {
+		select {
+		case data := <-c.out:
+			c.netConn.SetWriteDeadline(time.Now().Add(rtspWriteTimeout))
+			if _, err := c.netConn.Write(data); err != nil {
+				c.close()
+				return
+			}
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+func (c *rtspConn) serve() {
+	defer c.close()
+	go c.writeLoop()
+	for {
+		head, err := c.reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if head[0] == RTSP_INTERLEAVED_MAGIC {
+			channel, payload, err := ReadRtspInterleaved(c.reader)
+			if err != nil {
+				return
+			}
+			c.handleInterleaved(channel, payload)
+			continue
+		}
+
+		req, err := ReadRtspRequest(c.reader)
+		if err != nil {
+			return
+		}
+		res := c.handle(req)
+		var buf bytes.Buffer
+		res.Write(&buf)
+		if !c.send(buf.Bytes(), false) {
+			return
+		}
+	}
+}
+
+func (c *rtspConn) close() {
+	c.once.Do(func() {
+		close(c.closeCh)
+		c.netConn.Close()
+		c.mu.Lock()
+		sessions := make([]*rtspSession, 0, len(c.sessions))
+		for _, sess := range c.sessions {
+			sessions = append(sessions, sess)
+		}
+		c.mu.Unlock()
+		for _, sess := range sessions {
+			sess.close()
+		}
+		c.server.mu.Lock()
+		delete(c.server.conns, c)
+		c.server.mu.Unlock()
+	})
+}
+
+func (c *rtspConn) removeSession(sess *rtspSession) {
+	c.mu.Lock()
+	delete(c.sessions, sess.id)
+	c.mu.Unlock()
+}
+
+// handleInterleaved keeps alive the sessions sending RTCP on the connection
+func (c *rtspConn) handleInterleaved(channel uint8, payload []byte) {
+	if channel%2 == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sess := range c.sessions {
+		sess.handleRtcp(payload)
+	}
+}
+
+func (c *rtspConn) handle(req *RtspRequest) *RtspResponse {
+	switch req.Method {
+	case RTSP_OPTIONS:
+		res := NewRtspResponse(req, 200)
+		res.Header.Set("Public", rtspPublicMethods)
+		if sess := c.requestSession(req); sess != nil {
+			sess.touch()
+		}
+		return res
+	case RTSP_DESCRIBE:
+		return c.handleDescribe(req)
+	case RTSP_SETUP:
+		return c.handleSetup(req)
+	case RTSP_PLAY, RTSP_PAUSE, RTSP_TEARDOWN, RTSP_GET_PARAMETER, RTSP_SET_PARAMETER:
+		sess := c.requestSession(req)
+		if sess == nil {
+			if req.Header.Get("Session") == "" && (req.Method == RTSP_GET_PARAMETER || req.Method == RTSP_SET_PARAMETER) {
+				return NewRtspResponse(req, 200)
+			}
+			return NewRtspResponse(req, 454)
+		}
+		sess.touch()
+		res := NewRtspResponse(req, 200)
+		res.Header.Set("Session", sess.id)
+		switch req.Method {
+		case RTSP_PLAY:
+			return c.handlePlay(req, sess, res)
+		case RTSP_PAUSE:
+			sess.pause()
+		case RTSP_TEARDOWN:
+			sess.close()
+		}
+		return res
+	}
+	return NewRtspResponse(req, 501)
+}
+
+func (c *rtspConn) requestSession(req *RtspRequest) *rtspSession {
+	id, _, _ := strings.Cut(req.Header.Get("Session"), ";")
+	if id = strings.TrimSpace(id); id == "" {
+		return nil
+	}
+	return c.server.session(id)
+}
+
+func (c *rtspConn) handleDescribe(req *RtspRequest) *RtspResponse {
+	stream, _, err := c.server.lookup(req.URL)
+	if err != nil || stream == nil {
+		return NewRtspResponse(req, rtspLookupStatus(err))
+	}
+	host, _, _ := net.SplitHostPort(c.netConn.LocalAddr().String())
+	res := NewRtspResponse(req, 200)
+	res.Header.Set("Content-Type", "application/sdp")
+	res.Header.Set("Content-Base", strings.TrimSuffix(req.URL.String(), "/")+"/")
+	res.Body = stream.SessionDescription(host).Marshal()
+	return res
+}
+
+func (c *rtspConn) handleSetup(req *RtspRequest) *RtspResponse {
+	stream, trackID, err := c.server.lookup(req.URL)
+	if err != nil || stream == nil {
+		return NewRtspResponse(req, rtspLookupStatus(err))
+	}
+	if trackID < 0 {
+		// aggregate control is only meaningful for single track streams
+		if len(stream.tracks) != 1 {
+			return NewRtspResponse(req, 459)
+		}
+		trackID = 0
+	}
+	transport, err := ParseRtspTransport(req.Header.Get("Transport"))
+	if err != nil {
+		return NewRtspResponse(req, 461)
+	}
+
+	sess := c.requestSession(req)
+	if req.Header.Get("Session") != "" && sess == nil {
+		return NewRtspResponse(req, 454)
+	}
+	if sess != nil && sess.stream != stream {
+		return NewRtspResponse(req, 459)
+	}
+
+	track := &rtspSessionTrack{transport: transport}
+	switch {
+	case transport.IsTCP():
+		if transport.Interleaved[0] == 0 && transport.Interleaved[1] == 0 {
+			transport.Interleaved = [2]int{2 * trackID, 2*trackID + 1}
+		}
+	case transport.Multicast:
+		if c.server.multicast == nil {
+			return NewRtspResponse(req, 461)
+		}
+		addr, err := c.server.allocMulticast(stream, trackID)
+		if err != nil {
+			return NewRtspResponse(req, 503)
+		}
+		track.rtpAddr = addr
+		transport.Destination = addr.IP
+		transport.Port = [2]int{addr.Port, addr.Port + 1}
+		transport.TTL = c.server.conf.MulticastTTL
+	default:
+		if c.server.rtpConn == nil || transport.ClientPort[0] == 0 {
+			return NewRtspResponse(req, 461)
+		}
+		remote, ok := c.netConn.RemoteAddr().(*net.TCPAddr)
+		if !ok {
+			return NewRtspResponse(req, 461)
+		}
+		track.rtpAddr = &net.UDPAddr{IP: remote.IP, Port: transport.ClientPort[0], Zone: remote.Zone}
+		track.rtcpAddr = &net.UDPAddr{IP: remote.IP, Port: transport.ClientPort[1], Zone: remote.Zone}
+		transport.ServerPort = [2]int{c.server.conf.UdpRtpPort, c.server.conf.UdpRtpPort + 1}
+	}
+	if state := stream.trackState(trackID); state.received {
+		transport.SSRC, transport.HasSSRC = state.ssrc, true
+	}
+
+	if sess == nil {
+		sess = &rtspSession{
+			id:     utils.RandomString(12),
+			server: c.server,
+			conn:   c,
+			stream: stream,
+			tracks: make(map[int]*rtspSessionTrack),
+		}
+		c.server.addSession(sess)
+		c.mu.Lock()
+		c.sessions[sess.id] = sess
+		c.mu.Unlock()
+	}
+	sess.touch()
+	sess.mu.Lock()
+	sess.tracks[trackID] = track
+	sess.mu.Unlock()
+	if track.rtcpAddr != nil {
+		c.server.addUdpPeer(track.rtcpAddr, sess)
+	}
+
+	res := NewRtspResponse(req, 200)
+	res.Header.Set("Transport", transport.String())
+	res.Header.Set("Session", fmt.Sprintf("%s;timeout=%d", sess.id, int(c.server.conf.SessionTimeout/time.Second)))
+	return res
+}
+
+func (c *rtspConn) handlePlay(req *RtspRequest, sess *rtspSession, res *RtspResponse) *RtspResponse {
+	tracks := sess.snapshotTracks()
+	if len(tracks) == 0 {
+		return NewRtspResponse(req, 455)
+	}
+
+	base := strings.TrimSuffix(req.URL.String(), "/")
+	if i := strings.LastIndex(base, "/"+rtspTrackControlPrefix); i >= 0 {
+		base = base[:i]
+	}
+	var infos []string
+	for trackID := range tracks {
+		state := sess.stream.trackState(trackID)
+		if !state.received {
+			continue
+		}
+		infos = append(infos, fmt.Sprintf("url=%s/%s%d;seq=%d;rtptime=%d",
+			base, rtspTrackControlPrefix, trackID, state.seq+1, state.timestamp))
+	}
+	if len(infos) > 0 {
+		res.Header.Set("RTP-Info", strings.Join(infos, ","))
+	}
+	res.Header.Set("Range", "npt=0.000-")
+	sess.play()
+	return res
+}
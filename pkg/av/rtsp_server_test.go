@@ -0,0 +1,344 @@
+package av
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testRtspTracks() []*RtspTrack {
+	return []*RtspTrack{
+		{Media: "video", PayloadType: 96, EncodingName: "H264", ClockRate: RTP_VIDEO_CLOCK_RATE, Fmtp: "packetization-mode=1"},
+		{Media: "audio", PayloadType: 8, EncodingName: "PCMA", ClockRate: 8000, Channels: 1},
+	}
+}
+
+// testRtspUdpPort returns an even port whose pair is free for the server
+func testRtspUdpPort(t *testing.T) int {
+	t.Helper()
+	for port := 41000; port < 49000; port += 2 {
+		rtp, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			continue
+		}
+		rtcp, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		rtp.Close()
+		if err != nil {
+			continue
+		}
+		rtcp.Close()
+		return port
+	}
+	t.Fatal("no free udp port pair")
+	return 0
+}
+
+// testRtspServer serves conf on a loopback listener and returns its address
+func testRtspServer(t *testing.T, conf RtspServerConfig) (*RtspServer, string) {
+	t.Helper()
+	server, err := NewRtspServer(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		server.Close()
+		<-done
+	})
+	return server, listener.Addr().String()
+}
+
+// testRtspClient a minimal RTSP client,interleaved frames received while
+// waiting for a response are queued in frames
+type testRtspClient struct {
+	t       *testing.T
+	conn    net.Conn
+	reader  *bufio.Reader
+	cseq    int
+	session string
+	frames  chan testRtspFrame
+	resCh   chan *RtspResponse
+}
+
+type testRtspFrame struct {
+	channel uint8
+	payload []byte
+}
+
+func newTestRtspClient(t *testing.T, addr string) *testRtspClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testRtspClient{
+		t:      t,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		frames: make(chan testRtspFrame, 16),
+		resCh:  make(chan *RtspResponse, 1),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *testRtspClient) readLoop() {
+	defer close(c.resCh)
+	for {
+		head, err := c.reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if head[0] == RTSP_INTERLEAVED_MAGIC {
+			channel, payload, err := ReadRtspInterleaved(c.reader)
+			if err != nil {
+				return
+			}
+			c.frames <- testRtspFrame{channel, payload}
+			continue
+		}
+		res, err := ReadRtspResponse(c.reader)
+		if err != nil {
+			return
+		}
+		c.resCh <- res
+	}
+}
+
+// do sends a request and returns the response,the session of the client is
+// sent and remembered from the response
+func (c *testRtspClient) do(method, rawURL string, header RtspHeader) *RtspResponse {
+	c.t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if header == nil {
+		header = RtspHeader{}
+	}
+	c.cseq++
+	header.Set("CSeq", strconv.Itoa(c.cseq))
+	if c.session != "" {
+		header.Set("Session", c.session)
+	}
+	req := &RtspRequest{Method: method, URL: u, Header: header}
+	if err := req.Write(c.conn); err != nil {
+		c.t.Fatal(err)
+	}
+	select {
+	case res, ok := <-c.resCh:
+		if !ok {
+			c.t.Fatalf("%s %s: connection closed", method, rawURL)
+		}
+		if res.Header.Get("CSeq") != strconv.Itoa(c.cseq) {
+			c.t.Fatalf("%s %s: cseq %q", method, rawURL, res.Header.Get("CSeq"))
+		}
+		if id, _, _ := strings.Cut(res.Header.Get("Session"), ";"); id != "" {
+			c.session = id
+		}
+		return res
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("%s %s: timeout", method, rawURL)
+	}
+	return nil
+}
+
+func (c *testRtspClient) expect(method, rawURL string, header RtspHeader, code int) *RtspResponse {
+	c.t.Helper()
+	res := c.do(method, rawURL, header)
+	if res.StatusCode != code {
+		c.t.Fatalf("%s %s: status %d,want %d", method, rawURL, res.StatusCode, code)
+	}
+	return res
+}
+
+func testRtspPacket(seq uint16, payload string) *RtpPacket {
+	return &RtpPacket{
+		RtpHeader: RtpHeader{Version: RTP_VERSION, PayloadType: 96, SequenceNumber: seq, Timestamp: 3000, SSRC: 0x1234},
+		Payload:   []byte(payload),
+	}
+}
+
+func expectRtspRtp(t *testing.T, buf []byte, seq uint16, payload string) {
+	t.Helper()
+	pkt := &RtpPacket{}
+	if err := pkt.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	if pkt.SequenceNumber != seq || string(pkt.Payload) != payload {
+		t.Fatalf("received seq %d payload %q,want %d %q", pkt.SequenceNumber, pkt.Payload, seq, payload)
+	}
+}
+
+func TestRtspServerPlay(t *testing.T) {
+	port := testRtspUdpPort(t)
+	server, addr := testRtspServer(t, RtspServerConfig{UdpRtpPort: port})
+	stream := NewRtspStream("test", testRtspTracks()...)
+	server.Handle("/live/1", stream)
+	base := "rtsp://" + addr + "/live/1"
+
+	client := newTestRtspClient(t, addr)
+	client.expect(RTSP_OPTIONS, base, nil, 200)
+	res := client.expect(RTSP_DESCRIBE, base, RtspHeader{"Accept": "application/sdp"}, 200)
+	if res.Header.Get("Content-Base") != base+"/" {
+		t.Fatalf("content base %q", res.Header.Get("Content-Base"))
+	}
+	sd := &SessionDescription{}
+	if err := sd.Unmarshal(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.Medias) != 2 {
+		t.Fatalf("%d medias", len(sd.Medias))
+	}
+	for i, m := range sd.Medias {
+		if control, _ := m.Attribute("control"); control != fmt.Sprintf("trackID=%d", i) {
+			t.Fatalf("media %d control %q", i, control)
+		}
+	}
+
+	// the video track over UDP
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtpConn.Close()
+	rtpPort := rtpConn.LocalAddr().(*net.UDPAddr).Port
+	res = client.expect(RTSP_SETUP, base+"/trackID=0",
+		RtspHeader{"Transport": fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", rtpPort, rtpPort+1)}, 200)
+	transport, err := ParseRtspTransport(res.Header.Get("Transport"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.ServerPort != [2]int{port, port + 1} || transport.ClientPort != [2]int{rtpPort, rtpPort + 1} {
+		t.Fatalf("udp transport %s", res.Header.Get("Transport"))
+	}
+
+	// the audio track interleaved
+	res = client.expect(RTSP_SETUP, base+"/trackID=1", RtspHeader{"Transport": "RTP/AVP/TCP;unicast;interleaved=2-3"}, 200)
+	if transport, err = ParseRtspTransport(res.Header.Get("Transport")); err != nil || transport.Interleaved != [2]int{2, 3} {
+		t.Fatalf("interleaved transport %s", res.Header.Get("Transport"))
+	}
+
+	client.expect(RTSP_PLAY, base, nil, 200)
+	if err := stream.WritePacket(0, testRtspPacket(1, "video")); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WritePacket(1, testRtspPacket(2, "audio")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1500)
+	rtpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := rtpConn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRtspRtp(t, buf[:n], 1, "video")
+	select {
+	case frame := <-client.frames:
+		if frame.channel != 2 {
+			t.Fatalf("interleaved channel %d", frame.channel)
+		}
+		expectRtspRtp(t, frame.payload, 2, "audio")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the interleaved packet")
+	}
+
+	// PLAY again reports the sequence following the latest packets
+	res = client.expect(RTSP_PLAY, base, nil, 200)
+	if info := res.Header.Get("RTP-Info"); !strings.Contains(info, "trackID=0;seq=2") ||
+		!strings.Contains(info, "trackID=1;seq=3") {
+		t.Fatalf("rtp info %q", info)
+	}
+
+	client.expect(RTSP_TEARDOWN, base, nil, 200)
+	if sess := server.session(client.session); sess != nil {
+		t.Fatal("session alive after teardown")
+	}
+	client.expect(RTSP_PLAY, base, nil, 454)
+}
+
+func TestRtspServerSource(t *testing.T) {
+	var opens int32
+	errSource := errors.New("source failure")
+	source := RtspStreamSourceFunc(func(path string) (*RtspStream, error) {
+		switch path {
+		case "/live/source":
+			atomic.AddInt32(&opens, 1)
+			// a new stream on every call
+			return NewRtspStream("source", testRtspTracks()...), nil
+		case "/live/broken":
+			return nil, errSource
+		}
+		return nil, nil
+	})
+	server, addr := testRtspServer(t, RtspServerConfig{Source: source})
+	base := "rtsp://" + addr
+
+	client := newTestRtspClient(t, addr)
+	client.expect(RTSP_DESCRIBE, base+"/live/source", nil, 200)
+	client.expect(RTSP_SETUP, base+"/live/source/trackID=0", RtspHeader{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"}, 200)
+	client.expect(RTSP_SETUP, base+"/live/source/trackID=1", RtspHeader{"Transport": "RTP/AVP/TCP;unicast;interleaved=2-3"}, 200)
+	if n := atomic.LoadInt32(&opens); n != 1 {
+		t.Fatalf("source opened %d times", n)
+	}
+	server.Unhandle("/live/source")
+	client.expect(RTSP_DESCRIBE, base+"/live/source", nil, 200)
+	if n := atomic.LoadInt32(&opens); n != 2 {
+		t.Fatalf("source opened %d times after unhandle", n)
+	}
+
+	other := newTestRtspClient(t, addr)
+	tcp := RtspHeader{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"}
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/live/unknown", 404},
+		{"/live/source/trackID=5", 404},
+		{"/live/source/trackID=x", 404},
+		{"/live/broken", 500},
+	} {
+		other.expect(RTSP_DESCRIBE, base+tt.path, nil, tt.code)
+		other.expect(RTSP_SETUP, base+tt.path, RtspHeader{"Transport": tcp.Get("Transport")}, tt.code)
+	}
+	// aggregate SETUP of a stream with two tracks
+	other.expect(RTSP_SETUP, base+"/live/source", tcp, 459)
+}
+
+func TestRtspServerUdpPortInUse(t *testing.T) {
+	port := testRtspUdpPort(t)
+	busy, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	server, err := NewRtspServer(RtspServerConfig{UdpRtpPort: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(listener); err == nil {
+		t.Fatal("serve with the rtp port in use")
+	}
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("listener not closed: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package av
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SdpAttribute a=<key>[:<value>]
+type SdpAttribute struct {
+	Key   string
+	Value string
+}
+
+// SdpMedia one m= section
+type SdpMedia struct {
+	Media      string // video,audio,application
+	Port       int
+	Proto      string // RTP/AVP,UDP/TLS/RTP/SAVPF...
+	Formats    []string
+	Connection string // c= of the media,empty to use the session one
+	Bandwidth  string // b= of the media
+	Attributes []SdpAttribute
+}
+
+// SessionDescription RFC 4566 session description,only the fields used by
+// RTSP and WebRTC are modeled
+type SessionDescription struct {
+	Origin      string // o=
+	SessionName string // s=
+	Connection  string // c=
+	Timing      string // t=
+	Attributes  []SdpAttribute
+	Medias      []*SdpMedia
+}
+
+// Attribute returns the value of the first attribute named key.
+func (m *SdpMedia) Attribute(key string) (string, bool) {
+	return findSdpAttribute(m.Attributes, key)
+}
+
+// AddAttribute appends an attribute to the media.
+func (m *SdpMedia) AddAttribute(key, value string) {
+	m.Attributes = append(m.Attributes, SdpAttribute{Key: key, Value: value})
+}
+
+// ExtensionMap returns the RTP header extensions negotiated by the extmap
+// attributes of the media.
+func (m *SdpMedia) ExtensionMap() RtpExtensionMap {
+	extensions := RtpExtensionMap{}
+	for _, attr := range m.Attributes {
+		if attr.Key != "extmap" {
+			continue
+		}
+		// extmap:<id>[/<direction>] <uri> [<attributes>]
+		fields := strings.Fields(attr.Value)
+		if len(fields) < 2 {
+			continue
+		}
+		id, _, _ := strings.Cut(fields[0], "/")
+		n, err := strconv.Atoi(id)
+		if err != nil || n <= 0 || n > 255 {
+			continue
+		}
+		extensions[uint8(n)] = fields[1]
+	}
+	return extensions
+}
+
+// Attribute returns the value of the first session level attribute named key.
+func (sd *SessionDescription) Attribute(key string) (string, bool) {
+	return findSdpAttribute(sd.Attributes, key)
+}
+
+// AddAttribute appends a session level attribute.
+func (sd *SessionDescription) AddAttribute(key, value string) {
+	sd.Attributes = append(sd.Attributes, SdpAttribute{Key: key, Value: value})
+}
+
+func findSdpAttribute(attrs []SdpAttribute, key string) (string, bool) {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func writeSdpAttributes(buf *bytes.Buffer, attrs []SdpAttribute) {
+	for _, attr := range attrs {
+		if attr.Value == "" {
+			fmt.Fprintf(buf, "a=%s\r\n", attr.Key)
+		} else {
+			fmt.Fprintf(buf, "a=%s:%s\r\n", attr.Key, attr.Value)
+		}
+	}
+}
+
+// Marshal serializes the session description,lines end with CRLF.
+func (sd *SessionDescription) Marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("v=0\r\n")
+	origin := sd.Origin
+	if origin == "" {
+		origin = "- 0 0 IN IP4 127.0.0.1"
+	}
+	fmt.Fprintf(&buf, "o=%s\r\n", origin)
+	name := sd.SessionName
+	if name == "" {
+		name = "-"
+	}
+	fmt.Fprintf(&buf, "s=%s\r\n", name)
+	if sd.Connection != "" {
+		fmt.Fprintf(&buf, "c=%s\r\n", sd.Connection)
+	}
+	timing := sd.Timing
+	if timing == "" {
+		timing = "0 0"
+	}
+	fmt.Fprintf(&buf, "t=%s\r\n", timing)
+	writeSdpAttributes(&buf, sd.Attributes)
+
+	for _, m := range sd.Medias {
+		fmt.Fprintf(&buf, "m=%s %d %s %s\r\n", m.Media, m.Port, m.Proto, strings.Join(m.Formats, " "))
+		if m.Connection != "" {
+			fmt.Fprintf(&buf, "c=%s\r\n", m.Connection)
+		}
+		if m.Bandwidth != "" {
+			fmt.Fprintf(&buf, "b=%s\r\n", m.Bandwidth)
+		}
+		writeSdpAttributes(&buf, m.Attributes)
+	}
+	return buf.Bytes()
+}
+
+// Unmarshal parses a session description,unknown lines are ignored.
+func (sd *SessionDescription) Unmarshal(data []byte) error {
+	*sd = SessionDescription{}
+	var media *SdpMedia
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return fmt.Errorf("sdp: invalid line %q", line)
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'o':
+			sd.Origin = value
+		case 's':
+			sd.SessionName = value
+		case 't':
+			sd.Timing = value
+		case 'c':
+			if media != nil {
+				media.Connection = value
+			} else {
+				sd.Connection = value
+			}
+		case 'b':
+			if media != nil {
+				media.Bandwidth = value
+			}
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				return fmt.Errorf("sdp: invalid media %q", value)
+			}
+			// port may be <port>/<number of ports>
+			port, err := strconv.Atoi(strings.SplitN(fields[1], "/", 2)[0])
+			if err != nil {
+				return fmt.Errorf("sdp: invalid media port %q", fields[1])
+			}
+			media = &SdpMedia{Media: fields[0], Port: port, Proto: fields[2], Formats: fields[3:]}
+			sd.Medias = append(sd.Medias, media)
+		case 'a':
+			attr := SdpAttribute{Key: value}
+			if i := strings.IndexByte(value, ':'); i >= 0 {
+				attr.Key, attr.Value = value[:i], value[i+1:]
+			}
+			if media != nil {
+				media.Attributes = append(media.Attributes, attr)
+			} else {
+				sd.Attributes = append(sd.Attributes, attr)
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,273 @@
+package av
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sync"
+)
+
+const (
+	// SRTP_AES128_CM_HMAC_SHA1_80 the DTLS-SRTP protection profile,RFC 5764
+	SRTP_AES128_CM_HMAC_SHA1_80 = 0x0001
+
+	SRTP_MASTER_KEY_SIZE  = 16
+	SRTP_MASTER_SALT_SIZE = 14
+)
+
+const (
+	srtpAuthKeySize   = 20
+	srtpAuthTagSize   = 10
+	srtcpIndexSize    = 4
+	srtcpEncryptedBit = 0x80000000
+	srtpReplayWindow  = 64
+
+	// key derivation labels,RFC 3711 4.3.2
+	srtpLabelRtpKey   = 0x00
+	srtpLabelRtpAuth  = 0x01
+	srtpLabelRtpSalt  = 0x02
+	srtpLabelRtcpKey  = 0x03
+	srtpLabelRtcpAuth = 0x04
+	srtpLabelRtcpSalt = 0x05
+)
+
+var (
+	ErrSrtpAuth   = errors.New("srtp: authentication failed")
+	ErrSrtpReplay = errors.New("srtp: replayed packet")
+)
+
+// srtpReplay the sliding replay window of one index space
+type srtpReplay struct {
+	started bool
+	max     int64
+	mask    uint64 // bit n set when max-n was received
+}
+
+func (r *srtpReplay) check(index int64) bool {
+	if !r.started || index > r.max {
+		return true
+	}
+	diff := r.max - index
+	return diff < srtpReplayWindow && r.mask&(1<<diff) == 0
+}
+
+func (r *srtpReplay) accept(index int64) {
+	if !r.started {
+		r.started, r.max, r.mask = true, index, 1
+		return
+	}
+	if index > r.max {
+		if shift := index - r.max; shift < srtpReplayWindow {
+			r.mask = r.mask<<shift | 1
+		} else {
+			r.mask = 1
+		}
+		r.max = index
+		return
+	}
+	r.mask |= 1 << (r.max - index)
+}
+
+// srtpSource the rollover counter and replay state of one SSRC
+type srtpSource struct {
+	seqs   SeqUnwrapper
+	replay srtpReplay
+	// sent SRTCP index
+	rtcpIndex uint32
+	rtcp      srtpReplay
+}
+
+// SrtpContext protects or unprotects the SRTP and SRTCP packets of one
+// direction with AES_CM_128_HMAC_SHA1_80 (RFC 3711),it is safe for
+// concurrent use
+type SrtpContext struct {
+	mu       sync.Mutex
+	rtpKey   cipher.Block
+	rtpSalt  []byte
+	rtpAuth  hash.Hash
+	rtcpKey  cipher.Block
+	rtcpSalt []byte
+	rtcpAuth hash.Hash
+	sources  map[uint32]*srtpSource
+}
+
+// NewSrtpContext derives the session keys from a 16 bytes master key and a
+// 14 bytes master salt.
+func NewSrtpContext(masterKey, masterSalt []byte) (*SrtpContext, error) {
+	if len(masterKey) != SRTP_MASTER_KEY_SIZE || len(masterSalt) != SRTP_MASTER_SALT_SIZE {
+		return nil, errors.New("srtp: invalid master key or salt size")
+	}
+	master, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	derive := func(label byte, n int) []byte {
+		// x = label<<48 xor master salt,keystream of AES-CM at x*2^16
+		iv := make([]byte, aes.BlockSize)
+		copy(iv, masterSalt)
+		iv[7] ^= label
+		out := make([]byte, n)
+		cipher.NewCTR(master, iv).XORKeyStream(out, out)
+		return out
+	}
+	c := &SrtpContext{
+		rtpSalt:  derive(srtpLabelRtpSalt, SRTP_MASTER_SALT_SIZE),
+		rtpAuth:  hmac.New(sha1.New, derive(srtpLabelRtpAuth, srtpAuthKeySize)),
+		rtcpSalt: derive(srtpLabelRtcpSalt, SRTP_MASTER_SALT_SIZE),
+		rtcpAuth: hmac.New(sha1.New, derive(srtpLabelRtcpAuth, srtpAuthKeySize)),
+		sources:  make(map[uint32]*srtpSource),
+	}
+	if c.rtpKey, err = aes.NewCipher(derive(srtpLabelRtpKey, SRTP_MASTER_KEY_SIZE)); err != nil {
+		return nil, err
+	}
+	if c.rtcpKey, err = aes.NewCipher(derive(srtpLabelRtcpKey, SRTP_MASTER_KEY_SIZE)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *SrtpContext) source(ssrc uint32) *srtpSource {
+	s := c.sources[ssrc]
+	if s == nil {
+		s = &srtpSource{}
+		c.sources[ssrc] = s
+	}
+	return s
+}
+
+// srtpXorKeyStream encrypts or decrypts buf with the AES-CM keystream of the
+// packet index of ssrc
+func srtpXorKeyStream(block cipher.Block, salt []byte, ssrc uint32, index int64, buf []byte) {
+	// IV = (salt*2^16) xor (SSRC*2^64) xor (index*2^16)
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, salt)
+	var v [8]byte
+	binary.BigEndian.PutUint32(v[:4], ssrc)
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= v[i]
+	}
+	binary.BigEndian.PutUint64(v[:], uint64(index))
+	for i := 0; i < 6; i++ {
+		iv[8+i] ^= v[2+i]
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(buf, buf)
+}
+
+// srtpAuthTag returns the truncated HMAC-SHA1 of buf followed by trailer
+func srtpAuthTag(mac hash.Hash, buf []byte, trailer []byte) []byte {
+	mac.Reset()
+	mac.Write(buf)
+	mac.Write(trailer)
+	return mac.Sum(nil)[:srtpAuthTagSize]
+}
+
+// EncryptRtp protects the RTP packet buf,the result does not alias buf.
+func (c *SrtpContext) EncryptRtp(buf []byte) ([]byte, error) {
+	n, err := validateRtpHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	ssrc := binary.BigEndian.Uint32(buf[ssrcOffset:])
+	seq := binary.BigEndian.Uint16(buf[seqNumOffset:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index := c.source(ssrc).seqs.Unwrap(seq)
+	out := make([]byte, len(buf), len(buf)+srtpAuthTagSize)
+	copy(out, buf)
+	srtpXorKeyStream(c.rtpKey, c.rtpSalt, ssrc, index, out[n:])
+	var roc [4]byte
+	binary.BigEndian.PutUint32(roc[:], uint32(index>>16))
+	return append(out, srtpAuthTag(c.rtpAuth, out, roc[:])...), nil
+}
+
+// DecryptRtp authenticates and decrypts the SRTP packet buf,the result does
+// not alias buf.
+func (c *SrtpContext) DecryptRtp(buf []byte) ([]byte, error) {
+	if len(buf) < RTP_HEADER_SIZE+srtpAuthTagSize {
+		return nil, ErrTruncatedHeader
+	}
+	body := buf[:len(buf)-srtpAuthTagSize]
+	n, err := validateRtpHeader(body)
+	if err != nil {
+		return nil, err
+	}
+	ssrc := binary.BigEndian.Uint32(buf[ssrcOffset:])
+	seq := binary.BigEndian.Uint16(buf[seqNumOffset:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.source(ssrc)
+	// the rollover counter is only updated once the packet is authenticated
+	seqs := s.seqs
+	index := seqs.Unwrap(seq)
+	if index < 0 || !s.replay.check(index) {
+		return nil, ErrSrtpReplay
+	}
+	var roc [4]byte
+	binary.BigEndian.PutUint32(roc[:], uint32(index>>16))
+	if !hmac.Equal(srtpAuthTag(c.rtpAuth, body, roc[:]), buf[len(body):]) {
+		return nil, ErrSrtpAuth
+	}
+	s.seqs = seqs
+	s.replay.accept(index)
+
+	out := append([]byte(nil), body...)
+	srtpXorKeyStream(c.rtpKey, c.rtpSalt, ssrc, index, out[n:])
+	return out, nil
+}
+
+// EncryptRtcp protects the compound RTCP packet buf,the result does not
+// alias buf.
+func (c *SrtpContext) EncryptRtcp(buf []byte) ([]byte, error) {
+	// header and sender SSRC stay in the clear
+	if len(buf) < RTCP_HEADER_SIZE+4 {
+		return nil, errRtcpTruncated
+	}
+	ssrc := binary.BigEndian.Uint32(buf[4:8])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.source(ssrc)
+	index := s.rtcpIndex
+	s.rtcpIndex = (s.rtcpIndex + 1) &^ srtcpEncryptedBit
+
+	out := make([]byte, len(buf), len(buf)+srtcpIndexSize+srtpAuthTagSize)
+	copy(out, buf)
+	srtpXorKeyStream(c.rtcpKey, c.rtcpSalt, ssrc, int64(index), out[8:])
+	out = binary.BigEndian.AppendUint32(out, index|srtcpEncryptedBit)
+	return append(out, srtpAuthTag(c.rtcpAuth, out, nil)...), nil
+}
+
+// DecryptRtcp authenticates and decrypts the SRTCP packet buf,the result
+// does not alias buf.
+func (c *SrtpContext) DecryptRtcp(buf []byte) ([]byte, error) {
+	if len(buf) < RTCP_HEADER_SIZE+4+srtcpIndexSize+srtpAuthTagSize {
+		return nil, errRtcpTruncated
+	}
+	body := buf[:len(buf)-srtpAuthTagSize]
+	trailer := binary.BigEndian.Uint32(body[len(body)-srtcpIndexSize:])
+	index := int64(trailer &^ srtcpEncryptedBit)
+	ssrc := binary.BigEndian.Uint32(buf[4:8])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.source(ssrc)
+	if !s.rtcp.check(index) {
+		return nil, ErrSrtpReplay
+	}
+	if !hmac.Equal(srtpAuthTag(c.rtcpAuth, body, nil), buf[len(body):]) {
+		return nil, ErrSrtpAuth
+	}
+	s.rtcp.accept(index)
+
+	out := append([]byte(nil), body[:len(body)-srtcpIndexSize]...)
+	if trailer&srtcpEncryptedBit != 0 {
+		srtpXorKeyStream(c.rtcpKey, c.rtcpSalt, ssrc, index, out[8:])
+	}
+	return out, nil
+}
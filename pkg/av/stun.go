@@ -0,0 +1,236 @@
+package av
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+)
+
+// STUN message types and attributes used by ICE,RFC 5389 and RFC 8445
+const (
+	STUN_BINDING_REQUEST    = 0x0001
+	STUN_BINDING_SUCCESS    = 0x0101
+	STUN_BINDING_ERROR      = 0x0111
+	STUN_BINDING_INDICATION = 0x0011
+
+	STUN_ATTR_USERNAME           = 0x0006
+	STUN_ATTR_MESSAGE_INTEGRITY  = 0x0008
+	STUN_ATTR_ERROR_CODE         = 0x0009
+	STUN_ATTR_XOR_MAPPED_ADDRESS = 0x0020
+	STUN_ATTR_PRIORITY           = 0x0024
+	STUN_ATTR_USE_CANDIDATE      = 0x0025
+	STUN_ATTR_FINGERPRINT        = 0x8028
+	STUN_ATTR_ICE_CONTROLLED     = 0x8029
+	STUN_ATTR_ICE_CONTROLLING    = 0x802A
+
+	STUN_HEADER_SIZE = 20
+)
+
+const (
+	stunMagicCookie      = 0x2112A442
+	stunFingerprintXor   = 0x5354554e
+	stunIntegritySize    = 20
+	stunFingerprintSize  = 4
+	stunAttrHeaderSize   = 4
+	stunFamilyIPv4       = 0x01
+	stunFamilyIPv6       = 0x02
+	stunTransactionIDLen = 12
+)
+
+var (
+	ErrStunTruncated   = errors.New("stun: message truncated")
+	ErrStunIntegrity   = errors.New("stun: message integrity mismatch")
+	ErrStunFingerprint = errors.New("stun: fingerprint mismatch")
+)
+
+// StunAttribute a type-length-value attribute of a STUN message
+type StunAttribute struct {
+	Type  uint16
+	Value []byte
+}
+
+// StunMessage a STUN message,MESSAGE-INTEGRITY and FINGERPRINT are added by
+// Marshal and checked by CheckIntegrity and Unmarshal
+type StunMessage struct {
+	Type          uint16
+	TransactionID [stunTransactionIDLen]byte
+	Attributes    []StunAttribute
+}
+
+// IsStun reports whether buf looks like a STUN message rather than DTLS or
+// RTP when they are multiplexed on one transport (RFC 7983).
+func IsStun(buf []byte) bool {
+	return len(buf) >= STUN_HEADER_SIZE && buf[0] < 4 &&
+		binary.BigEndian.Uint32(buf[4:8]) == stunMagicCookie
+}
+
+// NewStunMessage creates a message of type typ with a random transaction id.
+func NewStunMessage(typ uint16) *StunMessage {
+	m := &StunMessage{Type: typ}
+	for i := 0; i < stunTransactionIDLen; i += 4 {
+		binary.BigEndian.PutUint32(m.TransactionID[i:], randomUint32())
+	}
+	return m
+}
+
+// Attribute returns the value of the first attribute of type typ.
+func (m *StunMessage) Attribute(typ uint16) ([]byte, bool) {
+	for _, attr := range m.Attributes {
+		if attr.Type == typ {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+// AddAttribute appends an attribute to the message.
+func (m *StunMessage) AddAttribute(typ uint16, value []byte) {
+	m.Attributes = append(m.Attributes, StunAttribute{Type: typ, Value: value})
+}
+
+// SetXorMappedAddress adds the XOR-MAPPED-ADDRESS of addr.
+func (m *StunMessage) SetXorMappedAddress(addr *net.UDPAddr) {
+	ip := addr.IP.To4()
+	family := byte(stunFamilyIPv4)
+	if ip == nil {
+		ip, family = addr.IP.To16(), stunFamilyIPv6
+	}
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	binary.BigEndian.PutUint16(value[2:4], uint16(addr.Port)^uint16(stunMagicCookie>>16))
+	m.xorAddress(value[4:], ip)
+	m.AddAttribute(STUN_ATTR_XOR_MAPPED_ADDRESS, value)
+}
+
+// XorMappedAddress returns the XOR-MAPPED-ADDRESS,nil when absent.
+func (m *StunMessage) XorMappedAddress() *net.UDPAddr {
+	value, ok := m.Attribute(STUN_ATTR_XOR_MAPPED_ADDRESS)
+	if !ok || len(value) < 8 {
+		return nil
+	}
+	size := net.IPv4len
+	if value[1] == stunFamilyIPv6 {
+		size = net.IPv6len
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+	ip := make(net.IP, size)
+	m.xorAddress(ip, value[4:4+size])
+	port := binary.BigEndian.Uint16(value[2:4]) ^ uint16(stunMagicCookie>>16)
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
+
+// xorAddress xors src with the magic cookie followed by the transaction id
+func (m *StunMessage) xorAddress(dst, src []byte) {
+	var key [4 + stunTransactionIDLen]byte
+	binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+	copy(key[4:], m.TransactionID[:])
+	for i := range src {
+		dst[i] = src[i] ^ key[i]
+	}
+}
+
+// Marshal serializes the message,MESSAGE-INTEGRITY keyed with key is added
+// when key is not nil,then FINGERPRINT.
+func (m *StunMessage) Marshal(key []byte) []byte {
+	buf := make([]byte, STUN_HEADER_SIZE, 128)
+	binary.BigEndian.PutUint16(buf[0:2], m.Type)
+	binary.BigEndian.PutUint32(buf[4:8], stunMagicCookie)
+	copy(buf[8:20], m.TransactionID[:])
+	for _, attr := range m.Attributes {
+		buf = appendStunAttribute(buf, attr.Type, attr.Value)
+	}
+	if key != nil {
+		// the length covers the integrity attribute while hashing
+		binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)-STUN_HEADER_SIZE+stunAttrHeaderSize+stunIntegritySize))
+		mac := hmac.New(sha1.New, key)
+		mac.Write(buf)
+		buf = appendStunAttribute(buf, STUN_ATTR_MESSAGE_INTEGRITY, mac.Sum(nil))
+	}
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)-STUN_HEADER_SIZE+stunAttrHeaderSize+stunFingerprintSize))
+	var fingerprint [stunFingerprintSize]byte
+	binary.BigEndian.PutUint32(fingerprint[:], crc32.ChecksumIEEE(buf)^stunFingerprintXor)
+	return appendStunAttribute(buf, STUN_ATTR_FINGERPRINT, fingerprint[:])
+}
+
+func appendStunAttribute(buf []byte, typ uint16, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, typ)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	// values are padded to 4 bytes
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// Unmarshal parses a STUN message and checks its FINGERPRINT when present.
+func (m *StunMessage) Unmarshal(buf []byte) error {
+	if !IsStun(buf) {
+		return ErrStunTruncated
+	}
+	size := STUN_HEADER_SIZE + int(binary.BigEndian.Uint16(buf[2:4]))
+	if len(buf) < size {
+		return ErrStunTruncated
+	}
+	m.Type = binary.BigEndian.Uint16(buf[0:2])
+	copy(m.TransactionID[:], buf[8:20])
+	m.Attributes = m.Attributes[:0]
+	for n := STUN_HEADER_SIZE; n < size; {
+		if n+stunAttrHeaderSize > size {
+			return ErrStunTruncated
+		}
+		typ := binary.BigEndian.Uint16(buf[n:])
+		length := int(binary.BigEndian.Uint16(buf[n+2:]))
+		if n+stunAttrHeaderSize+length > size {
+			return ErrStunTruncated
+		}
+		value := buf[n+stunAttrHeaderSize : n+stunAttrHeaderSize+length]
+		if typ == STUN_ATTR_FINGERPRINT {
+			if length != stunFingerprintSize ||
+				binary.BigEndian.Uint32(value) != crc32.ChecksumIEEE(buf[:n])^stunFingerprintXor {
+				return ErrStunFingerprint
+			}
+		}
+		m.Attributes = append(m.Attributes, StunAttribute{Type: typ, Value: value})
+		n += stunAttrHeaderSize + (length+3)&^3
+	}
+	return nil
+}
+
+// CheckStunIntegrity verifies the MESSAGE-INTEGRITY of the raw message buf
+// with key,the ICE password of the receiver for requests.
+func CheckStunIntegrity(buf []byte, key []byte) error {
+	if !IsStun(buf) {
+		return ErrStunTruncated
+	}
+	size := STUN_HEADER_SIZE + int(binary.BigEndian.Uint16(buf[2:4]))
+	if len(buf) < size {
+		return ErrStunTruncated
+	}
+	for n := STUN_HEADER_SIZE; n+stunAttrHeaderSize <= size; {
+		typ := binary.BigEndian.Uint16(buf[n:])
+		length := int(binary.BigEndian.Uint16(buf[n+2:]))
+		if typ == STUN_ATTR_MESSAGE_INTEGRITY {
+			if length != stunIntegritySize || n+stunAttrHeaderSize+length > size {
+				return ErrStunIntegrity
+			}
+			// hash the message up to the attribute with a length ending
+			// after it
+			hashed := append([]byte(nil), buf[:n]...)
+			binary.BigEndian.PutUint16(hashed[2:4], uint16(n-STUN_HEADER_SIZE+stunAttrHeaderSize+stunIntegritySize))
+			mac := hmac.New(sha1.New, key)
+			mac.Write(hashed)
+			if !hmac.Equal(mac.Sum(nil), buf[n+stunAttrHeaderSize:n+stunAttrHeaderSize+length]) {
+				return ErrStunIntegrity
+			}
+			return nil
+		}
+		n += stunAttrHeaderSize + (length+3)&^3
+	}
+	return ErrStunIntegrity
+}
@@ -0,0 +1,163 @@
+package av
+
+import "time"
+
+const (
+	RTP_VIDEO_CLOCK_RATE = 90000
+	RTP_G711_CLOCK_RATE  = 8000
+
+	// MPEG-TS/PS PTS and DTS,33 bits at 90kHz
+	MPEG_PTS_CLOCK_RATE = 90000
+	MPEG_PTS_BITS       = 33
+	MPEG_PTS_MASK       = 1<<MPEG_PTS_BITS - 1
+)
+
+// wrapDiff returns a-b of two counters of bits bits as the shortest signed
+// distance,half the range apart is negative
+func wrapDiff(a, b uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64((a-b)<<shift) >> shift
+}
+
+// RtpSeqDiff returns a-b of two sequence numbers taking the wraparound into
+// account,positive when a is newer.
+func RtpSeqDiff(a, b uint16) int {
+	return int(int16(a - b))
+}
+
+// RtpSeqNewer reports whether sequence number a comes after b.
+func RtpSeqNewer(a, b uint16) bool {
+	return RtpSeqDiff(a, b) > 0
+}
+
+// RtpTimestampDiff returns a-b of two RTP timestamps taking the wraparound
+// into account,positive when a is newer.
+func RtpTimestampDiff(a, b uint32) int64 {
+	return int64(int32(a - b))
+}
+
+// RtpTimestampNewer reports whether RTP timestamp a comes after b.
+func RtpTimestampNewer(a, b uint32) bool {
+	return RtpTimestampDiff(a, b) > 0
+}
+
+// PtsDiff returns a-b of two 33 bits PTS taking the wraparound into account,
+// positive when a is newer.Bits above 33 are ignored.
+func PtsDiff(a, b uint64) int64 {
+	return wrapDiff(a, b, MPEG_PTS_BITS)
+}
+
+// PtsNewer reports whether the 33 bits PTS a comes after b.
+func PtsNewer(a, b uint64) bool {
+	return PtsDiff(a, b) > 0
+}
+
+// unwrapper extends a wrapping counter to 64 bits,assuming two consecutive
+// values are less than half the range apart
+type unwrapper struct {
+	started  bool
+	last     uint64
+	extended int64
+}
+
+func (u *unwrapper) unwrap(v uint64, bits uint) int64 {
+	if !u.started {
+		u.started = true
+		u.last = v
+		u.extended = int64(v)
+		return u.extended
+	}
+	delta := wrapDiff(v, u.last, bits)
+	ext := u.extended + delta
+	// only move forward so a reordered value does not rewind the reference
+	if delta > 0 {
+		u.last = v
+		u.extended = ext
+	}
+	return ext
+}
+
+// Reset forgets the reference,the next value starts a new range.
+func (u *unwrapper) Reset() {
+	*u = unwrapper{}
+}
+
+// SeqUnwrapper extends RTP sequence numbers to 64 bits,the zero value is
+// ready to use
+type SeqUnwrapper struct {
+	unwrapper
+}
+
+// Unwrap returns the extended value of seq,the first one is returned as is.
+func (u *SeqUnwrapper) Unwrap(seq uint16) int64 {
+	return u.unwrap(uint64(seq), 16)
+}
+
+// TimestampUnwrapper extends RTP timestamps to 64 bits,the zero value is
+// ready to use
+type TimestampUnwrapper struct {
+	unwrapper
+}
+
+// Unwrap returns the extended value of ts,the first one is returned as is.
+func (u *TimestampUnwrapper) Unwrap(ts uint32) int64 {
+	return u.unwrap(uint64(ts), 32)
+}
+
+// PtsUnwrapper extends 33 bits PTS/DTS to 64 bits,the zero value is ready
+// to use
+type PtsUnwrapper struct {
+	unwrapper
+}
+
+// Unwrap returns the extended value of pts,the first one is returned as is.
+func (u *PtsUnwrapper) Unwrap(pts uint64) int64 {
+	return u.unwrap(pts&MPEG_PTS_MASK, MPEG_PTS_BITS)
+}
+
+// RescaleTicks converts ticks of clock rate from to clock rate to,like 90kHz
+// to 8kHz,truncating toward zero without overflowing for long streams.It
+// returns 0 when from is 0.
+func RescaleTicks(ticks int64, from, to uint32) int64 {
+	if from == to {
+		return ticks
+	}
+	if from == 0 {
+		return 0
+	}
+	return ticks/int64(from)*int64(to) + ticks%int64(from)*int64(to)/int64(from)
+}
+
+// RtpTicksToDuration converts ticks of clockRate to a duration.
+func RtpTicksToDuration(ticks int64, clockRate uint32) time.Duration {
+	return time.Duration(RescaleTicks(ticks, clockRate, uint32(time.Second)))
+}
+
+// DurationToRtpTicks converts d to ticks of clockRate,the low 32 bits are the
+// RTP timestamp offset.
+func DurationToRtpTicks(d time.Duration, clockRate uint32) int64 {
+	return RescaleTicks(int64(d), uint32(time.Second), clockRate)
+}
+
+// PtsToDuration converts a 33 bits PTS to a duration,bits above 33 are
+// ignored.Use PtsUnwrapper for streams longer than 26.5 hours.
+func PtsToDuration(pts uint64) time.Duration {
+	return RtpTicksToDuration(int64(pts&MPEG_PTS_MASK), MPEG_PTS_CLOCK_RATE)
+}
+
+// DurationToPts converts d to a 33 bits PTS,wrapping like the MPEG clock.
+func DurationToPts(d time.Duration) uint64 {
+	return uint64(DurationToRtpTicks(d, MPEG_PTS_CLOCK_RATE)) & MPEG_PTS_MASK
+}
+
+// RtpTimestampToPts converts the RTP timestamp ts of clockRate to a 33 bits
+// PTS,ts is expected to be unwrapped for clock rates other than 90kHz.
+func RtpTimestampToPts(ts int64, clockRate uint32) uint64 {
+	return uint64(RescaleTicks(ts, clockRate, MPEG_PTS_CLOCK_RATE)) & MPEG_PTS_MASK
+}
+
+// PtsToRtpTimestamp converts the 33 bits pts to an RTP timestamp of
+// clockRate,pts is expected to be unwrapped by PtsUnwrapper.
+func PtsToRtpTimestamp(pts int64, clockRate uint32) uint32 {
+	return uint32(RescaleTicks(pts, MPEG_PTS_CLOCK_RATE, clockRate))
+}
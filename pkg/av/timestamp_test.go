@@ -0,0 +1,223 @@
+package av
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRtpSeqDiff(t *testing.T) {
+	tests := []struct {
+		a, b  uint16
+		diff  int
+		newer bool
+	}{
+		{1, 0, 1, true},
+		{0, 1, -1, false},
+		{5, 5, 0, false},
+		{0, 65535, 1, true},
+		{65535, 0, -1, false},
+		{10, 65530, 16, true},
+		{32767, 0, 32767, true},
+		{32768, 0, -32768, false},
+		{0, 32768, -32768, false},
+		{32769, 1, -32768, false},
+		{0, 32769, 32767, true},
+	}
+	for _, tt := range tests {
+		if diff := RtpSeqDiff(tt.a, tt.b); diff != tt.diff {
+			t.Errorf("RtpSeqDiff(%d,%d) = %d,want %d", tt.a, tt.b, diff, tt.diff)
+		}
+		if newer := RtpSeqNewer(tt.a, tt.b); newer != tt.newer {
+			t.Errorf("RtpSeqNewer(%d,%d) = %v,want %v", tt.a, tt.b, newer, tt.newer)
+		}
+	}
+}
+
+func TestRtpTimestampDiff(t *testing.T) {
+	tests := []struct {
+		a, b  uint32
+		diff  int64
+		newer bool
+	}{
+		{3000, 0, 3000, true},
+		{0, 3000, -3000, false},
+		{1500, 4294966296, 2500, true},
+		{4294966296, 1500, -2500, false},
+		{1<<31 - 1, 0, 1<<31 - 1, true},
+		{1 << 31, 0, -(1 << 31), false},
+		{0, 1 << 31, -(1 << 31), false},
+		{0, 1<<31 + 1, 1<<31 - 1, true},
+	}
+	for _, tt := range tests {
+		if diff := RtpTimestampDiff(tt.a, tt.b); diff != tt.diff {
+			t.Errorf("RtpTimestampDiff(%d,%d) = %d,want %d", tt.a, tt.b, diff, tt.diff)
+		}
+		if newer := RtpTimestampNewer(tt.a, tt.b); newer != tt.newer {
+			t.Errorf("RtpTimestampNewer(%d,%d) = %v,want %v", tt.a, tt.b, newer, tt.newer)
+		}
+	}
+}
+
+func TestPtsDiff(t *testing.T) {
+	tests := []struct {
+		a, b  uint64
+		diff  int64
+		newer bool
+	}{
+		{3600, 0, 3600, true},
+		{0, MPEG_PTS_MASK, 1, true},
+		{MPEG_PTS_MASK, 0, -1, false},
+		{1 << 32, 1<<32 - 1, 1, true},
+		{1<<32 - 1, 0, 1<<32 - 1, true},
+		{1 << 32, 0, -(1 << 32), false},
+		{0, 1<<32 + 1, 1<<32 - 1, true},
+		// bits above 33 are ignored
+		{1<<33 + 5, 2, 3, true},
+		{1<<40 | 7, 1<<35 | 7, 0, false},
+	}
+	for _, tt := range tests {
+		if diff := PtsDiff(tt.a, tt.b); diff != tt.diff {
+			t.Errorf("PtsDiff(%d,%d) = %d,want %d", tt.a, tt.b, diff, tt.diff)
+		}
+		if newer := PtsNewer(tt.a, tt.b); newer != tt.newer {
+			t.Errorf("PtsNewer(%d,%d) = %v,want %v", tt.a, tt.b, newer, tt.newer)
+		}
+	}
+}
+
+func TestSeqUnwrapper(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []uint16
+		want []int64
+	}{
+		{"forward", []uint16{100, 101, 102}, []int64{100, 101, 102}},
+		{"wrap", []uint16{65534, 65535, 0, 1}, []int64{65534, 65535, 65536, 65537}},
+		{"reordered across the wrap", []uint16{65534, 0, 65535, 1, 65533, 2},
+			[]int64{65534, 65536, 65535, 65537, 65533, 65538}},
+		{"reordered before the start", []uint16{0, 65535, 1}, []int64{0, -1, 1}},
+		{"jump", []uint16{0, 30000, 60000, 10}, []int64{0, 30000, 60000, 65546}},
+		{"twice", []uint16{60000, 20000, 50000, 10000}, []int64{60000, 85536, 115536, 141072}},
+	}
+	for _, tt := range tests {
+		var u SeqUnwrapper
+		for i, seq := range tt.in {
+			if got := u.Unwrap(seq); got != tt.want[i] {
+				t.Errorf("%s: Unwrap(%d) #%d = %d,want %d", tt.name, seq, i, got, tt.want[i])
+			}
+		}
+	}
+
+	var u SeqUnwrapper
+	u.Unwrap(65535)
+	u.Unwrap(0)
+	u.Reset()
+	if got := u.Unwrap(7); got != 7 {
+		t.Errorf("Unwrap after Reset = %d", got)
+	}
+}
+
+func TestTimestampUnwrapper(t *testing.T) {
+	const max = 1<<32 - 1
+	tests := []struct {
+		name string
+		in   []uint32
+		want []int64
+	}{
+		{"wrap", []uint32{max - 2999, 500, 3500}, []int64{max - 2999, 1<<32 + 500, 1<<32 + 3500}},
+		{"reordered across the wrap", []uint32{max - 999, 2000, max - 499, 5000},
+			[]int64{max - 999, 1<<32 + 2000, max - 499, 1<<32 + 5000}},
+		{"half range steps", []uint32{0, 1<<31 - 1, max - 1, 10},
+			[]int64{0, 1<<31 - 1, max - 1, 1<<32 + 10}},
+	}
+	for _, tt := range tests {
+		var u TimestampUnwrapper
+		for i, ts := range tt.in {
+			if got := u.Unwrap(ts); got != tt.want[i] {
+				t.Errorf("%s: Unwrap(%d) #%d = %d,want %d", tt.name, ts, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPtsUnwrapper(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []uint64
+		want []int64
+	}{
+		{"wrap", []uint64{MPEG_PTS_MASK - 3599, 1, 3601},
+			[]int64{MPEG_PTS_MASK - 3599, 1<<33 + 1, 1<<33 + 3601}},
+		{"reordered across the wrap", []uint64{MPEG_PTS_MASK - 3599, 3600, MPEG_PTS_MASK, 7200},
+			[]int64{MPEG_PTS_MASK - 3599, 1<<33 + 3600, MPEG_PTS_MASK, 1<<33 + 7200}},
+		{"high bits ignored", []uint64{1<<34 | 10, 1<<40 | 20}, []int64{10, 20}},
+	}
+	for _, tt := range tests {
+		var u PtsUnwrapper
+		for i, pts := range tt.in {
+			if got := u.Unwrap(pts); got != tt.want[i] {
+				t.Errorf("%s: Unwrap(%d) #%d = %d,want %d", tt.name, pts, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRescaleTicks(t *testing.T) {
+	tests := []struct {
+		ticks    int64
+		from, to uint32
+		want     int64
+	}{
+		{90000, 90000, 90000, 90000},
+		{90000, 90000, 8000, 8000},
+		{8000, 8000, 90000, 90000},
+		{3003, 90000, 48000, 1601},
+		{-3003, 90000, 48000, -1601},
+		{960, 48000, 90000, 1800},
+		// 100 days at 90kHz to nanoseconds does not overflow
+		{100 * 24 * 3600 * 90000, 90000, uint32(time.Second), 100 * 24 * 3600 * int64(time.Second)},
+		{12345, 0, 90000, 0},
+		{12345, 0, 0, 12345},
+	}
+	for _, tt := range tests {
+		if got := RescaleTicks(tt.ticks, tt.from, tt.to); got != tt.want {
+			t.Errorf("RescaleTicks(%d,%d,%d) = %d,want %d", tt.ticks, tt.from, tt.to, got, tt.want)
+		}
+	}
+	if got := RtpTicksToDuration(100, 0); got != 0 {
+		t.Errorf("RtpTicksToDuration with clock rate 0 = %v", got)
+	}
+}
+
+func TestDurationToRtpTicks(t *testing.T) {
+	for _, rate := range []uint32{RTP_VIDEO_CLOCK_RATE, 48000} {
+		for _, d := range []time.Duration{0, 20 * time.Millisecond, 40 * time.Millisecond, time.Second,
+			time.Hour, 27 * time.Hour, 30 * 24 * time.Hour} {
+			ticks := DurationToRtpTicks(d, rate)
+			if want := int64(d/time.Millisecond) * int64(rate) / 1000; ticks != want {
+				t.Errorf("DurationToRtpTicks(%v,%d) = %d,want %d", d, rate, ticks, want)
+			}
+			if got := RtpTicksToDuration(ticks, rate); got != d {
+				t.Errorf("%d Hz: %v round trips to %v", rate, d, got)
+			}
+		}
+		for _, ticks := range []int64{1, 3000, 960, 1 << 32, 1 << 40} {
+			d := RtpTicksToDuration(ticks, rate)
+			// the duration is truncated to the nanosecond
+			if got := DurationToRtpTicks(d, rate); got != ticks && got != ticks-1 {
+				t.Errorf("%d Hz: %d ticks round trip to %d", rate, ticks, got)
+			}
+		}
+	}
+
+	pts := DurationToPts(27 * time.Hour)
+	if pts != uint64(27*3600*90000)&MPEG_PTS_MASK {
+		t.Errorf("DurationToPts(27h) = %d", pts)
+	}
+	if got := RtpTimestampToPts(48000, 48000); got != 90000 {
+		t.Errorf("RtpTimestampToPts = %d", got)
+	}
+	if got := PtsToRtpTimestamp(90000, 48000); got != 48000 {
+		t.Errorf("PtsToRtpTimestamp = %d", got)
+	}
+}
@@ -0,0 +1,607 @@
+package av
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	twccHistorySize     = 1 << 13 // sent packets kept for the feedback,power of 2
+	twccMaxPacketStatus = 500     // packets per feedback,keeps it below the MTU
+
+	twccSendGroupSpan = 5 * time.Millisecond
+
+	trendlineWindow    = 20
+	trendlineSmoothing = 0.9
+	trendlineGain      = 4.0
+	trendlineMaxDeltas = 60
+
+	overuseThresholdInit = 12.5 // ms
+	overuseThresholdMin  = 6.0
+	overuseThresholdMax  = 600.0
+	overuseKUp           = 0.01
+	overuseKDown         = 0.00018
+	overuseTime          = 10.0 // ms
+	overuseMaxUpdate     = 100.0
+
+	bweDecreaseFactor   = 0.85
+	bweIncreasePerSec   = 1.08
+	bweDecreaseInterval = 200 * time.Millisecond
+	bweAckedWindow      = 500 * time.Millisecond
+	bweAckedMinSpan     = 100 * time.Millisecond
+
+	DEFAULT_MIN_BITRATE = 50000
+	DEFAULT_MAX_BITRATE = 20000000
+)
+
+// BandwidthUsage the state of the link estimated from the delay trend
+type BandwidthUsage int
+
+const (
+	BANDWIDTH_NORMAL BandwidthUsage = iota
+	BANDWIDTH_UNDERUSING
+	BANDWIDTH_OVERUSING
+)
+
+func (u BandwidthUsage) String() string {
+	switch u {
+	case BANDWIDTH_UNDERUSING:
+		return "underusing"
+	case BANDWIDTH_OVERUSING:
+		return "overusing"
+	}
+	return "normal"
+}
+
+// TwccRecorder records the arrival of the transport-wide sequence numbers
+// on the receiver and builds the feedback packets.It is safe for concurrent use
+type TwccRecorder struct {
+	mu         sync.Mutex
+	extID      uint8
+	senderSSRC uint32
+	mediaSSRC  uint32
+	fbCount    uint8
+
+	start    time.Time // origin of the arrival clock
+	started  bool
+	seqs     SeqUnwrapper
+	nextSeq  int64 // first sequence number of the next feedback
+	maxSeq   int64
+	arrivals map[int64]time.Duration
+}
+
+// NewTwccRecorder creates a recorder reading the header extension extID,
+// senderSSRC is the SSRC the feedback is sent from.
+func NewTwccRecorder(extID uint8, senderSSRC uint32) *TwccRecorder {
+	return &TwccRecorder{
+		extID:      extID,
+		senderSSRC: senderSSRC,
+		arrivals:   make(map[int64]time.Duration),
+	}
+}
+
+// Record records the arrival of the packet of header h,false when it does
+// not carry the transport-wide sequence number.
+func (r *TwccRecorder) Record(h *RtpHeader, arrival time.Time) bool {
+	payload := h.GetExtension(r.extID)
+	if len(payload) < 2 {
+		return false
+	}
+	r.RecordSequence(binary.BigEndian.Uint16(payload), h.SSRC, arrival)
+	return true
+}
+
+// RecordSequence records the arrival of the transport-wide sequence number
+// seq sent by mediaSSRC.
+func (r *TwccRecorder) RecordSequence(seq uint16, mediaSSRC uint32, arrival time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ext := r.seqs.Unwrap(seq)
+	if !r.started {
+		r.started = true
+		r.start = arrival
+		r.nextSeq = ext
+		r.maxSeq = ext
+	}
+	if ext < r.nextSeq {
+		// already reported as lost
+		return
+	}
+	since := arrival.Sub(r.start)
+	if since < 0 {
+		since = 0
+	}
+	r.arrivals[ext] = since
+	if ext > r.maxSeq {
+		r.maxSeq = ext
+	}
+	r.mediaSSRC = mediaSSRC
+}
+
+// BuildFeedback returns the feedback of the packets recorded since the last
+// call,nil when nothing new arrived.It is called periodically,typically
+// every 50 to 100ms.
+func (r *TwccRecorder) BuildFeedback() []*RtcpTransportFeedback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started || len(r.arrivals) == 0 {
+		return nil
+	}
+
+	var feedbacks []*RtcpTransportFeedback
+	var fb *RtcpTransportFeedback
+	var last int64 // arrival of the previous received packet in TwccDeltaUnit
+	for seq := r.nextSeq; seq <= r.maxSeq; seq++ {
+		arrival, ok := r.arrivals[seq]
+		if fb == nil {
+			reference := arrival
+			if !ok {
+				// the range always ends with a received packet
+				for next := seq + 1; ; next++ {
+					if reference, ok = r.arrivals[next]; ok {
+						break
+					}
+				}
+			}
+			ref := int64(reference / TwccReferenceTimeUnit)
+			fb = &RtcpTransportFeedback{
+				SenderSSRC:         r.senderSSRC,
+				MediaSSRC:          r.mediaSSRC,
+				BaseSequenceNumber: uint16(seq),
+				ReferenceTime:      uint32(ref) & 0xFFFFFF,
+				FbPktCount:         r.fbCount,
+			}
+			r.fbCount++
+			last = ref * int64(TwccReferenceTimeUnit/TwccDeltaUnit)
+			_, ok = r.arrivals[seq]
+		}
+
+		status := TwccPacketStatus{SequenceNumber: uint16(seq)}
+		if ok {
+			units := int64(arrival/TwccDeltaUnit) - last
+			if units < math.MinInt16 || units > math.MaxInt16 {
+				// restart with a new reference time
+				feedbacks = append(feedbacks, fb)
+				fb = nil
+				seq--
+				continue
+			}
+			status.Received = true
+			status.Delta = time.Duration(units) * TwccDeltaUnit
+			last += units
+			delete(r.arrivals, seq)
+		}
+		fb.Packets = append(fb.Packets, status)
+		if len(fb.Packets) >= twccMaxPacketStatus {
+			feedbacks = append(feedbacks, fb)
+			fb = nil
+		}
+	}
+	if fb != nil {
+		feedbacks = append(feedbacks, fb)
+	}
+	r.nextSeq = r.maxSeq + 1
+	return feedbacks
+}
+
+// TwccPacketResult a sent packet acknowledged by a feedback
+type TwccPacketResult struct {
+	SequenceNumber uint16
+	SendTime       time.Time
+	Arrival        time.Duration // on the receiver clock,only differences are meaningful
+	Size           int
+}
+
+type twccSentPacket struct {
+	seq      uint16
+	valid    bool
+	sendTime time.Time
+	size     int
+}
+
+// TwccSender stamps the outgoing packets with the transport-wide sequence
+// number and feeds the feedback to a BandwidthEstimator.It is safe for
+// concurrent use
+type TwccSender struct {
+	mu        sync.Mutex
+	extID     uint8
+	seq       uint16
+	history   []twccSentPacket
+	estimator *BandwidthEstimator
+
+	refStarted bool
+	lastRef    int64
+}
+
+// NewTwccSender creates a sender writing the header extension extID,nil
+// estimator uses NewBandwidthEstimator with the default bounds.
+func NewTwccSender(extID uint8, estimator *BandwidthEstimator) *TwccSender {
+	if estimator == nil {
+		estimator = NewBandwidthEstimator(0, DEFAULT_MIN_BITRATE, DEFAULT_MAX_BITRATE)
+	}
+	return &TwccSender{
+		extID:     extID,
+		seq:       uint16(randomUint32()),
+		history:   make([]twccSentPacket, twccHistorySize),
+		estimator: estimator,
+	}
+}
+
+// OnSend sets the transport-wide sequence number of pkt and records it as
+// sent at now,it is called right before the packet is written.
+func (s *TwccSender) OnSend(pkt *RtpPacket, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, s.seq)
+	if err := pkt.SetExtension(s.extID, payload); err != nil {
+		return err
+	}
+	s.history[int(s.seq)&(twccHistorySize-1)] = twccSentPacket{
+		seq:      s.seq,
+		valid:    true,
+		sendTime: now,
+		size:     pkt.MarshalSize(),
+	}
+	s.seq++
+	return nil
+}
+
+// unwrapReference extends the 24 bits reference time of a feedback
+func (s *TwccSender) unwrapReference(ref uint32) int64 {
+	if !s.refStarted {
+		s.refStarted = true
+		s.lastRef = int64(ref)
+		return s.lastRef
+	}
+	delta := int64(int32((ref-uint32(s.lastRef))<<8) >> 8)
+	s.lastRef += delta
+	return s.lastRef
+}
+
+// OnFeedback updates the estimator with the packets acknowledged by fb.
+func (s *TwccSender) OnFeedback(fb *RtcpTransportFeedback, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	arrival := time.Duration(s.unwrapReference(fb.ReferenceTime)) * TwccReferenceTimeUnit
+	results := make([]TwccPacketResult, 0, len(fb.Packets))
+	for _, p := range fb.Packets {
+		if !p.Received {
+			continue
+		}
+		arrival += p.Delta
+		sent := &s.history[int(p.SequenceNumber)&(twccHistorySize-1)]
+		if !sent.valid || sent.seq != p.SequenceNumber {
+			continue
+		}
+		results = append(results, TwccPacketResult{
+			SequenceNumber: p.SequenceNumber,
+			SendTime:       sent.sendTime,
+			Arrival:        arrival,
+			Size:           sent.size,
+		})
+	}
+	s.estimator.Update(results, now)
+}
+
+// HandleRtcp feeds the transport-wide feedback of packets,it can be
+// registered with RtpSession.HandleRtcp.
+func (s *TwccSender) HandleRtcp(packets []RtcpPacket, from *net.UDPAddr) {
+	now := time.Now()
+	for _, packet := range packets {
+		if fb, ok := packet.(*RtcpTransportFeedback); ok {
+			s.OnFeedback(fb, now)
+		}
+	}
+}
+
+// TargetBitrate returns the estimated bitrate in bits per second.
+func (s *TwccSender) TargetBitrate() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.estimator.TargetBitrate()
+}
+
+type twccSendGroup struct {
+	firstSend   time.Time
+	lastSend    time.Time
+	lastArrival time.Duration
+}
+
+type trendlineSample struct {
+	x float64 // arrival ms
+	y float64 // smoothed accumulated delay ms
+}
+
+type bweAckedSample struct {
+	arrival time.Duration
+	size    int
+}
+
+// BandwidthEstimator send-side delay-based bandwidth estimator:the packets
+// are grouped by 5ms of send time,a trendline filter estimates the queuing
+// delay trend between groups,an overuse detector with adaptive threshold
+// turns it into BandwidthUsage,and an AIMD controller into the target
+// bitrate.It is not safe for concurrent use
+type BandwidthEstimator struct {
+	MinBitrate int
+	MaxBitrate int
+
+	target float64
+
+	group     twccSendGroup
+	prevGroup twccSendGroup
+	hasGroup  bool
+	hasPrev   bool
+
+	firstArrival time.Duration
+	numDeltas    int
+	accumulated  float64
+	smoothed     float64
+	samples      []trendlineSample
+	prevTrend    float64
+
+	threshold     float64
+	lastThreshold time.Duration
+	hasThreshold  bool
+	timeOverUsing float64
+	overuseCount  int
+	usage         BandwidthUsage
+
+	lastUpdate   time.Time
+	lastDecrease time.Time
+
+	acked      []bweAckedSample
+	ackedBytes int
+}
+
+// NewBandwidthEstimator creates an estimator starting at initial bits per
+// second clamped to [min,max],0 initial starts at min.
+func NewBandwidthEstimator(initial, min, max int) *BandwidthEstimator {
+	if min <= 0 {
+		min = DEFAULT_MIN_BITRATE
+	}
+	if max < min {
+		max = min
+	}
+	e := &BandwidthEstimator{
+		MinBitrate:    min,
+		MaxBitrate:    max,
+		target:        float64(initial),
+		threshold:     overuseThresholdInit,
+		timeOverUsing: -1,
+	}
+	e.clamp()
+	return e
+}
+
+// TargetBitrate returns the estimated bitrate in bits per second.
+func (e *BandwidthEstimator) TargetBitrate() int {
+	return int(e.target)
+}
+
+// Usage returns the last detected state of the link.
+func (e *BandwidthEstimator) Usage() BandwidthUsage {
+	return e.usage
+}
+
+// AckedBitrate returns the bitrate received by the peer over the last
+// 500ms,0 until enough packets were acknowledged.
+func (e *BandwidthEstimator) AckedBitrate() int {
+	if len(e.acked) < 2 {
+		return 0
+	}
+	span := e.acked[len(e.acked)-1].arrival - e.acked[0].arrival
+	if span < bweAckedMinSpan {
+		return 0
+	}
+	return int(float64(e.ackedBytes*8) / span.Seconds())
+}
+
+// Update processes the packets acknowledged by one feedback in sequence
+// order and updates the target bitrate.
+func (e *BandwidthEstimator) Update(results []TwccPacketResult, now time.Time) {
+	for i := range results {
+		r := &results[i]
+		e.updateAcked(r)
+		if !e.hasGroup {
+			e.group = twccSendGroup{firstSend: r.SendTime, lastSend: r.SendTime, lastArrival: r.Arrival}
+			e.hasGroup = true
+			continue
+		}
+		if r.SendTime.Before(e.group.firstSend) {
+			// reordered from a previous group
+			continue
+		}
+		if r.SendTime.Sub(e.group.firstSend) <= twccSendGroupSpan {
+			if r.SendTime.After(e.group.lastSend) {
+				e.group.lastSend = r.SendTime
+			}
+			if r.Arrival > e.group.lastArrival {
+				e.group.lastArrival = r.Arrival
+			}
+			continue
+		}
+
+		// the group is complete
+		if e.hasPrev {
+			sendDelta := msOf(e.group.lastSend.Sub(e.prevGroup.lastSend))
+			arrivalDelta := msOf(e.group.lastArrival - e.prevGroup.lastArrival)
+			e.updateTrendline(arrivalDelta-sendDelta, sendDelta, e.group.lastArrival)
+		}
+		e.prevGroup = e.group
+		e.hasPrev = true
+		e.group = twccSendGroup{firstSend: r.SendTime, lastSend: r.SendTime, lastArrival: r.Arrival}
+	}
+	e.updateRate(now)
+}
+
+func msOf(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (e *BandwidthEstimator) updateAcked(r *TwccPacketResult) {
+	if n := len(e.acked); n > 0 && r.Arrival < e.acked[n-1].arrival {
+		// keep the window ordered,a reordered packet counts at the latest arrival
+		e.acked = append(e.acked, bweAckedSample{arrival: e.acked[n-1].arrival, size: r.Size})
+	} else {
+		e.acked = append(e.acked, bweAckedSample{arrival: r.Arrival, size: r.Size})
+	}
+	e.ackedBytes += r.Size
+	deadline := e.acked[len(e.acked)-1].arrival - bweAckedWindow
+	i := 0
+	for i < len(e.acked)-1 && e.acked[i].arrival < deadline {
+		e.ackedBytes -= e.acked[i].size
+		i++
+	}
+	if i > 0 {
+		e.acked = append(e.acked[:0], e.acked[i:]...)
+	}
+}
+
+func (e *BandwidthEstimator) updateTrendline(delayDelta, sendDelta float64, arrival time.Duration) {
+	if e.numDeltas == 0 {
+		e.firstArrival = arrival
+	}
+	if e.numDeltas < 1000 {
+		e.numDeltas++
+	}
+	e.accumulated += delayDelta
+	e.smoothed = trendlineSmoothing*e.smoothed + (1-trendlineSmoothing)*e.accumulated
+	e.samples = append(e.samples, trendlineSample{x: msOf(arrival - e.firstArrival), y: e.smoothed})
+	if len(e.samples) > trendlineWindow {
+		copy(e.samples, e.samples[1:])
+		e.samples = e.samples[:trendlineWindow]
+	}
+
+	trend := e.prevTrend
+	if len(e.samples) == trendlineWindow {
+		if slope, ok := linearFitSlope(e.samples); ok {
+			trend = slope
+		}
+	}
+	e.detect(trend, sendDelta, arrival)
+}
+
+func linearFitSlope(samples []trendlineSample) (float64, bool) {
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.x
+		sumY += s.y
+	}
+	avgX := sumX / float64(len(samples))
+	avgY := sumY / float64(len(samples))
+	var num, den float64
+	for _, s := range samples {
+		num += (s.x - avgX) * (s.y - avgY)
+		den += (s.x - avgX) * (s.x - avgX)
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+func (e *BandwidthEstimator) detect(trend, sendDelta float64, arrival time.Duration) {
+	if e.numDeltas < 2 {
+		e.usage = BANDWIDTH_NORMAL
+		return
+	}
+	modified := float64(minInt(e.numDeltas, trendlineMaxDeltas)) * trend * trendlineGain
+	switch {
+	case modified > e.threshold:
+		if e.timeOverUsing < 0 {
+			// assume the overuse started half way of the delta
+			e.timeOverUsing = sendDelta / 2
+		} else {
+			e.timeOverUsing += sendDelta
+		}
+		e.overuseCount++
+		if e.timeOverUsing > overuseTime && e.overuseCount > 1 && trend >= e.prevTrend {
+			e.timeOverUsing = 0
+			e.overuseCount = 0
+			e.usage = BANDWIDTH_OVERUSING
+		}
+	case modified < -e.threshold:
+		e.timeOverUsing = -1
+		e.overuseCount = 0
+		e.usage = BANDWIDTH_UNDERUSING
+	default:
+		e.timeOverUsing = -1
+		e.overuseCount = 0
+		e.usage = BANDWIDTH_NORMAL
+	}
+	e.prevTrend = trend
+	e.updateThreshold(modified, arrival)
+}
+
+// updateThreshold adapts the threshold to the trend so the detector neither
+// starves against loss-based flows nor triggers on noise,the elapsed time is
+// measured on the arrival clock of the groups
+func (e *BandwidthEstimator) updateThreshold(modified float64, arrival time.Duration) {
+	if !e.hasThreshold {
+		e.hasThreshold = true
+		e.lastThreshold = arrival
+	}
+	abs := math.Abs(modified)
+	if abs > e.threshold+15 {
+		// a spike,e.g. a route change,must not move the threshold
+		e.lastThreshold = arrival
+		return
+	}
+	k := overuseKUp
+	if abs < e.threshold {
+		k = overuseKDown
+	}
+	elapsed := math.Max(0, math.Min(msOf(arrival-e.lastThreshold), overuseMaxUpdate))
+	e.threshold += k * (abs - e.threshold) * elapsed
+	e.threshold = math.Max(overuseThresholdMin, math.Min(e.threshold, overuseThresholdMax))
+	e.lastThreshold = arrival
+}
+
+func (e *BandwidthEstimator) updateRate(now time.Time) {
+	acked := float64(e.AckedBitrate())
+	switch e.usage {
+	case BANDWIDTH_OVERUSING:
+		if now.Sub(e.lastDecrease) >= bweDecreaseInterval {
+			base := e.target
+			if acked > 0 {
+				base = acked
+			}
+			if decreased := base * bweDecreaseFactor; decreased < e.target {
+				e.target = decreased
+			}
+			e.lastDecrease = now
+		}
+	case BANDWIDTH_UNDERUSING:
+		// hold while the queues drain
+	case BANDWIDTH_NORMAL:
+		if !e.lastUpdate.IsZero() {
+			elapsed := math.Min(now.Sub(e.lastUpdate).Seconds(), 1)
+			increased := e.target * math.Pow(bweIncreasePerSec, elapsed)
+			if acked > 0 {
+				// do not probe far beyond what is actually sent
+				if limit := 1.5*acked + 10000; increased > limit {
+					increased = math.Max(limit, e.target)
+				}
+			}
+			e.target = increased
+		}
+	}
+	e.lastUpdate = now
+	e.clamp()
+}
+
+func (e *BandwidthEstimator) clamp() {
+	e.target = math.Max(float64(e.MinBitrate), math.Min(e.target, float64(e.MaxBitrate)))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
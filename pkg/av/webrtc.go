@@ -0,0 +1,930 @@
+package av
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+const (
+	webRtcDefaultTimeout    = 30 * time.Second
+	webRtcCheckInterval     = 50 * time.Millisecond
+	webRtcConsentInterval   = 2 * time.Second
+	webRtcReadBufferSize    = 2048
+	webRtcBindRetry         = 8
+	webRtcMaxTransactions   = 64
+	webRtcProto             = "UDP/TLS/RTP/SAVPF"
+	webRtcIceChars          = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	webRtcUfragSize         = 8
+	webRtcPwdSize           = 24
+	webRtcFingerprintAlgo   = "sha-256"
+	webRtcHostTypePref      = 126
+	webRtcPeerReflexivePref = 110
+)
+
+var (
+	ErrWebRtcNegotiation  = errors.New("webrtc: negotiation failed")
+	ErrWebRtcTrack        = errors.New("webrtc: track not negotiated")
+	ErrWebRtcNotConnected = errors.New("webrtc: not connected")
+	ErrWebRtcTimeout      = errors.New("webrtc: consent timed out")
+	ErrWebRtcClosed       = errors.New("webrtc: closed")
+)
+
+// WebRtcTrack one media sent or received by a WebRtcPeer
+type WebRtcTrack struct {
+	Media        string // video or audio
+	PayloadType  uint8
+	EncodingName string // H264,opus,PCMA...
+	ClockRate    uint32
+	Channels     int    // audio channels,0 means unspecified
+	Fmtp         string // a=fmtp parameters without the payload type
+	Mid          string // set by the negotiation
+	SSRC         uint32 // SSRC of the sent packets,set by the negotiation
+}
+
+// WebRtcPeerConfig configuration of WebRtcPeer
+type WebRtcPeerConfig struct {
+	Ports *utils.RangePort // the UDP port is allocated from it,nil binds an ephemeral port
+	// CandidateIPs addresses of the host candidates,nil advertises the IPv4
+	// addresses of the interfaces which are up
+	CandidateIPs []net.IP
+	Certificate  *DtlsCertificate // nil generates one
+	// Timeout closes the peer when nothing is received from the remote for
+	// that long,including before it connects.Default 30s
+	Timeout time.Duration
+}
+
+// WebRtcPeer a minimal WebRTC endpoint exchanging RTP over DTLS-SRTP.All
+// the media are bundled on one UDP port with rtcp-mux and host candidates
+// only,the answerer is ICE-lite and the offerer is the controlling agent.
+// Sender reports are not generated,use WriteRtcp
+type WebRtcPeer struct {
+	conf     WebRtcPeerConfig
+	conn     *net.UDPConn
+	port     int
+	ownsPort bool
+
+	localUfrag  string
+	localPwd    string
+	controlling bool
+	tieBreaker  [8]byte
+
+	mu                sync.Mutex
+	negotiated        bool
+	remoteUfrag       string
+	remotePwd         string
+	remoteFingerprint string
+	candidates        []*net.UDPAddr
+	remote            *net.UDPAddr    // selected candidate pair
+	validated         map[string]bool // remote addresses which passed a check
+	transactions      map[[stunTransactionIDLen]byte]bool
+	tracks            []*WebRtcTrack // by local track index,nil when rejected
+	ptTracks          map[uint8]int  // received payload type to local track index
+	dtls              *dtlsConn
+	srtpOut           *SrtpContext
+	srtpIn            *SrtpContext
+	rtpHandler        func(track int, pkt *RtpPacket)
+	rtcpHandler       RtcpHandler
+	lastReceived      time.Time
+	err               error
+	onClose           func()
+
+	connected chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWebRtcPeer binds the UDP port of a peer,it is negotiated by Answer or
+// by Offer and SetAnswer.
+func NewWebRtcPeer(conf WebRtcPeerConfig) (*WebRtcPeer, error) {
+	if conf.Certificate == nil {
+		cert, err := NewDtlsCertificate()
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificate = cert
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = webRtcDefaultTimeout
+	}
+	if conf.CandidateIPs == nil {
+		conf.CandidateIPs = webRtcHostIPs()
+	}
+	p := &WebRtcPeer{
+		conf:         conf,
+		localUfrag:   webRtcIceString(webRtcUfragSize),
+		localPwd:     webRtcIceString(webRtcPwdSize),
+		validated:    make(map[string]bool),
+		transactions: make(map[[stunTransactionIDLen]byte]bool),
+		ptTracks:     make(map[uint8]int),
+		lastReceived: time.Now(),
+		connected:    make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if _, err := rand.Read(p.tieBreaker[:]); err != nil {
+		return nil, err
+	}
+	if err := p.listen(); err != nil {
+		return nil, err
+	}
+	go p.readLoop()
+	go p.watchdog()
+	return p, nil
+}
+
+func (p *WebRtcPeer) listen() error {
+	if p.conf.Ports == nil {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			return err
+		}
+		p.conn, p.port = conn, conn.LocalAddr().(*net.UDPAddr).Port
+		return nil
+	}
+	var lastErr error
+	// the port may be taken by another process between select and bind
+	for i := 0; i < webRtcBindRetry; i++ {
+		port, err := p.conf.Ports.SelectUdpPort()
+		if err != nil {
+			return err
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			p.conf.Ports.FreeUdpPort(port)
+			lastErr = err
+			continue
+		}
+		p.conn, p.port, p.ownsPort = conn, port, true
+		return nil
+	}
+	return lastErr
+}
+
+// webRtcHostIPs returns the IPv4 addresses of the interfaces which are up,
+// the loopback address when there is none
+func webRtcHostIPs() []net.IP {
+	var ips []net.IP
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ips = append(ips, ipnet.IP.To4())
+			}
+		}
+	}
+	if len(ips) == 0 {
+		ips = append(ips, net.IPv4(127, 0, 0, 1).To4())
+	}
+	return ips
+}
+
+// webRtcIceString returns n random ice-chars,RFC 8839 5.4
+func webRtcIceString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	for i := range buf {
+		buf[i] = webRtcIceChars[int(buf[i])%len(webRtcIceChars)]
+	}
+	return string(buf)
+}
+
+// webRtcPriority the candidate priority of RTP component 1,RFC 8445 5.1.2.1
+func webRtcPriority(typePref, localPref int) uint32 {
+	return uint32(typePref)<<24 | uint32(localPref)<<8 | 255
+}
+
+// Offer returns the offer of a controlling peer sending or receiving tracks,
+// the peer connects once SetAnswer is called.
+func (p *WebRtcPeer) Offer(tracks []WebRtcTrack, send bool) (*SessionDescription, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.negotiated || len(tracks) == 0 {
+		return nil, fmt.Errorf("%w:already negotiated or no track", ErrWebRtcNegotiation)
+	}
+	p.controlling = true
+	offer := p.newDescription()
+	p.tracks = make([]*WebRtcTrack, len(tracks))
+	mids := make([]string, len(tracks))
+	for i := range tracks {
+		track := tracks[i]
+		track.Mid = strconv.Itoa(i)
+		if send {
+			track.SSRC = NewSSRC()
+		}
+		p.tracks[i] = &track
+		p.ptTracks[track.PayloadType] = i
+		mids[i] = track.Mid
+		offer.Medias = append(offer.Medias, p.sdpMedia(&track, "actpass", send))
+	}
+	offer.AddAttribute("group", "BUNDLE "+strings.Join(mids, " "))
+	return offer, nil
+}
+
+// SetAnswer applies the answer to the offer,the tracks rejected by it are
+// not negotiated.
+func (p *WebRtcPeer) SetAnswer(answer *SessionDescription) error {
+	p.mu.Lock()
+	if p.negotiated || !p.controlling {
+		p.mu.Unlock()
+		return fmt.Errorf("%w:no pending offer", ErrWebRtcNegotiation)
+	}
+	setup, err := p.setRemote(answer)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	accepted := 0
+	for i, track := range p.tracks {
+		m := webRtcFindMedia(answer, track.Mid)
+		if m == nil || m.Port == 0 || len(m.Formats) == 0 {
+			p.tracks[i] = nil
+			delete(p.ptTracks, track.PayloadType)
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		p.mu.Unlock()
+		return fmt.Errorf("%w:every media rejected", ErrWebRtcNegotiation)
+	}
+	p.dtls = newDtlsConn(setup != "active", p.conf.Certificate, p.remoteFingerprint, p.writeDtls)
+	p.negotiated = true
+	p.mu.Unlock()
+
+	go p.runChecks()
+	return nil
+}
+
+// Answer negotiates the offer of a controlling peer against tracks,the
+// tracks the peer sends when send is true,or accepts to receive otherwise.
+// Each offered media takes the first unused track of the same media with a
+// matching codec,the other media are rejected.
+func (p *WebRtcPeer) Answer(offer *SessionDescription, tracks []WebRtcTrack, send bool) (*SessionDescription, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.negotiated {
+		return nil, fmt.Errorf("%w:already negotiated", ErrWebRtcNegotiation)
+	}
+	if _, lite := offer.Attribute("ice-lite"); lite {
+		return nil, fmt.Errorf("%w:ice-lite offerer", ErrWebRtcNegotiation)
+	}
+	setup, err := p.setRemote(offer)
+	if err != nil {
+		return nil, err
+	}
+	// a passive offerer makes the answerer the DTLS client
+	localSetup := "passive"
+	if setup == "passive" {
+		localSetup = "active"
+	}
+
+	answer := p.newDescription()
+	answer.AddAttribute("ice-lite", "")
+	p.tracks = make([]*WebRtcTrack, len(tracks))
+	used := make([]bool, len(tracks))
+	var mids []string
+	for _, m := range offer.Medias {
+		mid, _ := m.Attribute("mid")
+		index, format := -1, ""
+		if m.Port != 0 && mid != "" && strings.Contains(m.Proto, "SAVP") && webRtcDirectionAccepted(m, send) {
+			index, format = webRtcMatchTrack(m, tracks, used)
+		}
+		if index < 0 {
+			rejected := &SdpMedia{Media: m.Media, Proto: m.Proto, Formats: m.Formats}
+			if mid != "" {
+				rejected.AddAttribute("mid", mid)
+			}
+			answer.Medias = append(answer.Medias, rejected)
+			continue
+		}
+		used[index] = true
+		track := tracks[index]
+		pt, _ := strconv.Atoi(format)
+		track.PayloadType = uint8(pt)
+		track.Mid = mid
+		if fmtp, ok := webRtcFmtp(m, format); ok {
+			track.Fmtp = fmtp
+		}
+		if send {
+			track.SSRC = NewSSRC()
+		}
+		p.tracks[index] = &track
+		p.ptTracks[track.PayloadType] = index
+		mids = append(mids, mid)
+		answer.Medias = append(answer.Medias, p.sdpMedia(&track, localSetup, send))
+	}
+	if len(mids) == 0 {
+		return nil, fmt.Errorf("%w:no media matches the tracks", ErrWebRtcNegotiation)
+	}
+	answer.AddAttribute("group", "BUNDLE "+strings.Join(mids, " "))
+	p.dtls = newDtlsConn(localSetup == "active", p.conf.Certificate, p.remoteFingerprint, p.writeDtls)
+	p.negotiated = true
+	return answer, nil
+}
+
+// setRemote takes the ICE credentials,fingerprint and candidates of the
+// remote description and returns its DTLS setup role
+func (p *WebRtcPeer) setRemote(sd *SessionDescription) (string, error) {
+	var m *SdpMedia
+	for _, media := range sd.Medias {
+		if media.Port != 0 {
+			m = media
+			break
+		}
+	}
+	if m == nil {
+		return "", fmt.Errorf("%w:no media", ErrWebRtcNegotiation)
+	}
+	value := func(key string) string {
+		if v, ok := m.Attribute(key); ok {
+			return v
+		}
+		v, _ := sd.Attribute(key)
+		return v
+	}
+	p.remoteUfrag, p.remotePwd = value("ice-ufrag"), value("ice-pwd")
+	algo, fingerprint, _ := strings.Cut(value("fingerprint"), " ")
+	if p.remoteUfrag == "" || p.remotePwd == "" || !strings.EqualFold(algo, webRtcFingerprintAlgo) || fingerprint == "" {
+		return "", fmt.Errorf("%w:missing ice credentials or sha-256 fingerprint", ErrWebRtcNegotiation)
+	}
+	p.remoteFingerprint = fingerprint
+	for _, attr := range m.Attributes {
+		if attr.Key != "candidate" {
+			continue
+		}
+		if addr := webRtcParseCandidate(attr.Value); addr != nil {
+			p.candidates = append(p.candidates, addr)
+		}
+	}
+	return value("setup"), nil
+}
+
+// webRtcParseCandidate returns the address of a UDP candidate of the RTP
+// component,<foundation> <component> <transport> <priority> <ip> <port> typ <type>
+func webRtcParseCandidate(value string) *net.UDPAddr {
+	fields := strings.Fields(value)
+	if len(fields) < 8 || fields[1] != "1" || !strings.EqualFold(fields[2], "udp") {
+		return nil
+	}
+	ip := net.ParseIP(fields[4])
+	port, err := strconv.Atoi(fields[5])
+	if ip == nil || err != nil || port <= 0 || port > 65535 {
+		return nil
+	}
+	return &net.UDPAddr{IP: ip, Port: port}
+}
+
+func webRtcFindMedia(sd *SessionDescription, mid string) *SdpMedia {
+	for _, m := range sd.Medias {
+		if v, _ := m.Attribute("mid"); v == mid {
+			return m
+		}
+	}
+	return nil
+}
+
+// webRtcDirectionAccepted reports whether the offered media lets the
+// answerer send or receive
+func webRtcDirectionAccepted(m *SdpMedia, send bool) bool {
+	direction := "sendrecv"
+	for _, d := range []string{"sendonly", "recvonly", "inactive"} {
+		if _, ok := m.Attribute(d); ok {
+			direction = d
+		}
+	}
+	if send {
+		return direction == "sendrecv" || direction == "recvonly"
+	}
+	return direction == "sendrecv" || direction == "sendonly"
+}
+
+// webRtcRtpmap parses the rtpmap of format,<pt> <name>/<rate>[/<channels>]
+func webRtcRtpmap(m *SdpMedia, format string) (name string, rate uint32, channels int, ok bool) {
+	for _, attr := range m.Attributes {
+		pt, encoding, found := strings.Cut(attr.Value, " ")
+		if attr.Key != "rtpmap" || !found || pt != format {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(encoding), "/")
+		if len(parts) < 2 {
+			return "", 0, 0, false
+		}
+		r, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return "", 0, 0, false
+		}
+		channels = 1
+		if len(parts) > 2 {
+			if channels, err = strconv.Atoi(parts[2]); err != nil {
+				return "", 0, 0, false
+			}
+		}
+		return parts[0], uint32(r), channels, true
+	}
+	return "", 0, 0, false
+}
+
+func webRtcFmtp(m *SdpMedia, format string) (string, bool) {
+	for _, attr := range m.Attributes {
+		if pt, params, found := strings.Cut(attr.Value, " "); attr.Key == "fmtp" && found && pt == format {
+			return strings.TrimSpace(params), true
+		}
+	}
+	return "", false
+}
+
+// webRtcFmtpParams splits a=fmtp parameters into lower case keys and values
+func webRtcFmtpParams(fmtp string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(fmtp, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return params
+}
+
+// webRtcFmtpScore rates an offered fmtp against the one of a track,-1 when
+// incompatible.H264 needs the same packetization mode and prefers the same
+// profile,a track without fmtp accepts any
+func webRtcFmtpScore(encodingName, local, offered string) int {
+	if !strings.EqualFold(encodingName, "H264") || local == "" {
+		return 0
+	}
+	l, o := webRtcFmtpParams(local), webRtcFmtpParams(offered)
+	mode := func(params map[string]string) string {
+		if v := params["packetization-mode"]; v != "" {
+			return v
+		}
+		return "0"
+	}
+	if mode(l) != mode(o) {
+		return -1
+	}
+	lp, op := l["profile-level-id"], o["profile-level-id"]
+	if len(lp) >= 2 && len(op) >= 2 && strings.EqualFold(lp[:2], op[:2]) {
+		return 1
+	}
+	return 0
+}
+
+// webRtcMatchTrack returns the first unused track matching a codec of m and
+// the offered format it matches best
+func webRtcMatchTrack(m *SdpMedia, tracks []WebRtcTrack, used []bool) (int, string) {
+	for i := range tracks {
+		track := &tracks[i]
+		if used[i] || track.Media != m.Media {
+			continue
+		}
+		best, bestScore := "", -1
+		for _, format := range m.Formats {
+			name, rate, channels, ok := webRtcRtpmap(m, format)
+			if !ok || !strings.EqualFold(name, track.EncodingName) || rate != track.ClockRate ||
+				(track.Channels > 0 && channels != track.Channels) {
+				continue
+			}
+			fmtp, _ := webRtcFmtp(m, format)
+			if score := webRtcFmtpScore(track.EncodingName, track.Fmtp, fmtp); score > bestScore {
+				best, bestScore = format, score
+			}
+		}
+		if best != "" {
+			return i, best
+		}
+	}
+	return -1, ""
+}
+
+func (p *WebRtcPeer) newDescription() *SessionDescription {
+	return &SessionDescription{
+		Origin: fmt.Sprintf("- %d 2 IN IP4 127.0.0.1", randomUint32()),
+	}
+}
+
+// sdpMedia the bundled m= section of a local track
+func (p *WebRtcPeer) sdpMedia(t *WebRtcTrack, setup string, send bool) *SdpMedia {
+	pt := strconv.Itoa(int(t.PayloadType))
+	m := &SdpMedia{Media: t.Media, Port: 9, Proto: webRtcProto, Formats: []string{pt}, Connection: "IN IP4 0.0.0.0"}
+	m.AddAttribute("mid", t.Mid)
+	m.AddAttribute("ice-ufrag", p.localUfrag)
+	m.AddAttribute("ice-pwd", p.localPwd)
+	m.AddAttribute("fingerprint", webRtcFingerprintAlgo+" "+p.conf.Certificate.Fingerprint())
+	m.AddAttribute("setup", setup)
+	if send {
+		m.AddAttribute("sendonly", "")
+	} else {
+		m.AddAttribute("recvonly", "")
+	}
+	m.AddAttribute("rtcp-mux", "")
+	rtpmap := fmt.Sprintf("%s %s/%d", pt, t.EncodingName, t.ClockRate)
+	if t.Channels > 0 {
+		rtpmap += "/" + strconv.Itoa(t.Channels)
+	}
+	m.AddAttribute("rtpmap", rtpmap)
+	if t.Fmtp != "" {
+		m.AddAttribute("fmtp", pt+" "+t.Fmtp)
+	}
+	if t.Media == "video" {
+		m.AddAttribute("rtcp-fb", pt+" nack pli")
+	}
+	if send {
+		m.AddAttribute("ssrc", fmt.Sprintf("%d cname:%s", t.SSRC, p.localUfrag))
+	}
+	for i, ip := range p.conf.CandidateIPs {
+		m.AddAttribute("candidate", fmt.Sprintf("%d 1 udp %d %s %d typ host",
+			i+1, webRtcPriority(webRtcHostTypePref, 65535-i), ip, p.port))
+	}
+	m.AddAttribute("end-of-candidates", "")
+	return m
+}
+
+// Tracks returns the negotiated tracks by index of the tracks passed to
+// Offer or Answer,nil for the rejected ones.
+func (p *WebRtcPeer) Tracks() []*WebRtcTrack {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*WebRtcTrack(nil), p.tracks...)
+}
+
+// HandleRtp sets the handler of the received RTP packets,track is the
+// index of the tracks passed to Offer or Answer.
+func (p *WebRtcPeer) HandleRtp(handler func(track int, pkt *RtpPacket)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rtpHandler = handler
+}
+
+// HandleRtcp sets the handler of the received RTCP packets.
+func (p *WebRtcPeer) HandleRtcp(handler RtcpHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rtcpHandler = handler
+}
+
+// Connected is closed once the SRTP keys are negotiated.
+func (p *WebRtcPeer) Connected() <-chan struct{} {
+	return p.connected
+}
+
+// Done is closed when the peer is closed.
+func (p *WebRtcPeer) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns why the peer was closed,nil when closed by Close.
+func (p *WebRtcPeer) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// LocalAddr returns the bound UDP address.
+func (p *WebRtcPeer) LocalAddr() *net.UDPAddr {
+	return p.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// RemoteAddr returns the address of the selected candidate pair,nil before
+// connectivity is established.
+func (p *WebRtcPeer) RemoteAddr() *net.UDPAddr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.remote
+}
+
+// WriteRtp sends pkt on the track of index track,the payload type and SSRC
+// are rewritten to the negotiated ones.
+func (p *WebRtcPeer) WriteRtp(track int, pkt *RtpPacket) error {
+	p.mu.Lock()
+	if track < 0 || track >= len(p.tracks) || p.tracks[track] == nil {
+		p.mu.Unlock()
+		return ErrWebRtcTrack
+	}
+	t := p.tracks[track]
+	srtp, remote := p.srtpOut, p.remote
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return ErrWebRtcClosed
+	default:
+	}
+	if srtp == nil {
+		return ErrWebRtcNotConnected
+	}
+	out := *pkt
+	out.PayloadType = t.PayloadType
+	out.SSRC = t.SSRC
+	buf, err := out.Marshal()
+	if err != nil {
+		return err
+	}
+	if buf, err = srtp.EncryptRtp(buf); err != nil {
+		return err
+	}
+	_, err = p.conn.WriteToUDP(buf, remote)
+	return err
+}
+
+// WriteRtcp sends packets as one compound RTCP packet.
+func (p *WebRtcPeer) WriteRtcp(packets ...RtcpPacket) error {
+	p.mu.Lock()
+	srtp, remote := p.srtpOut, p.remote
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return ErrWebRtcClosed
+	default:
+	}
+	if srtp == nil {
+		return ErrWebRtcNotConnected
+	}
+	buf, err := MarshalRtcp(packets...)
+	if err != nil {
+		return err
+	}
+	if buf, err = srtp.EncryptRtcp(buf); err != nil {
+		return err
+	}
+	_, err = p.conn.WriteToUDP(buf, remote)
+	return err
+}
+
+// Close sends the DTLS close_notify and releases the port.
+func (p *WebRtcPeer) Close() error {
+	p.close(nil)
+	return nil
+}
+
+func (p *WebRtcPeer) close(err error) {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.err = err
+		dtls, onClose := p.dtls, p.onClose
+		p.mu.Unlock()
+		if dtls != nil {
+			dtls.close()
+		}
+		close(p.done)
+		// the read loop releases the port once it returns
+		p.conn.Close()
+		if onClose != nil {
+			onClose()
+		}
+	})
+}
+
+func (p *WebRtcPeer) writeDtls(buf []byte) error {
+	p.mu.Lock()
+	remote := p.remote
+	p.mu.Unlock()
+	if remote == nil {
+		return ErrWebRtcNotConnected
+	}
+	_, err := p.conn.WriteToUDP(buf, remote)
+	return err
+}
+
+// watchdog closes the peer when the remote stops sending
+func (p *WebRtcPeer) watchdog() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			expired := time.Since(p.lastReceived) > p.conf.Timeout
+			p.mu.Unlock()
+			if expired {
+				p.close(ErrWebRtcTimeout)
+				return
+			}
+		}
+	}
+}
+
+// runChecks sends the connectivity checks of the controlling agent to every
+// remote candidate until one answers,then keeps the consent fresh on it
+func (p *WebRtcPeer) runChecks() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-timer.C:
+		}
+		p.mu.Lock()
+		targets := p.candidates
+		interval := webRtcCheckInterval
+		if p.remote != nil {
+			targets, interval = []*net.UDPAddr{p.remote}, webRtcConsentInterval
+		}
+		p.mu.Unlock()
+		for _, addr := range targets {
+			p.sendCheck(addr)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// sendCheck sends a nominating binding request,RFC 8445 7.1
+func (p *WebRtcPeer) sendCheck(addr *net.UDPAddr) {
+	msg := NewStunMessage(STUN_BINDING_REQUEST)
+	p.mu.Lock()
+	msg.AddAttribute(STUN_ATTR_USERNAME, []byte(p.remoteUfrag+":"+p.localUfrag))
+	key := []byte(p.remotePwd)
+	if len(p.transactions) >= webRtcMaxTransactions {
+		p.transactions = make(map[[stunTransactionIDLen]byte]bool)
+	}
+	p.transactions[msg.TransactionID] = true
+	p.mu.Unlock()
+	priority := binary.BigEndian.AppendUint32(nil, webRtcPriority(webRtcPeerReflexivePref, 65535))
+	msg.AddAttribute(STUN_ATTR_PRIORITY, priority)
+	msg.AddAttribute(STUN_ATTR_ICE_CONTROLLING, p.tieBreaker[:])
+	msg.AddAttribute(STUN_ATTR_USE_CANDIDATE, nil)
+	p.conn.WriteToUDP(msg.Marshal(key), addr)
+}
+
+func (p *WebRtcPeer) readLoop() {
+	defer func() {
+		if p.ownsPort {
+			p.conf.Ports.FreeUdpPort(p.port)
+		}
+	}()
+	buf := make([]byte, webRtcReadBufferSize)
+	for {
+		n, from, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			p.close(err)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		data := buf[:n]
+		// demultiplexed by the first byte,RFC 7983
+		switch {
+		case IsStun(data):
+			p.handleStun(data, from)
+		case data[0] >= 20 && data[0] <= 63:
+			p.handleDtls(data, from)
+		case data[0] >= 128 && data[0] <= 191:
+			p.handleSrtp(data, from)
+		}
+	}
+}
+
+// handleStun answers the checks of the remote and takes the responses to
+// the checks of the controlling agent
+func (p *WebRtcPeer) handleStun(data []byte, from *net.UDPAddr) {
+	var msg StunMessage
+	if err := msg.Unmarshal(data); err != nil {
+		return
+	}
+	switch msg.Type {
+	case STUN_BINDING_REQUEST:
+		p.mu.Lock()
+		username, _ := msg.Attribute(STUN_ATTR_USERNAME)
+		valid := p.negotiated && string(username) == p.localUfrag+":"+p.remoteUfrag
+		controlling := p.controlling
+		p.mu.Unlock()
+		if !valid || CheckStunIntegrity(data, []byte(p.localPwd)) != nil {
+			return
+		}
+		resp := &StunMessage{Type: STUN_BINDING_SUCCESS, TransactionID: msg.TransactionID}
+		resp.SetXorMappedAddress(from)
+		p.conn.WriteToUDP(resp.Marshal([]byte(p.localPwd)), from)
+		if controlling {
+			p.touch(from, false)
+			return
+		}
+		// a lite agent uses the first valid pair until one is nominated
+		_, nominated := msg.Attribute(STUN_ATTR_USE_CANDIDATE)
+		p.touch(from, nominated)
+	case STUN_BINDING_SUCCESS:
+		p.mu.Lock()
+		pending := p.transactions[msg.TransactionID]
+		delete(p.transactions, msg.TransactionID)
+		key := []byte(p.remotePwd)
+		p.mu.Unlock()
+		if !pending || CheckStunIntegrity(data, key) != nil {
+			return
+		}
+		p.touch(from, true)
+	}
+}
+
+// touch refreshes the consent of a validated remote address,selecting it
+// when nominated or when no pair is selected yet
+func (p *WebRtcPeer) touch(from *net.UDPAddr, nominate bool) {
+	p.mu.Lock()
+	p.lastReceived = time.Now()
+	p.validated[from.String()] = true
+	first := p.remote == nil
+	if first || (nominate && p.remote.String() != from.String()) {
+		p.remote = from
+	}
+	dtls := p.dtls
+	p.mu.Unlock()
+	if first {
+		// a no-op for the DTLS server
+		if err := dtls.start(); err != nil {
+			p.close(err)
+		}
+	}
+}
+
+// accepts reports whether media may come from addr and refreshes the consent
+func (p *WebRtcPeer) accepts(addr *net.UDPAddr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.validated[addr.String()] {
+		return false
+	}
+	p.lastReceived = time.Now()
+	return true
+}
+
+func (p *WebRtcPeer) handleDtls(data []byte, from *net.UDPAddr) {
+	if !p.accepts(from) {
+		return
+	}
+	p.mu.Lock()
+	dtls := p.dtls
+	p.mu.Unlock()
+	done, err := dtls.handle(data)
+	if err != nil {
+		p.close(err)
+		return
+	}
+	if !done {
+		return
+	}
+	localKey, localSalt, remoteKey, remoteSalt := dtls.exportSrtpKeys()
+	out, err := NewSrtpContext(localKey, localSalt)
+	if err != nil {
+		p.close(err)
+		return
+	}
+	in, err := NewSrtpContext(remoteKey, remoteSalt)
+	if err != nil {
+		p.close(err)
+		return
+	}
+	p.mu.Lock()
+	p.srtpOut, p.srtpIn = out, in
+	p.mu.Unlock()
+	close(p.connected)
+}
+
+func (p *WebRtcPeer) handleSrtp(data []byte, from *net.UDPAddr) {
+	if !p.accepts(from) {
+		return
+	}
+	p.mu.Lock()
+	srtp, rtpHandler, rtcpHandler := p.srtpIn, p.rtpHandler, p.rtcpHandler
+	p.mu.Unlock()
+	if srtp == nil {
+		return
+	}
+	if IsRtcp(data) {
+		buf, err := srtp.DecryptRtcp(data)
+		if err != nil || rtcpHandler == nil {
+			return
+		}
+		if packets, err := UnmarshalRtcp(buf); err == nil {
+			rtcpHandler(packets, from)
+		}
+		return
+	}
+	buf, err := srtp.DecryptRtp(data)
+	if err != nil || rtpHandler == nil {
+		return
+	}
+	pkt := &RtpPacket{}
+	if err := pkt.Unmarshal(buf); err != nil {
+		return
+	}
+	p.mu.Lock()
+	track, ok := p.ptTracks[pkt.PayloadType]
+	p.mu.Unlock()
+	if ok {
+		rtpHandler(track, pkt)
+	}
+}
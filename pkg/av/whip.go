@@ -0,0 +1,227 @@
+package av
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+const (
+	whipContentType      = "application/sdp"
+	whipMaxOfferSize     = 64 << 10
+	whipSessionIDSize    = 12
+	whipDeleteTimeout    = 5 * time.Second
+	whipAllowedMethods   = "OPTIONS, POST, DELETE"
+	whipExposedHeaders   = "Location"
+	whipRequestedHeaders = "Authorization, Content-Type"
+)
+
+// WhipConfig configuration of the WHIP ingest and WHEP egress handlers
+type WhipConfig struct {
+	Peer WebRtcPeerConfig
+	// Tracks returns the tracks of the resource path,the codecs accepted from
+	// a WHIP publisher or sent to a WHEP viewer.A nil slice answers 404
+	Tracks func(path string) ([]WebRtcTrack, error)
+	// OnPeer is called with the negotiated peer before the answer is sent,it
+	// feeds a WHEP peer with WriteRtp or sets the handlers of a WHIP peer.
+	// The request is refused with 403 when it returns an error
+	OnPeer func(path string, peer *WebRtcPeer) error
+}
+
+// whipHandler serves the WHIP (RFC 9725) or WHEP endpoints of the paths it
+// is mounted on,a POST creates a session resource at <path>/<id> which is
+// ended by a DELETE
+type whipHandler struct {
+	conf     WhipConfig
+	send     bool
+	mu       sync.Mutex
+	sessions map[string]*WebRtcPeer // by resource path
+}
+
+// NewWhipHandler returns the handler of a WHIP ingest endpoint,the peers
+// receive the tracks.
+func NewWhipHandler(conf WhipConfig) http.Handler {
+	return &whipHandler{conf: conf, sessions: make(map[string]*WebRtcPeer)}
+}
+
+// NewWhepHandler returns the handler of a WHEP egress endpoint,the peers
+// send the tracks.
+func NewWhepHandler(conf WhipConfig) http.Handler {
+	return &whipHandler{conf: conf, send: true, sessions: make(map[string]*WebRtcPeer)}
+}
+
+func (h *whipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", whipExposedHeaders)
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", whipAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", whipRequestedHeaders)
+		w.Header().Set("Accept-Post", whipContentType)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		h.create(w, r)
+	case http.MethodDelete:
+		h.mu.Lock()
+		peer := h.sessions[r.URL.Path]
+		delete(h.sessions, r.URL.Path)
+		h.mu.Unlock()
+		if peer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		peer.Close()
+		w.WriteHeader(http.StatusOK)
+	default:
+		// trickle ICE and ICE restarts by PATCH are not supported
+		w.Header().Set("Allow", whipAllowedMethods)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *whipHandler) create(w http.ResponseWriter, r *http.Request) {
+	if typ, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); typ != whipContentType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, whipMaxOfferSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var offer SessionDescription
+	if err := offer.Unmarshal(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Path
+	tracks, err := h.conf.Tracks(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tracks == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	peer, err := NewWebRtcPeer(h.conf.Peer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	answer, err := peer.Answer(&offer, tracks, h.send)
+	if err != nil {
+		peer.Close()
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	if h.conf.OnPeer != nil {
+		if err := h.conf.OnPeer(path, peer); err != nil {
+			peer.Close()
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	resource := strings.TrimSuffix(path, "/") + "/" + utils.RandomString(whipSessionIDSize)
+	h.mu.Lock()
+	h.sessions[resource] = peer
+	h.mu.Unlock()
+	go func() {
+		<-peer.Done()
+		h.mu.Lock()
+		if h.sessions[resource] == peer {
+			delete(h.sessions, resource)
+		}
+		h.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", whipContentType)
+	w.Header().Set("Location", resource)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(answer.Marshal())
+}
+
+// DialWhip publishes tracks to the WHIP endpoint url,WriteRtp is usable once
+// Connected is closed.Close ends the session with a DELETE.
+func DialWhip(ctx context.Context, url string, conf WebRtcPeerConfig, tracks []WebRtcTrack) (*WebRtcPeer, error) {
+	return dialWhip(ctx, url, conf, tracks, true)
+}
+
+// DialWhep plays the WHEP endpoint url,receiving tracks by HandleRtp.Close
+// ends the session with a DELETE.
+func DialWhep(ctx context.Context, url string, conf WebRtcPeerConfig, tracks []WebRtcTrack) (*WebRtcPeer, error) {
+	return dialWhip(ctx, url, conf, tracks, false)
+}
+
+func dialWhip(ctx context.Context, url string, conf WebRtcPeerConfig, tracks []WebRtcTrack, send bool) (*WebRtcPeer, error) {
+	peer, err := NewWebRtcPeer(conf)
+	if err != nil {
+		return nil, err
+	}
+	answer, location, err := postWhipOffer(ctx, url, peer, tracks, send)
+	if err != nil {
+		peer.Close()
+		return nil, err
+	}
+	peer.mu.Lock()
+	peer.onClose = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), whipDeleteTimeout)
+		defer cancel()
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, location, nil); err == nil {
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	peer.mu.Unlock()
+	if err := peer.SetAnswer(answer); err != nil {
+		peer.Close()
+		return nil, err
+	}
+	return peer, nil
+}
+
+// postWhipOffer posts the offer of peer and returns the answer and the
+// absolute URL of the session resource
+func postWhipOffer(ctx context.Context, url string, peer *WebRtcPeer, tracks []WebRtcTrack, send bool) (*SessionDescription, string, error) {
+	offer, err := peer.Offer(tracks, send)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(offer.Marshal()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", whipContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, whipMaxOfferSize))
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, "", fmt.Errorf("%w:%s %s", ErrWebRtcNegotiation, resp.Status, strings.TrimSpace(string(body)))
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return nil, "", fmt.Errorf("%w:missing session location", ErrWebRtcNegotiation)
+	}
+	var answer SessionDescription
+	if err := answer.Unmarshal(body); err != nil {
+		return nil, "", err
+	}
+	return &answer, location.String(), nil
+}
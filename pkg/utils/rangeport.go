@@ -90,3 +90,42 @@ func (range_port *RangePort) SelectUdpPort() (int, error) {
 	range_port.udp_ports.Store(select_port, 1)
 	return select_port, nil
 }
+
+// SelectUdpPortPair select an even port and the next odd port,both unused,
+// as RTP/RTCP requires
+func (range_port *RangePort) SelectUdpPortPair() (int, error) {
+	first := range_port.port_min + range_port.port_min%2
+	for port := first; port+1 <= range_port.port_max; port += 2 {
+		if !range_port.udp_ports.CompareAndSwap(port, 0, 1) {
+			continue
+		}
+		if !range_port.udp_ports.CompareAndSwap(port+1, 0, 1) {
+			range_port.udp_ports.Store(port, 0)
+			continue
+		}
+		if udpPortUsable(port) && udpPortUsable(port+1) {
+			return port, nil
+		}
+		// used by other process,release it and try the next pair
+		range_port.udp_ports.Store(port, 0)
+		range_port.udp_ports.Store(port+1, 0)
+	}
+	return 0, errors.New("can't select unused port pair")
+}
+
+// FreeUdpPortPair free the pair selected by SelectUdpPortPair
+func (range_port *RangePort) FreeUdpPortPair(port int) {
+	range_port.FreeUdpPort(port)
+	range_port.FreeUdpPort(port + 1)
+}
+
+func udpPortUsable(port int) bool {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{
+		Port: port,
+	})
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
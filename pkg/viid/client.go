@@ -0,0 +1,319 @@
+package viid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+var (
+	ErrUnauthorized = errors.New("viid: unauthorized")
+	ErrClientClosed = errors.New("viid: client closed")
+)
+
+// ClientState 客户端注册状态
+type ClientState int
+
+const (
+	ClientState_Offline     ClientState = iota // 未注册
+	ClientState_Registering                    // 注册中
+	ClientState_Online                         // 已注册,保活中
+	ClientState_Closed                         // 已注销关闭
+)
+
+func (state ClientState) String() string {
+	switch state {
+	case ClientState_Offline:
+		return "offline"
+	case ClientState_Registering:
+		return "registering"
+	case ClientState_Online:
+		return "online"
+	case ClientState_Closed:
+		return "closed"
+	}
+	return fmt.Sprintf("ClientState(%d)", int(state))
+}
+
+// ClientEvent 客户端状态变化事件,Err为导致离线的错误
+type ClientEvent struct {
+	State ClientState
+	Err   error
+}
+
+// ClientConfig 视图库客户端配置
+type ClientConfig struct {
+	ServerURL string // 视图库地址,如 http://192.168.1.10:8080
+	DeviceID  string // 本级设备编码,作为 User-Identify
+	Username  string // 认证用户名,为空时使用DeviceID
+	Password  string // 认证密码
+
+	KeepaliveInterval time.Duration // 保活间隔,默认30s
+	KeepaliveRetry    int           // 连续保活失败次数达到后重新注册,默认3
+	RetryInterval     time.Duration // 注册失败后的重试间隔,默认10s
+	HTTPClient        *http.Client  // 默认使用10s超时的客户端
+
+	OnEvent func(ClientEvent) // 状态变化回调,在客户端goroutine中调用
+}
+
+// Client 视图库客户端,负责注册 保活 注销,并以注册身份访问视图库接口
+type Client struct {
+	conf ClientConfig
+
+	mu        sync.Mutex
+	state     ClientState
+	challenge *digestChallenge
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewClient(conf ClientConfig) (*Client, error) {
+	if utils.StringIsNullOrEmpty(conf.ServerURL) || utils.StringIsNullOrEmpty(conf.DeviceID) {
+		return nil, fmt.Errorf("%w:viid client need ServerURL and DeviceID", utils.ERR_INVALID_PARAMETER)
+	}
+	conf.ServerURL = strings.TrimRight(conf.ServerURL, "/")
+	if conf.Username == "" {
+		conf.Username = conf.DeviceID
+	}
+	if conf.KeepaliveInterval <= 0 {
+		conf.KeepaliveInterval = 30 * time.Second
+	}
+	if conf.KeepaliveRetry <= 0 {
+		conf.KeepaliveRetry = 3
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = 10 * time.Second
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{conf: conf}, nil
+}
+
+// State 当前注册状态
+func (c *Client) State() ClientState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(state ClientState, err error) {
+	c.mu.Lock()
+	if c.state == state || c.state == ClientState_Closed {
+		c.mu.Unlock()
+		return
+	}
+	c.state = state
+	c.mu.Unlock()
+	if c.conf.OnEvent != nil {
+		c.conf.OnEvent(ClientEvent{State: state, Err: err})
+	}
+}
+
+// Start 启动注册保活循环,注册失败或保活失败时自动重新注册,直到Close
+func (c *Client) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil || c.state == ClientState_Closed {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.run(ctx)
+}
+
+func (c *Client) run(ctx context.Context) {
+	defer close(c.done)
+	for {
+		c.setState(ClientState_Registering, nil)
+		err := c.Register(ctx)
+		if err == nil {
+			c.setState(ClientState_Online, nil)
+			err = c.keepalive(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		c.setState(ClientState_Offline, err)
+		if !sleepContext(ctx, c.conf.RetryInterval) {
+			return
+		}
+	}
+}
+
+// keepalive 周期保活,返回导致需要重新注册的错误
+func (c *Client) keepalive(ctx context.Context) error {
+	ticker := time.NewTicker(c.conf.KeepaliveInterval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		err := c.Keepalive(ctx)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return err
+		}
+		if failures++; failures >= c.conf.KeepaliveRetry {
+			return err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Close 停止保活,已注册时注销
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, done, state := c.cancel, c.done, c.state
+	c.cancel = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	var err error
+	if state == ClientState_Online {
+		err = c.UnRegister(ctx)
+	}
+	c.setState(ClientState_Closed, err)
+	return err
+}
+
+// Register 注册,首次请求返回401质询后以Digest认证重发
+func (c *Client) Register(ctx context.Context) error {
+	c.mu.Lock()
+	c.challenge = nil
+	c.mu.Unlock()
+	return c.Do(ctx, http.MethodPost, VIIDURL_Register, &RegisterBody{RegisterObject: &DeviceIDObject{DeviceID: c.conf.DeviceID}}, nil)
+}
+
+// Keepalive 保活
+func (c *Client) Keepalive(ctx context.Context) error {
+	return c.Do(ctx, http.MethodPost, VIIDURL_Keepalive, &KeepaliveBody{KeepaliveObject: &DeviceIDObject{DeviceID: c.conf.DeviceID}}, nil)
+}
+
+// UnRegister 注销
+func (c *Client) UnRegister(ctx context.Context) error {
+	return c.Do(ctx, http.MethodPost, VIIDURL_UnRegister, &UnRegisterBody{UnRegisterObject: &DeviceIDObject{DeviceID: c.conf.DeviceID}}, nil)
+}
+
+// Time 查询视图库时间
+func (c *Client) Time(ctx context.Context) (*SystemTime, error) {
+	var body SystemTimeBody
+	if err := c.Do(ctx, http.MethodGet, VIIDURL_Time, nil, &body); err != nil {
+		return nil, err
+	}
+	if body.SystemTimeObject == nil {
+		return nil, fmt.Errorf("viid: %s missing SystemTimeObject", VIIDURL_Time)
+	}
+	return body.SystemTimeObject, nil
+}
+
+// Do 以注册身份请求视图库接口,in为请求消息体,out为nil时按应答状态解析,
+// 状态码非正常时返回*ResponseStatus
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	challenge := c.challenge
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, method, path, payload, challenge)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && challenge == nil {
+		resp.Body.Close()
+		if challenge, err = parseDigestChallenge(resp.Header.Get("WWW-Authenticate")); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.challenge = challenge
+		c.mu.Unlock()
+		if resp, err = c.send(ctx, method, path, payload, challenge); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	return c.decode(path, resp, out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, challenge *digestChallenge) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.conf.ServerURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", ContentType_VIID)
+	}
+	req.Header.Set(Header_UserIdentify, c.conf.DeviceID)
+	if challenge != nil {
+		c.mu.Lock()
+		auth := challenge.authorization(method, req.URL.RequestURI(), c.conf.Username, c.conf.Password)
+		c.mu.Unlock()
+		req.Header.Set("Authorization", auth)
+	}
+	return c.conf.HTTPClient.Do(req)
+}
+
+func (c *Client) decode(path string, resp *http.Response, out any) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.mu.Lock()
+		c.challenge = nil
+		c.mu.Unlock()
+		return fmt.Errorf("%w:%s", ErrUnauthorized, path)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 || out == nil {
+		var status ResponseStatusBody
+		if json.Unmarshal(data, &status) == nil && status.ResponseStatusObject != nil {
+			if status.ResponseStatusObject.StatusCode != StatusCode_OK {
+				return status.ResponseStatusObject
+			}
+		} else if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("viid: %s http status %s", path, resp.Status)
+		}
+		if out == nil {
+			return nil
+		}
+	}
+	return json.Unmarshal(data, out)
+}
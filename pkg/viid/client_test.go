@@ -0,0 +1,271 @@
+package viid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRecorder 记录经过视图库服务的请求,fail 不为0时以该状态码应答
+type testRecorder struct {
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests []*http.Request
+	fail     int
+}
+
+func (rec *testRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, r.Clone(context.Background()))
+	fail := rec.fail
+	rec.mu.Unlock()
+	if fail != 0 {
+		http.Error(w, http.StatusText(fail), fail)
+		return
+	}
+	rec.handler.ServeHTTP(w, r)
+}
+
+func (rec *testRecorder) setFail(code int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.fail = code
+}
+
+// count 路径 path 的请求数
+func (rec *testRecorder) count(path string) int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	n := 0
+	for _, r := range rec.requests {
+		if r.URL.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func (rec *testRecorder) take() []*http.Request {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	requests := rec.requests
+	rec.requests = nil
+	return requests
+}
+
+func newTestRecorder(t *testing.T, conf ServerConfig) (*Server, *testRecorder, string) {
+	t.Helper()
+	rec := &testRecorder{}
+	server, ts := newTestServer(t, conf, func(handler http.Handler) http.Handler {
+		rec.handler = handler
+		return rec
+	})
+	return server, rec, ts.URL
+}
+
+// testEvents 收集客户端状态事件
+func testEvents() (func(ClientEvent), <-chan ClientEvent) {
+	ch := make(chan ClientEvent, 64)
+	return func(event ClientEvent) { ch <- event }, ch
+}
+
+// expectEvent 等待状态为 state 的事件,err 不为nil时检查事件的错误
+func expectEvent(t *testing.T, events <-chan ClientEvent, state ClientState, err error) ClientEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		if event.State != state {
+			t.Fatalf("event %v (%v),want %v", event.State, event.Err, state)
+		}
+		if err != nil && !errors.Is(event.Err, err) {
+			t.Fatalf("event %v error %v,want %v", event.State, event.Err, err)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %v", state)
+	}
+	return ClientEvent{}
+}
+
+func TestClientDigest(t *testing.T) {
+	_, rec, url := newTestRecorder(t, ServerConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := newTestClient(t, url, ClientConfig{})
+
+	if err := client.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+	requests := rec.take()
+	if len(requests) != 2 {
+		t.Fatalf("%d register requests", len(requests))
+	}
+	// 首次请求无认证,收到质询后以 Digest 重发
+	if auth := requests[0].Header.Get("Authorization"); auth != "" {
+		t.Fatalf("first request authorization %q", auth)
+	}
+	params, ok := digestParams(requests[1].Header.Get("Authorization"))
+	if !ok {
+		t.Fatalf("authorization %q", requests[1].Header.Get("Authorization"))
+	}
+	want := map[string]string{"username": testDeviceID, "realm": testServerID, "uri": VIIDURL_Register, "qop": "auth", "nc": "00000001"}
+	for key, value := range want {
+		if params[key] != value {
+			t.Fatalf("digest %s = %q,want %q", key, params[key], value)
+		}
+	}
+	for _, r := range requests {
+		if r.Header.Get(Header_UserIdentify) != testDeviceID {
+			t.Fatalf("User-Identify %q", r.Header.Get(Header_UserIdentify))
+		}
+	}
+
+	// 注册后的请求以注册身份访问
+	systemTime, err := client.Time(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if systemTime.VIIDServerID != testServerID || systemTime.LocalTime == nil {
+		t.Fatalf("time %+v", systemTime)
+	}
+	if err := client.Keepalive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UnRegister(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 注销后保活被质询,重新质询后仍是未注册设备
+	if err := client.Keepalive(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("keepalive after unregister: %v", err)
+	}
+}
+
+func TestClientKeepalive(t *testing.T) {
+	server, rec, url := newTestRecorder(t, ServerConfig{})
+	onEvent, events := testEvents()
+	client := newTestClient(t, url, ClientConfig{KeepaliveInterval: 20 * time.Millisecond, RetryInterval: 20 * time.Millisecond, OnEvent: onEvent})
+	client.Start()
+
+	expectEvent(t, events, ClientState_Registering, nil)
+	expectEvent(t, events, ClientState_Online, nil)
+	if client.State() != ClientState_Online {
+		t.Fatalf("state %v", client.State())
+	}
+	registered, _ := server.Device(testDeviceID)
+	deadline := time.Now().Add(5 * time.Second)
+	for rec.count(VIIDURL_Keepalive) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for keepalive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	device, ok := server.Device(testDeviceID)
+	if !ok || !device.KeepaliveTime.After(registered.KeepaliveTime) {
+		t.Fatalf("keepalive time not refreshed %+v", device)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, ClientState_Closed, nil)
+	if rec.count(VIIDURL_UnRegister) != 1 {
+		t.Fatalf("%d unregister requests", rec.count(VIIDURL_UnRegister))
+	}
+	if _, ok := server.Device(testDeviceID); ok {
+		t.Fatal("device online after close")
+	}
+	// 关闭后不再启动
+	client.Start()
+	if client.State() != ClientState_Closed {
+		t.Fatalf("state %v after restart", client.State())
+	}
+}
+
+func TestClientReregister(t *testing.T) {
+	devices := make(chan DeviceEvent, 16)
+	server, rec, url := newTestRecorder(t, ServerConfig{OnDevice: func(event DeviceEvent) { devices <- event }})
+	onEvent, events := testEvents()
+	client := newTestClient(t, url, ClientConfig{KeepaliveInterval: 20 * time.Millisecond, RetryInterval: 20 * time.Millisecond, OnEvent: onEvent})
+	client.Start()
+	defer client.Close(context.Background())
+
+	expectEvent(t, events, ClientState_Registering, nil)
+	expectEvent(t, events, ClientState_Online, nil)
+	if event := <-devices; !event.Online || event.Device.DeviceID != testDeviceID {
+		t.Fatalf("device event %+v", event)
+	}
+
+	// 服务端丢失会话,保活收到401后立即重新注册
+	registers := rec.count(VIIDURL_Register)
+	server.unregister(testDeviceID)
+	<-devices
+	expectEvent(t, events, ClientState_Offline, ErrUnauthorized)
+	expectEvent(t, events, ClientState_Registering, nil)
+	expectEvent(t, events, ClientState_Online, nil)
+	if event := <-devices; !event.Online {
+		t.Fatalf("device event %+v", event)
+	}
+	if n := rec.count(VIIDURL_Register); n != registers+2 {
+		t.Fatalf("%d register requests,want %d", n, registers+2)
+	}
+
+	// 保活连续失败 KeepaliveRetry 次后重新注册,注册失败时按 RetryInterval 重试
+	rec.setFail(http.StatusServiceUnavailable)
+	event := expectEvent(t, events, ClientState_Offline, nil)
+	if event.Err == nil || !strings.Contains(event.Err.Error(), "503") {
+		t.Fatalf("offline error %v", event.Err)
+	}
+	keepalives := rec.count(VIIDURL_Keepalive)
+	expectEvent(t, events, ClientState_Registering, nil)
+	expectEvent(t, events, ClientState_Offline, nil)
+	rec.setFail(0)
+	for {
+		event := <-events
+		if event.State == ClientState_Online {
+			break
+		}
+		if event.State != ClientState_Registering && event.State != ClientState_Offline {
+			t.Fatalf("event %v", event.State)
+		}
+	}
+	if keepalives < 3 {
+		t.Fatalf("%d keepalive requests before offline", keepalives)
+	}
+	if _, ok := server.Device(testDeviceID); !ok {
+		t.Fatal("device not registered again")
+	}
+}
+
+func TestClientRegisterRejected(t *testing.T) {
+	_, _, url := newTestRecorder(t, ServerConfig{})
+	onEvent, events := testEvents()
+	client := newTestClient(t, url, ClientConfig{Password: "wrong", RetryInterval: 20 * time.Millisecond, OnEvent: onEvent})
+	client.Start()
+
+	for i := 0; i < 2; i++ {
+		expectEvent(t, events, ClientState_Registering, nil)
+		expectEvent(t, events, ClientState_Offline, ErrUnauthorized)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 未注册时关闭不发送注销
+	if err := client.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		event := <-events
+		if event.State == ClientState_Closed {
+			break
+		}
+	}
+	if _, err := client.Time(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("time after rejected register: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package viid
+
+import (
+	"encoding/base64"
+	"io"
+	"strings"
+)
+
+// Data字段可能带有 data:image/jpeg;base64, 形式的前缀
+const dataURIBase64Marker = ";base64,"
+
+// NewDataReader 返回base64编码的Data字段的解码流,按需逐块解码,解码时不会再生成
+// 完整的解码副本.兼容data URI前缀,换行以及缺省的填充.
+// 注意Data字段本身仍是完整的base64字符串,反序列化期间消息体与其同时存在于内存中,
+// 这里只保证解码和编码不再额外缓冲,超大的载荷应改用StoragePath传递
+func NewDataReader(data string) io.Reader {
+	if strings.HasPrefix(data, "data:") {
+		if i := strings.Index(data, dataURIBase64Marker); i >= 0 {
+			data = data[i+len(dataURIBase64Marker):]
+		}
+	}
+	// 去掉末尾的填充后按无填充编码解码,中间的换行由解码器忽略
+	data = strings.TrimRight(data, "=\r\n")
+	return base64.NewDecoder(base64.RawStdEncoding, strings.NewReader(data))
+}
+
+// DecodeData 将Data字段解码写入w,返回写入的字节数
+func DecodeData(w io.Writer, data string) (int64, error) {
+	return io.Copy(w, NewDataReader(data))
+}
+
+// EncodeData 读取r直到EOF并编码为Data字段,原始字节不缓冲,编码结果只分配一次.
+// size为已知的原始字节数用于预分配,未知时传0
+func EncodeData(r io.Reader, size int64) (string, error) {
+	var sb strings.Builder
+	if size > 0 {
+		sb.Grow(base64.StdEncoding.EncodedLen(int(size)))
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, &sb)
+	if _, err := io.Copy(encoder, r); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,181 @@
+package viid
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// 设备编码 GA/T 1400.1 / GB/T 28181 附录D:
+// 中心编码(8位,前6位为行政区划代码)+行业编码(2位)+类型编码(3位)+网络标识(1位)+设备序号(6位)
+
+// 类型编码(值类型string)
+const (
+	DeviceType_DVR              string = "111" // DVR
+	DeviceType_VideoServer      string = "112" // 视频服务器
+	DeviceType_Encoder          string = "113" // 编码器
+	DeviceType_Decoder          string = "114" // 解码器
+	DeviceType_VideoSwitch      string = "115" // 视频切换矩阵
+	DeviceType_AudioSwitch      string = "116" // 音频切换矩阵
+	DeviceType_AlarmController  string = "117" // 报警控制器
+	DeviceType_NVR              string = "118" // 网络视频录像机
+	DeviceType_APE              string = "119" // 视频图像信息采集设备
+	DeviceType_APS              string = "120" // 视频图像信息采集系统
+	DeviceType_Tollgate         string = "121" // 视频卡口
+	DeviceType_Camera           string = "131" // 摄像机
+	DeviceType_IPC              string = "132" // 网络摄像机
+	DeviceType_Display          string = "133" // 显示器
+	DeviceType_AlarmInput       string = "134" // 报警输入设备
+	DeviceType_AlarmOutput      string = "135" // 报警输出设备
+	DeviceType_AudioInput       string = "136" // 语音输入设备
+	DeviceType_AudioOutput      string = "137" // 语音输出设备
+	DeviceType_MobileTransmit   string = "138" // 移动传输设备
+	DeviceType_Peripheral       string = "139" // 其他外围设备
+	DeviceType_CenterServer     string = "200" // 中心信令控制服务器
+	DeviceType_WebServer        string = "201" // Web应用服务器
+	DeviceType_MediaServer      string = "202" // 媒体分发服务器
+	DeviceType_ProxyServer      string = "203" // 代理服务器
+	DeviceType_SecurityServer   string = "204" // 安全服务器
+	DeviceType_AlarmServer      string = "205" // 报警服务器
+	DeviceType_DatabaseServer   string = "206" // 数据库服务器
+	DeviceType_GISServer        string = "207" // GIS服务器
+	DeviceType_ManagementServer string = "208" // 管理服务器
+	DeviceType_Gateway          string = "209" // 接入网关
+	DeviceType_StorageServer    string = "210" // 媒体存储服务器
+	DeviceType_SignalGateway    string = "211" // 信令安全路由网关
+	DeviceType_BusinessGroup    string = "215" // 业务分组
+	DeviceType_VirtualOrg       string = "216" // 虚拟组织
+	DeviceType_CenterUser       string = "300" // 中心用户
+	DeviceType_TerminalUser     string = "400" // 终端用户
+	DeviceType_VIID             string = "503" // 视图库
+)
+
+var deviceTypeNames = map[string]string{
+	DeviceType_DVR: "DVR", DeviceType_VideoServer: "视频服务器", DeviceType_Encoder: "编码器",
+	DeviceType_Decoder: "解码器", DeviceType_VideoSwitch: "视频切换矩阵", DeviceType_AudioSwitch: "音频切换矩阵",
+	DeviceType_AlarmController: "报警控制器", DeviceType_NVR: "网络视频录像机", DeviceType_APE: "视频图像信息采集设备",
+	DeviceType_APS: "视频图像信息采集系统", DeviceType_Tollgate: "视频卡口", DeviceType_Camera: "摄像机",
+	DeviceType_IPC: "网络摄像机", DeviceType_Display: "显示器", DeviceType_AlarmInput: "报警输入设备",
+	DeviceType_AlarmOutput: "报警输出设备", DeviceType_AudioInput: "语音输入设备", DeviceType_AudioOutput: "语音输出设备",
+	DeviceType_MobileTransmit: "移动传输设备", DeviceType_Peripheral: "其他外围设备", DeviceType_CenterServer: "中心信令控制服务器",
+	DeviceType_WebServer: "Web应用服务器", DeviceType_MediaServer: "媒体分发服务器", DeviceType_ProxyServer: "代理服务器",
+	DeviceType_SecurityServer: "安全服务器", DeviceType_AlarmServer: "报警服务器", DeviceType_DatabaseServer: "数据库服务器",
+	DeviceType_GISServer: "GIS服务器", DeviceType_ManagementServer: "管理服务器", DeviceType_Gateway: "接入网关",
+	DeviceType_StorageServer: "媒体存储服务器", DeviceType_SignalGateway: "信令安全路由网关", DeviceType_BusinessGroup: "业务分组",
+	DeviceType_VirtualOrg: "虚拟组织", DeviceType_CenterUser: "中心用户", DeviceType_TerminalUser: "终端用户",
+	DeviceType_VIID: "视图库",
+}
+
+// 行业编码名称,未列出的为预留
+var industryNames = map[string]string{
+	"00": "社会治安路面接入", "01": "社会治安社区接入", "02": "社会治安内部接入", "03": "社会治安其他接入",
+	"04": "交通路面接入", "05": "交通卡口接入", "06": "交通内部接入", "07": "交通其他接入",
+	"08": "城市管理接入", "09": "卫生环保接入", "10": "商检海关接入", "11": "教育部门接入",
+	"40": "农林牧渔业接入", "41": "采矿企业接入", "42": "制造企业接入", "43": "冶金企业接入",
+	"44": "电力企业接入", "45": "燃气企业接入", "46": "建筑企业接入", "47": "物流企业接入",
+	"48": "邮政企业接入", "49": "信息企业接入", "50": "住宿和餐饮业接入", "51": "金融企业接入",
+	"52": "房地产业接入", "53": "商务服务业接入", "54": "水利企业接入", "55": "娱乐企业接入",
+}
+
+// 网络标识名称,0-4 均为监控报警专网
+var networkNames = [10]string{"监控报警专网", "监控报警专网", "监控报警专网", "监控报警专网", "监控报警专网",
+	"公安信息网", "政务网", "Internet", "社会资源接入网", "预留"}
+
+// 设备序号最大值
+const MaxDeviceSerial = 999999
+
+// DeviceID 20位设备编码,各段的访问方法要求编码已通过 Validate
+type DeviceID string
+
+// ParseDeviceID 解析并校验设备编码
+func ParseDeviceID(s string) (DeviceID, error) {
+	id := DeviceID(s)
+	if err := id.Validate(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// NewDeviceID 由各段生成设备编码,center 为8位中心编码,industry 为2位行业编码,
+// typeCode 为3位类型编码,network 为网络标识0-9
+func NewDeviceID(center, industry, typeCode string, network, serial int) (DeviceID, error) {
+	if network < 0 || network > 9 || serial < 0 || serial > MaxDeviceSerial {
+		return "", fmt.Errorf("%w:device network %d serial %d", utils.ERR_INVALID_PARAMETER, network, serial)
+	}
+	if len(center) != 8 || len(industry) != 2 || len(typeCode) != 3 {
+		return "", fmt.Errorf("%w:device code %s %s %s length", utils.ERR_INVALID_PARAMETER, center, industry, typeCode)
+	}
+	return ParseDeviceID(fmt.Sprintf("%s%s%s%d%06d", center, industry, typeCode, network, serial))
+}
+
+// Validate 校验20位数字及中心编码中的行政区划代码
+func (id DeviceID) Validate() error {
+	if len(id) != MaxLength_DeviceID {
+		return fmt.Errorf("%w:device id %q must be %d digits", utils.ERR_INVALID_PARAMETER, string(id), MaxLength_DeviceID)
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return fmt.Errorf("%w:device id %q must be digits", utils.ERR_INVALID_PARAMETER, string(id))
+		}
+	}
+	return id.PlaceCode().Validate()
+}
+
+// CenterCode 中心编码,行政区划代码+2位基层接入单位编码
+func (id DeviceID) CenterCode() string {
+	return string(id[:8])
+}
+
+// PlaceCode 中心编码中的行政区划代码
+func (id DeviceID) PlaceCode() PlaceCode {
+	return PlaceCode(id[:6])
+}
+
+// IndustryCode 行业编码
+func (id DeviceID) IndustryCode() string {
+	return string(id[8:10])
+}
+
+// IndustryName 行业编码名称,预留编码返回空
+func (id DeviceID) IndustryName() string {
+	return industryNames[id.IndustryCode()]
+}
+
+// TypeCode 类型编码 DeviceType_*
+func (id DeviceID) TypeCode() string {
+	return string(id[10:13])
+}
+
+// TypeName 类型编码名称,未知类型返回空
+func (id DeviceID) TypeName() string {
+	return deviceTypeNames[id.TypeCode()]
+}
+
+// Network 网络标识
+func (id DeviceID) Network() int {
+	return int(id[13] - '0')
+}
+
+// NetworkName 网络标识名称
+func (id DeviceID) NetworkName() string {
+	return networkNames[id.Network()]
+}
+
+// Serial 设备序号
+func (id DeviceID) Serial() int {
+	serial, _ := strconv.Atoi(string(id[14:]))
+	return serial
+}
+
+// Next 同一中心 行业 类型和网络下序号加一的编码,用于顺序分配
+func (id DeviceID) Next() (DeviceID, error) {
+	if id.Serial() >= MaxDeviceSerial {
+		return "", fmt.Errorf("%w:device serial of %s exhausted", utils.ERR_INVALID_PARAMETER, string(id))
+	}
+	return NewDeviceID(id.CenterCode(), id.IndustryCode(), id.TypeCode(), id.Network(), id.Serial()+1)
+}
+
+func (id DeviceID) String() string {
+	return string(id)
+}
@@ -0,0 +1,114 @@
+package viid
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// 注册使用的 HTTP Digest 认证 RFC 2617,只支持 MD5 及 qop=auth
+
+var ErrDigestChallenge = errors.New("viid: invalid digest challenge")
+
+// digestParams 解析 Digest 头的参数,如 Digest realm="x",nonce="y",qop=auth
+func digestParams(header string) (map[string]string, bool) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, false
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimLeft(value, " ")
+		if strings.HasPrefix(value, "\"") {
+			end := strings.IndexByte(value[1:], '"')
+			if end < 0 {
+				return nil, false
+			}
+			params[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			end := strings.IndexByte(value, ',')
+			if end < 0 {
+				end = len(value)
+			}
+			params[key] = strings.TrimSpace(value[:end])
+			rest = value[end:]
+		}
+	}
+	return params, true
+}
+
+func digestMD5(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestResponse 计算摘要,qop为空时按 RFC 2069 计算
+func digestResponse(username, realm, password, method, uri, nonce, nc, cnonce, qop string) string {
+	ha1 := digestMD5(username, realm, password)
+	ha2 := digestMD5(method, uri)
+	if qop == "" {
+		return digestMD5(ha1, nonce, ha2)
+	}
+	return digestMD5(ha1, nonce, nc, cnonce, qop, ha2)
+}
+
+// digestChallenge 服务端 WWW-Authenticate 质询
+type digestChallenge struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    string
+	nc     uint32
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	params, ok := digestParams(header)
+	if !ok || params["nonce"] == "" {
+		return nil, fmt.Errorf("%w:%s", ErrDigestChallenge, header)
+	}
+	if alg := params["algorithm"]; alg != "" && !strings.EqualFold(alg, "MD5") {
+		return nil, fmt.Errorf("%w:unsupported algorithm %s", ErrDigestChallenge, alg)
+	}
+	ch := &digestChallenge{realm: params["realm"], nonce: params["nonce"], opaque: params["opaque"]}
+	if qop, ok := params["qop"]; ok {
+		for _, v := range strings.Split(qop, ",") {
+			if strings.TrimSpace(v) == "auth" {
+				ch.qop = "auth"
+			}
+		}
+		if ch.qop == "" {
+			return nil, fmt.Errorf("%w:unsupported qop %s", ErrDigestChallenge, qop)
+		}
+	}
+	return ch, nil
+}
+
+// authorization 生成 Authorization 头,每次调用递增 nc
+func (ch *digestChallenge) authorization(method, uri, username, password string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s",realm="%s",nonce="%s",uri="%s"`, username, ch.realm, ch.nonce, uri)
+	if ch.qop == "" {
+		fmt.Fprintf(&b, `,response="%s"`, digestResponse(username, ch.realm, password, method, uri, ch.nonce, "", "", ""))
+	} else {
+		ch.nc++
+		nc := fmt.Sprintf("%08x", ch.nc)
+		cnonce := utils.RandomString(12)
+		response := digestResponse(username, ch.realm, password, method, uri, ch.nonce, nc, cnonce, ch.qop)
+		fmt.Fprintf(&b, `,response="%s",qop=%s,nc=%s,cnonce="%s"`, response, ch.qop, nc, cnonce)
+	}
+	b.WriteString(`,algorithm=MD5`)
+	if ch.opaque != "" {
+		fmt.Fprintf(&b, `,opaque="%s"`, ch.opaque)
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package viid
+
+// Face 人脸对象 GA/T 1400.3 A.10
+type Face struct {
+	FaceID   string   `json:"FaceID"`             // 人脸标识 BasicObjectIDType string(48)
+	InfoKind InfoType `json:"InfoKind"`           // 信息分类 InfoType_*
+	SourceID string   `json:"SourceID"`           // 来源标识 BasicObjectIDType string(41)
+	DeviceID string   `json:"DeviceID,omitempty"` // 设备编码 DeviceIDType string(20)
+	ObjectPosition
+	LocationMarkTime  *VIIDTime `json:"LocationMarkTime,omitempty"`  // 位置标记时间
+	FaceAppearTime    *VIIDTime `json:"FaceAppearTime,omitempty"`    // 人脸出现时间
+	FaceDisAppearTime *VIIDTime `json:"FaceDisAppearTime,omitempty"` // 人脸消失时间
+	PersonCharacter
+
+	Attitude         int     `json:"Attitude,omitempty"`         // 姿态分布 1平视 2微仰 3微俯 4左微侧脸 5左斜侧脸 6左全侧脸 7右微侧脸 8右斜侧脸 9右全侧脸
+	Similaritydegree float64 `json:"Similaritydegree,omitempty"` // 近似度 0-1
+	EyebrowStyle     string  `json:"EyebrowStyle,omitempty"`     // 眉型 string(32)
+	NoseStyle        string  `json:"NoseStyle,omitempty"`        // 鼻型 string(32)
+	MustacheStyle    string  `json:"MustacheStyle,omitempty"`    // 胡型 string(32)
+	LipStyle         string  `json:"LipStyle,omitempty"`         // 嘴唇 string(32)
+	WrinklePouch     string  `json:"WrinklePouch,omitempty"`     // 皱纹眼袋 string(32)
+	AcneStain        string  `json:"AcneStain,omitempty"`        // 痤疮色斑 string(32)
+	FreckleBirthmark string  `json:"FreckleBirthmark,omitempty"` // 黑痣胎记 string(32)
+	ScarDimple       string  `json:"ScarDimple,omitempty"`       // 疤痕酒窝 string(32)
+	OtherFeature     string  `json:"OtherFeature,omitempty"`     // 其他特征 string(128)
+
+	SubImageList *SubImageInfoList `json:"SubImageList,omitempty"` // 图像列表
+}
+
+// FaceListObject 人脸对象列表
+type FaceListObject struct {
+	FaceObject []*Face `json:"FaceObject"`
+}
+
+// FaceListBody 人脸批量接口的消息体 {"FaceListObject":{"FaceObject":[...]}}
+type FaceListBody struct {
+	FaceListObject *FaceListObject `json:"FaceListObject"`
+}
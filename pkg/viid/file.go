@@ -0,0 +1,34 @@
+package viid
+
+// FileInfo 文件信息 GA/T 1400.3 A.4
+type FileInfo struct {
+	FileID        string    `json:"FileID"`                 // 文件标识 BasicObjectIDType string(41)
+	InfoKind      InfoType  `json:"InfoKind"`               // 信息分类 InfoType_*
+	Source        string    `json:"Source"`                 // 文件来源 DataSourceType string(2)
+	FileName      string    `json:"FileName"`               // 文件名 string(256)
+	StoragePath   string    `json:"StoragePath,omitempty"`  // 存储路径 string(256)
+	FileHash      string    `json:"FileHash,omitempty"`     // 文件哈希值 string(128)
+	FileFormat    string    `json:"FileFormat"`             // 文件格式 string(6)
+	Title         string    `json:"Title"`                  // 题名 string(128)
+	SecurityLevel string    `json:"SecurityLevel"`          // 密级代码 SecretLevelType_*
+	SubmiterName  string    `json:"SubmiterName,omitempty"` // 入库人 NameType string(50)
+	SubmiterOrg   string    `json:"SubmiterOrg,omitempty"`  // 入库单位名称 OrgType string(100)
+	EntryTime     *VIIDTime `json:"EntryTime,omitempty"`    // 入库时间
+	FileSize      int64     `json:"FileSize,omitempty"`     // 文件大小 字节
+}
+
+// File 文件对象,Data为base64编码的文件内容
+type File struct {
+	FileInfo *FileInfo `json:"FileInfo"`
+	Data     string    `json:"Data,omitempty"`
+}
+
+// FileListObject 文件对象列表
+type FileListObject struct {
+	File []*File `json:"File"`
+}
+
+// FileListBody 文件批量接口的消息体 {"FileListObject":{"File":[...]}}
+type FileListBody struct {
+	FileListObject *FileListObject `json:"FileListObject"`
+}
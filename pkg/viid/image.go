@@ -0,0 +1,95 @@
+package viid
+
+// 图像类型代码(值类型string) SubImageInfo.Type
+const (
+	ImageType_Vehicle         string = "01"  // 车辆大图
+	ImageType_Plate           string = "02"  // 车牌彩色小图
+	ImageType_PlateBinary     string = "03"  // 车牌二值化图
+	ImageType_Driver          string = "04"  // 驾驶员面部特征图
+	ImageType_CoDriver        string = "05"  // 副驾驶面部特征图
+	ImageType_VehicleLogo     string = "06"  // 车标
+	ImageType_Violation       string = "07"  // 违章合成图
+	ImageType_PassComposite   string = "08"  // 过车合成图
+	ImageType_VehicleCloseup  string = "09"  // 车辆特写图
+	ImageType_Person          string = "10"  // 人员图
+	ImageType_Face            string = "11"  // 人脸图
+	ImageType_NonMotorVehicle string = "12"  // 非机动车图
+	ImageType_Thing           string = "13"  // 物品图
+	ImageType_Scene           string = "14"  // 场景图
+	ImageType_General         string = "100" // 一般图片
+)
+
+// ImageInfo 图像信息 GA/T 1400.3 A.3
+type ImageInfo struct {
+	ImageID       string    `json:"ImageID"`                 // 图像标识 BasicObjectIDType string(41)
+	InfoKind      InfoType  `json:"InfoKind"`                // 信息分类 InfoType_*
+	ImageSource   string    `json:"ImageSource"`             // 图像来源 DataSourceType string(2)
+	SourceVideoID string    `json:"SourceVideoID,omitempty"` // 来源视频标识 BasicObjectIDType string(41)
+	OriginImageID string    `json:"OriginImageID,omitempty"` // 原始图像标识 BasicObjectIDType string(41)
+	EventSort     int       `json:"EventSort"`               // 事件分类
+	DeviceID      string    `json:"DeviceID"`                // 采集设备编码 DeviceIDType string(20)
+	StoragePath   string    `json:"StoragePath,omitempty"`   // 存储路径 string(256)
+	FileHash      string    `json:"FileHash,omitempty"`      // 图像文件哈希值 string(128)
+	FileFormat    string    `json:"FileFormat"`              // 图像文件格式 ImageFormatType string(6)
+	ShotTime      *VIIDTime `json:"ShotTime,omitempty"`      // 拍摄时间
+
+	Title              string `json:"Title"`                        // 题名 string(128)
+	TitleNote          string `json:"TitleNote,omitempty"`          // 题名补充 string(128)
+	SpecialIName       string `json:"SpecialIName,omitempty"`       // 专项名 string(128)
+	Keyword            string `json:"Keyword,omitempty"`            // 关键词 string(200)
+	ContentDescription string `json:"ContentDescription,omitempty"` // 内容描述 string(256)
+	SubjectCharacter   string `json:"SubjectCharacter,omitempty"`   // 主题人物 string(256)
+	ShotPlace
+	SecurityLevel string `json:"SecurityLevel"` // 密级代码 SecretLevelType_*
+
+	Width              int    `json:"Width"`                        // 宽度 像素
+	Height             int    `json:"Height"`                       // 高度 像素
+	CameraManufacturer string `json:"CameraManufacturer,omitempty"` // 数码相机生产商 string(50)
+	CameraVersion      string `json:"CameraVersion,omitempty"`      // 数码相机型号 string(64)
+	ApertureValue      int    `json:"ApertureValue,omitempty"`      // 光圈值
+	ISOSensitivity     int    `json:"ISOSensitivity,omitempty"`     // ISO感光度
+	FocalLength        int    `json:"FocalLength,omitempty"`        // 焦距
+	QualityGrade       string `json:"QualityGrade,omitempty"`       // 质量等级 QualityGradeType string(1)
+	Collector
+	ImageProcFlag int   `json:"ImageProcFlag,omitempty"` // 图像处理标志 0未处理 1已处理
+	FileSize      int64 `json:"FileSize,omitempty"`      // 文件大小 字节
+}
+
+// Image 图像对象,图像信息及其中识别出的目标,Data为base64编码的图像
+type Image struct {
+	ImageInfo           *ImageInfo                 `json:"ImageInfo"`
+	PersonList          *PersonListObject          `json:"PersonList,omitempty"`
+	FaceList            *FaceListObject            `json:"FaceList,omitempty"`
+	MotorVehicleList    *MotorVehicleListObject    `json:"MotorVehicleList,omitempty"`
+	NonMotorVehicleList *NonMotorVehicleListObject `json:"NonMotorVehicleList,omitempty"`
+	Data                string                     `json:"Data,omitempty"`
+}
+
+// ImageListObject 图像对象列表
+type ImageListObject struct {
+	Image []*Image `json:"Image"`
+}
+
+// ImageListBody 图像批量接口的消息体 {"ImageListObject":{"Image":[...]}}
+type ImageListBody struct {
+	ImageListObject *ImageListObject `json:"ImageListObject"`
+}
+
+// SubImageInfo 子图像信息,视频图像信息对象携带的图像 GA/T 1400.3 A.13
+type SubImageInfo struct {
+	ImageID     string    `json:"ImageID"`               // 图像标识 BasicObjectIDType string(41)
+	EventSort   int       `json:"EventSort"`             // 事件分类
+	DeviceID    string    `json:"DeviceID"`              // 采集设备编码 DeviceIDType string(20)
+	StoragePath string    `json:"StoragePath,omitempty"` // 存储路径 string(256)
+	Type        string    `json:"Type"`                  // 图像类型 ImageType_*
+	FileFormat  string    `json:"FileFormat"`            // 图像文件格式 ImageFormatType string(6)
+	ShotTime    *VIIDTime `json:"ShotTime,omitempty"`    // 拍摄时间
+	Width       int       `json:"Width"`                 // 宽度 像素
+	Height      int       `json:"Height"`                // 高度 像素
+	Data        string    `json:"Data,omitempty"`        // base64编码的图像,为空时由StoragePath获取
+}
+
+// SubImageInfoList 子图像列表
+type SubImageInfoList struct {
+	SubImageInfoObject []*SubImageInfo `json:"SubImageInfoObject"`
+}
@@ -0,0 +1,121 @@
+package viid
+
+// ObjectPosition 目标在图像中的位置,以图像左上角为原点的像素坐标
+type ObjectPosition struct {
+	LeftTopX  int `json:"LeftTopX,omitempty"`  // 左上角X坐标
+	LeftTopY  int `json:"LeftTopY,omitempty"`  // 左上角Y坐标
+	RightBtmX int `json:"RightBtmX,omitempty"` // 右下角X坐标
+	RightBtmY int `json:"RightBtmY,omitempty"` // 右下角Y坐标
+}
+
+// PersonCharacter 人员身份与体貌特征,人脸和人员对象共有的属性
+type PersonCharacter struct {
+	IDType                 string `json:"IDType,omitempty"`                 // 证件种类 string(3)
+	IDNumber               string `json:"IDNumber,omitempty"`               // 证件号码 string(30)
+	Name                   string `json:"Name,omitempty"`                   // 姓名 string(50)
+	UsedName               string `json:"UsedName,omitempty"`               // 曾用名 string(50)
+	Alias                  string `json:"Alias,omitempty"`                  // 绰号 string(50)
+	GenderCode             string `json:"GenderCode,omitempty"`             // 性别代码 string(1)
+	AgeUpLimit             int    `json:"AgeUpLimit,omitempty"`             // 年龄上限
+	AgeLowerLimit          int    `json:"AgeLowerLimit,omitempty"`          // 年龄下限
+	EthicCode              string `json:"EthicCode,omitempty"`              // 民族代码 string(2)
+	NationalityCode        string `json:"NationalityCode,omitempty"`        // 国籍代码 string(3)
+	NativeCityCode         string `json:"NativeCityCode,omitempty"`         // 籍贯省市县代码 string(6)
+	ResidenceAdminDivision string `json:"ResidenceAdminDivision,omitempty"` // 居住地行政区划 string(6)
+	ChineseAccentCode      string `json:"ChineseAccentCode,omitempty"`      // 汉语口音代码 string(6)
+	JobCategory            string `json:"JobCategory,omitempty"`            // 职业类别代码 string(3)
+	AccompanyNumber        int    `json:"AccompanyNumber,omitempty"`        // 同行人数
+
+	SkinColor       string `json:"SkinColor,omitempty"`       // 肤色 string(2)
+	HairStyle       string `json:"HairStyle,omitempty"`       // 发型 string(2)
+	HairColor       string `json:"HairColor,omitempty"`       // 发色 string(2)
+	FaceStyle       string `json:"FaceStyle,omitempty"`       // 脸型 string(4)
+	FacialFeature   string `json:"FacialFeature,omitempty"`   // 脸部特征 string(40)
+	PhysicalFeature string `json:"PhysicalFeature,omitempty"` // 体貌特征 string(200)
+	RespiratorColor string `json:"RespiratorColor,omitempty"` // 口罩颜色 string(2)
+	CapStyle        string `json:"CapStyle,omitempty"`        // 帽子款式 string(2)
+	CapColor        string `json:"CapColor,omitempty"`        // 帽子颜色 string(2)
+	GlassStyle      string `json:"GlassStyle,omitempty"`      // 眼镜款式 string(2)
+	GlassColor      string `json:"GlassColor,omitempty"`      // 眼镜颜色 string(2)
+
+	IsDriver                          int    `json:"IsDriver"`                                    // 是否驾驶员 YesOrNot_*
+	IsForeigner                       int    `json:"IsForeigner"`                                 // 是否涉外人员 YesOrNot_*
+	PassportType                      string `json:"PassportType,omitempty"`                      // 护照证件种类 string(2)
+	ImmigrantTypeCode                 string `json:"ImmigrantTypeCode,omitempty"`                 // 出入境人员类别代码 string(2)
+	IsSuspectedTerrorist              int    `json:"IsSuspectedTerrorist"`                        // 是否涉恐人员 YesOrNot_*
+	SuspectedTerroristNumber          string `json:"SuspectedTerroristNumber,omitempty"`          // 涉恐人员编号 string(19)
+	IsCriminalInvolved                int    `json:"IsCriminalInvolved"`                          // 是否涉案人员 YesOrNot_*
+	CriminalInvolvedSpecilisationCode string `json:"CriminalInvolvedSpecilisationCode,omitempty"` // 涉案人员专长代码 string(2)
+	BodySpeciallMark                  string `json:"BodySpeciallMark,omitempty"`                  // 体表特殊标记 string(7)
+	CrimeMethod                       string `json:"CrimeMethod,omitempty"`                       // 作案手段 string(4)
+	CrimeCharacterCode                string `json:"CrimeCharacterCode,omitempty"`                // 作案特点代码 string(3)
+	EscapedCriminalNumber             string `json:"EscapedCriminalNumber,omitempty"`             // 在逃人员编号 string(23)
+	IsDetainees                       int    `json:"IsDetainees"`                                 // 是否在押人员 YesOrNot_*
+	DetentionHouseCode                string `json:"DetentionHouseCode,omitempty"`                // 看守所编码 string(9)
+	DetaineesIdentity                 string `json:"DetaineesIdentity,omitempty"`                 // 在押人员身份 string(2)
+	DetaineesSpecialIdentity          string `json:"DetaineesSpecialIdentity,omitempty"`          // 在押人员特殊身份 string(2)
+	MemberTypeCode                    string `json:"MemberTypeCode,omitempty"`                    // 成员类型代码 string(2)
+	IsVictim                          int    `json:"IsVictim"`                                    // 是否被害人 YesOrNot_*
+	VictimType                        string `json:"VictimType,omitempty"`                        // 被害人种类 string(3)
+	InjuredDegree                     string `json:"InjuredDegree,omitempty"`                     // 受伤害程度 string(1)
+	CorpseConditionCode               string `json:"CorpseConditionCode,omitempty"`               // 尸体状况代码 string(2)
+	IsSuspiciousPerson                int    `json:"IsSuspiciousPerson"`                          // 是否可疑人 YesOrNot_*
+}
+
+// VehicleCharacter 车辆号牌与车身特征,机动车和非机动车对象共有的属性
+type VehicleCharacter struct {
+	HasPlate            bool    `json:"HasPlate,omitempty"`            // 有无车牌
+	PlateClass          string  `json:"PlateClass,omitempty"`          // 号牌种类 string(2)
+	PlateColor          string  `json:"PlateColor,omitempty"`          // 车牌颜色 string(2)
+	PlateNo             string  `json:"PlateNo,omitempty"`             // 车牌号 string(15)
+	PlateNoAttach       string  `json:"PlateNoAttach,omitempty"`       // 挂车牌号 string(15)
+	PlateDescribe       string  `json:"PlateDescribe,omitempty"`       // 车牌描述 string(64)
+	IsDecked            bool    `json:"IsDecked,omitempty"`            // 是否套牌
+	IsAltered           bool    `json:"IsAltered,omitempty"`           // 是否涂改
+	IsCovered           bool    `json:"IsCovered,omitempty"`           // 是否遮挡
+	Speed               float64 `json:"Speed,omitempty"`               // 行驶速度 km/h
+	DrivingStatusCode   string  `json:"DrivingStatusCode,omitempty"`   // 行驶状态代码 string(4)
+	UsingPropertiesCode string  `json:"UsingPropertiesCode,omitempty"` // 车辆使用性质代码 string(3)
+	VehicleBrand        string  `json:"VehicleBrand,omitempty"`        // 车辆品牌 string(3)
+	VehicleLength       int     `json:"VehicleLength,omitempty"`       // 车辆长度 mm
+	VehicleWidth        int     `json:"VehicleWidth,omitempty"`        // 车辆宽度 mm
+	VehicleHeight       int     `json:"VehicleHeight,omitempty"`       // 车辆高度 mm
+	VehicleColor        string  `json:"VehicleColor,omitempty"`        // 车身颜色 string(2)
+	VehicleHood         string  `json:"VehicleHood,omitempty"`         // 车前盖 string(64)
+	VehicleTrunk        string  `json:"VehicleTrunk,omitempty"`        // 车后盖 string(64)
+	VehicleWheel        string  `json:"VehicleWheel,omitempty"`        // 车轮 string(64)
+	WheelPrintedPattern string  `json:"WheelPrintedPattern,omitempty"` // 车轮印花纹 string(2)
+	VehicleWindow       string  `json:"VehicleWindow,omitempty"`       // 车窗 string(64)
+	VehicleRoof         string  `json:"VehicleRoof,omitempty"`         // 车顶 string(64)
+	VehicleDoor         string  `json:"VehicleDoor,omitempty"`         // 车门 string(64)
+	SideOfVehicle       string  `json:"SideOfVehicle,omitempty"`       // 车侧 string(64)
+	CarOfVehicle        string  `json:"CarOfVehicle,omitempty"`        // 车厢 string(64)
+	RearviewMirror      string  `json:"RearviewMirror,omitempty"`      // 后视镜 string(64)
+	VehicleChassis      string  `json:"VehicleChassis,omitempty"`      // 底盘 string(64)
+	VehicleShielding    string  `json:"VehicleShielding,omitempty"`    // 遮挡 string(64)
+	FilmColor           string  `json:"FilmColor,omitempty"`           // 贴膜颜色 string(1)
+	IsModified          bool    `json:"IsModified,omitempty"`          // 改装标志
+}
+
+// ShotPlace 拍摄地点与方向,图像和视频片段共有的属性
+type ShotPlace struct {
+	ShotPlaceCode           string  `json:"ShotPlaceCode,omitempty"`           // 拍摄地点区划 PlaceCodeType string(6)
+	ShotPlaceFullAdress     string  `json:"ShotPlaceFullAdress,omitempty"`     // 拍摄地点名称 PlaceFullAddressType string(100)
+	ShotPlaceLongitude      float64 `json:"ShotPlaceLongitude,omitempty"`      // 拍摄地点经度
+	ShotPlaceLatitude       float64 `json:"ShotPlaceLatitude,omitempty"`       // 拍摄地点纬度
+	HorizontalShotDirection string  `json:"HorizontalShotDirection,omitempty"` // 水平拍摄方向 string(1)
+	VerticalShotDirection   string  `json:"VerticalShotDirection,omitempty"`   // 垂直拍摄方向 string(1)
+}
+
+// Collector 采集人与入库人,图像和视频片段共有的属性
+type Collector struct {
+	CollectorName    string    `json:"CollectorName,omitempty"`    // 采集人 NameType string(50)
+	CollectorOrg     string    `json:"CollectorOrg,omitempty"`     // 采集单位名称 OrgType string(100)
+	CollectorIDType  string    `json:"CollectorIDType,omitempty"`  // 采集人证件类型 IDType string(3)
+	CollectorID      string    `json:"CollectorID,omitempty"`      // 采集人证件号码 IDNumberType string(30)
+	EntryClerk       string    `json:"EntryClerk,omitempty"`       // 入库人 NameType string(50)
+	EntryClerkOrg    string    `json:"EntryClerkOrg,omitempty"`    // 入库单位名称 OrgType string(100)
+	EntryClerkIDType string    `json:"EntryClerkIDType,omitempty"` // 入库人证件类型 IDType string(3)
+	EntryClerkID     string    `json:"EntryClerkID,omitempty"`     // 入库人证件号码 IDNumberType string(30)
+	EntryTime        *VIIDTime `json:"EntryTime,omitempty"`        // 入库时间
+}
@@ -0,0 +1,51 @@
+package viid
+
+// Person 人员对象 GA/T 1400.3 A.9
+type Person struct {
+	PersonID string   `json:"PersonID"`           // 人员标识 BasicObjectIDType string(48)
+	InfoKind InfoType `json:"InfoKind"`           // 信息分类 InfoType_*
+	SourceID string   `json:"SourceID"`           // 来源标识 BasicObjectIDType string(41)
+	DeviceID string   `json:"DeviceID,omitempty"` // 设备编码 DeviceIDType string(20)
+	ObjectPosition
+	LocationMarkTime    *VIIDTime `json:"LocationMarkTime,omitempty"`    // 位置标记时间
+	PersonAppearTime    *VIIDTime `json:"PersonAppearTime,omitempty"`    // 人员出现时间
+	PersonDisAppearTime *VIIDTime `json:"PersonDisAppearTime,omitempty"` // 人员消失时间
+	PersonCharacter
+
+	PersonOrg            string `json:"PersonOrg,omitempty"`            // 所在单位 string(0...100)
+	HeightUpLimit        int    `json:"HeightUpLimit,omitempty"`        // 身高上限 cm
+	HeightLowerLimit     int    `json:"HeightLowerLimit,omitempty"`     // 身高下限 cm
+	BodyType             string `json:"BodyType,omitempty"`             // 体型 string(2)
+	Gesture              string `json:"Gesture,omitempty"`              // 姿态 string(2)
+	Status               string `json:"Status,omitempty"`               // 状态 string(2)
+	BodyFeature          string `json:"BodyFeature,omitempty"`          // 体表特征 string(70)
+	HabitualMovement     string `json:"HabitualMovement,omitempty"`     // 习惯动作 string(2)
+	Behavior             string `json:"Behavior,omitempty"`             // 行为 string(2)
+	BehaviorDescription  string `json:"BehaviorDescription,omitempty"`  // 行为描述 string(256)
+	Appendant            string `json:"Appendant,omitempty"`            // 附属物 string(128)
+	AppendantDescription string `json:"AppendantDescription,omitempty"` // 附属物描述 string(256)
+	UmbrellaColor        string `json:"UmbrellaColor,omitempty"`        // 伞颜色 string(2)
+	ScarfColor           string `json:"ScarfColor,omitempty"`           // 围巾颜色 string(2)
+	BagStyle             string `json:"BagStyle,omitempty"`             // 包款式 string(2)
+	BagColor             string `json:"BagColor,omitempty"`             // 包颜色 string(2)
+	CoatStyle            string `json:"CoatStyle,omitempty"`            // 上衣款式 string(2)
+	CoatLength           string `json:"CoatLength,omitempty"`           // 上衣长度 string(2)
+	CoatColor            string `json:"CoatColor,omitempty"`            // 上衣颜色 string(2)
+	TrousersStyle        string `json:"TrousersStyle,omitempty"`        // 裤子款式 string(2)
+	TrousersColor        string `json:"TrousersColor,omitempty"`        // 裤子颜色 string(2)
+	TrousersLen          string `json:"TrousersLen,omitempty"`          // 裤子长度 string(2)
+	ShoesStyle           string `json:"ShoesStyle,omitempty"`           // 鞋子款式 string(2)
+	ShoesColor           string `json:"ShoesColor,omitempty"`           // 鞋子颜色 string(2)
+
+	SubImageList *SubImageInfoList `json:"SubImageList,omitempty"` // 图像列表
+}
+
+// PersonListObject 人员对象列表
+type PersonListObject struct {
+	PersonObject []*Person `json:"PersonObject"`
+}
+
+// PersonListBody 人员批量接口的消息体 {"PersonListObject":{"PersonObject":[...]}}
+type PersonListBody struct {
+	PersonListObject *PersonListObject `json:"PersonListObject"`
+}
@@ -0,0 +1,185 @@
+package viid
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// 内置的 GB/T 2260 代码表包含省级 地级和县级代码,
+// 代码表更新后新增的代码可由 LoadPlaceCodes 加载
+//
+//go:embed gbt2260.txt
+var gbt2260 string
+
+var (
+	placeOnce  sync.Once
+	placeMu    sync.RWMutex
+	placeNames map[PlaceCode]string
+)
+
+func placeTable() map[PlaceCode]string {
+	placeOnce.Do(func() {
+		placeNames = make(map[PlaceCode]string)
+		if err := loadPlaceCodes(strings.NewReader(gbt2260)); err != nil {
+			panic(err)
+		}
+	})
+	return placeNames
+}
+
+// LoadPlaceCodes 加载行政区划代码表并与已有代码合并,每行为 代码 名称,以空白分隔,
+// 空行和 # 开头的行被忽略
+func LoadPlaceCodes(r io.Reader) error {
+	placeTable()
+	return loadPlaceCodes(r)
+}
+
+func loadPlaceCodes(r io.Reader) error {
+	names := make(map[PlaceCode]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("%w:place code line %d %q", utils.ERR_INVALID_PARAMETER, line, text)
+		}
+		code := PlaceCode(fields[0])
+		if !code.wellFormed() {
+			return fmt.Errorf("%w:place code line %d %q", utils.ERR_INVALID_PARAMETER, line, text)
+		}
+		names[code] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	placeMu.Lock()
+	defer placeMu.Unlock()
+	for code, name := range names {
+		placeNames[code] = name
+	}
+	return nil
+}
+
+// PlaceCode 6位行政区划代码 GB/T 2260,前2位省级 中间2位地级 后2位县级
+type PlaceCode string
+
+// 行政区划级别
+const (
+	PlaceLevel_Province = 1 // 省级
+	PlaceLevel_City     = 2 // 地级
+	PlaceLevel_District = 3 // 县级
+)
+
+// ParsePlaceCode 解析并校验行政区划代码
+func ParsePlaceCode(s string) (PlaceCode, error) {
+	code := PlaceCode(s)
+	if err := code.Validate(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (code PlaceCode) wellFormed() bool {
+	if len(code) != MaxLength_PlaceCode || code[:2] == "00" {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 校验格式,代码须在代码表中
+func (code PlaceCode) Validate() error {
+	if !code.wellFormed() {
+		return fmt.Errorf("%w:invalid place code %q", utils.ERR_INVALID_PARAMETER, string(code))
+	}
+	if _, ok := lookupPlace(code); !ok {
+		return fmt.Errorf("%w:unknown place code %s", utils.ERR_INVALID_PARAMETER, string(code))
+	}
+	return nil
+}
+
+// Level 代码级别 PlaceLevel_*
+func (code PlaceCode) Level() int {
+	switch {
+	case strings.HasSuffix(string(code), "0000"):
+		return PlaceLevel_Province
+	case strings.HasSuffix(string(code), "00"):
+		return PlaceLevel_City
+	}
+	return PlaceLevel_District
+}
+
+// Province 所属省级代码
+func (code PlaceCode) Province() PlaceCode {
+	if len(code) < 2 {
+		return ""
+	}
+	return code[:2] + "0000"
+}
+
+// City 所属地级代码,省级代码返回空
+func (code PlaceCode) City() PlaceCode {
+	if len(code) < 4 || code.Level() == PlaceLevel_Province {
+		return ""
+	}
+	return code[:4] + "00"
+}
+
+// Name 代码表中的名称,未知代码返回空
+func (code PlaceCode) Name() string {
+	name, _ := lookupPlace(code)
+	return name
+}
+
+// ProvinceName 省级名称
+func (code PlaceCode) ProvinceName() string {
+	return code.Province().Name()
+}
+
+// CityName 地级名称,直辖市的区县及省直辖县级行政区划返回空
+func (code PlaceCode) CityName() string {
+	name := code.City().Name()
+	if isPlaceholderPlace(name) {
+		return ""
+	}
+	return name
+}
+
+// FullName 省 地 县名称的组合,如 广东省深圳市;北京市东城区
+func (code PlaceCode) FullName() string {
+	full := code.ProvinceName() + code.CityName()
+	if code.Level() == PlaceLevel_District {
+		full += code.Name()
+	}
+	return full
+}
+
+func (code PlaceCode) String() string {
+	return string(code)
+}
+
+func lookupPlace(code PlaceCode) (string, bool) {
+	table := placeTable()
+	placeMu.RLock()
+	defer placeMu.RUnlock()
+	name, ok := table[code]
+	return name, ok
+}
+
+// isPlaceholderPlace 完整代码表中 市辖区 县 直辖县级行政区划等非实际地名
+func isPlaceholderPlace(name string) bool {
+	return name == "市辖区" || name == "县" || strings.HasSuffix(name, "直辖县级行政区划")
+}
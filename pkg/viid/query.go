@@ -0,0 +1,528 @@
+package viid
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// 查询条件 GA/T 1400.4 附录,如
+// (Face.DeviceID=xxx)AND(Face.ShotTime>=20170101000000)&RecordStartNo=1&PageRecordNum=20&Sort=Face.ShotTime DESC
+// 条件以 AND OR 组合,AND 优先,多个条件须加括号,值不能包含右括号
+
+// ErrInvalidQuery 查询条件错误,errors.Is(err, utils.ERR_INVALID_PARAMETER) 成立
+var ErrInvalidQuery = fmt.Errorf("%w:viid query", utils.ERR_INVALID_PARAMETER)
+
+// QueryOp 条件运算符
+type QueryOp string
+
+const (
+	QueryOp_Eq   QueryOp = "="
+	QueryOp_Ne   QueryOp = "<>" // 也接受 !=
+	QueryOp_Gt   QueryOp = ">"
+	QueryOp_Ge   QueryOp = ">="
+	QueryOp_Lt   QueryOp = "<"
+	QueryOp_Le   QueryOp = "<="
+	QueryOp_Like QueryOp = "LIKE" // 只用于字符串字段,% 为通配符
+)
+
+// 条件组合
+const (
+	QueryLogic_And = "AND"
+	QueryLogic_Or  = "OR"
+)
+
+// 分页参数
+const (
+	QueryParam_RecordStartNo = "RecordStartNo" // 起始记录号,从1开始
+	QueryParam_PageRecordNum = "PageRecordNum" // 每页记录数
+	QueryParam_Sort          = "Sort"          // 排序字段,多个以逗号分隔,字段后可加 ASC DESC
+)
+
+// QueryExpr 条件表达式,为 *QueryCondition 或 *QueryGroup
+type QueryExpr interface {
+	fmt.Stringer
+	sql(b *sqlBuilder)
+}
+
+// QueryCondition 单个条件,Value 已按字段类型转换:
+// 字符串为string,整数为int64,浮点为float64,布尔为bool,时间为VIIDTime
+type QueryCondition struct {
+	Object string
+	Field  string
+	Op     QueryOp
+	Value  any
+	raw    string
+}
+
+// String 查询串形式,值经过URL编码
+func (cond *QueryCondition) String() string {
+	if cond.Op == QueryOp_Like {
+		return fmt.Sprintf("(%s.%s%%20LIKE%%20%s)", cond.Object, cond.Field, url.QueryEscape(cond.raw))
+	}
+	return fmt.Sprintf("(%s.%s%s%s)", cond.Object, cond.Field, cond.Op, url.QueryEscape(cond.raw))
+}
+
+// QueryGroup 以 AND 或 OR 组合的条件
+type QueryGroup struct {
+	Logic string // QueryLogic_*
+	Exprs []QueryExpr
+}
+
+func (group *QueryGroup) String() string {
+	parts := make([]string, len(group.Exprs))
+	for i, expr := range group.Exprs {
+		parts[i] = expr.String()
+	}
+	return "(" + strings.Join(parts, group.Logic) + ")"
+}
+
+// QuerySort 排序字段
+type QuerySort struct {
+	Field string
+	Desc  bool
+}
+
+// Query 解析后的查询
+type Query struct {
+	Object        string    // 查询对象,如 Face
+	Where         QueryExpr // 查询条件,nil 为无条件
+	RecordStartNo int       // 起始记录号,从1开始
+	PageRecordNum int       // 每页记录数,0 为不分页
+	Sort          []QuerySort
+}
+
+// String 规范化的查询串,可再次由 ParseQuery 解析
+func (q *Query) String() string {
+	var parts []string
+	if q.Where != nil {
+		parts = append(parts, q.Where.String())
+	}
+	parts = append(parts, fmt.Sprintf("%s=%d", QueryParam_RecordStartNo, q.RecordStartNo))
+	if q.PageRecordNum > 0 {
+		parts = append(parts, fmt.Sprintf("%s=%d", QueryParam_PageRecordNum, q.PageRecordNum))
+	}
+	if len(q.Sort) > 0 {
+		sorts := make([]string, len(q.Sort))
+		for i, sort := range q.Sort {
+			sorts[i] = q.Object + "." + sort.Field
+			if sort.Desc {
+				sorts[i] += "%20DESC"
+			}
+		}
+		parts = append(parts, QueryParam_Sort+"="+strings.Join(sorts, ","))
+	}
+	return strings.Join(parts, "&")
+}
+
+// LimitOffset 分页对应的 LIMIT OFFSET,不分页时 limit 为0
+func (q *Query) LimitOffset() (limit, offset int) {
+	return q.PageRecordNum, q.RecordStartNo - 1
+}
+
+// 可查询的对象及其模型
+var queryModels = map[string]reflect.Type{
+	"Face":            reflect.TypeOf(Face{}),
+	"Person":          reflect.TypeOf(Person{}),
+	"MotorVehicle":    reflect.TypeOf(MotorVehicle{}),
+	"NonMotorVehicle": reflect.TypeOf(NonMotorVehicle{}),
+	"Image":           reflect.TypeOf(ImageInfo{}),
+	"VideoSlice":      reflect.TypeOf(VideoSliceInfo{}),
+	"File":            reflect.TypeOf(FileInfo{}),
+	"Subscribe":       reflect.TypeOf(Subscribe{}),
+}
+
+var (
+	queryFieldsOnce sync.Once
+	queryFields     map[string]map[string]reflect.Type
+)
+
+var viidTimeType = reflect.TypeOf(&VIIDTime{})
+
+// modelFields 由 json tag 得到模型的可查询字段,展开嵌入结构,忽略对象列表
+func modelFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			modelFields(field.Type, fields)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			fields[name] = field.Type
+		case reflect.Pointer:
+			if field.Type == viidTimeType {
+				fields[name] = field.Type
+			}
+		}
+	}
+}
+
+func lookupField(object, field string) (reflect.Type, error) {
+	queryFieldsOnce.Do(func() {
+		queryFields = make(map[string]map[string]reflect.Type, len(queryModels))
+		for name, t := range queryModels {
+			fields := make(map[string]reflect.Type)
+			modelFields(t, fields)
+			queryFields[name] = fields
+		}
+	})
+	fields, ok := queryFields[object]
+	if !ok {
+		return nil, fmt.Errorf("%w:unknown object %s", ErrInvalidQuery, object)
+	}
+	t, ok := fields[field]
+	if !ok {
+		return nil, fmt.Errorf("%w:unknown field %s.%s", ErrInvalidQuery, object, field)
+	}
+	return t, nil
+}
+
+// ParseQuery 解析 object 对象的查询串,rawQuery 为未解码的 URL 查询部分,
+// 条件和排序只能使用该对象模型中的字段
+func ParseQuery(object, rawQuery string) (*Query, error) {
+	if _, ok := queryModels[object]; !ok {
+		return nil, fmt.Errorf("%w:unknown object %s", ErrInvalidQuery, object)
+	}
+	q := &Query{Object: object, RecordStartNo: 1}
+	var exprs []QueryExpr
+	for _, part := range splitQuery(rawQuery) {
+		part, err := url.QueryUnescape(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w:%s", ErrInvalidQuery, err.Error())
+		}
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		if name, value, ok := queryParam(part); ok {
+			if err := q.setParam(name, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p := &queryParser{object: object, s: part}
+		expr, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	switch len(exprs) {
+	case 0:
+	case 1:
+		q.Where = exprs[0]
+	default:
+		q.Where = &QueryGroup{Logic: QueryLogic_And, Exprs: exprs}
+	}
+	return q, nil
+}
+
+// splitQuery 以括号外的 & 分割查询串
+func splitQuery(rawQuery string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(rawQuery); i++ {
+		switch rawQuery[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '&':
+			if depth <= 0 {
+				parts = append(parts, rawQuery[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, rawQuery[start:])
+}
+
+// queryParam 判断是否为 name=value 形式的参数,条件表达式的字段总有对象前缀
+func queryParam(part string) (string, string, bool) {
+	name, value, ok := strings.Cut(part, "=")
+	if !ok || strings.ContainsAny(name, ".()<>! ") {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+func (q *Query) setParam(name, value string) error {
+	switch name {
+	case QueryParam_RecordStartNo, QueryParam_PageRecordNum:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || (n == 0 && name == QueryParam_RecordStartNo) {
+			return fmt.Errorf("%w:%s=%s", ErrInvalidQuery, name, value)
+		}
+		if name == QueryParam_RecordStartNo {
+			q.RecordStartNo = n
+		} else {
+			q.PageRecordNum = n
+		}
+	case QueryParam_Sort:
+		for _, item := range splitList(value) {
+			path, order, _ := strings.Cut(item, " ")
+			sort := QuerySort{}
+			switch strings.ToUpper(strings.TrimSpace(order)) {
+			case "", "ASC":
+			case "DESC":
+				sort.Desc = true
+			default:
+				return fmt.Errorf("%w:sort order %s", ErrInvalidQuery, order)
+			}
+			object, field, ok := strings.Cut(path, ".")
+			if !ok || object != q.Object {
+				return fmt.Errorf("%w:sort field %s", ErrInvalidQuery, path)
+			}
+			if _, err := lookupField(object, field); err != nil {
+				return err
+			}
+			sort.Field = field
+			q.Sort = append(q.Sort, sort)
+		}
+	default:
+		return fmt.Errorf("%w:unknown parameter %s", ErrInvalidQuery, name)
+	}
+	return nil
+}
+
+// queryParser 条件表达式的递归下降解析
+//
+//	expr   = term { OR term }
+//	term   = factor { AND factor }
+//	factor = "(" expr ")" | condition
+type queryParser struct {
+	object string
+	s      string
+	pos    int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w:%s at %d of %q", ErrInvalidQuery, fmt.Sprintf(format, args...), p.pos, p.s)
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// keyword 匹配不区分大小写的关键字
+func (p *queryParser) keyword(word string) bool {
+	p.skipSpace()
+	if len(p.s)-p.pos >= len(word) && strings.EqualFold(p.s[p.pos:p.pos+len(word)], word) {
+		p.pos += len(word)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parse() (QueryExpr, error) {
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return expr, nil
+}
+
+func (p *queryParser) expr() (QueryExpr, error) {
+	return p.group(QueryLogic_Or, p.term)
+}
+
+func (p *queryParser) term() (QueryExpr, error) {
+	return p.group(QueryLogic_And, p.factor)
+}
+
+func (p *queryParser) group(logic string, next func() (QueryExpr, error)) (QueryExpr, error) {
+	expr, err := next()
+	if err != nil {
+		return nil, err
+	}
+	group := &QueryGroup{Logic: logic, Exprs: []QueryExpr{expr}}
+	for p.keyword(logic) {
+		if expr, err = next(); err != nil {
+			return nil, err
+		}
+		group.Exprs = append(group.Exprs, expr)
+	}
+	if len(group.Exprs) == 1 {
+		return group.Exprs[0], nil
+	}
+	return group, nil
+}
+
+func (p *queryParser) factor() (QueryExpr, error) {
+	if p.keyword("(") {
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("missing )")
+		}
+		return expr, nil
+	}
+	return p.condition()
+}
+
+func (p *queryParser) condition() (QueryExpr, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && (isQueryIdent(p.s[p.pos]) || p.s[p.pos] == '.') {
+		p.pos++
+	}
+	object, field, ok := strings.Cut(p.s[start:p.pos], ".")
+	if !ok || object == "" || field == "" {
+		return nil, p.errorf("expect Object.Field")
+	}
+	if object != p.object {
+		return nil, p.errorf("field %s.%s not of %s", object, field, p.object)
+	}
+	t, err := lookupField(object, field)
+	if err != nil {
+		return nil, err
+	}
+
+	cond := &QueryCondition{Object: object, Field: field}
+	switch {
+	case p.keyword(">="):
+		cond.Op = QueryOp_Ge
+	case p.keyword("<="):
+		cond.Op = QueryOp_Le
+	case p.keyword("<>"), p.keyword("!="):
+		cond.Op = QueryOp_Ne
+	case p.keyword("="):
+		cond.Op = QueryOp_Eq
+	case p.keyword(">"):
+		cond.Op = QueryOp_Gt
+	case p.keyword("<"):
+		cond.Op = QueryOp_Lt
+	case p.keyword("LIKE "):
+		cond.Op = QueryOp_Like
+	default:
+		return nil, p.errorf("expect operator")
+	}
+
+	p.skipSpace()
+	start = p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ')' {
+		p.pos++
+	}
+	cond.raw = strings.TrimSpace(p.s[start:p.pos])
+	if cond.Value, err = queryValue(t, cond.Op, cond.raw); err != nil {
+		return nil, fmt.Errorf("%w:%s.%s %s", ErrInvalidQuery, object, field, err.Error())
+	}
+	return cond, nil
+}
+
+func isQueryIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// queryValue 按字段类型转换条件值
+func queryValue(t reflect.Type, op QueryOp, raw string) (any, error) {
+	if op == QueryOp_Like && t.Kind() != reflect.String {
+		return nil, errors.New("LIKE needs string field")
+	}
+	if t == viidTimeType {
+		tt, err := time.ParseInLocation("20060102150405", raw, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", raw)
+		}
+		return VIIDTime(tt), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// SQLOptions SQL 渲染选项
+type SQLOptions struct {
+	Column      func(field string) string // 字段对应的列名,默认为字段名
+	Placeholder func(index int) string    // 第index个参数的占位符,从1开始,默认为 ?
+}
+
+type sqlBuilder struct {
+	opts *SQLOptions
+	b    strings.Builder
+	args []any
+}
+
+func (b *sqlBuilder) column(field string) string {
+	if b.opts != nil && b.opts.Column != nil {
+		return b.opts.Column(field)
+	}
+	return field
+}
+
+func (b *sqlBuilder) placeholder() string {
+	if b.opts != nil && b.opts.Placeholder != nil {
+		return b.opts.Placeholder(len(b.args))
+	}
+	return "?"
+}
+
+func (cond *QueryCondition) sql(b *sqlBuilder) {
+	b.args = append(b.args, cond.Value)
+	op := string(cond.Op)
+	if cond.Op == QueryOp_Like {
+		op = " LIKE "
+	}
+	b.b.WriteString(b.column(cond.Field) + op + b.placeholder())
+}
+
+func (group *QueryGroup) sql(b *sqlBuilder) {
+	b.b.WriteByte('(')
+	for i, expr := range group.Exprs {
+		if i > 0 {
+			b.b.WriteString(" " + group.Logic + " ")
+		}
+		expr.sql(b)
+	}
+	b.b.WriteByte(')')
+}
+
+// WhereSQL 渲染为参数化的 WHERE 条件(不含 WHERE 关键字),无条件时返回空串,
+// 字段名已按模型校验,列名映射由 opts.Column 负责
+func (q *Query) WhereSQL(opts *SQLOptions) (string, []any) {
+	if q.Where == nil {
+		return "", nil
+	}
+	b := &sqlBuilder{opts: opts}
+	q.Where.sql(b)
+	return b.b.String(), b.args
+}
+
+// OrderBySQL 渲染排序(不含 ORDER BY 关键字),无排序时返回空串
+func (q *Query) OrderBySQL(opts *SQLOptions) string {
+	b := &sqlBuilder{opts: opts}
+	sorts := make([]string, len(q.Sort))
+	for i, sort := range q.Sort {
+		sorts[i] = b.column(sort.Field)
+		if sort.Desc {
+			sorts[i] += " DESC"
+		}
+	}
+	return strings.Join(sorts, ",")
+}
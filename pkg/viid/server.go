@@ -0,0 +1,621 @@
+package viid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// 视频图像信息对象批量接口 GA/T 1400.4 5.3
+const (
+	VIIDURL_Faces            = "/VIID/Faces"
+	VIIDURL_Persons          = "/VIID/Persons"
+	VIIDURL_MotorVehicles    = "/VIID/MotorVehicles"
+	VIIDURL_NonMotorVehicles = "/VIID/NonMotorVehicles"
+	VIIDURL_Images           = "/VIID/Images"
+	VIIDURL_VideoSlices      = "/VIID/VideoSlices"
+	VIIDURL_Files            = "/VIID/Files"
+)
+
+const (
+	viidNonceTimeout = 5 * time.Minute // 注册质询 nonce 的有效期
+	viidMaxNonces    = 1024            // 未使用的 nonce 上限,超过时淘汰最早的
+	viidMaxBodySize  = 64 << 20        // 默认的请求消息体上限,图像以base64携带在消息体中
+)
+
+var ErrKeepaliveTimeout = errors.New("viid: keepalive timeout")
+
+// DeviceSession 已注册设备
+type DeviceSession struct {
+	DeviceID      string
+	Username      string // 注册使用的Digest用户名
+	RemoteAddr    string // 注册请求的地址,之后的请求须来自同一主机
+	RegisterTime  time.Time
+	KeepaliveTime time.Time // 最近一次保活或请求的时间
+}
+
+// DeviceEvent 设备上下线事件,Err为离线原因,主动注销时为nil
+type DeviceEvent struct {
+	Device DeviceSession
+	Online bool
+	Err    error
+}
+
+// ServerConfig 视图库服务配置,上传回调为nil时不提供对应接口,
+// 回调收到的对象已通过Validate,返回error时这批对象都应答失败
+type ServerConfig struct {
+	ServerID         string                                                     // 视图库编码,校时应答的VIIDServerID
+	Realm            string                                                     // Digest认证域,默认ServerID
+	Password         func(deviceID, username string) (password string, ok bool) // 查找设备注册用户的密码,用户不能注册该设备时ok为false
+	KeepaliveTimeout time.Duration                                              // 超过时间未保活视为离线,默认90s
+	MaxBodySize      int64                                                      // 请求消息体上限 字节,默认64MB
+
+	OnDevice           func(DeviceEvent)
+	OnFaces            func(ctx context.Context, deviceID string, faces []*Face) error
+	OnPersons          func(ctx context.Context, deviceID string, persons []*Person) error
+	OnMotorVehicles    func(ctx context.Context, deviceID string, vehicles []*MotorVehicle) error
+	OnNonMotorVehicles func(ctx context.Context, deviceID string, vehicles []*NonMotorVehicle) error
+	OnImages           func(ctx context.Context, deviceID string, images []*Image) error
+	OnVideoSlices      func(ctx context.Context, deviceID string, slices []*VideoSlice) error
+	OnFiles            func(ctx context.Context, deviceID string, files []*File) error
+
+	Subscriptions            *SubscriptionManager // 不为nil时提供 /VIID/Subscribes 订阅接口
+	Notifier                 *Notifier            // 不为nil时回调成功的对象发布给匹配的订阅
+	OnSubscribeNotifications func(ctx context.Context, deviceID string, notifications []*SubscribeNotification) error
+}
+
+// Server 视图库服务,处理注册 保活 注销 校时及对象上传,实现 http.Handler
+type Server struct {
+	conf ServerConfig
+
+	mu      sync.Mutex
+	devices map[string]*DeviceSession
+	nonces  map[string]time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewServer(conf ServerConfig) (*Server, error) {
+	if utils.StringIsNullOrEmpty(conf.ServerID) || conf.Password == nil {
+		return nil, fmt.Errorf("%w:viid server need ServerID and Password", utils.ERR_INVALID_PARAMETER)
+	}
+	if conf.Realm == "" {
+		conf.Realm = conf.ServerID
+	}
+	if conf.KeepaliveTimeout <= 0 {
+		conf.KeepaliveTimeout = 90 * time.Second
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = viidMaxBodySize
+	}
+	s := &Server{
+		conf:    conf,
+		devices: make(map[string]*DeviceSession),
+		nonces:  make(map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	go s.watchdog()
+	return s, nil
+}
+
+// Close 停止保活超时检查,不会触发设备离线事件
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// Devices 在线设备列表
+func (s *Server) Devices() []DeviceSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := make([]DeviceSession, 0, len(s.devices))
+	for _, device := range s.devices {
+		devices = append(devices, *device)
+	}
+	return devices
+}
+
+// Device 查找在线设备
+func (s *Server) Device(deviceID string) (DeviceSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if device, ok := s.devices[deviceID]; ok {
+		return *device, true
+	}
+	return DeviceSession{}, false
+}
+
+func (s *Server) watchdog() {
+	ticker := time.NewTicker(s.conf.KeepaliveTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			var expired []DeviceSession
+			s.mu.Lock()
+			for id, device := range s.devices {
+				if now.Sub(device.KeepaliveTime) > s.conf.KeepaliveTimeout {
+					expired = append(expired, *device)
+					delete(s.devices, id)
+				}
+			}
+			for nonce, created := range s.nonces {
+				if now.Sub(created) > viidNonceTimeout {
+					delete(s.nonces, nonce)
+				}
+			}
+			s.mu.Unlock()
+			for _, device := range expired {
+				s.event(DeviceEvent{Device: device, Err: ErrKeepaliveTimeout})
+			}
+		}
+	}
+}
+
+func (s *Server) event(event DeviceEvent) {
+	if s.conf.OnDevice != nil {
+		s.conf.OnDevice(event)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimRight(r.URL.Path, "/")
+	method := http.MethodPost
+	if path == VIIDURL_Time {
+		method = http.MethodGet
+	}
+	if path == VIIDURL_Subscribes || strings.HasPrefix(path, VIIDURL_Subscribes+"/") {
+		if s.conf.Subscriptions == nil {
+			http.NotFound(w, r)
+			return
+		}
+		deviceID, ok := s.touch(r)
+		if !ok {
+			s.challenge(w)
+			return
+		}
+		s.serveSubscribes(w, r, deviceID, path)
+		return
+	}
+
+	var upload uploadFunc
+	switch path {
+	case VIIDURL_Register, VIIDURL_Keepalive, VIIDURL_UnRegister, VIIDURL_Time:
+	default:
+		if upload = s.uploader(path); upload == nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if path == VIIDURL_Register {
+		s.register(w, r)
+		return
+	}
+
+	deviceID, ok := s.touch(r)
+	if !ok {
+		s.challenge(w)
+		return
+	}
+	data, err := s.readBody(w, r)
+	if err != nil {
+		WriteResponseStatus(w, r, deviceID, err)
+		return
+	}
+	switch path {
+	case VIIDURL_Keepalive:
+		var body KeepaliveBody
+		WriteResponseStatus(w, r, deviceID, decodeBody(data, &body))
+	case VIIDURL_UnRegister:
+		var body UnRegisterBody
+		err := decodeBody(data, &body)
+		if err == nil {
+			s.unregister(deviceID)
+		}
+		WriteResponseStatus(w, r, deviceID, err)
+	case VIIDURL_Time:
+		now := VIIDTime(time.Now())
+		writeJSON(w, &SystemTimeBody{SystemTimeObject: &SystemTime{VIIDServerID: s.conf.ServerID, TimeMode: TimeMode_Network, LocalTime: &now}})
+	default:
+		statuses, err := upload(r.Context(), deviceID, data)
+		if err != nil {
+			WriteResponseStatus(w, r, "", err)
+			return
+		}
+		WriteResponseStatusList(w, statuses)
+	}
+}
+
+// touch 以 User-Identify 查找在线设备并刷新保活时间,请求须来自注册时的主机
+func (s *Server) touch(r *http.Request) (string, bool) {
+	deviceID := r.Header.Get(Header_UserIdentify)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	device, ok := s.devices[deviceID]
+	if !ok || remoteHost(device.RemoteAddr) != remoteHost(r.RemoteAddr) {
+		return deviceID, false
+	}
+	device.KeepaliveTime = time.Now()
+	return deviceID, true
+}
+
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func (s *Server) unregister(deviceID string) {
+	s.mu.Lock()
+	device, ok := s.devices[deviceID]
+	delete(s.devices, deviceID)
+	s.mu.Unlock()
+	if ok {
+		s.event(DeviceEvent{Device: *device})
+	}
+}
+
+// challenge 应答401质询,未注册设备的请求同样质询以便客户端重新注册
+func (s *Server) challenge(w http.ResponseWriter) {
+	nonce := utils.RandomString(24)
+	s.mu.Lock()
+	if len(s.nonces) >= viidMaxNonces {
+		oldest, oldestTime := "", time.Time{}
+		for n, created := range s.nonces {
+			if oldest == "" || created.Before(oldestTime) {
+				oldest, oldestTime = n, created
+			}
+		}
+		delete(s.nonces, oldest)
+	}
+	s.nonces[nonce] = time.Now()
+	s.mu.Unlock()
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s",qop="auth",nonce="%s",algorithm=MD5`, s.conf.Realm, nonce))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// authorize 校验注册设备 deviceID 的 Digest 认证,通过后 nonce 作废,
+// 返回认证的用户名
+func (s *Server) authorize(r *http.Request, deviceID string) (string, bool) {
+	params, ok := digestParams(r.Header.Get("Authorization"))
+	if !ok || params["realm"] != s.conf.Realm || params["uri"] != r.URL.RequestURI() {
+		return "", false
+	}
+	if qop := params["qop"]; qop != "auth" || params["nc"] == "" || params["cnonce"] == "" {
+		return "", false
+	}
+	username := params["username"]
+	password, ok := s.conf.Password(deviceID, username)
+	if !ok {
+		return "", false
+	}
+	nonce := params["nonce"]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created, ok := s.nonces[nonce]
+	if !ok || time.Since(created) > viidNonceTimeout {
+		return "", false
+	}
+	response := digestResponse(username, s.conf.Realm, password, r.Method, params["uri"], nonce, params["nc"], params["cnonce"], params["qop"])
+	if params["response"] != response {
+		return "", false
+	}
+	delete(s.nonces, nonce)
+	return username, true
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var body RegisterBody
+	data, err := s.readBody(w, r)
+	if err == nil {
+		err = decodeBody(data, &body)
+	}
+	if err == nil && (body.RegisterObject == nil || body.RegisterObject.DeviceID == "") {
+		err = missingObject("RegisterObject.DeviceID")
+	}
+	if err != nil {
+		WriteResponseStatus(w, r, "", err)
+		return
+	}
+	// 认证的用户须能注册消息体中的设备
+	username, ok := s.authorize(r, body.RegisterObject.DeviceID)
+	if !ok {
+		s.challenge(w)
+		return
+	}
+
+	now := time.Now()
+	device := &DeviceSession{DeviceID: body.RegisterObject.DeviceID, Username: username, RemoteAddr: r.RemoteAddr, RegisterTime: now, KeepaliveTime: now}
+	s.mu.Lock()
+	_, online := s.devices[device.DeviceID]
+	s.devices[device.DeviceID] = device
+	s.mu.Unlock()
+	if !online {
+		s.event(DeviceEvent{Device: *device, Online: true})
+	}
+	WriteResponseStatus(w, r, device.DeviceID, nil)
+}
+
+// readBody 读取不超过 MaxBodySize 的消息体,超过上限时返回 StatusCode_InvalidOperation
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.conf.MaxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, &ResponseStatus{StatusCode: StatusCode_InvalidOperation, StatusString: fmt.Sprintf("body exceeds %d bytes", tooLarge.Limit)}
+		}
+		return nil, &ResponseStatus{StatusCode: StatusCode_OtherError, StatusString: err.Error()}
+	}
+	return data, nil
+}
+
+// decodeBody 解析消息体,格式错误时返回 StatusCode_InvalidJSONFormat
+func decodeBody(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &ResponseStatus{StatusCode: StatusCode_InvalidJSONFormat, StatusString: err.Error()}
+	}
+	return nil
+}
+
+func missingObject(name string) error {
+	return &ResponseStatus{StatusCode: StatusCode_InvalidJSONContent, StatusString: "missing " + name}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ContentType_VIID)
+	json.NewEncoder(w).Encode(v)
+}
+
+// uploadBatch 批量上传的应答,校验失败的对象单独应答,其余对象以回调结果应答
+type uploadBatch struct {
+	url      string
+	statuses []*ResponseStatus
+	pending  []int
+}
+
+func newUploadBatch(url string) *uploadBatch {
+	return &uploadBatch{url: url, statuses: []*ResponseStatus{}}
+}
+
+func (batch *uploadBatch) add(id string, err error) bool {
+	batch.statuses = append(batch.statuses, NewResponseStatus(batch.url, id, err))
+	if err != nil {
+		return false
+	}
+	batch.pending = append(batch.pending, len(batch.statuses)-1)
+	return true
+}
+
+func (batch *uploadBatch) done(err error) []*ResponseStatus {
+	if err != nil {
+		for _, i := range batch.pending {
+			batch.statuses[i] = NewResponseStatus(batch.url, batch.statuses[i].ID, err)
+		}
+	}
+	return batch.statuses
+}
+
+// uploadFunc 处理一类对象的批量上传消息体
+type uploadFunc func(ctx context.Context, deviceID string, data []byte) ([]*ResponseStatus, error)
+
+// uploader 返回 path 的批量上传处理,未知接口或未配置回调时为nil
+func (s *Server) uploader(path string) uploadFunc {
+	switch path {
+	case VIIDURL_Faces:
+		return newUploader(s, path, "FaceListObject",
+			func(body *FaceListBody) ([]*Face, bool) {
+				if body.FaceListObject == nil {
+					return nil, false
+				}
+				return body.FaceListObject.FaceObject, true
+			},
+			func(face *Face) string { return face.FaceID },
+			s.conf.OnFaces, (*Notifier).PublishFaces)
+	case VIIDURL_Persons:
+		return newUploader(s, path, "PersonListObject",
+			func(body *PersonListBody) ([]*Person, bool) {
+				if body.PersonListObject == nil {
+					return nil, false
+				}
+				return body.PersonListObject.PersonObject, true
+			},
+			func(person *Person) string { return person.PersonID },
+			s.conf.OnPersons, (*Notifier).PublishPersons)
+	case VIIDURL_MotorVehicles:
+		return newUploader(s, path, "MotorVehicleListObject",
+			func(body *MotorVehicleListBody) ([]*MotorVehicle, bool) {
+				if body.MotorVehicleListObject == nil {
+					return nil, false
+				}
+				return body.MotorVehicleListObject.MotorVehicleObject, true
+			},
+			func(vehicle *MotorVehicle) string { return vehicle.MotorVehicleID },
+			s.conf.OnMotorVehicles, (*Notifier).PublishMotorVehicles)
+	case VIIDURL_NonMotorVehicles:
+		return newUploader(s, path, "NonMotorVehicleListObject",
+			func(body *NonMotorVehicleListBody) ([]*NonMotorVehicle, bool) {
+				if body.NonMotorVehicleListObject == nil {
+					return nil, false
+				}
+				return body.NonMotorVehicleListObject.NonMotorVehicleObject, true
+			},
+			func(vehicle *NonMotorVehicle) string { return vehicle.NonMotorVehicleID },
+			s.conf.OnNonMotorVehicles, (*Notifier).PublishNonMotorVehicles)
+	case VIIDURL_Images:
+		return newUploader(s, path, "ImageListObject",
+			func(body *ImageListBody) ([]*Image, bool) {
+				if body.ImageListObject == nil {
+					return nil, false
+				}
+				return body.ImageListObject.Image, true
+			},
+			func(image *Image) string {
+				if image.ImageInfo == nil {
+					return ""
+				}
+				return image.ImageInfo.ImageID
+			},
+			s.conf.OnImages, (*Notifier).PublishImages)
+	case VIIDURL_VideoSlices:
+		return newUploader(s, path, "VideoSliceListObject",
+			func(body *VideoSliceListBody) ([]*VideoSlice, bool) {
+				if body.VideoSliceListObject == nil {
+					return nil, false
+				}
+				return body.VideoSliceListObject.VideoSlice, true
+			},
+			func(slice *VideoSlice) string {
+				if slice.VideoSliceInfo == nil {
+					return ""
+				}
+				return slice.VideoSliceInfo.VideoID
+			},
+			s.conf.OnVideoSlices, (*Notifier).PublishVideoSlices)
+	case VIIDURL_Files:
+		return newUploader(s, path, "FileListObject",
+			func(body *FileListBody) ([]*File, bool) {
+				if body.FileListObject == nil {
+					return nil, false
+				}
+				return body.FileListObject.File, true
+			},
+			func(file *File) string {
+				if file.FileInfo == nil {
+					return ""
+				}
+				return file.FileInfo.FileID
+			},
+			s.conf.OnFiles, (*Notifier).PublishFiles)
+	case VIIDURL_SubscribeNotifications:
+		// 收到的通知来自上级的订阅,不再向下发布
+		return newUploader(s, path, "SubscribeNotificationListObject",
+			func(body *SubscribeNotificationListBody) ([]*SubscribeNotification, bool) {
+				if body.SubscribeNotificationListObject == nil {
+					return nil, false
+				}
+				return body.SubscribeNotificationListObject.SubscribeNotificationObject, true
+			},
+			func(notification *SubscribeNotification) string { return notification.NotificationID },
+			s.conf.OnSubscribeNotifications, nil)
+	}
+	return nil
+}
+
+// newUploader 创建消息体为 B 的批量上传处理:list 取出对象列表,name 为列表缺失时应答的对象名,
+// 校验通过的对象交给 callback,成功后由 publish 发布给配置的 Notifier.callback 为nil时返回nil
+func newUploader[B any, E any, P interface {
+	*E
+	Validate() error
+}](s *Server, url, name string, list func(*B) ([]P, bool), id func(P) string,
+	callback func(ctx context.Context, deviceID string, objects []P) error,
+	publish func(n *Notifier, deviceID string, objects []P)) uploadFunc {
+	if callback == nil {
+		return nil
+	}
+	return func(ctx context.Context, deviceID string, data []byte) ([]*ResponseStatus, error) {
+		var body B
+		if err := decodeBody(data, &body); err != nil {
+			return nil, err
+		}
+		objects, ok := list(&body)
+		if !ok {
+			return nil, missingObject(name)
+		}
+		batch := newUploadBatch(url)
+		var accepted []P
+		for _, object := range objects {
+			if object != nil && batch.add(id(object), object.Validate()) {
+				accepted = append(accepted, object)
+			}
+		}
+		if len(accepted) == 0 {
+			return batch.done(nil), nil
+		}
+		err := callback(ctx, deviceID, accepted)
+		if err == nil && publish != nil && s.conf.Notifier != nil {
+			publish(s.conf.Notifier, deviceID, accepted)
+		}
+		return batch.done(err), nil
+	}
+}
+
+// serveSubscribes 订阅接口:GET查询 POST批量订阅 PUT批量修改,
+// PUT /VIID/Subscribes/<ID> 修改或取消单个订阅,DELETE ?IDList= 批量取消.
+// 订阅属于创建它的设备,其他设备的订阅按不存在应答
+func (s *Server) serveSubscribes(w http.ResponseWriter, r *http.Request, deviceID, path string) {
+	id := strings.TrimPrefix(strings.TrimPrefix(path, VIIDURL_Subscribes), "/")
+	if id != "" && r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, &SubscribeListBody{SubscribeListObject: &SubscribeListObject{SubscribeObject: s.conf.Subscriptions.List(deviceID)}})
+	case http.MethodPost, http.MethodPut:
+		data, err := s.readBody(w, r)
+		if err != nil {
+			WriteResponseStatus(w, r, id, err)
+			return
+		}
+		if id != "" {
+			var body SubscribeBody
+			if err = decodeBody(data, &body); err == nil && body.SubscribeObject == nil {
+				err = missingObject("SubscribeObject")
+			}
+			if err == nil {
+				body.SubscribeObject.SubscribeID = id
+				err = s.conf.Subscriptions.Update(deviceID, body.SubscribeObject)
+			}
+			WriteResponseStatus(w, r, id, err)
+			return
+		}
+		var body SubscribeListBody
+		if err = decodeBody(data, &body); err == nil && body.SubscribeListObject == nil {
+			err = missingObject("SubscribeListObject")
+		}
+		if err != nil {
+			WriteResponseStatus(w, r, "", err)
+			return
+		}
+		var statuses []*ResponseStatus
+		for _, sub := range body.SubscribeListObject.SubscribeObject {
+			if sub == nil {
+				continue
+			}
+			if r.Method == http.MethodPost {
+				err = s.conf.Subscriptions.Create(deviceID, sub)
+			} else {
+				err = s.conf.Subscriptions.Update(deviceID, sub)
+			}
+			statuses = append(statuses, NewResponseStatus(path, sub.SubscribeID, err))
+		}
+		WriteResponseStatusList(w, statuses)
+	case http.MethodDelete:
+		var statuses []*ResponseStatus
+		for _, id := range splitList(r.URL.Query().Get("IDList")) {
+			statuses = append(statuses, NewResponseStatus(path, id, s.conf.Subscriptions.Cancel(deviceID, id, "", "", "")))
+		}
+		WriteResponseStatusList(w, statuses)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
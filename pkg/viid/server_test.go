@@ -0,0 +1,238 @@
+package viid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testServerID = "11000000005030000001"
+	testDeviceID = "11000000001190000001"
+	testPassword = "viid-password"
+)
+
+// newTestServer 以 conf 创建视图库服务,设备只能以自己的编码作为用户名注册,
+// wrap 不为nil时包装服务的 handler
+func newTestServer(t *testing.T, conf ServerConfig, wrap func(http.Handler) http.Handler) (*Server, *httptest.Server) {
+	t.Helper()
+	conf.ServerID = testServerID
+	if conf.Password == nil {
+		conf.Password = func(deviceID, username string) (string, bool) {
+			return testPassword, username == deviceID
+		}
+	}
+	server, err := NewServer(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handler http.Handler = server
+	if wrap != nil {
+		handler = wrap(server)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+	})
+	return server, ts
+}
+
+func newTestClient(t *testing.T, url string, conf ClientConfig) *Client {
+	t.Helper()
+	conf.ServerURL = url
+	if conf.DeviceID == "" {
+		conf.DeviceID = testDeviceID
+	}
+	if conf.Password == "" {
+		conf.Password = testPassword
+	}
+	client, err := NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestServerRegisterOwner(t *testing.T) {
+	server, ts := newTestServer(t, ServerConfig{}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 用户名与设备编码不一致,不能注册该设备
+	other := newTestClient(t, ts.URL, ClientConfig{Username: "11000000001190000002"})
+	if err := other.Register(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("register with other user: %v", err)
+	}
+	if _, ok := server.Device(testDeviceID); ok {
+		t.Fatal("device registered by other user")
+	}
+
+	wrong := newTestClient(t, ts.URL, ClientConfig{Password: "wrong"})
+	if err := wrong.Register(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("register with wrong password: %v", err)
+	}
+
+	client := newTestClient(t, ts.URL, ClientConfig{})
+	if err := client.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+	device, ok := server.Device(testDeviceID)
+	if !ok || device.Username != testDeviceID || !strings.HasPrefix(device.RemoteAddr, "127.0.0.1:") {
+		t.Fatalf("device %+v %v", device, ok)
+	}
+}
+
+func TestServerSessionBinding(t *testing.T) {
+	server, ts := newTestServer(t, ServerConfig{}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := newTestClient(t, ts.URL, ClientConfig{})
+	if err := client.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	keepalive := func(remoteAddr, deviceID string) int {
+		r := httptest.NewRequest(http.MethodPost, VIIDURL_Keepalive,
+			strings.NewReader(`{"KeepaliveObject":{"DeviceID":"`+deviceID+`"}}`))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set(Header_UserIdentify, deviceID)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+	// 同一主机的其他连接
+	if code := keepalive("127.0.0.1:1", testDeviceID); code != http.StatusOK {
+		t.Fatalf("keepalive from the registered host: %d", code)
+	}
+	// 冒用 User-Identify
+	if code := keepalive("192.0.2.1:1234", testDeviceID); code != http.StatusUnauthorized {
+		t.Fatalf("keepalive from another host: %d", code)
+	}
+	if code := keepalive("127.0.0.1:1", "11000000001190000002"); code != http.StatusUnauthorized {
+		t.Fatalf("keepalive of an unregistered device: %d", code)
+	}
+	if err := client.Keepalive(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerNonceLimit(t *testing.T) {
+	server, _ := newTestServer(t, ServerConfig{}, nil)
+	for i := 0; i < viidMaxNonces*2; i++ {
+		r := httptest.NewRequest(http.MethodPost, VIIDURL_Keepalive, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status %d", w.Code)
+		}
+	}
+	server.mu.Lock()
+	n := len(server.nonces)
+	server.mu.Unlock()
+	if n > viidMaxNonces {
+		t.Fatalf("%d nonces", n)
+	}
+}
+
+func TestServerBodyLimit(t *testing.T) {
+	server, ts := newTestServer(t, ServerConfig{MaxBodySize: 128}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := newTestClient(t, ts.URL, ClientConfig{})
+	if err := client.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path string, body string) *ResponseStatus {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.RemoteAddr = "127.0.0.1:1"
+		r.Header.Set(Header_UserIdentify, testDeviceID)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		var status ResponseStatusBody
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.ResponseStatusObject == nil {
+			t.Fatalf("%s:%d %q", path, w.Code, w.Body.String())
+		}
+		return status.ResponseStatusObject
+	}
+	large := `{"KeepaliveObject":{"DeviceID":"` + strings.Repeat("1", 128) + `"}}`
+	// 注册在认证之前读取消息体,同样受上限约束
+	for _, path := range []string{VIIDURL_Register, VIIDURL_Keepalive} {
+		if status := post(path, large); status.StatusCode != StatusCode_InvalidOperation || status.StatusString != "body exceeds 128 bytes" {
+			t.Fatalf("%s:%+v", path, status)
+		}
+	}
+	if status := post(VIIDURL_Keepalive, `{"KeepaliveObject":{"DeviceID":"`+testDeviceID+`"}}`); status.StatusCode != StatusCode_OK {
+		t.Fatalf("keepalive:%+v", status)
+	}
+}
+
+func TestServerUploadPublish(t *testing.T) {
+	receiver, notifications, _ := testReceiver(t, 0)
+	subscriptions := NewSubscriptionManager(testServerID)
+	if err := subscriptions.Create("", testSubscribe(strings.Repeat("5", MaxLength_BusinessObjectID), SubscribeDetail_Face, receiver.URL)); err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewNotifier(NotifierConfig{ServerID: testServerID, Subscriptions: subscriptions, BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+	var uploaded []*Image
+	_, ts := newTestServer(t, ServerConfig{
+		Notifier: notifier,
+		OnImages: func(ctx context.Context, deviceID string, images []*Image) error {
+			uploaded = images
+			return nil
+		},
+	}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := newTestClient(t, ts.URL, ClientConfig{})
+	if err := client.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 未配置回调的接口不提供
+	if err := client.Do(ctx, http.MethodPost, VIIDURL_Faces, &FaceListBody{FaceListObject: &FaceListObject{}}, nil); err == nil {
+		t.Fatal("faces uploaded without OnFaces")
+	}
+
+	face := testFace()
+	image := &Image{
+		ImageInfo: &ImageInfo{
+			ImageID:       strings.Repeat("6", MaxLength_BasicObjectID),
+			InfoKind:      InfoType_Auto,
+			ImageSource:   "1",
+			DeviceID:      testDeviceID,
+			FileFormat:    "Jpeg",
+			Title:         "image",
+			SecurityLevel: SecretLevelType_Public,
+			Width:         640,
+			Height:        480,
+		},
+		FaceList: &FaceListObject{FaceObject: []*Face{face}},
+	}
+	var statuses ResponseStatusListBody
+	if err := client.Do(ctx, http.MethodPost, VIIDURL_Images, &ImageListBody{ImageListObject: &ImageListObject{Image: []*Image{image, {}}}}, &statuses); err != nil {
+		t.Fatal(err)
+	}
+	list := statuses.ResponseStatusListObject.ResponseStatusObject
+	if len(list) != 2 || list[0].ID != image.ImageInfo.ImageID || list[0].StatusCode != StatusCode_OK ||
+		list[1].StatusCode != StatusCode_InvalidJSONContent || len(uploaded) != 1 {
+		t.Fatalf("statuses %+v uploaded %d", list, len(uploaded))
+	}
+	select {
+	case notification := <-notifications:
+		if notification.InfoIDs != face.FaceID || notification.FaceObjectList == nil || len(notification.FaceObjectList.FaceObject) != 1 {
+			t.Fatalf("notification %+v", notification)
+		}
+	case <-ctx.Done():
+		t.Fatal("faces of the image not published")
+	}
+}
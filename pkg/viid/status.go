@@ -0,0 +1,177 @@
+package viid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+// StatusCode 应答状态码,兼容字符串和数字两种编码
+type StatusCode int
+
+// 应答状态码 GA/T 1400.4 附录
+const (
+	StatusCode_OK                 StatusCode = 0 // 正常
+	StatusCode_OtherError         StatusCode = 1 // 其他未知错误
+	StatusCode_DeviceBusy         StatusCode = 2 // 设备忙
+	StatusCode_DeviceError        StatusCode = 3 // 设备错
+	StatusCode_InvalidOperation   StatusCode = 4 // 无效操作
+	StatusCode_InvalidXMLFormat   StatusCode = 5 // XML格式错误
+	StatusCode_InvalidXMLContent  StatusCode = 6 // XML内容错误
+	StatusCode_InvalidJSONFormat  StatusCode = 7 // JSON格式错误
+	StatusCode_InvalidJSONContent StatusCode = 8 // JSON内容错误
+	StatusCode_Reboot             StatusCode = 9 // 系统重启中
+)
+
+var statusStrings = map[StatusCode]string{
+	StatusCode_OK:                 "OK",
+	StatusCode_OtherError:         "Other Error",
+	StatusCode_DeviceBusy:         "Device Busy",
+	StatusCode_DeviceError:        "Device Error",
+	StatusCode_InvalidOperation:   "Invalid Operation",
+	StatusCode_InvalidXMLFormat:   "Invalid XML Format",
+	StatusCode_InvalidXMLContent:  "Invalid XML Content",
+	StatusCode_InvalidJSONFormat:  "Invalid JSON Format",
+	StatusCode_InvalidJSONContent: "Invalid JSON Content",
+	StatusCode_Reboot:             "Reboot",
+}
+
+// String 标准状态描述
+func (code StatusCode) String() string {
+	if s, ok := statusStrings[code]; ok {
+		return s
+	}
+	return fmt.Sprintf("StatusCode(%d)", int(code))
+}
+
+// UtilsError 状态码对应的 utils.Error,正常时为nil:
+// 格式和内容错误对应 ERR_INVALID_PARAMETER,无效操作对应 ERR_UNIMPLEMENTATION,其余为 ERR_UNKNOWN
+func (code StatusCode) UtilsError() *utils.Error {
+	switch code {
+	case StatusCode_OK:
+		return nil
+	case StatusCode_InvalidXMLFormat, StatusCode_InvalidXMLContent,
+		StatusCode_InvalidJSONFormat, StatusCode_InvalidJSONContent:
+		return utils.ERR_INVALID_PARAMETER
+	case StatusCode_InvalidOperation:
+		return utils.ERR_UNIMPLEMENTATION
+	}
+	return utils.ERR_UNKNOWN
+}
+
+// StatusCodeOf 错误对应的状态码,nil为正常,*ResponseStatus 保留原状态码,
+// utils.Error 按错误码映射,其余为 StatusCode_OtherError
+func StatusCodeOf(err error) StatusCode {
+	if err == nil {
+		return StatusCode_OK
+	}
+	var status *ResponseStatus
+	if errors.As(err, &status) {
+		return status.StatusCode
+	}
+	var utilsErr *utils.Error
+	if errors.As(err, &utilsErr) {
+		switch utilsErr.Code {
+		case utils.ERR_INVALID_PARAMETER.Code:
+			return StatusCode_InvalidJSONContent
+		case utils.ERR_UNIMPLEMENTATION.Code:
+			return StatusCode_InvalidOperation
+		}
+	}
+	return StatusCode_OtherError
+}
+
+func (code *StatusCode) UnmarshalJSON(data []byte) error {
+	var v json.Number
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(v.String())
+	if err != nil {
+		return fmt.Errorf("viid: invalid status code %s", data)
+	}
+	*code = StatusCode(n)
+	return nil
+}
+
+// ResponseStatus 应答状态 GA/T 1400.4 ResponseStatusObject,状态码非正常时
+// 作为 error 返回,errors.Is 可按状态码对应的 utils.Error 判断
+type ResponseStatus struct {
+	ID           string     `json:"Id,omitempty"`        // 对象标识
+	RequestURL   string     `json:"RequestURL"`          // 请求的资源地址
+	StatusCode   StatusCode `json:"StatusCode"`          // 状态码
+	StatusString string     `json:"StatusString"`        // 状态描述
+	LocalTime    *VIIDTime  `json:"LocalTime,omitempty"` // 应答时间
+}
+
+func (status *ResponseStatus) Error() string {
+	return fmt.Sprintf("viid: %s status %d %s", status.RequestURL, status.StatusCode, status.StatusString)
+}
+
+func (status *ResponseStatus) Unwrap() error {
+	// 避免返回带类型的nil
+	if err := status.StatusCode.UtilsError(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResponseStatusBody 单个应答消息体 {"ResponseStatusObject":{...}}
+type ResponseStatusBody struct {
+	ResponseStatusObject *ResponseStatus `json:"ResponseStatusObject"`
+}
+
+// ResponseStatusList 批量应答状态列表
+type ResponseStatusList struct {
+	ResponseStatusObject []*ResponseStatus `json:"ResponseStatusObject"`
+}
+
+// Err 非正常的应答状态,全部正常时为nil
+func (list *ResponseStatusList) Err() error {
+	var errs []error
+	for _, status := range list.ResponseStatusObject {
+		if status != nil && status.StatusCode != StatusCode_OK {
+			errs = append(errs, status)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ResponseStatusListBody 批量应答消息体 {"ResponseStatusListObject":{"ResponseStatusObject":[...]}}
+type ResponseStatusListBody struct {
+	ResponseStatusListObject *ResponseStatusList `json:"ResponseStatusListObject"`
+}
+
+// NewResponseStatus 由处理结果生成应答状态,err为nil时为正常,状态码由 StatusCodeOf 映射
+func NewResponseStatus(url, id string, err error) *ResponseStatus {
+	now := VIIDTime(time.Now())
+	status := &ResponseStatus{ID: id, RequestURL: url, StatusCode: StatusCodeOf(err), LocalTime: &now}
+	var respErr *ResponseStatus
+	switch {
+	case err == nil:
+		status.StatusString = status.StatusCode.String()
+	case errors.As(err, &respErr):
+		status.StatusString = respErr.StatusString
+	default:
+		status.StatusString = err.Error()
+	}
+	return status
+}
+
+// WriteResponseStatus 以处理结果应答单个 ResponseStatusObject
+func WriteResponseStatus(w http.ResponseWriter, r *http.Request, id string, err error) {
+	writeJSON(w, &ResponseStatusBody{ResponseStatusObject: NewResponseStatus(r.URL.Path, id, err)})
+}
+
+// WriteResponseStatusList 应答 ResponseStatusListObject
+func WriteResponseStatusList(w http.ResponseWriter, statuses []*ResponseStatus) {
+	if statuses == nil {
+		statuses = []*ResponseStatus{}
+	}
+	writeJSON(w, &ResponseStatusListBody{ResponseStatusListObject: &ResponseStatusList{ResponseStatusObject: statuses}})
+}
@@ -0,0 +1,220 @@
+package viid
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 订阅 通知接口 GA/T 1400.4 5.10
+const (
+	VIIDURL_Subscribes             = "/VIID/Subscribes"
+	VIIDURL_SubscribeNotifications = "/VIID/SubscribeNotifications"
+)
+
+// 订阅类别(值类型string) Subscribe.SubscribeDetail,多个以逗号分隔
+const (
+	SubscribeDetail_Case            string = "1"  // 案(事)件目录
+	SubscribeDetail_CaseContent     string = "2"  // 单个案(事)件内容
+	SubscribeDetail_Device          string = "3"  // 采集设备目录
+	SubscribeDetail_DeviceStatus    string = "4"  // 采集设备状态
+	SubscribeDetail_APS             string = "5"  // 采集系统目录
+	SubscribeDetail_APSStatus       string = "6"  // 采集系统状态
+	SubscribeDetail_Tollgate        string = "7"  // 视频卡口目录
+	SubscribeDetail_TollgateRecord  string = "8"  // 单个卡口记录
+	SubscribeDetail_Lane            string = "9"  // 车道目录
+	SubscribeDetail_LaneRecord      string = "10" // 单个车道记录
+	SubscribeDetail_Person          string = "11" // 自动采集的人员信息
+	SubscribeDetail_Face            string = "12" // 自动采集的人脸信息
+	SubscribeDetail_MotorVehicle    string = "13" // 自动采集的车辆信息
+	SubscribeDetail_NonMotorVehicle string = "14" // 自动采集的非机动车辆信息
+	SubscribeDetail_Thing           string = "15" // 自动采集的物品信息
+	SubscribeDetail_File            string = "16" // 自动采集的文件信息
+)
+
+var subscribeDetails = []string{
+	SubscribeDetail_Case, SubscribeDetail_CaseContent, SubscribeDetail_Device, SubscribeDetail_DeviceStatus,
+	SubscribeDetail_APS, SubscribeDetail_APSStatus, SubscribeDetail_Tollgate, SubscribeDetail_TollgateRecord,
+	SubscribeDetail_Lane, SubscribeDetail_LaneRecord, SubscribeDetail_Person, SubscribeDetail_Face,
+	SubscribeDetail_MotorVehicle, SubscribeDetail_NonMotorVehicle, SubscribeDetail_Thing, SubscribeDetail_File,
+}
+
+// 订阅操作类型 Subscribe.OperateType
+const (
+	OperateType_Subscribe int = 0 // 订阅
+	OperateType_Cancel    int = 1 // 取消订阅
+)
+
+// 订阅执行状态 Subscribe.SubscribeStatus
+const (
+	SubscribeStatus_Subscribing int = 0 // 订阅中
+	SubscribeStatus_Canceled    int = 1 // 已取消订阅
+	SubscribeStatus_Expired     int = 2 // 订阅到期
+	SubscribeStatus_None        int = 9 // 未订阅
+)
+
+// 业务对象标识子类型 BusinessObjectIDType
+const (
+	BusinessType_Case         string = "01" // 案事件
+	BusinessType_Subscribe    string = "02" // 订阅
+	BusinessType_Notification string = "03" // 通知
+)
+
+// 不需要图片 Subscribe.ResultImageDeclare
+const ResultImageDeclare_None = "-1"
+
+const (
+	MaxLength_BusinessObjectID = 33  // BusinessObjectIDType string(33)
+	MaxLength_SubscribeTitle   = 256 // Subscribe.Title Reason CancelReason string(256)
+	MaxLength_ResourceURI      = 256 // ResourceURI ReceiveAddr string(256)
+)
+
+var businessSequence atomic.Uint32
+
+// NewBusinessObjectID 生成业务对象标识:管理单位代码(unitID前12位)+子类型+时间(14位)+流水号(5位)
+func NewBusinessObjectID(unitID, businessType string) string {
+	if len(unitID) > 12 {
+		unitID = unitID[:12]
+	}
+	seq := businessSequence.Add(1) % 100000
+	return fmt.Sprintf("%012s%s%s%05d", unitID, businessType, time.Now().Format("20060102150405"), seq)
+}
+
+// Subscribe 订阅对象 GA/T 1400.3 A.25
+type Subscribe struct {
+	SubscribeID     string    `json:"SubscribeID"`              // 订阅标识 BusinessObjectIDType string(33)
+	Title           string    `json:"Title"`                    // 订阅标题 string(256)
+	SubscribeDetail string    `json:"SubscribeDetail"`          // 订阅类别 SubscribeDetail_*,多个以逗号分隔
+	ResourceURI     string    `json:"ResourceURI"`              // 订阅资源 设备 卡口或视图库编码,多个以逗号分隔 string(256)
+	ApplicantName   string    `json:"ApplicantName"`            // 申请人 NameType string(50)
+	ApplicantOrg    string    `json:"ApplicantOrg"`             // 申请单位 OrgType string(100)
+	BeginTime       *VIIDTime `json:"BeginTime"`                // 开始时间
+	EndTime         *VIIDTime `json:"EndTime"`                  // 结束时间
+	ReceiveAddr     string    `json:"ReceiveAddr"`              // 信息接收地址 string(256)
+	ReportInterval  int       `json:"ReportInterval,omitempty"` // 信息上报间隔 秒
+	Reason          string    `json:"Reason,omitempty"`         // 理由 string(256)
+	OperateType     int       `json:"OperateType"`              // 操作类型 OperateType_*
+	SubscribeStatus int       `json:"SubscribeStatus"`          // 订阅执行状态 SubscribeStatus_*
+
+	SubscribeCancelOrg    string    `json:"SubscribeCancelOrg,omitempty"`    // 取消订阅单位 OrgType string(100)
+	SubscribeCancelPerson string    `json:"SubscribeCancelPerson,omitempty"` // 取消订阅人 NameType string(50)
+	CancelTime            *VIIDTime `json:"CancelTime,omitempty"`            // 取消时间
+	CancelReason          string    `json:"CancelReason,omitempty"`          // 取消原因 string(256)
+
+	ResultImageDeclare   string `json:"ResultImageDeclare,omitempty"`   // 图片要求 ResultImageDeclare_None不需要图片
+	ResultFeatureDeclare int    `json:"ResultFeatureDeclare,omitempty"` // 特征值要求 -1不需要
+}
+
+// Details 订阅类别列表
+func (sub *Subscribe) Details() []string {
+	return splitList(sub.SubscribeDetail)
+}
+
+// Resources 订阅资源编码列表
+func (sub *Subscribe) Resources() []string {
+	return splitList(sub.ResourceURI)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SubscribeBody 单个订阅消息体 {"SubscribeObject":{...}}
+type SubscribeBody struct {
+	SubscribeObject *Subscribe `json:"SubscribeObject"`
+}
+
+// SubscribeListObject 订阅对象列表
+type SubscribeListObject struct {
+	SubscribeObject []*Subscribe `json:"SubscribeObject"`
+}
+
+// SubscribeListBody 订阅批量接口的消息体 {"SubscribeListObject":{"SubscribeObject":[...]}}
+type SubscribeListBody struct {
+	SubscribeListObject *SubscribeListObject `json:"SubscribeListObject"`
+}
+
+// SubscribeNotification 通知对象 GA/T 1400.3 A.26,按订阅类别携带对象列表
+type SubscribeNotification struct {
+	NotificationID string    `json:"NotificationID"` // 通知标识 BusinessObjectIDType string(33)
+	SubscribeID    string    `json:"SubscribeID"`    // 订阅标识 BusinessObjectIDType string(33)
+	Title          string    `json:"Title"`          // 订阅标题 string(256)
+	TriggerTime    *VIIDTime `json:"TriggerTime"`    // 触发时间
+	InfoIDs        string    `json:"InfoIDs"`        // 信息标识,多个以逗号分隔
+
+	PersonObjectList          *PersonListObject          `json:"PersonObjectList,omitempty"`
+	FaceObjectList            *FaceListObject            `json:"FaceObjectList,omitempty"`
+	MotorVehicleObjectList    *MotorVehicleListObject    `json:"MotorVehicleObjectList,omitempty"`
+	NonMotorVehicleObjectList *NonMotorVehicleListObject `json:"NonMotorVehicleObjectList,omitempty"`
+	FileObjectList            *FileListObject            `json:"FileObjectList,omitempty"`
+}
+
+// SubscribeNotificationListObject 通知对象列表
+type SubscribeNotificationListObject struct {
+	SubscribeNotificationObject []*SubscribeNotification `json:"SubscribeNotificationObject"`
+}
+
+// SubscribeNotificationListBody 通知批量接口的消息体
+// {"SubscribeNotificationListObject":{"SubscribeNotificationObject":[...]}}
+type SubscribeNotificationListBody struct {
+	SubscribeNotificationListObject *SubscribeNotificationListObject `json:"SubscribeNotificationListObject"`
+}
+
+// Validate 校验订阅的必选字段 类别 时间范围和接收地址
+func (sub *Subscribe) Validate() error {
+	v := newValidator()
+	v.digits("SubscribeID", sub.SubscribeID, true, MaxLength_BusinessObjectID, true)
+	v.text("Title", sub.Title, true, MaxLength_SubscribeTitle)
+	details := sub.Details()
+	if len(details) == 0 {
+		v.fail("SubscribeDetail", "required")
+	}
+	for _, detail := range details {
+		v.oneOf("SubscribeDetail", detail, true, subscribeDetails...)
+	}
+	v.text("ResourceURI", sub.ResourceURI, true, MaxLength_ResourceURI)
+	v.text("ApplicantName", sub.ApplicantName, true, MaxLength_NameType)
+	v.text("ApplicantOrg", sub.ApplicantOrg, true, MaxLength_OrgType)
+	switch {
+	case sub.BeginTime == nil:
+		v.fail("BeginTime", "required")
+	case sub.EndTime == nil:
+		v.fail("EndTime", "required")
+	case !time.Time(*sub.EndTime).After(time.Time(*sub.BeginTime)):
+		v.fail("EndTime", "must be after BeginTime")
+	}
+	v.text("ReceiveAddr", sub.ReceiveAddr, true, MaxLength_ResourceURI)
+	if sub.ReceiveAddr != "" {
+		if u, err := url.Parse(sub.ReceiveAddr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.fail("ReceiveAddr", "must be http url")
+		}
+	}
+	if sub.ReportInterval < 0 {
+		v.fail("ReportInterval", "negative")
+	}
+	v.text("Reason", sub.Reason, false, MaxLength_SubscribeTitle)
+	v.intRange("OperateType", sub.OperateType, OperateType_Subscribe, OperateType_Cancel)
+	v.texts(MaxLength_NameType, "SubscribeCancelPerson", sub.SubscribeCancelPerson)
+	v.texts(MaxLength_OrgType, "SubscribeCancelOrg", sub.SubscribeCancelOrg)
+	v.text("CancelReason", sub.CancelReason, false, MaxLength_SubscribeTitle)
+	return v.result(sub.SubscribeID)
+}
+
+// Validate 校验通知标识
+func (notification *SubscribeNotification) Validate() error {
+	v := newValidator()
+	v.digits("NotificationID", notification.NotificationID, true, MaxLength_BusinessObjectID, true)
+	v.digits("SubscribeID", notification.SubscribeID, true, MaxLength_BusinessObjectID, true)
+	if notification.TriggerTime == nil {
+		v.fail("TriggerTime", "required")
+	}
+	return v.result(notification.NotificationID)
+}
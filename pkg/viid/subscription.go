@@ -0,0 +1,500 @@
+package viid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/286897655/gopkgs/pkg/utils"
+)
+
+var (
+	ErrSubscribeNotFound = errors.New("viid: subscribe not found")
+	ErrSubscribeExists   = errors.New("viid: subscribe already exists")
+	ErrSubscribeCanceled = errors.New("viid: subscribe not active")
+)
+
+// SubscriptionManager 视图库收到的订阅,按资源编码和订阅类别匹配,
+// 到期的订阅在访问时置为 SubscribeStatus_Expired.
+// owner 为创建订阅的设备编码,设备只能查询 修改和取消自己的订阅,owner 为空时表示本地管理,不受限制
+type SubscriptionManager struct {
+	serverID string
+
+	mu         sync.Mutex
+	subscribes map[string]*Subscribe
+	owners     map[string]string
+}
+
+// NewSubscriptionManager serverID 为本级视图库编码,ResourceURI 包含该编码的订阅匹配全部资源
+func NewSubscriptionManager(serverID string) *SubscriptionManager {
+	return &SubscriptionManager{serverID: serverID, subscribes: make(map[string]*Subscribe), owners: make(map[string]string)}
+}
+
+// Create 新建订阅,记录 owner 为订阅的所有者.已失效的订阅可由所有者以同一标识重新订阅
+func (m *SubscriptionManager) Create(owner string, sub *Subscribe) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	if sub.OperateType != OperateType_Subscribe {
+		return fmt.Errorf("%w:OperateType %d", utils.ERR_INVALID_PARAMETER, sub.OperateType)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.subscribes[sub.SubscribeID]; ok && (old.SubscribeStatus == SubscribeStatus_Subscribing || !m.ownedLocked(owner, sub.SubscribeID)) {
+		return fmt.Errorf("%w:%s", ErrSubscribeExists, sub.SubscribeID)
+	}
+	stored := *sub
+	stored.SubscribeStatus = SubscribeStatus_Subscribing
+	m.subscribes[sub.SubscribeID] = &stored
+	m.owners[sub.SubscribeID] = owner
+	return nil
+}
+
+// Update 修改 owner 的订阅,OperateType 为取消时等同 Cancel,只需携带取消相关字段
+func (m *SubscriptionManager) Update(owner string, sub *Subscribe) error {
+	if sub.OperateType == OperateType_Cancel {
+		return m.Cancel(owner, sub.SubscribeID, sub.SubscribeCancelOrg, sub.SubscribeCancelPerson, sub.CancelReason)
+	}
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.subscribes[sub.SubscribeID]
+	if !ok || !m.ownedLocked(owner, sub.SubscribeID) {
+		return fmt.Errorf("%w:%s", ErrSubscribeNotFound, sub.SubscribeID)
+	}
+	if m.expire(old, time.Now()) != SubscribeStatus_Subscribing {
+		return fmt.Errorf("%w:%s", ErrSubscribeCanceled, sub.SubscribeID)
+	}
+	stored := *sub
+	stored.SubscribeStatus = SubscribeStatus_Subscribing
+	m.subscribes[sub.SubscribeID] = &stored
+	return nil
+}
+
+// Cancel 取消 owner 的订阅
+func (m *SubscriptionManager) Cancel(owner, id, org, person, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subscribes[id]
+	if !ok || !m.ownedLocked(owner, id) {
+		return fmt.Errorf("%w:%s", ErrSubscribeNotFound, id)
+	}
+	now := VIIDTime(time.Now())
+	sub.OperateType = OperateType_Cancel
+	sub.SubscribeStatus = SubscribeStatus_Canceled
+	sub.SubscribeCancelOrg, sub.SubscribeCancelPerson, sub.CancelReason = org, person, reason
+	sub.CancelTime = &now
+	return nil
+}
+
+// Remove 删除订阅记录
+func (m *SubscriptionManager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscribes, id)
+	delete(m.owners, id)
+}
+
+// Get 查找订阅,返回副本
+func (m *SubscriptionManager) Get(id string) (*Subscribe, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subscribes[id]
+	if !ok {
+		return nil, false
+	}
+	m.expire(sub, time.Now())
+	copied := *sub
+	return &copied, true
+}
+
+// List owner 的全部订阅,返回副本
+func (m *SubscriptionManager) List(owner string) []*Subscribe {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	subs := make([]*Subscribe, 0, len(m.subscribes))
+	for id, sub := range m.subscribes {
+		if !m.ownedLocked(owner, id) {
+			continue
+		}
+		m.expire(sub, now)
+		copied := *sub
+		subs = append(subs, &copied)
+	}
+	return subs
+}
+
+// ownedLocked owner 为空或是订阅 id 的所有者
+func (m *SubscriptionManager) ownedLocked(owner, id string) bool {
+	return owner == "" || m.owners[id] == owner
+}
+
+// Match 查找订阅了 detail 类别且资源包含 resourceIDs 之一的生效订阅,返回副本
+func (m *SubscriptionManager) Match(detail string, resourceIDs ...string) []*Subscribe {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var subs []*Subscribe
+	for _, sub := range m.subscribes {
+		if m.expire(sub, now) != SubscribeStatus_Subscribing ||
+			(sub.BeginTime != nil && now.Before(time.Time(*sub.BeginTime))) {
+			continue
+		}
+		if containsString(sub.Details(), detail) && m.matchResource(sub, resourceIDs) {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	return subs
+}
+
+func (m *SubscriptionManager) matchResource(sub *Subscribe, resourceIDs []string) bool {
+	for _, resource := range sub.Resources() {
+		if resource == m.serverID {
+			return true
+		}
+		for _, id := range resourceIDs {
+			if id != "" && resource == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expire 到期的订阅中订阅置为到期,返回当前状态
+func (m *SubscriptionManager) expire(sub *Subscribe, now time.Time) int {
+	if sub.SubscribeStatus == SubscribeStatus_Subscribing && sub.EndTime != nil && !now.Before(time.Time(*sub.EndTime)) {
+		sub.SubscribeStatus = SubscribeStatus_Expired
+	}
+	return sub.SubscribeStatus
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifierConfig 订阅通知推送配置
+type NotifierConfig struct {
+	ServerID       string               // 本级视图库编码,作为 User-Identify 及通知标识的管理单位代码
+	Subscriptions  *SubscriptionManager // 订阅来源
+	BatchSize      int                  // 单个通知最多携带的对象数,默认100
+	ReportInterval time.Duration        // 订阅未指定 ReportInterval 时的上报间隔,默认1s
+	Retry          int                  // 推送失败的重试次数,默认3,负数不重试
+	RetryInterval  time.Duration        // 重试间隔,默认2s
+	HTTPClient     *http.Client         // 默认使用10s超时的客户端
+
+	OnError func(receiveAddr string, notification *SubscribeNotification, err error) // 重试后仍失败的通知
+}
+
+// Notifier 将发布的对象按订阅合并为通知,达到批量或上报间隔后推送到订阅的 ReceiveAddr
+type Notifier struct {
+	conf NotifierConfig
+
+	mu      sync.Mutex
+	pending map[string]*pendingNotification
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type pendingNotification struct {
+	subscribeID  string
+	receiveAddr  string
+	notification *SubscribeNotification
+	infoIDs      []string
+	timer        *time.Timer
+}
+
+func NewNotifier(conf NotifierConfig) (*Notifier, error) {
+	if utils.StringIsNullOrEmpty(conf.ServerID) || conf.Subscriptions == nil {
+		return nil, fmt.Errorf("%w:viid notifier need ServerID and Subscriptions", utils.ERR_INVALID_PARAMETER)
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.ReportInterval <= 0 {
+		conf.ReportInterval = time.Second
+	}
+	if conf.Retry < 0 {
+		conf.Retry = 0
+	} else if conf.Retry == 0 {
+		conf.Retry = 3
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = 2 * time.Second
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Notifier{conf: conf, pending: make(map[string]*pendingNotification)}, nil
+}
+
+// PublishFaces 发布人脸,deviceID 为上传设备编码,与对象的 DeviceID 一起匹配订阅资源
+func (n *Notifier) PublishFaces(deviceID string, faces []*Face) {
+	for _, face := range faces {
+		for _, sub := range n.conf.Subscriptions.Match(SubscribeDetail_Face, face.DeviceID, deviceID) {
+			obj := face
+			if sub.ResultImageDeclare == ResultImageDeclare_None && face.SubImageList != nil {
+				copied := *face
+				copied.SubImageList = nil
+				obj = &copied
+			}
+			n.add(sub, face.FaceID, func(notification *SubscribeNotification) {
+				if notification.FaceObjectList == nil {
+					notification.FaceObjectList = &FaceListObject{}
+				}
+				notification.FaceObjectList.FaceObject = append(notification.FaceObjectList.FaceObject, obj)
+			})
+		}
+	}
+}
+
+// PublishPersons 发布人员
+func (n *Notifier) PublishPersons(deviceID string, persons []*Person) {
+	for _, person := range persons {
+		for _, sub := range n.conf.Subscriptions.Match(SubscribeDetail_Person, person.DeviceID, deviceID) {
+			obj := person
+			if sub.ResultImageDeclare == ResultImageDeclare_None && person.SubImageList != nil {
+				copied := *person
+				copied.SubImageList = nil
+				obj = &copied
+			}
+			n.add(sub, person.PersonID, func(notification *SubscribeNotification) {
+				if notification.PersonObjectList == nil {
+					notification.PersonObjectList = &PersonListObject{}
+				}
+				notification.PersonObjectList.PersonObject = append(notification.PersonObjectList.PersonObject, obj)
+			})
+		}
+	}
+}
+
+// PublishMotorVehicles 发布机动车,同时匹配关联卡口编号
+func (n *Notifier) PublishMotorVehicles(deviceID string, vehicles []*MotorVehicle) {
+	for _, vehicle := range vehicles {
+		for _, sub := range n.conf.Subscriptions.Match(SubscribeDetail_MotorVehicle, vehicle.DeviceID, vehicle.TollgateID, deviceID) {
+			obj := vehicle
+			if sub.ResultImageDeclare == ResultImageDeclare_None && vehicle.SubImageList != nil {
+				copied := *vehicle
+				copied.SubImageList = nil
+				obj = &copied
+			}
+			n.add(sub, vehicle.MotorVehicleID, func(notification *SubscribeNotification) {
+				if notification.MotorVehicleObjectList == nil {
+					notification.MotorVehicleObjectList = &MotorVehicleListObject{}
+				}
+				notification.MotorVehicleObjectList.MotorVehicleObject = append(notification.MotorVehicleObjectList.MotorVehicleObject, obj)
+			})
+		}
+	}
+}
+
+// PublishNonMotorVehicles 发布非机动车
+func (n *Notifier) PublishNonMotorVehicles(deviceID string, vehicles []*NonMotorVehicle) {
+	for _, vehicle := range vehicles {
+		for _, sub := range n.conf.Subscriptions.Match(SubscribeDetail_NonMotorVehicle, vehicle.DeviceID, deviceID) {
+			obj := vehicle
+			if sub.ResultImageDeclare == ResultImageDeclare_None && vehicle.SubImageList != nil {
+				copied := *vehicle
+				copied.SubImageList = nil
+				obj = &copied
+			}
+			n.add(sub, vehicle.NonMotorVehicleID, func(notification *SubscribeNotification) {
+				if notification.NonMotorVehicleObjectList == nil {
+					notification.NonMotorVehicleObjectList = &NonMotorVehicleListObject{}
+				}
+				notification.NonMotorVehicleObjectList.NonMotorVehicleObject = append(notification.NonMotorVehicleObjectList.NonMotorVehicleObject, obj)
+			})
+		}
+	}
+}
+
+// PublishFiles 发布文件,文件对象没有设备编码,只按上传设备匹配
+func (n *Notifier) PublishFiles(deviceID string, files []*File) {
+	for _, file := range files {
+		if file.FileInfo == nil {
+			continue
+		}
+		for _, sub := range n.conf.Subscriptions.Match(SubscribeDetail_File, deviceID) {
+			obj := file
+			if sub.ResultImageDeclare == ResultImageDeclare_None && file.Data != "" {
+				copied := *file
+				copied.Data = ""
+				obj = &copied
+			}
+			n.add(sub, file.FileInfo.FileID, func(notification *SubscribeNotification) {
+				if notification.FileObjectList == nil {
+					notification.FileObjectList = &FileListObject{}
+				}
+				notification.FileObjectList.File = append(notification.FileObjectList.File, obj)
+			})
+		}
+	}
+}
+
+// PublishImages 发布图像携带的人员 人脸 机动车和非机动车,图像本身没有订阅类别
+func (n *Notifier) PublishImages(deviceID string, images []*Image) {
+	for _, image := range images {
+		n.publishObjects(deviceID, image.PersonList, image.FaceList, image.MotorVehicleList, image.NonMotorVehicleList)
+	}
+}
+
+// PublishVideoSlices 发布视频片段携带的对象,同 PublishImages
+func (n *Notifier) PublishVideoSlices(deviceID string, slices []*VideoSlice) {
+	for _, slice := range slices {
+		n.publishObjects(deviceID, slice.PersonList, slice.FaceList, slice.MotorVehicleList, slice.NonMotorVehicleList)
+	}
+}
+
+func (n *Notifier) publishObjects(deviceID string, persons *PersonListObject, faces *FaceListObject,
+	motorVehicles *MotorVehicleListObject, nonMotorVehicles *NonMotorVehicleListObject) {
+	if persons != nil {
+		n.PublishPersons(deviceID, persons.PersonObject)
+	}
+	if faces != nil {
+		n.PublishFaces(deviceID, faces.FaceObject)
+	}
+	if motorVehicles != nil {
+		n.PublishMotorVehicles(deviceID, motorVehicles.MotorVehicleObject)
+	}
+	if nonMotorVehicles != nil {
+		n.PublishNonMotorVehicles(deviceID, nonMotorVehicles.NonMotorVehicleObject)
+	}
+}
+
+// add 将对象加入订阅的待发通知,首个对象启动上报计时
+func (n *Notifier) add(sub *Subscribe, id string, add func(*SubscribeNotification)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	p, ok := n.pending[sub.SubscribeID]
+	if !ok {
+		p = &pendingNotification{
+			subscribeID: sub.SubscribeID,
+			receiveAddr: sub.ReceiveAddr,
+			notification: &SubscribeNotification{
+				NotificationID: NewBusinessObjectID(n.conf.ServerID, BusinessType_Notification),
+				SubscribeID:    sub.SubscribeID,
+				Title:          sub.Title,
+			},
+		}
+		interval := n.conf.ReportInterval
+		if sub.ReportInterval > 0 {
+			interval = time.Duration(sub.ReportInterval) * time.Second
+		}
+		p.timer = time.AfterFunc(interval, func() { n.flush(p) })
+		n.pending[sub.SubscribeID] = p
+	}
+	add(p.notification)
+	p.infoIDs = append(p.infoIDs, id)
+	if len(p.infoIDs) >= n.conf.BatchSize {
+		p.timer.Stop()
+		n.sendLocked(p)
+	}
+}
+
+func (n *Notifier) flush(p *pendingNotification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pending[p.subscribeID] == p {
+		n.sendLocked(p)
+	}
+}
+
+// sendLocked 取出待发通知并在后台推送
+func (n *Notifier) sendLocked(p *pendingNotification) {
+	delete(n.pending, p.subscribeID)
+	now := VIIDTime(time.Now())
+	p.notification.TriggerTime = &now
+	p.notification.InfoIDs = strings.Join(p.infoIDs, ",")
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.push(p.receiveAddr, p.notification); err != nil && n.conf.OnError != nil {
+			n.conf.OnError(p.receiveAddr, p.notification, err)
+		}
+	}()
+}
+
+// push 推送通知,失败时按 Retry 重试
+func (n *Notifier) push(receiveAddr string, notification *SubscribeNotification) error {
+	addr, err := url.Parse(receiveAddr)
+	if err != nil {
+		return err
+	}
+	if addr.Path == "" || addr.Path == "/" {
+		addr.Path = VIIDURL_SubscribeNotifications
+	}
+	payload, err := json.Marshal(&SubscribeNotificationListBody{
+		SubscribeNotificationListObject: &SubscribeNotificationListObject{SubscribeNotificationObject: []*SubscribeNotification{notification}},
+	})
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		if err = n.post(addr.String(), payload); err == nil || attempt >= n.conf.Retry {
+			return err
+		}
+		time.Sleep(n.conf.RetryInterval)
+	}
+}
+
+func (n *Notifier) post(addr string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType_VIID)
+	req.Header.Set(Header_UserIdentify, n.conf.ServerID)
+	resp, err := n.conf.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("viid: notify %s http status %s", addr, resp.Status)
+	}
+	// 通知按列表应答,也兼容单个应答状态
+	var list ResponseStatusListBody
+	if json.Unmarshal(data, &list) == nil && list.ResponseStatusListObject != nil {
+		return list.ResponseStatusListObject.Err()
+	}
+	var status ResponseStatusBody
+	if json.Unmarshal(data, &status) == nil && status.ResponseStatusObject != nil && status.ResponseStatusObject.StatusCode != StatusCode_OK {
+		return status.ResponseStatusObject
+	}
+	return nil
+}
+
+// Close 立即推送全部待发通知并等待推送结束,之后发布的对象被丢弃
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	n.closed = true
+	for _, p := range n.pending {
+		p.timer.Stop()
+		n.sendLocked(p)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
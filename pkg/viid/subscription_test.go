@@ -0,0 +1,278 @@
+package viid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSubscribe 订阅 detail 类别的本级全部资源,通知推送到 receiveAddr
+func testSubscribe(id, detail, receiveAddr string) *Subscribe {
+	begin, end := VIIDTime(time.Now().Add(-time.Minute)), VIIDTime(time.Now().Add(time.Hour))
+	return &Subscribe{
+		SubscribeID:     id,
+		Title:           "test",
+		SubscribeDetail: detail,
+		ResourceURI:     testServerID,
+		ApplicantName:   "applicant",
+		ApplicantOrg:    "org",
+		BeginTime:       &begin,
+		EndTime:         &end,
+		ReceiveAddr:     receiveAddr,
+	}
+}
+
+// testReceiver 接收推送的通知,前 failures 次推送应答500,返回推送次数
+func testReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan *SubscribeNotification, *atomic.Int32) {
+	t.Helper()
+	notifications := make(chan *SubscribeNotification, 16)
+	attempts := new(atomic.Int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		var body SubscribeNotificationListBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SubscribeNotificationListObject == nil {
+			http.Error(w, "bad notification", http.StatusBadRequest)
+			return
+		}
+		for _, notification := range body.SubscribeNotificationListObject.SubscribeNotificationObject {
+			notifications <- notification
+		}
+		WriteResponseStatusList(w, nil)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, notifications, attempts
+}
+
+func testSubscribeID(n int) string {
+	return strings.Repeat(string(rune('0'+n)), MaxLength_BusinessObjectID)
+}
+
+func expectNotification(t *testing.T, notifications <-chan *SubscribeNotification, infoIDs string) *SubscribeNotification {
+	t.Helper()
+	select {
+	case notification := <-notifications:
+		if notification.InfoIDs != infoIDs || notification.TriggerTime == nil {
+			t.Fatalf("notification %s want %s", notification.InfoIDs, infoIDs)
+		}
+		return notification
+	case <-time.After(5 * time.Second):
+		t.Fatalf("notification %s not received", infoIDs)
+	}
+	return nil
+}
+
+func TestSubscriptionExpire(t *testing.T) {
+	m := NewSubscriptionManager(testServerID)
+	sub := testSubscribe(testSubscribeID(1), SubscribeDetail_Face, "http://127.0.0.1/")
+	begin, end := VIIDTime(time.Now().Add(-2*time.Hour)), VIIDTime(time.Now().Add(-time.Hour))
+	sub.BeginTime, sub.EndTime = &begin, &end
+	if err := m.Create(testDeviceID, sub); err != nil {
+		t.Fatal(err)
+	}
+	if subs := m.Match(SubscribeDetail_Face, testDeviceID); len(subs) != 0 {
+		t.Fatalf("expired subscription matched")
+	}
+	if got, ok := m.Get(sub.SubscribeID); !ok || got.SubscribeStatus != SubscribeStatus_Expired {
+		t.Fatalf("status %+v", got)
+	}
+	if err := m.Update(testDeviceID, sub); !errors.Is(err, ErrSubscribeCanceled) {
+		t.Fatalf("update expired: %v", err)
+	}
+
+	// 到期的订阅只能由所有者重新订阅
+	sub = testSubscribe(sub.SubscribeID, SubscribeDetail_Face, sub.ReceiveAddr)
+	if err := m.Create("11000000001190000002", sub); !errors.Is(err, ErrSubscribeExists) {
+		t.Fatalf("create over another owner: %v", err)
+	}
+	if err := m.Create(testDeviceID, sub); err != nil {
+		t.Fatal(err)
+	}
+	if subs := m.Match(SubscribeDetail_Face, testDeviceID); len(subs) != 1 {
+		t.Fatalf("%d matched", len(subs))
+	}
+
+	// 未到开始时间的订阅保持订阅中但不匹配
+	later := testSubscribe(testSubscribeID(2), SubscribeDetail_Face, sub.ReceiveAddr)
+	begin = VIIDTime(time.Now().Add(time.Minute))
+	later.BeginTime = &begin
+	if err := m.Create(testDeviceID, later); err != nil {
+		t.Fatal(err)
+	}
+	if subs := m.Match(SubscribeDetail_Face, testDeviceID); len(subs) != 1 || subs[0].SubscribeID != sub.SubscribeID {
+		t.Fatalf("subscription before BeginTime matched")
+	}
+	if got, _ := m.Get(later.SubscribeID); got.SubscribeStatus != SubscribeStatus_Subscribing {
+		t.Fatalf("status %d", got.SubscribeStatus)
+	}
+}
+
+func TestServerSubscribeOwner(t *testing.T) {
+	subscriptions := NewSubscriptionManager(testServerID)
+	_, ts := newTestServer(t, ServerConfig{Subscriptions: subscriptions}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	owner := newTestClient(t, ts.URL, ClientConfig{})
+	other := newTestClient(t, ts.URL, ClientConfig{DeviceID: "11000000001190000002"})
+	for _, client := range []*Client{owner, other} {
+		if err := client.Register(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(client *Client) []*Subscribe {
+		var body SubscribeListBody
+		if err := client.Do(ctx, http.MethodGet, VIIDURL_Subscribes, nil, &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.SubscribeListObject.SubscribeObject
+	}
+	statuses := func(client *Client, method, path string, in any) []*ResponseStatus {
+		var body ResponseStatusListBody
+		if err := client.Do(ctx, method, path, in, &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.ResponseStatusListObject.ResponseStatusObject
+	}
+
+	sub := testSubscribe(testSubscribeID(1), SubscribeDetail_Face, "http://127.0.0.1/")
+	body := &SubscribeListBody{SubscribeListObject: &SubscribeListObject{SubscribeObject: []*Subscribe{sub}}}
+	if list := statuses(owner, http.MethodPost, VIIDURL_Subscribes, body); len(list) != 1 || list[0].StatusCode != StatusCode_OK {
+		t.Fatalf("create %+v", list)
+	}
+	if subs := list(other); len(subs) != 0 {
+		t.Fatalf("other device listed %d subscriptions", len(subs))
+	}
+	if subs := list(owner); len(subs) != 1 || subs[0].SubscribeID != sub.SubscribeID {
+		t.Fatalf("owner listed %+v", subs)
+	}
+
+	// 其他设备不能改写接收地址或取消订阅
+	changed := *sub
+	changed.ReceiveAddr = "http://192.0.2.1/"
+	body.SubscribeListObject.SubscribeObject[0] = &changed
+	if list := statuses(other, http.MethodPut, VIIDURL_Subscribes, body); len(list) != 1 || list[0].StatusCode == StatusCode_OK {
+		t.Fatalf("other device updated %+v", list)
+	}
+	err := other.Do(ctx, http.MethodPut, VIIDURL_Subscribes+"/"+sub.SubscribeID, &SubscribeBody{SubscribeObject: &changed}, nil)
+	var status *ResponseStatus
+	if !errors.As(err, &status) || !strings.HasPrefix(status.StatusString, ErrSubscribeNotFound.Error()) {
+		t.Fatalf("other device updated by ID: %v", err)
+	}
+	if list := statuses(other, http.MethodDelete, VIIDURL_Subscribes+"?IDList="+sub.SubscribeID, nil); len(list) != 1 || list[0].StatusCode == StatusCode_OK {
+		t.Fatalf("other device canceled %+v", list)
+	}
+	if got, _ := subscriptions.Get(sub.SubscribeID); got.ReceiveAddr != sub.ReceiveAddr || got.SubscribeStatus != SubscribeStatus_Subscribing {
+		t.Fatalf("subscription changed by other device %+v", got)
+	}
+
+	if list := statuses(owner, http.MethodDelete, VIIDURL_Subscribes+"?IDList="+sub.SubscribeID, nil); len(list) != 1 || list[0].StatusCode != StatusCode_OK {
+		t.Fatalf("owner cancel %+v", list)
+	}
+	if got, _ := subscriptions.Get(sub.SubscribeID); got.SubscribeStatus != SubscribeStatus_Canceled {
+		t.Fatalf("status %d", got.SubscribeStatus)
+	}
+}
+
+func TestNotifierBatch(t *testing.T) {
+	receiver, notifications, _ := testReceiver(t, 0)
+	subscriptions := NewSubscriptionManager(testServerID)
+	if err := subscriptions.Create("", testSubscribe(testSubscribeID(1), SubscribeDetail_Face, receiver.URL)); err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewNotifier(NotifierConfig{ServerID: testServerID, Subscriptions: subscriptions, BatchSize: 2, ReportInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces := make([]*Face, 3)
+	for i := range faces {
+		faces[i] = testFace()
+		faces[i].FaceID = strings.Repeat(string(rune('1'+i)), MaxLength_ObjectID)
+	}
+	// 达到批量立即推送,其余等待上报间隔
+	notifier.PublishFaces(testDeviceID, faces)
+	notification := expectNotification(t, notifications, faces[0].FaceID+","+faces[1].FaceID)
+	if notification.SubscribeID != testSubscribeID(1) || len(notification.FaceObjectList.FaceObject) != 2 {
+		t.Fatalf("notification %+v", notification)
+	}
+	select {
+	case notification = <-notifications:
+		t.Fatalf("notification %s before the report interval", notification.InfoIDs)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Close 推送剩余的对象
+	notifier.Close()
+	expectNotification(t, notifications, faces[2].FaceID)
+
+	notifier, err = NewNotifier(NotifierConfig{ServerID: testServerID, Subscriptions: subscriptions, ReportInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+	notifier.PublishFaces(testDeviceID, faces[:1])
+	notification = expectNotification(t, notifications, faces[0].FaceID)
+	if notification.NotificationID == "" || notification.Title != "test" {
+		t.Fatalf("notification %+v", notification)
+	}
+}
+
+func TestNotifierRetry(t *testing.T) {
+	receiver, notifications, attempts := testReceiver(t, 2)
+	subscriptions := NewSubscriptionManager(testServerID)
+	if err := subscriptions.Create("", testSubscribe(testSubscribeID(1), SubscribeDetail_Face, receiver.URL)); err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan error, 1)
+	conf := NotifierConfig{
+		ServerID:       testServerID,
+		Subscriptions:  subscriptions,
+		ReportInterval: time.Millisecond,
+		Retry:          2,
+		RetryInterval:  time.Millisecond,
+		OnError: func(receiveAddr string, notification *SubscribeNotification, err error) {
+			failed <- err
+		},
+	}
+	notifier, err := NewNotifier(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := testFace()
+	notifier.PublishFaces(testDeviceID, []*Face{face})
+	expectNotification(t, notifications, face.FaceID)
+	notifier.Close()
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("%d attempts", n)
+	}
+
+	// 不重试时失败的通知交给 OnError
+	receiver, _, attempts = testReceiver(t, 1)
+	sub := testSubscribe(testSubscribeID(1), SubscribeDetail_Face, receiver.URL)
+	if err = subscriptions.Update("", sub); err != nil {
+		t.Fatal(err)
+	}
+	conf.Retry = -1
+	if notifier, err = NewNotifier(conf); err != nil {
+		t.Fatal(err)
+	}
+	notifier.PublishFaces(testDeviceID, []*Face{face})
+	notifier.Close()
+	select {
+	case err = <-failed:
+		if err == nil || !strings.Contains(err.Error(), "500") {
+			t.Fatalf("error %v", err)
+		}
+	default:
+		t.Fatal("OnError not called")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("%d attempts without retry", n)
+	}
+}
@@ -0,0 +1,55 @@
+package viid
+
+// 系统接口 GA/T 1400.4 5.2
+const (
+	VIIDURL_Register   = "/VIID/System/Register"
+	VIIDURL_UnRegister = "/VIID/System/UnRegister"
+	VIIDURL_Keepalive  = "/VIID/System/Keepalive"
+	VIIDURL_Time       = "/VIID/System/Time"
+)
+
+const (
+	// ContentType_VIID 视图库接口的消息体类型
+	ContentType_VIID = "application/VIID+JSON;charset=UTF-8"
+	// Header_UserIdentify 注册后每个请求携带的设备编码头
+	Header_UserIdentify = "User-Identify"
+)
+
+// 校时模式
+const (
+	TimeMode_Network = "1" // 网络校时
+	TimeMode_Manual  = "2" // 手动校时
+)
+
+// DeviceIDObject 注册 保活 注销对象,只有设备编码
+type DeviceIDObject struct {
+	DeviceID string `json:"DeviceID"`
+}
+
+// RegisterBody 注册消息体 {"RegisterObject":{"DeviceID":"..."}}
+type RegisterBody struct {
+	RegisterObject *DeviceIDObject `json:"RegisterObject"`
+}
+
+// UnRegisterBody 注销消息体 {"UnRegisterObject":{"DeviceID":"..."}}
+type UnRegisterBody struct {
+	UnRegisterObject *DeviceIDObject `json:"UnRegisterObject"`
+}
+
+// KeepaliveBody 保活消息体 {"KeepaliveObject":{"DeviceID":"..."}}
+type KeepaliveBody struct {
+	KeepaliveObject *DeviceIDObject `json:"KeepaliveObject"`
+}
+
+// SystemTime 校时对象
+type SystemTime struct {
+	VIIDServerID string    `json:"VIIDServerID"`       // 视图库编码 DeviceIDType string(20)
+	TimeMode     string    `json:"TimeMode"`           // 校时模式 TimeMode_*
+	LocalTime    *VIIDTime `json:"LocalTime"`          // 视图库时间
+	TimeZone     string    `json:"TimeZone,omitempty"` // 时区,如 Asia/Shanghai
+}
+
+// SystemTimeBody 校时消息体 {"SystemTimeObject":{...}}
+type SystemTimeBody struct {
+	SystemTimeObject *SystemTime `json:"SystemTimeObject"`
+}
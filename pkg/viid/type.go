@@ -64,16 +64,46 @@ const (
 	MaxLength_DateTimeType                  = 17  // DateTimeFormat (YYYYMMDDHHMMSSMMM)
 	MaxLength_HorizontalAndVerticalShotType = 1   // HorizontalShotType VerticalShotType string(1)
 	MaxLength_ImageEigenValue               = 256 // eigen value of image,256 dimension
+
+	MaxLength_ObjectID            = 48  // 人员 人脸 车辆等对象标识 string(48)
+	MaxLength_FileName            = 256 // FileName string(256)
+	MaxLength_FileFormat          = 6   // 视频 文件的 FileFormat string(6)
+	MaxLength_FileHash            = 128 // FileHash string(128)
+	MaxLength_CodedFormat         = 2   // CodedFormat AudioCodedFormat string(2)
+	MaxLength_ImageType           = 3   // SubImageInfo.Type string(3)
+	MaxLength_Code                = 2   // 颜色 款式等两位代码 string(2)
+	MaxLength_Url                 = 256 // StorageUrl OriginVideoURL string(256)
+	MaxLength_CameraManufacturer  = 50  // CameraManufacturer string(50)
+	MaxLength_CameraVersion       = 64  // CameraVersion string(64)
+	MaxLength_FacialFeature       = 40  // FacialFeature string(40)
+	MaxLength_PhysicalFeature     = 200 // PhysicalFeature string(200)
+	MaxLength_BodyFeature         = 70  // BodyFeature string(70)
+	MaxLength_FaceFeature         = 32  // EyebrowStyle NoseStyle 等面部特征 string(32)
+	MaxLength_OtherFeature        = 128 // OtherFeature Appendant string(128)
+	MaxLength_BehaviorDescription = 256 // BehaviorDescription AppendantDescription string(256)
+	MaxLength_PlateNo             = 15  // PlateNo PlateNoAttach string(15)
+	MaxLength_PlateDescribe       = 64  // PlateDescribe string(64)
+	MaxLength_VehiclePart         = 64  // VehicleHood VehicleTrunk 等车身部位描述 string(64)
+	MaxLength_VehicleModel        = 32  // VehicleModel string(32)
+	MaxLength_VehicleStyles       = 16  // VehicleStyles string(16)
+	MaxLength_VehicleBodyDesc     = 128 // VehicleBodyDesc string(128)
+	MaxLength_ItemDescription     = 256 // DescOfFrontItem DescOfRearItem string(256)
+	MaxLength_RoadName            = 64  // NameOfPassedRoad string(64)
+	MaxLength_Reliability         = 3   // PlateReliability BrandReliability string(3)
+	MaxLength_CharReliability     = 64  // PlateCharReliability string(64)
 )
 
 type DataSourceType = string
 
 // 视频图像信息对象 video and image information object
 const (
-	VIIO_Person       = "person"
-	VIIO_Face         = "face"
-	VIIO_ImageInfo    = "iamgeinfo"
-	VIIO_MotorVehicle = "motorvehicle"
+	VIIO_Person          = "person"
+	VIIO_Face            = "face"
+	VIIO_ImageInfo       = "iamgeinfo"
+	VIIO_MotorVehicle    = "motorvehicle"
+	VIIO_NonMotorVehicle = "nonmotorvehicle"
+	VIIO_VideoSlice      = "videoslice"
+	VIIO_File            = "file"
 )
 
 // viid时间格式
@@ -0,0 +1,581 @@
+package viid
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	utils "github.com/286897655/gopkgs/pkg/utils"
+)
+
+// FieldError 字段级校验错误
+type FieldError struct {
+	Field  string // JSON字段路径,如 SubImageList.SubImageInfoObject[0].ImageID
+	Reason string
+}
+
+func (err *FieldError) Error() string {
+	return err.Field + ":" + err.Reason
+}
+
+// ValidationError 一个视频图像信息对象的全部字段错误,对应一条 ResponseStatus,
+// errors.Is(err, utils.ERR_INVALID_PARAMETER) 成立
+type ValidationError struct {
+	ObjectID string // 对象标识,作为 ResponseStatus 的 Id
+	Fields   []*FieldError
+}
+
+func (err *ValidationError) Error() string {
+	reasons := make([]string, len(err.Fields))
+	for i, field := range err.Fields {
+		reasons[i] = field.Error()
+	}
+	return fmt.Sprintf("viid: invalid object %s:%s", err.ObjectID, strings.Join(reasons, ";"))
+}
+
+func (err *ValidationError) Unwrap() error {
+	return utils.ERR_INVALID_PARAMETER
+}
+
+// validator 收集一个对象的字段错误,prefix 为嵌套对象的字段路径前缀
+type validator struct {
+	prefix string
+	fields *[]*FieldError
+}
+
+func newValidator() *validator {
+	return &validator{fields: new([]*FieldError)}
+}
+
+// nested 返回校验嵌套对象 field 的 validator
+func (v *validator) nested(field string) *validator {
+	return &validator{prefix: v.prefix + field + ".", fields: v.fields}
+}
+
+func (v *validator) fail(field, format string, args ...any) {
+	*v.fields = append(*v.fields, &FieldError{Field: v.prefix + field, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) result(id string) error {
+	if len(*v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{ObjectID: id, Fields: *v.fields}
+}
+
+// text 校验字符串长度,长度按字符计算
+func (v *validator) text(field, value string, required bool, maxLength int) {
+	if value == "" {
+		if required {
+			v.fail(field, "required")
+		}
+		return
+	}
+	if n := utf8.RuneCountInString(value); n > maxLength {
+		v.fail(field, "length %d exceeds %d", n, maxLength)
+	}
+}
+
+// texts 校验多个可选字段的长度,pairs 为字段名和值交替
+func (v *validator) texts(maxLength int, pairs ...string) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v.text(pairs[i], pairs[i+1], false, maxLength)
+	}
+}
+
+// digits 校验数字代码,fixed 为真时长度必须为 length,否则最长 length
+func (v *validator) digits(field, value string, required bool, length int, fixed bool) {
+	if value == "" {
+		if required {
+			v.fail(field, "required")
+		}
+		return
+	}
+	if (fixed && len(value) != length) || len(value) > length {
+		v.fail(field, "must be %d digits", length)
+		return
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			v.fail(field, "must be digits")
+			return
+		}
+	}
+}
+
+func (v *validator) oneOf(field, value string, required bool, allowed ...string) {
+	if value == "" {
+		if required {
+			v.fail(field, "required")
+		}
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(field, "invalid value %q", value)
+}
+
+func (v *validator) intRange(field string, value, min, max int) {
+	if value < min || value > max {
+		v.fail(field, "%d out of range [%d,%d]", value, min, max)
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.fail(field, "must be positive")
+	}
+}
+
+func (v *validator) infoKind(kind InfoType) {
+	v.intRange("InfoKind", kind, InfoType_Other, InfoType_Manual)
+}
+
+func (v *validator) yesOrNot(field string, value int) {
+	v.intRange(field, value, YesOrNot_NOT, YesOrNot_Unknown)
+}
+
+func (v *validator) secretLevel(value string) {
+	v.oneOf("SecurityLevel", value, true, SecretLevelType_TOP, SecretLevelType_Confidential,
+		SecretLevelType_Secret, SecretLevelType_Internal, SecretLevelType_Public, SecretLevelType_Other)
+}
+
+func (v *validator) deviceID(field, value string, required bool) {
+	v.digits(field, value, required, MaxLength_DeviceID, true)
+}
+
+func (v *validator) position(p *ObjectPosition) {
+	if p.LeftTopX < 0 {
+		v.fail("LeftTopX", "negative")
+	}
+	if p.LeftTopY < 0 {
+		v.fail("LeftTopY", "negative")
+	}
+	if p.RightBtmX != 0 && p.RightBtmX < p.LeftTopX {
+		v.fail("RightBtmX", "less than LeftTopX")
+	}
+	if p.RightBtmY != 0 && p.RightBtmY < p.LeftTopY {
+		v.fail("RightBtmY", "less than LeftTopY")
+	}
+}
+
+func (v *validator) shotPlace(p *ShotPlace) {
+	v.digits("ShotPlaceCode", p.ShotPlaceCode, false, MaxLength_PlaceCode, true)
+	v.text("ShotPlaceFullAdress", p.ShotPlaceFullAdress, false, MaxLength_PlaceAddress)
+	if p.ShotPlaceLongitude < -180 || p.ShotPlaceLongitude > 180 {
+		v.fail("ShotPlaceLongitude", "out of range")
+	}
+	if p.ShotPlaceLatitude < -90 || p.ShotPlaceLatitude > 90 {
+		v.fail("ShotPlaceLatitude", "out of range")
+	}
+	v.digits("HorizontalShotDirection", p.HorizontalShotDirection, false, MaxLength_HorizontalAndVerticalShotType, true)
+	v.digits("VerticalShotDirection", p.VerticalShotDirection, false, MaxLength_HorizontalAndVerticalShotType, true)
+}
+
+func (v *validator) collector(c *Collector) {
+	v.text("CollectorName", c.CollectorName, false, MaxLength_NameType)
+	v.text("CollectorOrg", c.CollectorOrg, false, MaxLength_OrgType)
+	v.text("CollectorIDType", c.CollectorIDType, false, MaxLength_IDType)
+	v.text("CollectorID", c.CollectorID, false, MaxLength_IDNumberType)
+	v.text("EntryClerk", c.EntryClerk, false, MaxLength_NameType)
+	v.text("EntryClerkOrg", c.EntryClerkOrg, false, MaxLength_OrgType)
+	v.text("EntryClerkIDType", c.EntryClerkIDType, false, MaxLength_IDType)
+	v.text("EntryClerkID", c.EntryClerkID, false, MaxLength_IDNumberType)
+}
+
+func (v *validator) personCharacter(p *PersonCharacter) {
+	v.text("IDType", p.IDType, false, MaxLength_IDType)
+	v.text("IDNumber", p.IDNumber, false, MaxLength_IDNumberType)
+	v.text("Name", p.Name, false, MaxLength_NameType)
+	v.text("UsedName", p.UsedName, false, MaxLength_NameType)
+	v.text("Alias", p.Alias, false, MaxLength_NameType)
+	// 0未知 1男 2女 9未说明
+	v.oneOf("GenderCode", p.GenderCode, false, "0", "1", "2", "9")
+	if p.AgeUpLimit != 0 && p.AgeUpLimit < p.AgeLowerLimit {
+		v.fail("AgeUpLimit", "less than AgeLowerLimit")
+	}
+	v.digits("EthicCode", p.EthicCode, false, 2, false)
+	v.text("NationalityCode", p.NationalityCode, false, 3)
+	v.digits("NativeCityCode", p.NativeCityCode, false, MaxLength_PlaceCode, true)
+	v.digits("ResidenceAdminDivision", p.ResidenceAdminDivision, false, MaxLength_PlaceCode, true)
+	v.text("ChineseAccentCode", p.ChineseAccentCode, false, MaxLength_PlaceCode)
+	v.text("JobCategory", p.JobCategory, false, 3)
+	v.texts(MaxLength_Code,
+		"SkinColor", p.SkinColor, "HairStyle", p.HairStyle, "HairColor", p.HairColor,
+		"RespiratorColor", p.RespiratorColor, "CapStyle", p.CapStyle, "CapColor", p.CapColor,
+		"GlassStyle", p.GlassStyle, "GlassColor", p.GlassColor, "PassportType", p.PassportType,
+		"ImmigrantTypeCode", p.ImmigrantTypeCode,
+		"CriminalInvolvedSpecilisationCode", p.CriminalInvolvedSpecilisationCode,
+		"DetaineesIdentity", p.DetaineesIdentity, "DetaineesSpecialIdentity", p.DetaineesSpecialIdentity,
+		"MemberTypeCode", p.MemberTypeCode, "CorpseConditionCode", p.CorpseConditionCode)
+	v.text("FaceStyle", p.FaceStyle, false, 4)
+	v.text("FacialFeature", p.FacialFeature, false, MaxLength_FacialFeature)
+	v.text("PhysicalFeature", p.PhysicalFeature, false, MaxLength_PhysicalFeature)
+	v.text("SuspectedTerroristNumber", p.SuspectedTerroristNumber, false, 19)
+	v.text("BodySpeciallMark", p.BodySpeciallMark, false, 7)
+	v.text("CrimeMethod", p.CrimeMethod, false, 4)
+	v.text("CrimeCharacterCode", p.CrimeCharacterCode, false, 3)
+	v.text("EscapedCriminalNumber", p.EscapedCriminalNumber, false, 23)
+	v.text("DetentionHouseCode", p.DetentionHouseCode, false, 9)
+	v.text("VictimType", p.VictimType, false, 3)
+	v.text("InjuredDegree", p.InjuredDegree, false, 1)
+	v.yesOrNot("IsDriver", p.IsDriver)
+	v.yesOrNot("IsForeigner", p.IsForeigner)
+	v.yesOrNot("IsSuspectedTerrorist", p.IsSuspectedTerrorist)
+	v.yesOrNot("IsCriminalInvolved", p.IsCriminalInvolved)
+	v.yesOrNot("IsDetainees", p.IsDetainees)
+	v.yesOrNot("IsVictim", p.IsVictim)
+	v.yesOrNot("IsSuspiciousPerson", p.IsSuspiciousPerson)
+}
+
+func (v *validator) vehicleCharacter(c *VehicleCharacter) {
+	v.text("PlateClass", c.PlateClass, false, MaxLength_Code)
+	v.text("PlateColor", c.PlateColor, false, MaxLength_Code)
+	v.text("PlateNo", c.PlateNo, false, MaxLength_PlateNo)
+	v.text("PlateNoAttach", c.PlateNoAttach, false, MaxLength_PlateNo)
+	v.text("PlateDescribe", c.PlateDescribe, false, MaxLength_PlateDescribe)
+	if c.Speed < 0 {
+		v.fail("Speed", "negative")
+	}
+	v.text("DrivingStatusCode", c.DrivingStatusCode, false, 4)
+	v.text("UsingPropertiesCode", c.UsingPropertiesCode, false, 3)
+	v.text("VehicleBrand", c.VehicleBrand, false, 3)
+	v.text("VehicleColor", c.VehicleColor, false, MaxLength_Code)
+	v.text("WheelPrintedPattern", c.WheelPrintedPattern, false, MaxLength_Code)
+	v.texts(MaxLength_VehiclePart,
+		"VehicleHood", c.VehicleHood, "VehicleTrunk", c.VehicleTrunk, "VehicleWheel", c.VehicleWheel,
+		"VehicleWindow", c.VehicleWindow, "VehicleRoof", c.VehicleRoof, "VehicleDoor", c.VehicleDoor,
+		"SideOfVehicle", c.SideOfVehicle, "CarOfVehicle", c.CarOfVehicle, "RearviewMirror", c.RearviewMirror,
+		"VehicleChassis", c.VehicleChassis, "VehicleShielding", c.VehicleShielding)
+	v.text("FilmColor", c.FilmColor, false, 1)
+}
+
+// list 逐个校验对象列表,nil元素记为 field[i]:required
+func list[E any, P interface {
+	*E
+	validate(*validator)
+}](v *validator, field string, items []P) {
+	for i, item := range items {
+		name := fmt.Sprintf("%s[%d]", field, i)
+		if item == nil {
+			v.fail(name, "required")
+			continue
+		}
+		item.validate(v.nested(name))
+	}
+}
+
+func (v *validator) subImages(images *SubImageInfoList) {
+	if images != nil {
+		list(v, "SubImageList.SubImageInfoObject", images.SubImageInfoObject)
+	}
+}
+
+// objects 校验图像 视频片段中携带的对象列表
+func (v *validator) objects(persons *PersonListObject, faces *FaceListObject,
+	motorVehicles *MotorVehicleListObject, nonMotorVehicles *NonMotorVehicleListObject) {
+	if persons != nil {
+		list(v, "PersonList.PersonObject", persons.PersonObject)
+	}
+	if faces != nil {
+		list(v, "FaceList.FaceObject", faces.FaceObject)
+	}
+	if motorVehicles != nil {
+		list(v, "MotorVehicleList.MotorVehicleObject", motorVehicles.MotorVehicleObject)
+	}
+	if nonMotorVehicles != nil {
+		list(v, "NonMotorVehicleList.NonMotorVehicleObject", nonMotorVehicles.NonMotorVehicleObject)
+	}
+}
+
+// Validate 校验子图像的必选字段 长度和代码格式
+func (s *SubImageInfo) Validate() error {
+	v := newValidator()
+	s.validate(v)
+	return v.result(s.ImageID)
+}
+
+func (s *SubImageInfo) validate(v *validator) {
+	v.digits("ImageID", s.ImageID, true, MaxLength_BasicObjectID, true)
+	v.deviceID("DeviceID", s.DeviceID, true)
+	v.text("StoragePath", s.StoragePath, false, MaxLength_StoragePath)
+	v.oneOf("Type", s.Type, true, ImageType_Vehicle, ImageType_Plate, ImageType_PlateBinary, ImageType_Driver,
+		ImageType_CoDriver, ImageType_VehicleLogo, ImageType_Violation, ImageType_PassComposite,
+		ImageType_VehicleCloseup, ImageType_Person, ImageType_Face, ImageType_NonMotorVehicle,
+		ImageType_Thing, ImageType_Scene, ImageType_General)
+	v.text("FileFormat", s.FileFormat, true, MaxLength_ImageFormat)
+	v.positive("Width", s.Width)
+	v.positive("Height", s.Height)
+	if s.Data == "" && s.StoragePath == "" {
+		v.fail("Data", "either Data or StoragePath required")
+	}
+}
+
+// Validate 校验人脸对象的必选字段 长度 枚举和代码格式
+func (f *Face) Validate() error {
+	v := newValidator()
+	f.validate(v)
+	return v.result(f.FaceID)
+}
+
+func (f *Face) validate(v *validator) {
+	v.digits("FaceID", f.FaceID, true, MaxLength_ObjectID, true)
+	v.infoKind(f.InfoKind)
+	v.digits("SourceID", f.SourceID, true, MaxLength_BasicObjectID, true)
+	v.deviceID("DeviceID", f.DeviceID, false)
+	v.position(&f.ObjectPosition)
+	v.personCharacter(&f.PersonCharacter)
+	v.intRange("Attitude", f.Attitude, 0, 9)
+	if f.Similaritydegree < 0 || f.Similaritydegree > 1 {
+		v.fail("Similaritydegree", "out of range [0,1]")
+	}
+	v.texts(MaxLength_FaceFeature,
+		"EyebrowStyle", f.EyebrowStyle, "NoseStyle", f.NoseStyle, "MustacheStyle", f.MustacheStyle,
+		"LipStyle", f.LipStyle, "WrinklePouch", f.WrinklePouch, "AcneStain", f.AcneStain,
+		"FreckleBirthmark", f.FreckleBirthmark, "ScarDimple", f.ScarDimple)
+	v.text("OtherFeature", f.OtherFeature, false, MaxLength_OtherFeature)
+	v.subImages(f.SubImageList)
+}
+
+// Validate 校验人员对象的必选字段 长度 枚举和代码格式
+func (p *Person) Validate() error {
+	v := newValidator()
+	p.validate(v)
+	return v.result(p.PersonID)
+}
+
+func (p *Person) validate(v *validator) {
+	v.digits("PersonID", p.PersonID, true, MaxLength_ObjectID, true)
+	v.infoKind(p.InfoKind)
+	v.digits("SourceID", p.SourceID, true, MaxLength_BasicObjectID, true)
+	v.deviceID("DeviceID", p.DeviceID, false)
+	v.position(&p.ObjectPosition)
+	v.personCharacter(&p.PersonCharacter)
+	v.text("PersonOrg", p.PersonOrg, false, MaxLength_OrgType)
+	if p.HeightUpLimit != 0 && p.HeightUpLimit < p.HeightLowerLimit {
+		v.fail("HeightUpLimit", "less than HeightLowerLimit")
+	}
+	v.texts(MaxLength_Code,
+		"BodyType", p.BodyType, "Gesture", p.Gesture, "Status", p.Status, "HabitualMovement", p.HabitualMovement,
+		"Behavior", p.Behavior, "UmbrellaColor", p.UmbrellaColor, "ScarfColor", p.ScarfColor,
+		"BagStyle", p.BagStyle, "BagColor", p.BagColor, "CoatStyle", p.CoatStyle, "CoatLength", p.CoatLength,
+		"CoatColor", p.CoatColor, "TrousersStyle", p.TrousersStyle, "TrousersColor", p.TrousersColor,
+		"TrousersLen", p.TrousersLen, "ShoesStyle", p.ShoesStyle, "ShoesColor", p.ShoesColor)
+	v.text("BodyFeature", p.BodyFeature, false, MaxLength_BodyFeature)
+	v.text("BehaviorDescription", p.BehaviorDescription, false, MaxLength_BehaviorDescription)
+	v.text("Appendant", p.Appendant, false, MaxLength_OtherFeature)
+	v.text("AppendantDescription", p.AppendantDescription, false, MaxLength_BehaviorDescription)
+	v.subImages(p.SubImageList)
+}
+
+// Validate 校验机动车对象的必选字段 长度 枚举和代码格式
+func (m *MotorVehicle) Validate() error {
+	v := newValidator()
+	m.validate(v)
+	return v.result(m.MotorVehicleID)
+}
+
+func (m *MotorVehicle) validate(v *validator) {
+	v.digits("MotorVehicleID", m.MotorVehicleID, true, MaxLength_ObjectID, true)
+	v.infoKind(m.InfoKind)
+	v.digits("SourceID", m.SourceID, true, MaxLength_BasicObjectID, true)
+	v.deviceID("TollgateID", m.TollgateID, false)
+	v.deviceID("DeviceID", m.DeviceID, false)
+	for i, url := range []string{m.StorageUrl1, m.StorageUrl2, m.StorageUrl3, m.StorageUrl4, m.StorageUrl5} {
+		v.text(fmt.Sprintf("StorageUrl%d", i+1), url, false, MaxLength_Url)
+	}
+	v.position(&m.ObjectPosition)
+	if m.LaneNo < 0 {
+		v.fail("LaneNo", "negative")
+	}
+	v.vehicleCharacter(&m.VehicleCharacter)
+	v.digits("Direction", m.Direction, false, 1, true)
+	v.text("VehicleClass", m.VehicleClass, false, 3)
+	v.text("VehicleModel", m.VehicleModel, false, MaxLength_VehicleModel)
+	v.text("VehicleStyles", m.VehicleStyles, false, MaxLength_VehicleStyles)
+	v.text("VehicleColorDepth", m.VehicleColorDepth, false, 1)
+	v.text("HitMarkInfo", m.HitMarkInfo, false, 1)
+	v.text("VehicleBodyDesc", m.VehicleBodyDesc, false, MaxLength_VehicleBodyDesc)
+	v.text("VehicleFrontItem", m.VehicleFrontItem, false, MaxLength_Code)
+	v.text("DescOfFrontItem", m.DescOfFrontItem, false, MaxLength_ItemDescription)
+	v.text("VehicleRearItem", m.VehicleRearItem, false, MaxLength_Code)
+	v.text("DescOfRearItem", m.DescOfRearItem, false, MaxLength_ItemDescription)
+	if m.NumOfPassenger < 0 {
+		v.fail("NumOfPassenger", "negative")
+	}
+	v.text("NameOfPassedRoad", m.NameOfPassedRoad, false, MaxLength_RoadName)
+	v.intRange("Sunvisor", m.Sunvisor, 0, 1)
+	v.intRange("SafetyBelt", m.SafetyBelt, 0, 1)
+	v.intRange("Calling", m.Calling, 0, 1)
+	v.text("PlateReliability", m.PlateReliability, false, MaxLength_Reliability)
+	v.text("PlateCharReliability", m.PlateCharReliability, false, MaxLength_CharReliability)
+	v.text("BrandReliability", m.BrandReliability, false, MaxLength_Reliability)
+	v.subImages(m.SubImageList)
+}
+
+// Validate 校验非机动车对象的必选字段 长度 枚举和代码格式
+func (n *NonMotorVehicle) Validate() error {
+	v := newValidator()
+	n.validate(v)
+	return v.result(n.NonMotorVehicleID)
+}
+
+func (n *NonMotorVehicle) validate(v *validator) {
+	v.digits("NonMotorVehicleID", n.NonMotorVehicleID, true, MaxLength_ObjectID, true)
+	v.infoKind(n.InfoKind)
+	v.digits("SourceID", n.SourceID, true, MaxLength_BasicObjectID, true)
+	v.deviceID("DeviceID", n.DeviceID, false)
+	v.position(&n.ObjectPosition)
+	v.vehicleCharacter(&n.VehicleCharacter)
+	v.text("VehicleType", n.VehicleType, false, MaxLength_VehiclePart)
+	v.subImages(n.SubImageList)
+}
+
+// Validate 校验图像信息的必选字段 长度 枚举和代码格式
+func (info *ImageInfo) Validate() error {
+	v := newValidator()
+	info.validate(v)
+	return v.result(info.ImageID)
+}
+
+func (info *ImageInfo) validate(v *validator) {
+	v.digits("ImageID", info.ImageID, true, MaxLength_BasicObjectID, true)
+	v.infoKind(info.InfoKind)
+	v.digits("ImageSource", info.ImageSource, true, MaxLength_DataSourceType, false)
+	v.digits("SourceVideoID", info.SourceVideoID, false, MaxLength_BasicObjectID, true)
+	v.digits("OriginImageID", info.OriginImageID, false, MaxLength_BasicObjectID, true)
+	v.deviceID("DeviceID", info.DeviceID, true)
+	v.text("StoragePath", info.StoragePath, false, MaxLength_StoragePath)
+	v.text("FileHash", info.FileHash, false, MaxLength_FileHash)
+	v.text("FileFormat", info.FileFormat, true, MaxLength_ImageFormat)
+	v.text("Title", info.Title, true, MaxLength_Title)
+	v.text("TitleNote", info.TitleNote, false, MaxLength_Title)
+	v.text("SpecialIName", info.SpecialIName, false, MaxLength_Special)
+	v.text("Keyword", info.Keyword, false, MaxLength_KeyWord)
+	v.text("ContentDescription", info.ContentDescription, false, MaxLength_ContentDescription)
+	v.text("SubjectCharacter", info.SubjectCharacter, false, MaxLength_SubjectCharacter)
+	v.shotPlace(&info.ShotPlace)
+	v.secretLevel(info.SecurityLevel)
+	v.positive("Width", info.Width)
+	v.positive("Height", info.Height)
+	v.text("CameraManufacturer", info.CameraManufacturer, false, MaxLength_CameraManufacturer)
+	v.text("CameraVersion", info.CameraVersion, false, MaxLength_CameraVersion)
+	v.digits("QualityGrade", info.QualityGrade, false, MaxLength_QualityGradeType, true)
+	v.collector(&info.Collector)
+	v.intRange("ImageProcFlag", info.ImageProcFlag, 0, 1)
+	if info.FileSize < 0 {
+		v.fail("FileSize", "negative")
+	}
+}
+
+// Validate 校验图像信息及其携带的对象
+func (image *Image) Validate() error {
+	v := newValidator()
+	if image.ImageInfo == nil {
+		v.fail("ImageInfo", "required")
+		return v.result("")
+	}
+	image.ImageInfo.validate(v.nested("ImageInfo"))
+	v.objects(image.PersonList, image.FaceList, image.MotorVehicleList, image.NonMotorVehicleList)
+	return v.result(image.ImageInfo.ImageID)
+}
+
+// Validate 校验视频片段信息的必选字段 长度 枚举和代码格式
+func (info *VideoSliceInfo) Validate() error {
+	v := newValidator()
+	info.validate(v)
+	return v.result(info.VideoID)
+}
+
+func (info *VideoSliceInfo) validate(v *validator) {
+	v.digits("VideoID", info.VideoID, true, MaxLength_BasicObjectID, true)
+	v.infoKind(info.InfoKind)
+	v.digits("VideoSource", info.VideoSource, true, MaxLength_DataSourceType, false)
+	v.digits("OriginVideoID", info.OriginVideoID, false, MaxLength_BasicObjectID, true)
+	v.text("OriginVideoURL", info.OriginVideoURL, false, MaxLength_Url)
+	v.deviceID("DeviceID", info.DeviceID, true)
+	v.text("StoragePath", info.StoragePath, false, MaxLength_StoragePath)
+	v.text("ThumbnailStoragePath", info.ThumbnailStoragePath, false, MaxLength_StoragePath)
+	v.text("FileHash", info.FileHash, false, MaxLength_FileHash)
+	v.text("FileFormat", info.FileFormat, true, MaxLength_FileFormat)
+	v.text("CodedFormat", info.CodedFormat, true, MaxLength_CodedFormat)
+	v.intRange("AudioFlag", info.AudioFlag, 0, 1)
+	v.text("AudioCodedFormat", info.AudioCodedFormat, false, MaxLength_CodedFormat)
+	v.text("Title", info.Title, true, MaxLength_Title)
+	v.text("TitleNote", info.TitleNote, false, MaxLength_Title)
+	v.text("SpecialIName", info.SpecialIName, false, MaxLength_Special)
+	v.text("Keyword", info.Keyword, false, MaxLength_KeyWord)
+	v.text("ContentDescription", info.ContentDescription, false, MaxLength_ContentDescription)
+	v.text("MainCharacter", info.MainCharacter, false, MaxLength_SubjectCharacter)
+	v.shotPlace(&info.ShotPlace)
+	v.secretLevel(info.SecurityLevel)
+	if info.VideoLen < 0 {
+		v.fail("VideoLen", "negative")
+	}
+	if info.BeginTime == nil {
+		v.fail("BeginTime", "required")
+	}
+	if info.EndTime == nil {
+		v.fail("EndTime", "required")
+	}
+	if info.BeginTime != nil && info.EndTime != nil && time.Time(*info.EndTime).Before(time.Time(*info.BeginTime)) {
+		v.fail("EndTime", "before BeginTime")
+	}
+	v.digits("QualityGrade", info.QualityGrade, false, MaxLength_QualityGradeType, true)
+	v.collector(&info.Collector)
+	v.intRange("VideoProcFlag", info.VideoProcFlag, 0, 1)
+	if info.FileSize < 0 {
+		v.fail("FileSize", "negative")
+	}
+}
+
+// Validate 校验视频片段信息及其携带的对象
+func (slice *VideoSlice) Validate() error {
+	v := newValidator()
+	if slice.VideoSliceInfo == nil {
+		v.fail("VideoSliceInfo", "required")
+		return v.result("")
+	}
+	slice.VideoSliceInfo.validate(v.nested("VideoSliceInfo"))
+	v.objects(slice.PersonList, slice.FaceList, slice.MotorVehicleList, slice.NonMotorVehicleList)
+	return v.result(slice.VideoSliceInfo.VideoID)
+}
+
+// Validate 校验文件信息的必选字段 长度 枚举和代码格式
+func (info *FileInfo) Validate() error {
+	v := newValidator()
+	info.validate(v)
+	return v.result(info.FileID)
+}
+
+func (info *FileInfo) validate(v *validator) {
+	v.digits("FileID", info.FileID, true, MaxLength_BasicObjectID, true)
+	v.infoKind(info.InfoKind)
+	v.digits("Source", info.Source, true, MaxLength_DataSourceType, false)
+	v.text("FileName", info.FileName, true, MaxLength_FileName)
+	v.text("StoragePath", info.StoragePath, false, MaxLength_StoragePath)
+	v.text("FileHash", info.FileHash, false, MaxLength_FileHash)
+	v.text("FileFormat", info.FileFormat, true, MaxLength_FileFormat)
+	v.text("Title", info.Title, true, MaxLength_Title)
+	v.secretLevel(info.SecurityLevel)
+	v.text("SubmiterName", info.SubmiterName, false, MaxLength_NameType)
+	v.text("SubmiterOrg", info.SubmiterOrg, false, MaxLength_OrgType)
+	if info.FileSize < 0 {
+		v.fail("FileSize", "negative")
+	}
+}
+
+// Validate 校验文件信息
+func (file *File) Validate() error {
+	v := newValidator()
+	if file.FileInfo == nil {
+		v.fail("FileInfo", "required")
+		return v.result("")
+	}
+	file.FileInfo.validate(v.nested("FileInfo"))
+	return v.result(file.FileInfo.FileID)
+}
@@ -0,0 +1,158 @@
+package viid
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	utils "github.com/286897655/gopkgs/pkg/utils"
+)
+
+func testSubImage() *SubImageInfo {
+	return &SubImageInfo{
+		ImageID:    strings.Repeat("1", MaxLength_BasicObjectID),
+		DeviceID:   testDeviceID,
+		Type:       ImageType_Face,
+		FileFormat: "Jpeg",
+		Width:      640,
+		Height:     480,
+		Data:       "/9j/",
+	}
+}
+
+func testFace() *Face {
+	return &Face{
+		FaceID:       strings.Repeat("2", MaxLength_ObjectID),
+		InfoKind:     InfoType_Auto,
+		SourceID:     strings.Repeat("3", MaxLength_BasicObjectID),
+		SubImageList: &SubImageInfoList{SubImageInfoObject: []*SubImageInfo{testSubImage()}},
+	}
+}
+
+// testFieldErrors 返回校验错误中 字段路径到原因 的映射
+func testFieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !errors.Is(err, utils.ERR_INVALID_PARAMETER) {
+		t.Fatalf("not a validation error: %v", err)
+	}
+	fields := make(map[string]string, len(invalid.Fields))
+	for _, field := range invalid.Fields {
+		fields[field.Field] = field.Reason
+	}
+	return fields
+}
+
+func TestValidateNilElements(t *testing.T) {
+	face := testFace()
+	if err := face.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	face.SubImageList.SubImageInfoObject = append(face.SubImageList.SubImageInfoObject, nil)
+	fields := testFieldErrors(t, face.Validate())
+	if len(fields) != 1 || fields["SubImageList.SubImageInfoObject[1]"] != "required" {
+		t.Fatalf("fields %v", fields)
+	}
+
+	image := &Image{
+		ImageInfo:           &ImageInfo{},
+		FaceList:            &FaceListObject{FaceObject: []*Face{nil, testFace()}},
+		PersonList:          &PersonListObject{PersonObject: []*Person{nil}},
+		MotorVehicleList:    &MotorVehicleListObject{MotorVehicleObject: []*MotorVehicle{nil}},
+		NonMotorVehicleList: &NonMotorVehicleListObject{NonMotorVehicleObject: []*NonMotorVehicle{nil}},
+	}
+	image.FaceList.FaceObject[1].SubImageList.SubImageInfoObject[0] = nil
+	fields = testFieldErrors(t, image.Validate())
+	for _, field := range []string{
+		"FaceList.FaceObject[0]",
+		"FaceList.FaceObject[1].SubImageList.SubImageInfoObject[0]",
+		"PersonList.PersonObject[0]",
+		"MotorVehicleList.MotorVehicleObject[0]",
+		"NonMotorVehicleList.NonMotorVehicleObject[0]",
+	} {
+		if fields[field] != "required" {
+			t.Errorf("%s:%q", field, fields[field])
+		}
+	}
+
+	slice := &VideoSlice{
+		VideoSliceInfo: &VideoSliceInfo{},
+		FaceList:       &FaceListObject{FaceObject: []*Face{nil}},
+	}
+	if fields = testFieldErrors(t, slice.Validate()); fields["FaceList.FaceObject[0]"] != "required" {
+		t.Fatalf("fields %v", fields)
+	}
+}
+
+func TestValidateLength(t *testing.T) {
+	image := testSubImage()
+	image.StoragePath = strings.Repeat("路", MaxLength_StoragePath)
+	if err := image.Validate(); err != nil {
+		t.Fatalf("length counted in bytes: %v", err)
+	}
+	image.StoragePath += "a"
+	image.FileFormat = "Jpeg2000"
+	image.ImageID = image.ImageID[1:]
+	image.DeviceID = testDeviceID[:19] + "x"
+	fields := testFieldErrors(t, image.Validate())
+	want := map[string]string{
+		"StoragePath": "length 257 exceeds 256",
+		"FileFormat":  "length 8 exceeds 6",
+		"ImageID":     "must be 41 digits",
+		"DeviceID":    "must be digits",
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("fields %v", fields)
+	}
+	for field, reason := range want {
+		if fields[field] != reason {
+			t.Errorf("%s:%q want %q", field, fields[field], reason)
+		}
+	}
+
+	image = testSubImage()
+	image.Data, image.ImageID, image.Width = "", "", 0
+	fields = testFieldErrors(t, image.Validate())
+	if fields["Data"] == "" || fields["ImageID"] != "required" || fields["Width"] != "must be positive" {
+		t.Fatalf("fields %v", fields)
+	}
+}
+
+func TestValidateEnum(t *testing.T) {
+	face := testFace()
+	face.InfoKind = InfoType_Manual + 1
+	face.GenderCode = "3"
+	face.IsDriver = YesOrNot_Unknown
+	face.IsVictim = YesOrNot_Unknown + 1
+	face.SubImageList.SubImageInfoObject[0].Type = "99"
+	err := face.Validate()
+	fields := testFieldErrors(t, err)
+	want := []string{"InfoKind", "GenderCode", "IsVictim", "SubImageList.SubImageInfoObject[0].Type"}
+	if len(fields) != len(want) {
+		t.Fatalf("fields %v", fields)
+	}
+	for _, field := range want {
+		if fields[field] == "" {
+			t.Errorf("%s not reported", field)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "viid: invalid object "+face.FaceID+":") {
+		t.Fatalf("error %v", err)
+	}
+
+	info := &FileInfo{
+		FileID:        strings.Repeat("4", MaxLength_BasicObjectID),
+		Source:        "1",
+		FileName:      "a.txt",
+		FileFormat:    "txt",
+		Title:         "title",
+		SecurityLevel: "0",
+	}
+	if fields = testFieldErrors(t, (&File{FileInfo: info}).Validate()); fields["FileInfo.SecurityLevel"] != `invalid value "0"` {
+		t.Fatalf("fields %v", fields)
+	}
+	info.SecurityLevel = SecretLevelType_Public
+	if err = (&File{FileInfo: info}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
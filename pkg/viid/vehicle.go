@@ -0,0 +1,84 @@
+package viid
+
+// MotorVehicle 机动车对象 GA/T 1400.3 A.11
+type MotorVehicle struct {
+	MotorVehicleID string   `json:"MotorVehicleID"`        // 车辆标识 BasicObjectIDType string(48)
+	InfoKind       InfoType `json:"InfoKind"`              // 信息分类 InfoType_*
+	SourceID       string   `json:"SourceID"`              // 来源标识 BasicObjectIDType string(41)
+	TollgateID     string   `json:"TollgateID,omitempty"`  // 关联卡口编号 DeviceIDType string(20)
+	DeviceID       string   `json:"DeviceID,omitempty"`    // 设备编码 DeviceIDType string(20)
+	StorageUrl1    string   `json:"StorageUrl1,omitempty"` // 近景照片 string(256)
+	StorageUrl2    string   `json:"StorageUrl2,omitempty"` // 车牌照片 string(256)
+	StorageUrl3    string   `json:"StorageUrl3,omitempty"` // 一次合成照片 string(256)
+	StorageUrl4    string   `json:"StorageUrl4,omitempty"` // 二次合成照片 string(256)
+	StorageUrl5    string   `json:"StorageUrl5,omitempty"` // 缩略图 string(256)
+	ObjectPosition
+	MarkTime      *VIIDTime `json:"MarkTime,omitempty"`      // 位置标记时间
+	AppearTime    *VIIDTime `json:"AppearTime,omitempty"`    // 车辆出现时间
+	DisappearTime *VIIDTime `json:"DisappearTime,omitempty"` // 车辆消失时间
+	LaneNo        int       `json:"LaneNo,omitempty"`        // 车道号
+	VehicleCharacter
+
+	Direction            string    `json:"Direction,omitempty"`            // 行驶方向 string(1)
+	VehicleClass         string    `json:"VehicleClass,omitempty"`         // 车辆类型 string(3)
+	VehicleModel         string    `json:"VehicleModel,omitempty"`         // 车辆型号 string(32)
+	VehicleStyles        string    `json:"VehicleStyles,omitempty"`        // 车辆年款 string(16)
+	VehicleColorDepth    string    `json:"VehicleColorDepth,omitempty"`    // 颜色深浅 string(1)
+	HitMarkInfo          string    `json:"HitMarkInfo,omitempty"`          // 撞痕信息 string(1)
+	VehicleBodyDesc      string    `json:"VehicleBodyDesc,omitempty"`      // 车身描述 string(128)
+	VehicleFrontItem     string    `json:"VehicleFrontItem,omitempty"`     // 车前部物品 string(2)
+	DescOfFrontItem      string    `json:"DescOfFrontItem,omitempty"`      // 车前部物品描述 string(256)
+	VehicleRearItem      string    `json:"VehicleRearItem,omitempty"`      // 车后部物品 string(2)
+	DescOfRearItem       string    `json:"DescOfRearItem,omitempty"`       // 车后部物品描述 string(256)
+	NumOfPassenger       int       `json:"NumOfPassenger,omitempty"`       // 车内人数
+	PassTime             *VIIDTime `json:"PassTime,omitempty"`             // 经过时刻
+	NameOfPassedRoad     string    `json:"NameOfPassedRoad,omitempty"`     // 经过道路名称 string(64)
+	IsSuspicious         bool      `json:"IsSuspicious,omitempty"`         // 是否可疑车
+	Sunvisor             int       `json:"Sunvisor"`                       // 遮阳板状态 0收起 1放下
+	SafetyBelt           int       `json:"SafetyBelt"`                     // 安全带状态 0未系 1有系
+	Calling              int       `json:"Calling"`                        // 打电话状态 0未打 1正在打
+	PlateReliability     string    `json:"PlateReliability,omitempty"`     // 号牌识别可信度 string(3)
+	PlateCharReliability string    `json:"PlateCharReliability,omitempty"` // 每位号牌号码可信度 string(64)
+	BrandReliability     string    `json:"BrandReliability,omitempty"`     // 品牌标志识别可信度 string(3)
+
+	SubImageList *SubImageInfoList `json:"SubImageList,omitempty"` // 图像列表
+}
+
+// MotorVehicleListObject 机动车对象列表
+type MotorVehicleListObject struct {
+	MotorVehicleObject []*MotorVehicle `json:"MotorVehicleObject"`
+}
+
+// MotorVehicleListBody 机动车批量接口的消息体
+// {"MotorVehicleListObject":{"MotorVehicleObject":[...]}}
+type MotorVehicleListBody struct {
+	MotorVehicleListObject *MotorVehicleListObject `json:"MotorVehicleListObject"`
+}
+
+// NonMotorVehicle 非机动车对象 GA/T 1400.3 A.12
+type NonMotorVehicle struct {
+	NonMotorVehicleID string   `json:"NonMotorVehicleID"`  // 车辆标识 BasicObjectIDType string(48)
+	InfoKind          InfoType `json:"InfoKind"`           // 信息分类 InfoType_*
+	SourceID          string   `json:"SourceID"`           // 来源标识 BasicObjectIDType string(41)
+	DeviceID          string   `json:"DeviceID,omitempty"` // 设备编码 DeviceIDType string(20)
+	ObjectPosition
+	MarkTime      *VIIDTime `json:"MarkTime,omitempty"`      // 位置标记时间
+	AppearTime    *VIIDTime `json:"AppearTime,omitempty"`    // 车辆出现时间
+	DisappearTime *VIIDTime `json:"DisappearTime,omitempty"` // 车辆消失时间
+	VehicleCharacter
+
+	VehicleType string `json:"VehicleType,omitempty"` // 车辆款型 string(64)
+
+	SubImageList *SubImageInfoList `json:"SubImageList,omitempty"` // 图像列表
+}
+
+// NonMotorVehicleListObject 非机动车对象列表
+type NonMotorVehicleListObject struct {
+	NonMotorVehicleObject []*NonMotorVehicle `json:"NonMotorVehicleObject"`
+}
+
+// NonMotorVehicleListBody 非机动车批量接口的消息体
+// {"NonMotorVehicleListObject":{"NonMotorVehicleObject":[...]}}
+type NonMotorVehicleListBody struct {
+	NonMotorVehicleListObject *NonMotorVehicleListObject `json:"NonMotorVehicleListObject"`
+}
@@ -0,0 +1,60 @@
+package viid
+
+// VideoSliceInfo 视频片段信息 GA/T 1400.3 A.2
+type VideoSliceInfo struct {
+	VideoID              string   `json:"VideoID"`                        // 视频标识 BasicObjectIDType string(41)
+	InfoKind             InfoType `json:"InfoKind"`                       // 信息分类 InfoType_*
+	VideoSource          string   `json:"VideoSource"`                    // 视频来源 DataSourceType string(2)
+	IsAbstractVideo      bool     `json:"IsAbstractVideo,omitempty"`      // 是否摘要视频
+	OriginVideoID        string   `json:"OriginVideoID,omitempty"`        // 原始视频标识 BasicObjectIDType string(41)
+	OriginVideoURL       string   `json:"OriginVideoURL,omitempty"`       // 原始视频地址 string(256)
+	EventSort            int      `json:"EventSort"`                      // 事件分类
+	DeviceID             string   `json:"DeviceID"`                       // 采集设备编码 DeviceIDType string(20)
+	StoragePath          string   `json:"StoragePath,omitempty"`          // 存储路径 string(256)
+	ThumbnailStoragePath string   `json:"ThumbnailStoragePath,omitempty"` // 缩略图存储路径 string(256)
+	FileHash             string   `json:"FileHash,omitempty"`             // 视频文件哈希值 string(128)
+	FileFormat           string   `json:"FileFormat"`                     // 视频文件格式 string(6)
+	CodedFormat          string   `json:"CodedFormat"`                    // 视频编码格式 string(2)
+	AudioFlag            int      `json:"AudioFlag"`                      // 音频标志 0无音频 1有音频
+	AudioCodedFormat     string   `json:"AudioCodedFormat,omitempty"`     // 音频编码格式 string(2)
+
+	Title              string `json:"Title"`                        // 题名 string(128)
+	TitleNote          string `json:"TitleNote,omitempty"`          // 题名补充 string(128)
+	SpecialIName       string `json:"SpecialIName,omitempty"`       // 专项名 string(128)
+	Keyword            string `json:"Keyword,omitempty"`            // 关键词 string(200)
+	ContentDescription string `json:"ContentDescription,omitempty"` // 内容描述 string(256)
+	MainCharacter      string `json:"MainCharacter,omitempty"`      // 主要人物 string(256)
+	ShotPlace
+	SecurityLevel string `json:"SecurityLevel"` // 密级代码 SecretLevelType_*
+
+	VideoLen     int       `json:"VideoLen"`               // 视频长度 秒
+	BeginTime    *VIIDTime `json:"BeginTime"`              // 开始时间
+	EndTime      *VIIDTime `json:"EndTime"`                // 结束时间
+	TimeErr      int       `json:"TimeErr,omitempty"`      // 时间误差 秒
+	Width        int       `json:"Width,omitempty"`        // 宽度 像素
+	Height       int       `json:"Height,omitempty"`       // 高度 像素
+	QualityGrade string    `json:"QualityGrade,omitempty"` // 质量等级 QualityGradeType string(1)
+	Collector
+	VideoProcFlag int   `json:"VideoProcFlag,omitempty"` // 视频处理标志 0未处理 1已处理
+	FileSize      int64 `json:"FileSize,omitempty"`      // 文件大小 字节
+}
+
+// VideoSlice 视频片段对象,视频片段信息及其中识别出的目标,Data为base64编码的视频
+type VideoSlice struct {
+	VideoSliceInfo      *VideoSliceInfo            `json:"VideoSliceInfo"`
+	PersonList          *PersonListObject          `json:"PersonList,omitempty"`
+	FaceList            *FaceListObject            `json:"FaceList,omitempty"`
+	MotorVehicleList    *MotorVehicleListObject    `json:"MotorVehicleList,omitempty"`
+	NonMotorVehicleList *NonMotorVehicleListObject `json:"NonMotorVehicleList,omitempty"`
+	Data                string                     `json:"Data,omitempty"`
+}
+
+// VideoSliceListObject 视频片段对象列表
+type VideoSliceListObject struct {
+	VideoSlice []*VideoSlice `json:"VideoSlice"`
+}
+
+// VideoSliceListBody 视频片段批量接口的消息体 {"VideoSliceListObject":{"VideoSlice":[...]}}
+type VideoSliceListBody struct {
+	VideoSliceListObject *VideoSliceListObject `json:"VideoSliceListObject"`
+}